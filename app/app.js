@@ -1,4 +1,8 @@
 document.addEventListener('DOMContentLoaded', async () => {
+  await handleEmailLink();
+  await handleOIDCRedirect();
+  await loadOIDCProviders();
+
   const token = localStorage.getItem('token');
 
   if (token) {
@@ -26,11 +30,10 @@ async function createVideoDraft() {
   const description = document.getElementById('video-description').value;
 
   try {
-    const res = await fetch('/api/videos', {
+    const res = await authFetch('/api/videos', {
       method: 'POST',
       headers: {
         'Content-Type': 'application/json',
-        Authorization: `Bearer ${localStorage.getItem('token')}`,
       },
       body: JSON.stringify({ title, description }),
     });
@@ -61,24 +64,120 @@ async function login() {
       },
       body: JSON.stringify({ email, password }),
     });
-    const data = await res.json();
+    let data = await res.json();
     if (!res.ok) {
       throw new Error(`Failed to login: ${data.error}`);
     }
 
-    if (data.token) {
-      localStorage.setItem('token', data.token);
-      document.getElementById('auth-section').style.display = 'none';
-      document.getElementById('video-section').style.display = 'block';
-      await getVideos();
-    } else {
-      alert('Login failed. Please check your credentials.');
+    await finishLogin(data);
+  } catch (error) {
+    alert(`Error: ${error.message}`);
+  }
+}
+
+// finishLogin stores the session from a login response, asking for a second
+// factor first if the account needs one.
+async function finishLogin(data) {
+  if (data.mfa_required) {
+    data = await completeMFALogin(data.challenge_token);
+    if (!data) {
+      return;
+    }
+  }
+
+  if (data.token) {
+    localStorage.setItem('token', data.token);
+    localStorage.setItem('refreshToken', data.refresh_token);
+    document.getElementById('auth-section').style.display = 'none';
+    document.getElementById('video-section').style.display = 'block';
+    await getVideos();
+  } else {
+    alert('Login failed. Please check your credentials.');
+  }
+}
+
+// loadOIDCProviders adds a login button for each configured identity
+// provider.
+async function loadOIDCProviders() {
+  const container = document.getElementById('oidc-providers');
+  try {
+    const res = await fetch('/api/oidc/providers');
+    if (!res.ok) {
+      return;
+    }
+    const providers = await res.json();
+    for (const provider of providers) {
+      const button = document.createElement('button');
+      button.type = 'button';
+      button.textContent = `Log in with ${provider.display_name}`;
+      button.onclick = () => {
+        window.location.href = provider.login_url;
+      };
+      container.appendChild(button);
+    }
+  } catch (error) {
+    console.error('Failed to load identity providers', error);
+  }
+}
+
+// handleOIDCRedirect finishes a login through an identity provider, which
+// sends the browser back here with a one-time code or an error.
+async function handleOIDCRedirect() {
+  const params = new URLSearchParams(window.location.search);
+  const code = params.get('oidc_code');
+  const error = params.get('oidc_error');
+  if (!code && !error) {
+    return;
+  }
+  window.history.replaceState(null, '', window.location.pathname);
+
+  try {
+    if (error) {
+      throw new Error(error);
+    }
+    const res = await fetch('/api/oidc/exchange', {
+      method: 'POST',
+      headers: {
+        'Content-Type': 'application/json',
+      },
+      body: JSON.stringify({ code }),
+    });
+    const data = await res.json();
+    if (!res.ok) {
+      throw new Error(`Failed to login: ${data.error}`);
     }
+    await finishLogin(data);
   } catch (error) {
     alert(`Error: ${error.message}`);
   }
 }
 
+// completeMFALogin asks for a code from the user's authenticator app, or a
+// recovery code, and exchanges it with the challenge token for a session.
+async function completeMFALogin(challengeToken) {
+  const input = prompt('Enter the code from your authenticator app, or a recovery code');
+  if (!input) {
+    return null;
+  }
+  const code = input.trim();
+  const body = /^\d{6}$/.test(code)
+    ? { challenge_token: challengeToken, code }
+    : { challenge_token: challengeToken, recovery_code: code };
+
+  const res = await fetch('/api/login/2fa', {
+    method: 'POST',
+    headers: {
+      'Content-Type': 'application/json',
+    },
+    body: JSON.stringify(body),
+  });
+  const data = await res.json();
+  if (!res.ok) {
+    throw new Error(`Failed to login: ${data.error}`);
+  }
+  return data;
+}
+
 async function signup() {
   const email = document.getElementById('email').value;
   const password = document.getElementById('password').value;
@@ -96,18 +195,147 @@ async function signup() {
       throw new Error(`Failed to create user: ${data.error}`);
     }
     console.log('User created!');
+    alert('Account created. Check your email for a verification link.');
     await login();
   } catch (error) {
     alert(`Error: ${error.message}`);
   }
 }
 
-function logout() {
+// handleEmailLink completes the action behind a link from a verification or
+// password reset email, then strips the token from the address bar.
+async function handleEmailLink() {
+  const params = new URLSearchParams(window.location.search);
+  const verifyToken = params.get('verify_email');
+  const resetToken = params.get('reset_password');
+  if (!verifyToken && !resetToken) {
+    return;
+  }
+  window.history.replaceState(null, '', window.location.pathname);
+
+  try {
+    if (verifyToken) {
+      const res = await fetch('/api/verify_email', {
+        method: 'POST',
+        headers: {
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({ token: verifyToken }),
+      });
+      if (!res.ok) {
+        const data = await res.json();
+        throw new Error(`Failed to verify email: ${data.error}`);
+      }
+      alert('Email verified! You can now log in.');
+      return;
+    }
+
+    const password = prompt('Choose a new password');
+    if (!password) {
+      return;
+    }
+    const res = await fetch('/api/password_reset/confirm', {
+      method: 'POST',
+      headers: {
+        'Content-Type': 'application/json',
+      },
+      body: JSON.stringify({ token: resetToken, password }),
+    });
+    if (!res.ok) {
+      const data = await res.json();
+      throw new Error(`Failed to reset password: ${data.error}`);
+    }
+    localStorage.removeItem('token');
+    localStorage.removeItem('refreshToken');
+    alert('Password changed. Log in with your new password.');
+  } catch (error) {
+    alert(`Error: ${error.message}`);
+  }
+}
+
+async function forgotPassword() {
+  const email = document.getElementById('email').value;
+  if (!email) {
+    alert('Enter your email address first.');
+    return;
+  }
+
+  try {
+    const res = await fetch('/api/password_reset', {
+      method: 'POST',
+      headers: {
+        'Content-Type': 'application/json',
+      },
+      body: JSON.stringify({ email }),
+    });
+    if (!res.ok) {
+      const data = await res.json();
+      throw new Error(`Failed to request password reset: ${data.error}`);
+    }
+    alert('If that address has an account, a reset link is on its way.');
+  } catch (error) {
+    alert(`Error: ${error.message}`);
+  }
+}
+
+async function logout() {
+  const refreshToken = localStorage.getItem('refreshToken');
+  if (refreshToken) {
+    await fetch('/api/revoke', {
+      method: 'POST',
+      headers: {
+        Authorization: `Bearer ${refreshToken}`,
+      },
+    });
+  }
   localStorage.removeItem('token');
+  localStorage.removeItem('refreshToken');
   document.getElementById('auth-section').style.display = 'block';
   document.getElementById('video-section').style.display = 'none';
 }
 
+// authFetch sends the access token with the request. Access tokens are
+// short-lived, so on a 401 it exchanges the refresh token for a new pair and
+// retries once.
+async function authFetch(url, options = {}) {
+  const send = () =>
+    fetch(url, {
+      ...options,
+      headers: {
+        ...options.headers,
+        Authorization: `Bearer ${localStorage.getItem('token')}`,
+      },
+    });
+
+  const res = await send();
+  if (res.status !== 401 || !(await refreshAccessToken())) {
+    return res;
+  }
+  return send();
+}
+
+async function refreshAccessToken() {
+  const refreshToken = localStorage.getItem('refreshToken');
+  if (!refreshToken) {
+    return false;
+  }
+
+  const res = await fetch('/api/refresh', {
+    method: 'POST',
+    headers: {
+      Authorization: `Bearer ${refreshToken}`,
+    },
+  });
+  if (!res.ok) {
+    return false;
+  }
+
+  const data = await res.json();
+  localStorage.setItem('token', data.token);
+  localStorage.setItem('refreshToken', data.refresh_token);
+  return true;
+}
+
 function setUploadButtonState(uploading, selector) {
   const uploadBtn = document.getElementById(selector);
   if (uploading) {
@@ -130,11 +358,8 @@ async function uploadThumbnail(videoID) {
   setUploadButtonState(true, uploadBtnSelector);
 
   try {
-    const res = await fetch(`/api/thumbnail_upload/${videoID}`, {
+    const res = await authFetch(`/api/thumbnail_upload/${videoID}`, {
       method: 'POST',
-      headers: {
-        Authorization: `Bearer ${localStorage.getItem('token')}`,
-      },
       body: formData,
     });
     if (!res.ok) {
@@ -161,13 +386,11 @@ async function uploadVideoFile(videoID) {
 
   uploadBtnSelector = 'upload-video-btn';
   setUploadButtonState(true, uploadBtnSelector);
+  const progress = watchUploadProgress(videoID);
 
   try {
-    const res = await fetch(`/api/video_upload/${videoID}`, {
+    const res = await authFetch(`/api/video_upload/${videoID}`, {
       method: 'POST',
-      headers: {
-        Authorization: `Bearer ${localStorage.getItem('token')}`,
-      },
       body: formData,
     });
     if (!res.ok) {
@@ -181,18 +404,81 @@ async function uploadVideoFile(videoID) {
     alert(`Error: ${error.message}`);
   }
 
+  progress.abort();
+  document.getElementById('upload-progress').textContent = '';
   setUploadButtonState(false, uploadBtnSelector);
 }
 
+// watchUploadProgress shows what the server is doing with an upload as it
+// reports it. EventSource can't send the Authorization header, so the event
+// stream is read with fetch instead. Abort the returned controller once the
+// upload request finishes.
+function watchUploadProgress(videoID) {
+  const controller = new AbortController();
+  const status = document.getElementById('upload-progress');
+
+  const describe = (event) => {
+    const percent = event.percent ? ` ${Math.floor(event.percent)}%` : '';
+    switch (event.stage) {
+      case 'receiving':
+        return `Sending video... ${(event.done / (1 << 20)).toFixed(1)} MB`;
+      case 'processing':
+        return `Preparing video for streaming...${percent}`;
+      case 'uploading':
+        return `Storing video... part ${event.part} of ${event.parts}${percent}`;
+      case 'complete':
+        return 'Done';
+      case 'failed':
+        return `Failed: ${event.error}`;
+      default:
+        return '';
+    }
+  };
+
+  (async () => {
+    const res = await authFetch(`/api/videos/${videoID}/progress`, {
+      signal: controller.signal,
+    });
+    if (!res.ok) {
+      return;
+    }
+    const reader = res.body.pipeThrough(new TextDecoderStream()).getReader();
+    let buffer = '';
+    for (;;) {
+      const { value, done } = await reader.read();
+      if (done) {
+        return;
+      }
+      buffer += value;
+      const messages = buffer.split('\n\n');
+      buffer = messages.pop();
+      for (const message of messages) {
+        const data = message
+          .split('\n')
+          .find((line) => line.startsWith('data: '));
+        if (data) {
+          status.textContent = describe(JSON.parse(data.slice(6)));
+        }
+      }
+    }
+  })().catch((error) => {
+    if (error.name !== 'AbortError') {
+      console.error('Failed to follow upload progress', error);
+    }
+  });
+
+  return controller;
+}
+
 const videoStateHandler = createVideoStateHandler();
 
-async function getVideos() {
+// nextVideosURL is the next page of the video list, if there is one.
+let nextVideosURL = null;
+
+async function getVideos(url = '/api/videos') {
   try {
-    const res = await fetch('/api/videos', {
+    const res = await authFetch(url, {
       method: 'GET',
-      headers: {
-        Authorization: `Bearer ${localStorage.getItem('token')}`,
-      },
     });
     if (!res.ok) {
       const data = await res.json();
@@ -201,18 +487,62 @@ async function getVideos() {
 
     const videos = await res.json();
     const videoList = document.getElementById('video-list');
-    videoList.innerHTML = '';
+    if (url === '/api/videos') {
+      videoList.innerHTML = '';
+    }
     for (const video of videos) {
       const listItem = document.createElement('li');
       listItem.textContent = video.title;
       listItem.onclick = () => videoStateHandler(video.id);
       videoList.appendChild(listItem);
     }
+
+    const next = /<([^>]+)>;\s*rel="next"/.exec(res.headers.get('Link') || '');
+    nextVideosURL = next ? next[1] : null;
+    document.getElementById('load-more-videos').style.display = nextVideosURL ? 'block' : 'none';
   } catch (error) {
     alert(`Error: ${error.message}`);
   }
 }
 
+async function searchVideos() {
+  const q = document.getElementById('video-search').value.trim();
+  if (!q) {
+    await getVideos();
+    return;
+  }
+
+  try {
+    const res = await authFetch(`/api/videos/search?q=${encodeURIComponent(q)}`, {
+      method: 'GET',
+    });
+    const data = await res.json();
+    if (!res.ok) {
+      throw new Error(`Failed to search videos. Error: ${data.error}`);
+    }
+
+    const videoList = document.getElementById('video-list');
+    videoList.innerHTML = '';
+    for (const result of data) {
+      // title_html is escaped by the server, apart from the <mark> tags
+      const listItem = document.createElement('li');
+      listItem.innerHTML = result.title_html;
+      listItem.onclick = () => videoStateHandler(result.id);
+      videoList.appendChild(listItem);
+    }
+    nextVideosURL = null;
+    document.getElementById('load-more-videos').style.display = 'none';
+  } catch (error) {
+    alert(`Error: ${error.message}`);
+  }
+}
+
+async function loadMoreVideos() {
+  if (nextVideosURL) {
+    await getVideos(nextVideosURL);
+  }
+}
+
 function createVideoStateHandler() {
   let currentVideoID = null;
 
@@ -231,11 +561,8 @@ function createVideoStateHandler() {
 
 async function getVideo(videoID) {
   try {
-    const res = await fetch(`/api/videos/${videoID}`, {
+    const res = await authFetch(`/api/videos/${videoID}`, {
       method: 'GET',
-      headers: {
-        Authorization: `Bearer ${localStorage.getItem('token')}`,
-      },
     });
     if (!res.ok) {
       throw new Error('Failed to get video.');
@@ -255,6 +582,7 @@ function viewVideo(video) {
   document.getElementById('video-display').style.display = 'block';
   document.getElementById('video-title-display').textContent = video.title;
   document.getElementById('video-description-display').textContent = video.description;
+  document.getElementById('video-tags-display').textContent = (video.tags || []).map((tag) => `#${tag}`).join(' ');
 
   const thumbnailImg = document.getElementById('thumbnail-image');
   if (!video.thumbnail_url) {
@@ -283,11 +611,8 @@ async function deleteVideo() {
   }
 
   try {
-    const res = await fetch(`/api/videos/${currentVideo.id}`, {
+    const res = await authFetch(`/api/videos/${currentVideo.id}`, {
       method: 'DELETE',
-      headers: {
-        Authorization: `Bearer ${localStorage.getItem('token')}`,
-      },
     });
     if (!res.ok) {
       throw new Error('Failed to delete video.');
@@ -1,7 +1,18 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
 	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 )
 
 func (cfg apiConfig) ensureAssetsDir() error {
@@ -10,3 +21,75 @@ func (cfg apiConfig) ensureAssetsDir() error {
 	}
 	return nil
 }
+
+func (cfg apiConfig) assetsURLPrefix() string {
+	return fmt.Sprintf("http://localhost:%s/assets/", cfg.port)
+}
+
+// saveAsset writes src to a new, randomly named file in the assets
+// directory and returns the URL it is served from and its size.
+func (cfg apiConfig) saveAsset(src io.Reader, fileExtension string) (string, int64, error) {
+	randBytes := make([]byte, 32)
+	rand.Read(randBytes)
+	fileName := fmt.Sprintf("%s.%s", base64.RawURLEncoding.EncodeToString(randBytes), fileExtension)
+
+	path := filepath.Join(cfg.assetsRoot, fileName)
+	dst, err := os.Create(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer dst.Close()
+
+	size, err := io.Copy(dst, src)
+	if err != nil {
+		os.Remove(path)
+		return "", 0, err
+	}
+	return cfg.assetsURLPrefix() + fileName, size, nil
+}
+
+// removeAsset deletes the file behind a URL returned by saveAsset. URLs that
+// don't point into the assets directory are ignored.
+func (cfg apiConfig) removeAsset(url string) error {
+	fileName, ok := strings.CutPrefix(url, cfg.assetsURLPrefix())
+	if !ok || fileName == "" || strings.ContainsAny(fileName, `/\`) {
+		return nil
+	}
+	err := os.Remove(filepath.Join(cfg.assetsRoot, fileName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// removeVideoObject deletes the S3 object behind a video URL. URLs that
+// don't point at the CloudFront distribution are ignored.
+func (cfg apiConfig) removeVideoObject(ctx context.Context, url string) error {
+	key, ok := strings.CutPrefix(url, cfg.s3CfDistribution+"/")
+	if !ok || key == "" {
+		return nil
+	}
+	_, err := cfg.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: &cfg.s3Bucket,
+		Key:    &key,
+	})
+	return err
+}
+
+// removeVideoFiles deletes the video file and thumbnail stored for a video
+// that has been deleted. Failures are only logged, since the video is gone
+// either way.
+func (cfg apiConfig) removeVideoFiles(ctx context.Context, video database.Video) {
+	if video.VideoURL != nil {
+		err := cfg.removeVideoObject(ctx, *video.VideoURL)
+		if err != nil {
+			log.Printf("Couldn't remove video object %s: %v", *video.VideoURL, err)
+		}
+	}
+	if video.ThumbnailURL != nil {
+		err := cfg.removeAsset(*video.ThumbnailURL)
+		if err != nil {
+			log.Printf("Couldn't remove asset %s: %v", *video.ThumbnailURL, err)
+		}
+	}
+}
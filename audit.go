@@ -0,0 +1,28 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// auditEvent logs a security-relevant event, such as a failed login, as a
+// single JSON line prefixed with "audit:" so it can be picked out of the
+// server log.
+func auditEvent(r *http.Request, event string, fields map[string]any) {
+	entry := map[string]any{
+		"event":      event,
+		"ip_address": clientIP(r),
+		"user_agent": r.UserAgent(),
+	}
+	for k, v := range fields {
+		entry[k] = v
+	}
+
+	dat, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Couldn't marshal audit event %s: %v", event, err)
+		return
+	}
+	log.Printf("audit: %s", dat)
+}
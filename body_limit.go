@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+)
+
+const (
+	// defaultMaxBodySize applies to every request unless its route raises
+	// it. It is plenty for the JSON endpoints.
+	defaultMaxBodySize int64 = 1 << 20
+	// maxImageUploadSize limits thumbnail and avatar uploads.
+	maxImageUploadSize int64 = 10 << 20
+	// defaultMaxUploadSize limits video uploads for users without their
+	// own limit, unless MAX_UPLOAD_SIZE says otherwise.
+	defaultMaxUploadSize int64 = 1 << 30
+)
+
+type rawBodyContextKey struct{}
+
+// limitBodyMiddleware caps every request body at defaultMaxBodySize. Reading
+// past the limit fails with an *http.MaxBytesError, which respondWithError
+// turns into a 413.
+func limitBodyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = r.WithContext(context.WithValue(r.Context(), rawBodyContextKey{}, r.Body))
+		r.Body = http.MaxBytesReader(w, r.Body, defaultMaxBodySize)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withBodyLimit raises or lowers the body size limit for one route.
+func withBodyLimit(limit int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		setBodyLimit(w, r, limit)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// setBodyLimit replaces the limit limitBodyMiddleware put on the request
+// body. It must be called before any of the body is read.
+func setBodyLimit(w http.ResponseWriter, r *http.Request, limit int64) {
+	raw, ok := r.Context().Value(rawBodyContextKey{}).(io.ReadCloser)
+	if !ok {
+		raw = r.Body
+	}
+	r.Body = http.MaxBytesReader(w, raw, limit)
+}
+
+// bodyTooLarge reports whether err came from reading past a body limit,
+// returning the limit.
+func bodyTooLarge(err error) (int64, bool) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return maxBytesErr.Limit, true
+	}
+	return 0, false
+}
+
+// formFile streams a multipart request body up to the file in field,
+// without buffering the parts before it in memory or on disk. The caller
+// must read the part before touching the rest of the body.
+func formFile(r *http.Request, field string) (*multipart.Part, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("form has no %q file", field)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == field && part.FileName() != "" {
+			return part, nil
+		}
+		part.Close()
+	}
+}
+
+// formatBytes renders a size limit for an error message, such as "10 MB".
+func formatBytes(n int64) string {
+	const unit = 1 << 10
+	if n < unit {
+		return fmt.Sprintf("%d bytes", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	value := float64(n) / float64(div)
+	if value == float64(int64(value)) {
+		return fmt.Sprintf("%d %cB", int64(value), "KMGT"[exp])
+	}
+	return fmt.Sprintf("%.1f %cB", value, "KMGT"[exp])
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestBodyLimits(t *testing.T) {
+	api := newTestAPI(t)
+	_, token := api.createUser("uploader@example.com", auth.RoleUploader)
+	video := api.createVideo(token, map[string]any{"title": "Boots"})
+	api.cfg.maxUploadSize = 1 << 10
+
+	bigTitle := `{"title": "` + strings.Repeat("a", int(defaultMaxBodySize)) + `"}`
+	bigImage, imageType := multipartFile(t, "thumbnail", "image/png", make([]byte, maxImageUploadSize+1))
+	smallImage, smallImageType := multipartFile(t, "thumbnail", "image/png", make([]byte, 1<<20))
+	bigVideo, videoType := multipartFile(t, "video", "video/mp4", make([]byte, 2<<10))
+
+	tests := []struct {
+		name        string
+		path        string
+		body        string
+		contentType string
+		status      int
+	}{
+		{"JSON over 1 MB", "/api/videos", bigTitle, "application/json", http.StatusRequestEntityTooLarge},
+		{"thumbnail over 10 MB", "/api/thumbnail_upload/" + video.ID.String(), bigImage, imageType, http.StatusRequestEntityTooLarge},
+		{"thumbnail over 1 MB", "/api/thumbnail_upload/" + video.ID.String(), smallImage, smallImageType, http.StatusOK},
+		{"video over upload limit", "/api/video_upload/" + video.ID.String(), bigVideo, videoType, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := api.do("POST", tt.path, token, tt.body, "Content-Type", tt.contentType)
+			requireStatus(t, rec, tt.status)
+		})
+	}
+}
+
+func TestBodyLimitUserUploadLimit(t *testing.T) {
+	api := newTestAPI(t)
+	_, admin := api.createUser("admin@example.com", auth.RoleAdmin)
+	user, token := api.createUser("uploader@example.com", auth.RoleUploader)
+	video := api.createVideo(token, map[string]any{"title": "Boots"})
+
+	rec := api.do("PUT", "/admin/users/"+user.ID.String()+"/upload_limit", admin, map[string]any{"max_upload_size": 1 << 10})
+	requireStatus(t, rec, http.StatusOK)
+
+	body, contentType := multipartFile(t, "video", "video/mp4", make([]byte, 2<<10))
+	rec = api.do("POST", "/api/video_upload/"+video.ID.String(), token, body, "Content-Type", contentType)
+	requireStatus(t, rec, http.StatusRequestEntityTooLarge)
+}
+
+// A body without a Content-Length can't be turned away up front, so the
+// limit has to stop it while it streams in.
+func TestBodyLimitStreamedVideo(t *testing.T) {
+	api := newTestAPI(t)
+	_, token := api.createUser("uploader@example.com", auth.RoleUploader)
+	video := api.createVideo(token, map[string]any{"title": "Boots"})
+	api.cfg.maxUploadSize = 1 << 10
+
+	body, contentType := multipartFile(t, "video", "video/mp4", make([]byte, 2<<10))
+	req := httptest.NewRequest("POST", "/api/video_upload/"+video.ID.String(), io.NopCloser(bytes.NewBufferString(body)))
+	req.ContentLength = -1
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	api.handler.ServeHTTP(rec, req)
+	requireStatus(t, rec, http.StatusRequestEntityTooLarge)
+
+	stored, err := api.db.GetVideo(video.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != database.VideoStatusFailed {
+		t.Errorf("Status = %q, want %q", stored.Status, database.VideoStatusFailed)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{512, "512 bytes"},
+		{1 << 10, "1 KB"},
+		{1536, "1.5 KB"},
+		{10 << 20, "10 MB"},
+		{1 << 30, "1 GB"},
+	}
+	for _, tt := range tests {
+		if got := formatBytes(tt.n); got != tt.want {
+			t.Errorf("formatBytes(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
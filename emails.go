@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/mailer"
+)
+
+const (
+	emailVerificationTTL = 48 * time.Hour
+	passwordResetTTL     = time.Hour
+	sendEmailTimeout     = 10 * time.Second
+)
+
+// issueUserToken creates a single-use token for purpose and returns the
+// plaintext to send to the user. Only its hash is stored.
+func (cfg *apiConfig) issueUserToken(user database.User, purpose string, ttl time.Duration) (string, error) {
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	err = cfg.db.CreateUserToken(database.CreateUserTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		Purpose:   purpose,
+		ExpiresAt: time.Now().UTC().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// appLink returns a link into the web app carrying token in the query
+// parameter param.
+func (cfg *apiConfig) appLink(param, token string) string {
+	return fmt.Sprintf("%s/app/?%s=%s", cfg.appURL, param, url.QueryEscape(token))
+}
+
+func (cfg *apiConfig) sendVerificationEmail(ctx context.Context, user database.User) error {
+	token, err := cfg.issueUserToken(user, database.TokenPurposeVerifyEmail, emailVerificationTTL)
+	if err != nil {
+		return fmt.Errorf("couldn't create verification token: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sendEmailTimeout)
+	defer cancel()
+	return cfg.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your Tubely email address",
+		Body: fmt.Sprintf(
+			"Welcome to Tubely!\n\nConfirm your email address by opening this link:\n\n%s\n\nThe link expires in 48 hours.\n",
+			cfg.appLink("verify_email", token),
+		),
+	})
+}
+
+func (cfg *apiConfig) sendPasswordResetEmail(ctx context.Context, user database.User) error {
+	token, err := cfg.issueUserToken(user, database.TokenPurposeResetPassword, passwordResetTTL)
+	if err != nil {
+		return fmt.Errorf("couldn't create password reset token: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sendEmailTimeout)
+	defer cancel()
+	return cfg.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Tubely password",
+		Body: fmt.Sprintf(
+			"Someone asked to reset the password for your Tubely account.\n\nChoose a new password here:\n\n%s\n\nThe link expires in an hour. If you didn't ask for this, you can ignore this email.\n",
+			cfg.appLink("reset_password", token),
+		),
+	})
+}
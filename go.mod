@@ -14,11 +14,13 @@ require (
 	github.com/mattn/go-sqlite3 v1.14.24
 	github.com/aws/aws-sdk-go-v2/service/s3 v1.95.0
 	github.com/aws/aws-sdk-go-v2/config v1.32.6
+	github.com/aws/aws-sdk-go-v2 v1.41.0
+	github.com/coreos/go-oidc/v3 v3.9.0
+	golang.org/x/oauth2 v0.30.0
 )
 
 require (
-	golang.org/x/crypto v0.14.0 // indirect
-	github.com/aws/aws-sdk-go-v2 v1.41.0 // indirect
+	golang.org/x/crypto v0.41.0 // indirect
 	github.com/aws/aws-sdk-go-v2/aws/protocol/eventstream v1.7.4 // indirect
 	github.com/aws/aws-sdk-go-v2/credentials v1.19.6 // indirect
 	github.com/aws/aws-sdk-go-v2/feature/ec2/imds v1.18.16 // indirect
@@ -35,5 +37,6 @@ require (
 	github.com/aws/aws-sdk-go-v2/service/ssooidc v1.35.12 // indirect
 	github.com/aws/aws-sdk-go-v2/service/sts v1.41.5 // indirect
 	github.com/aws/smithy-go v1.24.0 // indirect
-	golang.org/x/sys v0.13.0 // indirect
+	golang.org/x/sys v0.35.0 // indirect
+	github.com/go-jose/go-jose/v3 v3.0.4 // indirect
 )
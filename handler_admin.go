@@ -0,0 +1,395 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// adminUser is how a user is shown to administrators. It leaves out
+// credentials.
+type adminUser struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	Email      string     `json:"email"`
+	Role       string     `json:"role"`
+	DisabledAt *time.Time `json:"disabled_at"`
+	// MaxUploadSize is the user's own video upload limit, if they have one.
+	MaxUploadSize *int64 `json:"max_upload_size"`
+	// Quota is the user's own overrides of the default quota.
+	Quota database.Quota `json:"quota"`
+}
+
+func newAdminUser(user database.User) adminUser {
+	return adminUser{
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		Role:          user.Role,
+		DisabledAt:    user.DisabledAt,
+		MaxUploadSize: user.MaxUploadSize,
+		Quota:         user.Quota,
+	}
+}
+
+// promoteAdmins gives the admin role to existing users listed in
+// ADMIN_EMAILS. Users who sign up later with one of those emails are made
+// admins by handlerUsersCreate.
+func (cfg *apiConfig) promoteAdmins() error {
+	for email := range cfg.adminEmails {
+		user, err := cfg.db.GetUserByEmail(email)
+		if errors.Is(err, database.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if user.Role == string(auth.RoleAdmin) {
+			continue
+		}
+		err = cfg.db.SetUserRole(user.ID, string(auth.RoleAdmin))
+		if err != nil {
+			return err
+		}
+		log.Printf("Promoted %s to admin", email)
+	}
+	return nil
+}
+
+func (cfg *apiConfig) handlerAdminUsersList(w http.ResponseWriter, r *http.Request) {
+	users, err := cfg.db.GetUsers()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve users", err)
+		return
+	}
+
+	resp := make([]adminUser, 0, len(users))
+	for _, user := range users {
+		resp = append(resp, newAdminUser(user))
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+func (cfg *apiConfig) handlerAdminUserSetRole(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Role string `json:"role"`
+	}
+
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if !auth.ValidRole(params.Role) {
+		respondWithError(w, http.StatusBadRequest, "Unknown role", nil)
+		return
+	}
+	if userID == requestPrincipal(r).UserID && params.Role != string(auth.RoleAdmin) {
+		respondWithError(w, http.StatusBadRequest, "You can't remove your own admin role", nil)
+		return
+	}
+
+	err = cfg.db.SetUserRole(userID, params.Role)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't set role", err)
+		return
+	}
+
+	user, err := cfg.db.GetUser(userID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get user", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, newAdminUser(*user))
+}
+
+func (cfg *apiConfig) handlerAdminUserDisable(w http.ResponseWriter, r *http.Request) {
+	cfg.setUserDisabled(w, r, true)
+}
+
+func (cfg *apiConfig) handlerAdminUserEnable(w http.ResponseWriter, r *http.Request) {
+	cfg.setUserDisabled(w, r, false)
+}
+
+func (cfg *apiConfig) setUserDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+	if disabled && userID == requestPrincipal(r).UserID {
+		respondWithError(w, http.StatusBadRequest, "You can't disable your own account", nil)
+		return
+	}
+
+	err = cfg.db.SetUserDisabled(userID, disabled)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't update account", err)
+		return
+	}
+
+	user, err := cfg.db.GetUser(userID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get user", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, newAdminUser(*user))
+}
+
+// handlerAdminUserSetUploadLimit gives the user their own video upload size
+// limit, or puts them back on the server default when max_upload_size is
+// null.
+func (cfg *apiConfig) handlerAdminUserSetUploadLimit(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		MaxUploadSize *int64 `json:"max_upload_size"`
+	}
+
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.MaxUploadSize != nil && *params.MaxUploadSize <= 0 {
+		respondWithError(w, http.StatusBadRequest, "Upload limit must be positive", nil)
+		return
+	}
+
+	err = cfg.db.SetUserMaxUploadSize(userID, params.MaxUploadSize)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't set upload limit", err)
+		return
+	}
+
+	user, err := cfg.db.GetUser(userID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get user", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, newAdminUser(*user))
+}
+
+// handlerAdminUserSetQuota replaces the user's quota overrides. A null
+// limit puts them back on the server default and -1 makes it unlimited.
+func (cfg *apiConfig) handlerAdminUserSetQuota(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := database.Quota{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if !validQuota(params) {
+		respondWithError(w, http.StatusBadRequest, quotaProblem, nil)
+		return
+	}
+
+	err = cfg.db.SetUserQuota(userID, params)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't set quota", err)
+		return
+	}
+
+	user, err := cfg.db.GetUser(userID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get user", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, newAdminUser(*user))
+}
+
+// handlerAdminOrganizationSetQuota replaces the organization's quota
+// overrides, as handlerAdminUserSetQuota does for users.
+func (cfg *apiConfig) handlerAdminOrganizationSetQuota(w http.ResponseWriter, r *http.Request) {
+	orgID, err := uuid.Parse(r.PathValue("orgID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid organization ID", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := database.Quota{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if !validQuota(params) {
+		respondWithError(w, http.StatusBadRequest, quotaProblem, nil)
+		return
+	}
+
+	err = cfg.db.SetOrganizationQuota(orgID, params)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't set quota", err)
+		return
+	}
+
+	org, err := cfg.db.GetOrganization(orgID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get organization", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, org)
+}
+
+// handlerAdminOrganizationSetKeyPrefix sets where in the bucket the
+// organization's new video files go. A null key_prefix puts it back on the
+// default. Files already uploaded stay where they are.
+func (cfg *apiConfig) handlerAdminOrganizationSetKeyPrefix(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		KeyPrefix *string `json:"key_prefix"`
+	}
+
+	orgID, err := uuid.Parse(r.PathValue("orgID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid organization ID", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.KeyPrefix != nil && !validKeyPrefix(*params.KeyPrefix) {
+		respondWithError(w, http.StatusBadRequest, "Key prefix must be slash-separated letters, digits, '-', '_' and '.'", nil)
+		return
+	}
+
+	err = cfg.db.SetOrganizationKeyPrefix(orgID, params.KeyPrefix)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't set key prefix", err)
+		return
+	}
+
+	org, err := cfg.db.GetOrganization(orgID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get organization", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, org)
+}
+
+// handlerAdminVideoTransfer hands a video to another user. An
+// organization's video stays in the organization, so it can only go to one
+// of its members.
+func (cfg *apiConfig) handlerAdminVideoTransfer(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		UserID uuid.UUID `json:"user_id"`
+	}
+
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	_, err = cfg.db.GetUser(params.UserID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusBadRequest, "New owner doesn't exist", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get new owner", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get video", err)
+		return
+	}
+	if video.OrganizationID != nil {
+		_, err = cfg.db.GetOrganizationMember(*video.OrganizationID, params.UserID)
+		if errors.Is(err, database.ErrNotFound) {
+			respondWithError(w, http.StatusConflict, "New owner isn't a member of the video's organization", err)
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't check membership", err)
+			return
+		}
+	}
+
+	err = cfg.db.SetVideoOwner(videoID, params.UserID, video.OrganizationID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't transfer video", err)
+		return
+	}
+	// the new owner no longer needs the role they may have had on it
+	err = cfg.db.DeleteVideoPermission(videoID, params.UserID)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		log.Printf("Couldn't remove new owner's role on video %s: %v", videoID, err)
+	}
+
+	video, err = cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get video", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, video)
+}
+
+func (cfg *apiConfig) handlerAdminVideoDelete(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get video", err)
+		return
+	}
+
+	err = cfg.db.DeleteVideo(videoID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't delete video", err)
+		return
+	}
+	cfg.removeVideoFiles(r.Context(), video)
+
+	log.Printf("Admin %s deleted video %s", requestPrincipal(r).UserID, videoID)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestAdminRoutesRequireAdmin(t *testing.T) {
+	api := newTestAPI(t)
+	_, admin := api.createUser("admin@example.com", auth.RoleAdmin)
+	_, uploader := api.createUser("uploader@example.com", auth.RoleUploader)
+	_, viewer := api.createUser("viewer@example.com", auth.RoleViewer)
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"anonymous", "", http.StatusUnauthorized},
+		{"viewer", viewer, http.StatusForbidden},
+		{"uploader", uploader, http.StatusForbidden},
+		{"admin", admin, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requireStatus(t, api.do("GET", "/admin/users", tt.token, nil), tt.status)
+		})
+	}
+}
+
+func TestHandlerAdminUserSetRole(t *testing.T) {
+	api := newTestAPI(t)
+	adminUser, admin := api.createUser("admin@example.com", auth.RoleAdmin)
+	user, token := api.createUser("user@example.com", auth.RoleUploader)
+	path := "/admin/users/" + user.ID.String() + "/role"
+
+	tests := []struct {
+		name   string
+		path   string
+		role   string
+		status int
+	}{
+		{"invalid user ID", "/admin/users/not-a-uuid/role", "viewer", http.StatusBadRequest},
+		{"unknown role", path, "superuser", http.StatusBadRequest},
+		{"own admin role", "/admin/users/" + adminUser.ID.String() + "/role", "viewer", http.StatusBadRequest},
+		{"demoted", path, "viewer", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := api.do("PUT", tt.path, admin, map[string]any{"role": tt.role})
+			requireStatus(t, rec, tt.status)
+		})
+	}
+
+	// the new role applies to tokens issued before the change
+	requireStatus(t, api.do("POST", "/api/videos", token, map[string]any{"title": "Boots"}), http.StatusForbidden)
+	requireStatus(t, api.do("GET", "/api/videos", token, nil), http.StatusOK)
+}
+
+func TestHandlerAdminUserDisable(t *testing.T) {
+	api := newTestAPI(t)
+	adminUser, admin := api.createUser("admin@example.com", auth.RoleAdmin)
+	user, _ := api.createUser("user@example.com", auth.RoleUploader)
+	access, refresh := api.login(user.Email)
+	userPath := "/admin/users/" + user.ID.String()
+
+	requireStatus(t, api.do("POST", "/admin/users/"+adminUser.ID.String()+"/disable", admin, nil), http.StatusBadRequest)
+	requireStatus(t, api.do("POST", userPath+"/disable", admin, nil), http.StatusOK)
+
+	requireStatus(t, api.do("GET", "/api/videos", access, nil), http.StatusForbidden)
+	requireStatus(t, api.do("POST", "/api/refresh", refresh, nil), http.StatusForbidden)
+	rec := api.do("POST", "/api/login", "", map[string]any{"email": user.Email, "password": testPassword})
+	if rec.Code == http.StatusOK {
+		t.Fatal("disabled user could log in")
+	}
+
+	requireStatus(t, api.do("POST", userPath+"/enable", admin, nil), http.StatusOK)
+	api.login(user.Email)
+}
+
+func TestHandlerAdminVideoTransfer(t *testing.T) {
+	api := newTestAPI(t)
+	_, admin := api.createUser("admin@example.com", auth.RoleAdmin)
+	_, owner := api.createUser("owner@example.com", auth.RoleUploader)
+	newOwner, newOwnerToken := api.createUser("new@example.com", auth.RoleUploader)
+	video := api.createVideo(owner, map[string]any{"title": "Boots", "description": "A bear"})
+	path := "/admin/videos/" + video.ID.String() + "/transfer"
+
+	tests := []struct {
+		name   string
+		path   string
+		userID string
+		status int
+	}{
+		{"invalid video ID", "/admin/videos/not-a-uuid/transfer", newOwner.ID.String(), http.StatusBadRequest},
+		{"unknown new owner", path, uuid.NewString(), http.StatusBadRequest},
+		{"unknown video", "/admin/videos/" + uuid.NewString() + "/transfer", newOwner.ID.String(), http.StatusNotFound},
+		{"transferred", path, newOwner.ID.String(), http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := api.do("POST", tt.path, admin, map[string]any{"user_id": tt.userID})
+			requireStatus(t, rec, tt.status)
+		})
+	}
+
+	// the transfer only changes the owner
+	rec := api.do("GET", "/api/videos/"+video.ID.String(), newOwnerToken, nil)
+	requireStatus(t, rec, http.StatusOK)
+	got := decodeJSON[database.Video](t, rec)
+	if got.UserID != newOwner.ID || got.Title != video.Title || got.Description != video.Description {
+		t.Errorf("transferred video = %+v", got)
+	}
+	requireStatus(t, api.do("DELETE", "/api/videos/"+video.ID.String(), owner, nil), http.StatusForbidden)
+}
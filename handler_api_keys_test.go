@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestHandlerAPIKeysCreate(t *testing.T) {
+	api := newTestAPI(t)
+	_, token := api.createUser("uploader@example.com", auth.RoleUploader)
+
+	tests := []struct {
+		name   string
+		token  string
+		body   map[string]any
+		status int
+	}{
+		{"anonymous", "", map[string]any{"name": "ci", "scopes": []string{auth.ScopeVideosRead}}, http.StatusUnauthorized},
+		{"missing name", token, map[string]any{"scopes": []string{auth.ScopeVideosRead}}, http.StatusBadRequest},
+		{"no scopes", token, map[string]any{"name": "ci"}, http.StatusBadRequest},
+		{"unknown scope", token, map[string]any{"name": "ci", "scopes": []string{"admin"}}, http.StatusBadRequest},
+		{"created", token, map[string]any{"name": "ci", "scopes": []string{auth.ScopeVideosRead}}, http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requireStatus(t, api.do("POST", "/api/api_keys", tt.token, tt.body), tt.status)
+		})
+	}
+}
+
+func TestHandlerAPIKeysCreateStoresOnlyHash(t *testing.T) {
+	api := newTestAPI(t)
+	_, token := api.createUser("uploader@example.com", auth.RoleUploader)
+
+	rec := api.do("POST", "/api/api_keys", token, map[string]any{"name": "ci", "scopes": []string{auth.ScopeUpload}})
+	requireStatus(t, rec, http.StatusCreated)
+	created := decodeJSON[struct {
+		database.APIKey
+		Key string `json:"key"`
+	}](t, rec)
+
+	stored, err := api.db.GetAPIKeyByHash(auth.HashToken(created.Key))
+	if err != nil {
+		t.Fatalf("key isn't stored by its hash: %v", err)
+	}
+	if stored.KeyHash == created.Key || stored.Prefix != created.Key[:len(stored.Prefix)] {
+		t.Errorf("stored key = %+v", stored)
+	}
+
+	// listing shows the prefix but never the key or its hash
+	rec = api.do("GET", "/api/api_keys", token, nil)
+	requireStatus(t, rec, http.StatusOK)
+	body := rec.Body.String()
+	if strings.Contains(body, created.Key) || strings.Contains(body, stored.KeyHash) {
+		t.Errorf("key list leaks the key: %s", body)
+	}
+}
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	api := newTestAPI(t)
+	_, token := api.createUser("uploader@example.com", auth.RoleUploader)
+
+	rec := api.do("POST", "/api/api_keys", token, map[string]any{"name": "ci", "scopes": []string{auth.ScopeVideosRead}})
+	requireStatus(t, rec, http.StatusCreated)
+	created := decodeJSON[struct {
+		ID  string `json:"id"`
+		Key string `json:"key"`
+	}](t, rec)
+
+	apiKey := func(method, path string, body any) int {
+		return api.do(method, path, "", body, "Authorization", "ApiKey "+created.Key).Code
+	}
+
+	if got := apiKey("GET", "/api/videos", nil); got != http.StatusOK {
+		t.Errorf("read with videos:read key = %d, want %d", got, http.StatusOK)
+	}
+	if got := apiKey("POST", "/api/videos", map[string]any{"title": "Boots"}); got != http.StatusForbidden {
+		t.Errorf("write with videos:read key = %d, want %d", got, http.StatusForbidden)
+	}
+	if got := apiKey("GET", "/api/api_keys", nil); got != http.StatusForbidden {
+		t.Errorf("login-only route with key = %d, want %d", got, http.StatusForbidden)
+	}
+
+	requireStatus(t, api.do("DELETE", "/api/api_keys/"+created.ID, token, nil), http.StatusNoContent)
+	if got := apiKey("GET", "/api/videos", nil); got != http.StatusUnauthorized {
+		t.Errorf("read with revoked key = %d, want %d", got, http.StatusUnauthorized)
+	}
+	if got := api.do("GET", "/api/videos", "", nil, "Authorization", "ApiKey tubely_unknown").Code; got != http.StatusUnauthorized {
+		t.Errorf("read with unknown key = %d, want %d", got, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+)
+
+// writeEd25519Key writes a new PEM encoded Ed25519 private key to a
+// temporary file and returns its path.
+func writeEd25519Key(t *testing.T) string {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "key.pem")
+	err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestHandlerJWKS(t *testing.T) {
+	api := newTestAPI(t)
+	keys, err := loadJWTKeys("test-secret", "current:"+writeEd25519Key(t), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.cfg.jwtKeys = keys
+
+	rec := api.do("GET", "/.well-known/jwks.json", "", nil)
+	requireStatus(t, rec, http.StatusOK)
+	if rec.Header().Get("Cache-Control") == "" {
+		t.Error("missing Cache-Control")
+	}
+	set := decodeJSON[auth.JWKS](t, rec)
+	if len(set.Keys) != 1 || set.Keys[0].KeyID != "current" || set.Keys[0].Algorithm != "EdDSA" {
+		t.Errorf("JWKS = %+v, want only the Ed25519 key", set.Keys)
+	}
+
+	// tokens from a login are signed with the published key
+	user, _ := api.createUser("user@example.com", auth.RoleUploader)
+	accessToken, _ := api.login(user.Email)
+	requireStatus(t, api.do("GET", "/api/videos", accessToken, nil), http.StatusOK)
+	if _, err := auth.ValidateJWT(accessToken, auth.NewHMACKeySet("test-secret")); err == nil {
+		t.Error("login token was signed with the HS256 secret, not the active key")
+	}
+}
+
+func TestLoadJWTKeys(t *testing.T) {
+	first, second := writeEd25519Key(t), writeEd25519Key(t)
+
+	tests := []struct {
+		name        string
+		secret      string
+		signingKeys string
+		activeKey   string
+		wantErr     bool
+	}{
+		{"nothing configured", "", "", "", true},
+		{"secret only", "secret", "", "", false},
+		{"signing keys", "", "first:" + first + ", second:" + second, "second", false},
+		{"entry without a kid", "", first, "", true},
+		{"missing file", "", "first:" + filepath.Join(t.TempDir(), "missing.pem"), "", true},
+		{"unknown active key", "secret", "first:" + first, "second", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadJWTKeys(tt.secret, tt.signingKeys, tt.activeKey)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("loadJWTKeys error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
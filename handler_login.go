@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"time"
 
@@ -14,11 +15,6 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		Password string `json:"password"`
 		Email    string `json:"email"`
 	}
-	type response struct {
-		database.User
-		Token        string `json:"token"`
-		RefreshToken string `json:"refresh_token"`
-	}
 
 	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
@@ -28,48 +24,88 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// checked before the password, since hashing it is the expensive part
+	if !allowAttempt(w, r, cfg.loginIPLimiter, loginIPKey(r)) ||
+		!allowAttempt(w, r, cfg.loginUserLimiter, loginAccountKey(params.Email)) {
+		return
+	}
+
 	user, err := cfg.db.GetUserByEmail(params.Email)
+	if errors.Is(err, database.ErrNotFound) {
+		cfg.recordLoginFailure(r, params.Email, "unknown_email")
+		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password", nil)
+		return
+	}
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
 		return
 	}
 
 	match, err := auth.CheckPasswordHash(params.Password, user.Password)
-	if err != nil {
+	if err != nil || !match {
+		cfg.recordLoginFailure(r, params.Email, "wrong_password")
 		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password", err)
 		return
 	}
-	if !match {
-		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password", nil)
+	if user.DisabledAt != nil {
+		respondWithError(w, http.StatusForbidden, "Account has been disabled", nil)
+		return
+	}
+	if cfg.requireVerified && user.EmailVerifiedAt == nil {
+		respondWithError(w, http.StatusForbidden, "Email address has not been verified", nil)
 		return
 	}
 
-	accessToken, err := auth.MakeJWT(
-		user.ID,
-		cfg.jwtSecret,
-		time.Hour*24*30,
-	)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't create access JWT", err)
+	if user.TOTPEnabledAt != nil {
+		// failures stay counted against the account until the second
+		// factor is passed too
+		cfg.respondWithMFAChallenge(w, user)
 		return
 	}
 
+	cfg.recordLoginSuccess(r, user.Email)
+	cfg.startSession(w, r, user)
+}
+
+// startSession logs the user in, responding with a new access token and
+// refresh token.
+func (cfg *apiConfig) startSession(w http.ResponseWriter, r *http.Request, user database.User) {
+	type response struct {
+		database.User
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+
 	refreshToken, err := auth.MakeRefreshToken()
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't create refresh token", err)
 		return
 	}
 
-	_, err = cfg.db.CreateRefreshToken(database.CreateRefreshTokenParams{
+	session, err := cfg.db.CreateRefreshToken(database.CreateRefreshTokenParams{
 		UserID:    user.ID,
 		Token:     refreshToken,
-		ExpiresAt: time.Now().UTC().Add(time.Hour * 24 * 60),
+		ExpiresAt: time.Now().UTC().Add(cfg.refreshTokenTTL),
+		UserAgent: r.UserAgent(),
+		IPAddress: clientIP(r),
 	})
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't save refresh token", err)
 		return
 	}
 
+	accessToken, err := auth.MakeSessionJWT(
+		user.ID,
+		session.FamilyID,
+		user.TokenVersion,
+		cfg.jwtKeys,
+		cfg.accessTokenTTL,
+	)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create access JWT", err)
+		return
+	}
+
 	respondWithJSON(w, http.StatusOK, response{
 		User:         user,
 		Token:        accessToken,
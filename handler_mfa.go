@@ -0,0 +1,340 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const (
+	mfaChallengeTTL = 5 * time.Minute
+	totpIssuer      = "Tubely"
+)
+
+// respondWithMFAChallenge answers a correct password for an account with
+// two-factor authentication turned on. The challenge token has to be sent
+// back to handlerLoginMFA along with a code.
+func (cfg *apiConfig) respondWithMFAChallenge(w http.ResponseWriter, user database.User) {
+	type response struct {
+		MFARequired    bool   `json:"mfa_required"`
+		ChallengeToken string `json:"challenge_token"`
+	}
+
+	challenge, err := auth.MakeMFAChallengeJWT(user.ID, user.TokenVersion, cfg.jwtKeys, mfaChallengeTTL)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create challenge token", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		MFARequired:    true,
+		ChallengeToken: challenge,
+	})
+}
+
+// handlerLoginMFA completes a login started by handlerLogin, accepting
+// either a TOTP code or one of the user's recovery codes.
+func (cfg *apiConfig) handlerLoginMFA(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	userID, tokenVersion, err := auth.ParseMFAChallengeJWT(params.ChallengeToken, cfg.jwtKeys)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Login challenge is invalid or has expired", err)
+		return
+	}
+
+	user, err := cfg.db.GetUser(userID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusUnauthorized, "Login challenge is invalid or has expired", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	if user.DisabledAt != nil {
+		respondWithError(w, http.StatusForbidden, "Account has been disabled", nil)
+		return
+	}
+	if user.TokenVersion != tokenVersion || user.TOTPEnabledAt == nil || user.TOTPSecret == nil {
+		respondWithError(w, http.StatusUnauthorized, "Login challenge is invalid or has expired", nil)
+		return
+	}
+
+	if !allowAttempt(w, r, cfg.loginIPLimiter, loginIPKey(r)) ||
+		!allowAttempt(w, r, cfg.loginUserLimiter, loginAccountKey(user.Email)) {
+		return
+	}
+
+	switch {
+	case params.Code != "":
+		step, ok := auth.ValidateTOTP(*user.TOTPSecret, params.Code, time.Now())
+		if !ok {
+			cfg.recordLoginFailure(r, user.Email, "wrong_totp_code")
+			respondWithError(w, http.StatusUnauthorized, "Incorrect code", nil)
+			return
+		}
+		err = cfg.db.UseTOTPStep(user.ID, step)
+		if errors.Is(err, database.ErrConflict) {
+			cfg.recordLoginFailure(r, user.Email, "reused_totp_code")
+			respondWithError(w, http.StatusUnauthorized, "Code has already been used", nil)
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't check code", err)
+			return
+		}
+	case params.RecoveryCode != "":
+		codeHash := auth.HashToken(auth.NormalizeRecoveryCode(params.RecoveryCode))
+		err = cfg.db.UseRecoveryCode(user.ID, codeHash)
+		if errors.Is(err, database.ErrNotFound) {
+			cfg.recordLoginFailure(r, user.Email, "wrong_recovery_code")
+			respondWithError(w, http.StatusUnauthorized, "Incorrect recovery code", nil)
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't check recovery code", err)
+			return
+		}
+		auditEvent(r, "recovery_code_used", map[string]any{"email": user.Email})
+	default:
+		respondWithError(w, http.StatusBadRequest, "A code or recovery code is required", nil)
+		return
+	}
+
+	cfg.recordLoginSuccess(r, user.Email)
+	cfg.startSession(w, r, *user)
+}
+
+func (cfg *apiConfig) handlerMFAStatus(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Enabled                bool `json:"enabled"`
+		RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+	}
+
+	user, err := cfg.db.GetUser(requestPrincipal(r).UserID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get user", err)
+		return
+	}
+
+	remaining, err := cfg.db.CountRecoveryCodes(user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't count recovery codes", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		Enabled:                user.TOTPEnabledAt != nil,
+		RecoveryCodesRemaining: remaining,
+	})
+}
+
+// handlerMFAEnroll gives the user a new TOTP secret to add to their
+// authenticator app. It isn't enforced until confirmed with
+// handlerMFAConfirm.
+func (cfg *apiConfig) handlerMFAEnroll(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		CurrentPassword string `json:"current_password"`
+	}
+	type response struct {
+		Secret     string `json:"secret"`
+		OTPAuthURI string `json:"otpauth_uri"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	user, ok := cfg.checkCurrentPassword(w, requestPrincipal(r), params.CurrentPassword)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabledAt != nil {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled", nil)
+		return
+	}
+
+	secret, err := auth.MakeTOTPSecret()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create TOTP secret", err)
+		return
+	}
+
+	err = cfg.db.SetTOTPSecret(user.ID, secret)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't save TOTP secret", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		Secret:     secret,
+		OTPAuthURI: auth.TOTPURI(secret, totpIssuer, user.Email),
+	})
+}
+
+// handlerMFAConfirm turns two-factor authentication on once the user proves
+// their authenticator app produces the right codes, and hands out their
+// recovery codes. They are never shown again.
+func (cfg *apiConfig) handlerMFAConfirm(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Code string `json:"code"`
+	}
+	type response struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	user, err := cfg.db.GetUser(requestPrincipal(r).UserID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get user", err)
+		return
+	}
+	if user.TOTPEnabledAt != nil {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled", nil)
+		return
+	}
+	if user.TOTPSecret == nil {
+		respondWithError(w, http.StatusBadRequest, "Start enrollment first", nil)
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(*user.TOTPSecret, params.Code, time.Now())
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Incorrect code", nil)
+		return
+	}
+	err = cfg.db.UseTOTPStep(user.ID, step)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't check code", err)
+		return
+	}
+
+	codes, hashes, err := makeRecoveryCodes()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create recovery codes", err)
+		return
+	}
+
+	err = cfg.db.EnableTOTP(user.ID, hashes)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't enable two-factor authentication", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		RecoveryCodes: codes,
+	})
+}
+
+func (cfg *apiConfig) handlerMFADisable(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		CurrentPassword string `json:"current_password"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	user, ok := cfg.checkCurrentPassword(w, requestPrincipal(r), params.CurrentPassword)
+	if !ok {
+		return
+	}
+
+	err = cfg.db.DisableTOTP(user.ID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't disable two-factor authentication", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerMFARecoveryCodesRegenerate replaces the user's recovery codes,
+// invalidating the old ones.
+func (cfg *apiConfig) handlerMFARecoveryCodesRegenerate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		CurrentPassword string `json:"current_password"`
+	}
+	type response struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	user, ok := cfg.checkCurrentPassword(w, requestPrincipal(r), params.CurrentPassword)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabledAt == nil {
+		respondWithError(w, http.StatusBadRequest, "Two-factor authentication isn't enabled", nil)
+		return
+	}
+
+	codes, hashes, err := makeRecoveryCodes()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create recovery codes", err)
+		return
+	}
+
+	err = cfg.db.ReplaceRecoveryCodes(user.ID, hashes)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save recovery codes", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		RecoveryCodes: codes,
+	})
+}
+
+// makeRecoveryCodes returns a new set of recovery codes along with the
+// hashes they are stored as.
+func makeRecoveryCodes() (codes []string, hashes []string, err error) {
+	codes, err = auth.MakeRecoveryCodes()
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes = make([]string, 0, len(codes))
+	for _, code := range codes {
+		hashes = append(hashes, auth.HashToken(code))
+	}
+	return codes, hashes, nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+)
+
+// totpAt computes the code an authenticator app would show for secret at
+// the given 30 second step.
+func totpAt(t *testing.T, secret string, step int64) string {
+	t.Helper()
+
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", value%1_000_000)
+}
+
+// currentTOTPStep returns the current step, first waiting out the end of a
+// step so the codes a test computes stay valid while it runs.
+func currentTOTPStep() int64 {
+	if time.Now().Unix()%30 >= 28 {
+		time.Sleep(3 * time.Second)
+	}
+	return time.Now().Unix() / 30
+}
+
+// enableMFA enrolls the user in two-factor authentication, confirming with
+// the code from the previous step, and returns the secret and recovery codes.
+func (a *testAPI) enableMFA(token string, step int64) (string, []string) {
+	a.t.Helper()
+
+	rec := a.do("POST", "/api/users/me/2fa", token, map[string]any{"current_password": testPassword})
+	requireStatus(a.t, rec, http.StatusOK)
+	secret := decodeJSON[struct {
+		Secret string `json:"secret"`
+	}](a.t, rec).Secret
+
+	rec = a.do("POST", "/api/users/me/2fa/confirm", token, map[string]any{"code": totpAt(a.t, secret, step-1)})
+	requireStatus(a.t, rec, http.StatusOK)
+	codes := decodeJSON[struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}](a.t, rec).RecoveryCodes
+	return secret, codes
+}
+
+// mfaChallenge logs in with the password and returns the challenge token
+// the second step needs.
+func (a *testAPI) mfaChallenge(email string) string {
+	a.t.Helper()
+
+	rec := a.do("POST", "/api/login", "", map[string]any{"email": email, "password": testPassword})
+	requireStatus(a.t, rec, http.StatusOK)
+	resp := decodeJSON[struct {
+		Token          string `json:"token"`
+		MFARequired    bool   `json:"mfa_required"`
+		ChallengeToken string `json:"challenge_token"`
+	}](a.t, rec)
+	if !resp.MFARequired || resp.ChallengeToken == "" || resp.Token != "" {
+		a.t.Fatalf("login didn't ask for a second factor: %s", rec.Body.String())
+	}
+	return resp.ChallengeToken
+}
+
+func TestHandlerMFAEnroll(t *testing.T) {
+	api := newTestAPI(t)
+	_, token := api.createUser("user@example.com", auth.RoleUploader)
+
+	requireStatus(t, api.do("POST", "/api/users/me/2fa", token, map[string]any{"current_password": "wrong"}), http.StatusUnauthorized)
+	requireStatus(t, api.do("POST", "/api/users/me/2fa/confirm", token, map[string]any{"code": "000000"}), http.StatusBadRequest)
+
+	rec := api.do("POST", "/api/users/me/2fa", token, map[string]any{"current_password": testPassword})
+	requireStatus(t, rec, http.StatusOK)
+	secret := decodeJSON[struct {
+		Secret string `json:"secret"`
+	}](t, rec).Secret
+
+	step := currentTOTPStep()
+	requireStatus(t, api.do("POST", "/api/users/me/2fa/confirm", token, map[string]any{"code": totpAt(t, secret, step-5)}), http.StatusBadRequest)
+	requireStatus(t, api.do("POST", "/api/users/me/2fa/confirm", token, map[string]any{"code": totpAt(t, secret, step)}), http.StatusOK)
+	requireStatus(t, api.do("POST", "/api/users/me/2fa", token, map[string]any{"current_password": testPassword}), http.StatusConflict)
+
+	rec = api.do("GET", "/api/users/me/2fa", token, nil)
+	requireStatus(t, rec, http.StatusOK)
+	status := decodeJSON[struct {
+		Enabled                bool `json:"enabled"`
+		RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+	}](t, rec)
+	if !status.Enabled || status.RecoveryCodesRemaining == 0 {
+		t.Errorf("status = %+v, want enabled with recovery codes", status)
+	}
+}
+
+func TestHandlerLoginMFA(t *testing.T) {
+	api := newTestAPI(t)
+	user, token := api.createUser("user@example.com", auth.RoleUploader)
+	step := currentTOTPStep()
+	secret, _ := api.enableMFA(token, step)
+
+	tests := []struct {
+		name   string
+		body   func() map[string]any
+		status int
+	}{
+		{"bad challenge", func() map[string]any {
+			return map[string]any{"challenge_token": "not-a-jwt", "code": totpAt(t, secret, step)}
+		}, http.StatusUnauthorized},
+		{"no code", func() map[string]any {
+			return map[string]any{"challenge_token": api.mfaChallenge(user.Email)}
+		}, http.StatusBadRequest},
+		{"wrong code", func() map[string]any {
+			return map[string]any{"challenge_token": api.mfaChallenge(user.Email), "code": totpAt(t, secret, step-5)}
+		}, http.StatusUnauthorized},
+		{"code used to confirm", func() map[string]any {
+			return map[string]any{"challenge_token": api.mfaChallenge(user.Email), "code": totpAt(t, secret, step-1)}
+		}, http.StatusUnauthorized},
+		{"logged in", func() map[string]any {
+			return map[string]any{"challenge_token": api.mfaChallenge(user.Email), "code": totpAt(t, secret, step)}
+		}, http.StatusOK},
+		{"code replayed", func() map[string]any {
+			return map[string]any{"challenge_token": api.mfaChallenge(user.Email), "code": totpAt(t, secret, step)}
+		}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requireStatus(t, api.do("POST", "/api/login/2fa", "", tt.body()), tt.status)
+		})
+	}
+}
+
+func TestHandlerLoginMFARecoveryCode(t *testing.T) {
+	api := newTestAPI(t)
+	user, token := api.createUser("user@example.com", auth.RoleUploader)
+	_, codes := api.enableMFA(token, currentTOTPStep())
+
+	login := func(code string) int {
+		body := map[string]any{"challenge_token": api.mfaChallenge(user.Email), "recovery_code": code}
+		return api.do("POST", "/api/login/2fa", "", body).Code
+	}
+	if got := login("not-a-code"); got != http.StatusUnauthorized {
+		t.Errorf("unknown recovery code = %d, want %d", got, http.StatusUnauthorized)
+	}
+	if got := login(codes[0]); got != http.StatusOK {
+		t.Errorf("recovery code = %d, want %d", got, http.StatusOK)
+	}
+	if got := login(codes[0]); got != http.StatusUnauthorized {
+		t.Errorf("reused recovery code = %d, want %d", got, http.StatusUnauthorized)
+	}
+	if got := login(codes[1]); got != http.StatusOK {
+		t.Errorf("second recovery code = %d, want %d", got, http.StatusOK)
+	}
+}
+
+func TestHandlerMFADisable(t *testing.T) {
+	api := newTestAPI(t)
+	user, token := api.createUser("user@example.com", auth.RoleUploader)
+	api.enableMFA(token, currentTOTPStep())
+
+	requireStatus(t, api.do("DELETE", "/api/users/me/2fa", token, map[string]any{"current_password": "wrong"}), http.StatusUnauthorized)
+	api.mfaChallenge(user.Email)
+
+	requireStatus(t, api.do("DELETE", "/api/users/me/2fa", token, map[string]any{"current_password": testPassword}), http.StatusNoContent)
+	api.login(user.Email)
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/sso"
+)
+
+const (
+	oidcStateCookie = "tubely_oidc_state"
+	oidcStateTTL    = 10 * time.Minute
+	// oidcLoginCodeTTL is how long the web app has to exchange the code it
+	// is handed at the end of the callback for a session.
+	oidcLoginCodeTTL = time.Minute
+)
+
+var errOIDCUnverifiedEmail = errors.New("an account with this email address already exists")
+
+func (cfg *apiConfig) handlerOIDCProviders(w http.ResponseWriter, r *http.Request) {
+	type provider struct {
+		Name        string `json:"name"`
+		DisplayName string `json:"display_name"`
+		LoginURL    string `json:"login_url"`
+	}
+
+	names := make([]string, 0, len(cfg.oidcProviders))
+	for name := range cfg.oidcProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	resp := make([]provider, 0, len(names))
+	for _, name := range names {
+		p := cfg.oidcProviders[name]
+		resp = append(resp, provider{
+			Name:        p.Name(),
+			DisplayName: p.DisplayName(),
+			LoginURL:    "/api/oidc/" + url.PathEscape(p.Name()) + "/login",
+		})
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// handlerOIDCLogin sends the browser to the identity provider. The state,
+// nonce and PKCE verifier needed to finish the login are kept in a signed
+// cookie until handlerOIDCCallback.
+func (cfg *apiConfig) handlerOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	provider, ok := cfg.oidcProviders[r.PathValue("provider")]
+	if !ok {
+		respondWithError(w, http.StatusNotFound, "Unknown identity provider", nil)
+		return
+	}
+
+	state := auth.OIDCState{Provider: provider.Name()}
+	for _, value := range []*string{&state.State, &state.Nonce, &state.Verifier} {
+		random, err := sso.RandomString()
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't start login", err)
+			return
+		}
+		*value = random
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), state.State, state.Nonce, state.Verifier)
+	if err != nil {
+		respondWithError(w, http.StatusBadGateway, "Couldn't reach identity provider", err)
+		return
+	}
+
+	stateToken, err := auth.MakeOIDCStateJWT(state, cfg.jwtKeys, oidcStateTTL)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't start login", err)
+		return
+	}
+	cfg.setOIDCStateCookie(w, stateToken, oidcStateTTL)
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// handlerOIDCCallback is where the identity provider sends the browser back
+// to. It finishes the login with the provider, finds or creates the Tubely
+// user, and hands the web app a short-lived code to exchange for a session
+// with handlerOIDCExchange.
+func (cfg *apiConfig) handlerOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	provider, ok := cfg.oidcProviders[r.PathValue("provider")]
+	if !ok {
+		respondWithError(w, http.StatusNotFound, "Unknown identity provider", nil)
+		return
+	}
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		cfg.redirectOIDCError(w, r, "Login session has expired, please try again", err)
+		return
+	}
+	cfg.setOIDCStateCookie(w, "", -1)
+
+	state, err := auth.ParseOIDCStateJWT(cookie.Value, cfg.jwtKeys)
+	if err != nil {
+		cfg.redirectOIDCError(w, r, "Login session has expired, please try again", err)
+		return
+	}
+	if state.Provider != provider.Name() || r.URL.Query().Get("state") != state.State {
+		cfg.redirectOIDCError(w, r, "Login session doesn't match, please try again", nil)
+		return
+	}
+	if providerErr := r.URL.Query().Get("error"); providerErr != "" {
+		cfg.redirectOIDCError(w, r, "Login was cancelled or refused by the identity provider", errors.New(providerErr))
+		return
+	}
+
+	identity, err := provider.Exchange(r.Context(), r.URL.Query().Get("code"), state.Nonce, state.Verifier)
+	if err != nil {
+		cfg.redirectOIDCError(w, r, "Couldn't complete login with the identity provider", err)
+		return
+	}
+
+	user, err := cfg.userForIdentity(r, identity)
+	if errors.Is(err, errOIDCUnverifiedEmail) {
+		cfg.redirectOIDCError(w, r, "Your identity provider hasn't verified your email address, which is already used by a Tubely account", err)
+		return
+	}
+	if err != nil {
+		cfg.redirectOIDCError(w, r, "Couldn't log in with the identity provider", err)
+		return
+	}
+
+	code, err := cfg.issueUserToken(*user, database.TokenPurposeOIDCLogin, oidcLoginCodeTTL)
+	if err != nil {
+		cfg.redirectOIDCError(w, r, "Couldn't log in with the identity provider", err)
+		return
+	}
+	auditEvent(r, "oidc_login", map[string]any{
+		"provider": identity.Provider,
+		"subject":  identity.Subject,
+		"user_id":  user.ID,
+	})
+
+	http.Redirect(w, r, cfg.appLink("oidc_code", code), http.StatusFound)
+}
+
+// handlerOIDCExchange trades the code from handlerOIDCCallback for a
+// session, or for a challenge if the account also needs a second factor.
+func (cfg *apiConfig) handlerOIDCExchange(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Code string `json:"code"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	token, err := cfg.db.ConsumeUserToken(database.TokenPurposeOIDCLogin, auth.HashToken(params.Code))
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusUnauthorized, "Login code is invalid or has expired", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check login code", err)
+		return
+	}
+
+	user, err := cfg.db.GetUser(token.UserID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get user", err)
+		return
+	}
+	if user.DisabledAt != nil {
+		respondWithError(w, http.StatusForbidden, "Account has been disabled", nil)
+		return
+	}
+	if cfg.requireVerified && user.EmailVerifiedAt == nil {
+		respondWithError(w, http.StatusForbidden, "Email address has not been verified", nil)
+		return
+	}
+
+	if user.TOTPEnabledAt != nil {
+		cfg.respondWithMFAChallenge(w, *user)
+		return
+	}
+	cfg.startSession(w, r, *user)
+}
+
+// userForIdentity returns the user an external identity belongs to. An
+// identity seen for the first time is linked to the account with the same
+// email address if the provider vouches for that address, and otherwise
+// gets a new account.
+func (cfg *apiConfig) userForIdentity(r *http.Request, identity sso.Identity) (*database.User, error) {
+	linked, err := cfg.db.GetIdentity(identity.Provider, identity.Subject)
+	if err == nil {
+		err = cfg.db.TouchIdentity(identity.Provider, identity.Subject)
+		if err != nil {
+			return nil, err
+		}
+		return cfg.db.GetUser(linked.UserID)
+	}
+	if !errors.Is(err, database.ErrNotFound) {
+		return nil, err
+	}
+
+	email := strings.TrimSpace(identity.Email)
+	if !validEmail(email) {
+		return nil, fmt.Errorf("identity provider gave no usable email address for %s", identity.Subject)
+	}
+
+	user, err := cfg.db.GetUserByEmail(email)
+	switch {
+	case err == nil:
+		// anyone can claim an address they don't own at some providers,
+		// so only take over an existing account on the provider's word
+		if !identity.EmailVerified {
+			return nil, errOIDCUnverifiedEmail
+		}
+	case errors.Is(err, database.ErrNotFound):
+		created, err := cfg.createOIDCUser(email, identity.EmailVerified)
+		if err != nil {
+			return nil, err
+		}
+		user = *created
+	default:
+		return nil, err
+	}
+
+	if identity.EmailVerified && user.EmailVerifiedAt == nil {
+		err = cfg.db.MarkEmailVerified(user.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = cfg.db.CreateIdentity(database.CreateIdentityParams{
+		UserID:   user.ID,
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Email:    email,
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = cfg.db.TouchIdentity(identity.Provider, identity.Subject)
+	if err != nil {
+		return nil, err
+	}
+	auditEvent(r, "oidc_identity_linked", map[string]any{
+		"provider": identity.Provider,
+		"subject":  identity.Subject,
+		"user_id":  user.ID,
+	})
+
+	return cfg.db.GetUser(user.ID)
+}
+
+// createOIDCUser creates an account for someone logging in through an
+// identity provider for the first time. It gets a random password nobody
+// knows; the user can set one with a password reset.
+func (cfg *apiConfig) createOIDCUser(email string, emailVerified bool) (*database.User, error) {
+	password, err := sso.RandomString()
+	if err != nil {
+		return nil, err
+	}
+	hashedPassword, err := auth.HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	role := auth.RoleUploader
+	if emailVerified && cfg.adminEmails[email] {
+		role = auth.RoleAdmin
+	}
+
+	return cfg.db.CreateUser(database.CreateUserParams{
+		Email:    email,
+		Password: hashedPassword,
+		Role:     string(role),
+	})
+}
+
+func (cfg *apiConfig) setOIDCStateCookie(w http.ResponseWriter, value string, maxAge time.Duration) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/api/oidc/",
+		MaxAge:   int(maxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(cfg.appURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// redirectOIDCError sends the browser back to the web app with msg to show,
+// since a failed callback has no page of its own.
+func (cfg *apiConfig) redirectOIDCError(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	if err != nil {
+		log.Printf("OIDC login failed: %v", err)
+	}
+	http.Redirect(w, r, cfg.appLink("oidc_error", msg), http.StatusFound)
+}
+
+func (cfg *apiConfig) handlerIdentitiesList(w http.ResponseWriter, r *http.Request) {
+	identities, err := cfg.db.GetIdentities(requestPrincipal(r).UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve linked identities", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, identities)
+}
+
+func (cfg *apiConfig) handlerIdentityDelete(w http.ResponseWriter, r *http.Request) {
+	err := cfg.db.DeleteIdentity(requestPrincipal(r).UserID, r.PathValue("provider"))
+	if err != nil {
+		respondWithStoreError(w, "Couldn't unlink identity", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/sso"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testOIDCClientID     = "tubely"
+	testOIDCClientSecret = "client-secret"
+)
+
+// mockIssuer is an OpenID Connect provider serving discovery, JWKS and token
+// endpoints. Tests stand in for the browser and its authorization endpoint
+// by calling authorize.
+type mockIssuer struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]mockAuthorization
+}
+
+// mockAuthorization is what the issuer remembers about a code it handed out.
+type mockAuthorization struct {
+	identity      sso.Identity
+	nonce         string
+	codeChallenge string
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIssuer{t: t, key: key, codes: map[string]mockAuthorization{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", m.handleDiscovery)
+	mux.HandleFunc("GET /jwks", m.handleJWKS)
+	mux.HandleFunc("POST /token", m.handleToken)
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func (m *mockIssuer) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                m.server.URL,
+		"authorization_endpoint":                m.server.URL + "/authorize",
+		"token_endpoint":                        m.server.URL + "/token",
+		"jwks_uri":                              m.server.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (m *mockIssuer) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	pub := m.key.PublicKey
+	respondWithJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "mock",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+// handleToken redeems a code once, checking the client credentials and the
+// PKCE verifier against the challenge the code was issued for.
+func (m *mockIssuer) handleToken(w http.ResponseWriter, r *http.Request) {
+	tokenError := func(code string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": code})
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+	if clientID != testOIDCClientID || clientSecret != testOIDCClientSecret {
+		tokenError("invalid_client")
+		return
+	}
+
+	m.mu.Lock()
+	authz, ok := m.codes[r.PostFormValue("code")]
+	delete(m.codes, r.PostFormValue("code"))
+	m.mu.Unlock()
+	if !ok {
+		tokenError("invalid_grant")
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != authz.codeChallenge {
+		tokenError("invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            m.server.URL,
+		"aud":            testOIDCClientID,
+		"sub":            authz.identity.Subject,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+		"nonce":          authz.nonce,
+		"email":          authz.identity.Email,
+		"email_verified": authz.identity.EmailVerified,
+		"name":           authz.identity.Name,
+	})
+	idToken.Header["kid"] = "mock"
+	signed, err := idToken.SignedString(m.key)
+	if err != nil {
+		m.t.Error(err)
+		tokenError("server_error")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]any{
+		"access_token": "mock-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     signed,
+	})
+}
+
+// authorize plays the user approving the login at the provider. It returns
+// the code the provider would send back to the callback.
+func (m *mockIssuer) authorize(authz mockAuthorization) string {
+	m.t.Helper()
+
+	code, err := sso.RandomString()
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.codes[code] = authz
+	return code
+}
+
+// useMockIssuer registers a mock issuer as the provider named "mock".
+func (a *testAPI) useMockIssuer() *mockIssuer {
+	a.t.Helper()
+
+	issuer := newMockIssuer(a.t)
+	a.cfg.oidcProviders = map[string]*sso.Provider{
+		"mock": sso.NewProvider(sso.Config{
+			Name:         "mock",
+			Issuer:       issuer.server.URL,
+			ClientID:     testOIDCClientID,
+			ClientSecret: testOIDCClientSecret,
+			RedirectURL:  a.cfg.appURL + "/api/oidc/mock/callback",
+		}),
+	}
+	return issuer
+}
+
+// oidcLogin is a login started at Tubely: the request it sent the browser to
+// the provider with, and the state cookie it set.
+type oidcLogin struct {
+	query  url.Values
+	cookie *http.Cookie
+}
+
+func (a *testAPI) startOIDCLogin() oidcLogin {
+	a.t.Helper()
+
+	rec := a.do("GET", "/api/oidc/mock/login", "", nil)
+	requireStatus(a.t, rec, http.StatusFound)
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != oidcStateCookie {
+		a.t.Fatalf("login set cookies %v, want the state cookie", cookies)
+	}
+	return oidcLogin{query: location.Query(), cookie: cookies[0]}
+}
+
+// approve authorizes the login at the provider for identity, as the
+// provider would after checking the user's credentials.
+func (l oidcLogin) approve(issuer *mockIssuer, identity sso.Identity) string {
+	return issuer.authorize(mockAuthorization{
+		identity:      identity,
+		nonce:         l.query.Get("nonce"),
+		codeChallenge: l.query.Get("code_challenge"),
+	})
+}
+
+// oidcCallback sends the browser back to Tubely with code and state, returning
+// the web app link it is redirected to.
+func (a *testAPI) oidcCallback(cookie *http.Cookie, code, state string) url.Values {
+	a.t.Helper()
+
+	query := url.Values{"code": {code}, "state": {state}}
+	headers := []string{}
+	if cookie != nil {
+		headers = append(headers, "Cookie", cookie.Name+"="+cookie.Value)
+	}
+	rec := a.do("GET", "/api/oidc/mock/callback?"+query.Encode(), "", nil, headers...)
+	requireStatus(a.t, rec, http.StatusFound)
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return location.Query()
+}
+
+// loginWithIdentity runs a whole OIDC login for identity and returns the
+// logged in user.
+func (a *testAPI) loginWithIdentity(issuer *mockIssuer, identity sso.Identity) database.User {
+	a.t.Helper()
+
+	login := a.startOIDCLogin()
+	result := a.oidcCallback(login.cookie, login.approve(issuer, identity), login.query.Get("state"))
+	if result.Has("oidc_error") {
+		a.t.Fatalf("login failed: %s", result.Get("oidc_error"))
+	}
+
+	rec := a.do("POST", "/api/oidc/exchange", "", map[string]any{"code": result.Get("oidc_code")})
+	requireStatus(a.t, rec, http.StatusOK)
+	session := decodeJSON[struct {
+		database.User
+		Token string `json:"token"`
+	}](a.t, rec)
+	requireStatus(a.t, a.do("GET", "/api/users/me", session.Token, nil), http.StatusOK)
+	return session.User
+}
+
+func TestOIDCLoginRequest(t *testing.T) {
+	api := newTestAPI(t)
+	api.useMockIssuer()
+
+	login := api.startOIDCLogin()
+	if got := login.query.Get("client_id"); got != testOIDCClientID {
+		t.Errorf("client_id = %q, want %q", got, testOIDCClientID)
+	}
+	if got := login.query.Get("redirect_uri"); got != api.cfg.appURL+"/api/oidc/mock/callback" {
+		t.Errorf("redirect_uri = %q", got)
+	}
+	if login.query.Get("code_challenge_method") != "S256" || login.query.Get("code_challenge") == "" {
+		t.Errorf("login doesn't use PKCE: %v", login.query)
+	}
+	if login.query.Get("state") == "" || login.query.Get("nonce") == "" {
+		t.Errorf("login has no state or nonce: %v", login.query)
+	}
+
+	// each login gets its own state, nonce and verifier
+	other := api.startOIDCLogin()
+	for _, param := range []string{"state", "nonce", "code_challenge"} {
+		if login.query.Get(param) == other.query.Get(param) {
+			t.Errorf("two logins share a %s", param)
+		}
+	}
+
+	requireStatus(t, api.do("GET", "/api/oidc/unknown/login", "", nil), http.StatusNotFound)
+}
+
+func TestOIDCCallbackRejects(t *testing.T) {
+	identity := sso.Identity{Subject: "mock-user", Email: "user@example.com", EmailVerified: true}
+
+	tests := []struct {
+		name string
+		// callback finishes login however the case needs to, returning the
+		// web app link Tubely redirects to
+		callback func(api *testAPI, issuer *mockIssuer, login oidcLogin) url.Values
+	}{
+		{"state mismatch", func(api *testAPI, issuer *mockIssuer, login oidcLogin) url.Values {
+			return api.oidcCallback(login.cookie, login.approve(issuer, identity), "forged-state")
+		}},
+		{"no state cookie", func(api *testAPI, issuer *mockIssuer, login oidcLogin) url.Values {
+			return api.oidcCallback(nil, login.approve(issuer, identity), login.query.Get("state"))
+		}},
+		{"state cookie from another login", func(api *testAPI, issuer *mockIssuer, login oidcLogin) url.Values {
+			other := api.startOIDCLogin()
+			return api.oidcCallback(other.cookie, login.approve(issuer, identity), login.query.Get("state"))
+		}},
+		{"PKCE mismatch", func(api *testAPI, issuer *mockIssuer, login oidcLogin) url.Values {
+			// a code issued to another login, whose verifier this one
+			// doesn't have
+			other := api.startOIDCLogin()
+			code := issuer.authorize(mockAuthorization{
+				identity:      identity,
+				nonce:         login.query.Get("nonce"),
+				codeChallenge: other.query.Get("code_challenge"),
+			})
+			return api.oidcCallback(login.cookie, code, login.query.Get("state"))
+		}},
+		{"nonce mismatch", func(api *testAPI, issuer *mockIssuer, login oidcLogin) url.Values {
+			code := issuer.authorize(mockAuthorization{
+				identity:      identity,
+				nonce:         "replayed-nonce",
+				codeChallenge: login.query.Get("code_challenge"),
+			})
+			return api.oidcCallback(login.cookie, code, login.query.Get("state"))
+		}},
+		{"unknown code", func(api *testAPI, issuer *mockIssuer, login oidcLogin) url.Values {
+			return api.oidcCallback(login.cookie, "made-up-code", login.query.Get("state"))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestAPI(t)
+			issuer := api.useMockIssuer()
+
+			result := tt.callback(api, issuer, api.startOIDCLogin())
+			if !result.Has("oidc_error") || result.Has("oidc_code") {
+				t.Fatalf("callback redirected to %v, want an error", result)
+			}
+			if _, err := api.db.GetUserByEmail(identity.Email); err == nil {
+				t.Error("rejected login created an account")
+			}
+		})
+	}
+}
+
+func TestOIDCLoginCreatesAccount(t *testing.T) {
+	api := newTestAPI(t)
+	issuer := api.useMockIssuer()
+	identity := sso.Identity{Subject: "mock-user", Email: "new@example.com", EmailVerified: true}
+
+	user := api.loginWithIdentity(issuer, identity)
+	if user.Email != identity.Email || user.Role != string(auth.RoleUploader) {
+		t.Errorf("created user = %s, %s", user.Email, user.Role)
+	}
+	if user.EmailVerifiedAt == nil {
+		t.Error("email the provider verified isn't marked verified")
+	}
+
+	identities, err := api.db.GetIdentities(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(identities) != 1 || identities[0].Provider != "mock" || identities[0].Subject != identity.Subject {
+		t.Errorf("identities = %+v", identities)
+	}
+
+	// later logins find the account by subject, even if the email changes
+	identity.Email = "renamed@example.com"
+	if again := api.loginWithIdentity(issuer, identity); again.ID != user.ID {
+		t.Errorf("second login got user %s, want %s", again.ID, user.ID)
+	}
+	users, err := api.db.GetUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 {
+		t.Errorf("%d users, want 1", len(users))
+	}
+}
+
+func TestOIDCLoginLinksExistingAccount(t *testing.T) {
+	tests := []struct {
+		name          string
+		emailVerified bool
+		wantLinked    bool
+	}{
+		{"provider verified the email", true, true},
+		{"provider didn't verify the email", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestAPI(t)
+			issuer := api.useMockIssuer()
+			existing, _ := api.createUser("user@example.com", auth.RoleUploader)
+			identity := sso.Identity{Subject: "mock-user", Email: existing.Email, EmailVerified: tt.emailVerified}
+
+			login := api.startOIDCLogin()
+			result := api.oidcCallback(login.cookie, login.approve(issuer, identity), login.query.Get("state"))
+
+			identities, err := api.db.GetIdentities(existing.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if linked := len(identities) == 1; linked != tt.wantLinked {
+				t.Fatalf("identity linked = %v, want %v; redirected to %v", linked, tt.wantLinked, result)
+			}
+			if !tt.wantLinked {
+				if !result.Has("oidc_error") {
+					t.Errorf("callback redirected to %v, want an error", result)
+				}
+				return
+			}
+
+			rec := api.do("POST", "/api/oidc/exchange", "", map[string]any{"code": result.Get("oidc_code")})
+			requireStatus(t, rec, http.StatusOK)
+			if got := decodeJSON[database.User](t, rec); got.ID != existing.ID {
+				t.Errorf("logged in as %s, want the existing account %s", got.ID, existing.ID)
+			}
+
+			// the login code is single use
+			rec = api.do("POST", "/api/oidc/exchange", "", map[string]any{"code": result.Get("oidc_code")})
+			requireStatus(t, rec, http.StatusUnauthorized)
+		})
+	}
+}
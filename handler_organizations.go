@@ -0,0 +1,480 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxOrganizationNameLength = 100
+	maxKeyPrefixLength        = 200
+)
+
+// handlerOrganizationsCreate creates an organization with the caller as its
+// owner.
+func (cfg *apiConfig) handlerOrganizationsCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Name string `json:"name"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if problem := organizationNameProblem(params.Name); problem != "" {
+		respondWithError(w, http.StatusBadRequest, problem, nil)
+		return
+	}
+
+	org, err := cfg.db.CreateOrganization(params.Name, requestPrincipal(r).UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create organization", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, database.Membership{
+		Organization: org,
+		Role:         database.OrganizationRoleOwner,
+	})
+}
+
+// handlerOrganizationsList lists the organizations the caller belongs to,
+// with their role in each.
+func (cfg *apiConfig) handlerOrganizationsList(w http.ResponseWriter, r *http.Request) {
+	memberships, err := cfg.db.GetMemberships(requestPrincipal(r).UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve organizations", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, memberships)
+}
+
+func (cfg *apiConfig) handlerOrganizationGet(w http.ResponseWriter, r *http.Request) {
+	membership, ok := cfg.organizationWithRole(w, r, database.OrganizationRoleMember, "see")
+	if !ok {
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, membership)
+}
+
+func (cfg *apiConfig) handlerOrganizationUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Name string `json:"name"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if problem := organizationNameProblem(params.Name); problem != "" {
+		respondWithError(w, http.StatusBadRequest, problem, nil)
+		return
+	}
+
+	membership, ok := cfg.organizationWithRole(w, r, database.OrganizationRoleAdmin, "rename")
+	if !ok {
+		return
+	}
+
+	err = cfg.db.RenameOrganization(membership.ID, params.Name)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't update organization", err)
+		return
+	}
+
+	membership.Organization, err = cfg.db.GetOrganization(membership.ID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get organization", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, membership)
+}
+
+// handlerOrganizationDelete deletes an organization once it has no videos
+// left.
+func (cfg *apiConfig) handlerOrganizationDelete(w http.ResponseWriter, r *http.Request) {
+	membership, ok := cfg.organizationWithRole(w, r, database.OrganizationRoleOwner, "delete")
+	if !ok {
+		return
+	}
+
+	err := cfg.db.DeleteOrganization(membership.ID)
+	if errors.Is(err, database.ErrConflict) {
+		respondWithError(w, http.StatusConflict, "Delete the organization's videos first", err)
+		return
+	}
+	if err != nil {
+		respondWithStoreError(w, "Couldn't delete organization", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerOrganizationUsage reports what the organization has used of its
+// quota, as handlerUserUsage does for users.
+func (cfg *apiConfig) handlerOrganizationUsage(w http.ResponseWriter, r *http.Request) {
+	membership, ok := cfg.organizationWithRole(w, r, database.OrganizationRoleMember, "see the usage of")
+	if !ok {
+		return
+	}
+
+	account, err := cfg.accountFor(requestPrincipal(r).UserID, &membership.ID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get usage", err)
+		return
+	}
+
+	respondWithUsage(w, account)
+}
+
+func (cfg *apiConfig) handlerOrganizationMembersList(w http.ResponseWriter, r *http.Request) {
+	membership, ok := cfg.organizationWithRole(w, r, database.OrganizationRoleMember, "see the members of")
+	if !ok {
+		return
+	}
+
+	members, err := cfg.db.GetOrganizationMembers(membership.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve members", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, members)
+}
+
+// handlerOrganizationMemberAdd adds the user with an email to the
+// organization. Only owners can add admins and owners.
+func (cfg *apiConfig) handlerOrganizationMemberAdd(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.Role == "" {
+		params.Role = database.OrganizationRoleMember
+	}
+	if !validOrganizationRole(params.Role) {
+		respondWithError(w, http.StatusBadRequest, organizationRoleProblem, nil)
+		return
+	}
+
+	membership, ok := cfg.organizationWithRole(w, r, database.OrganizationRoleAdmin, "add members to")
+	if !ok {
+		return
+	}
+	if !canManageMember(membership.Role, params.Role) {
+		respondWithError(w, http.StatusForbidden, "Only owners can add admins and owners", nil)
+		return
+	}
+
+	user, err := cfg.db.GetUserByEmail(strings.TrimSpace(params.Email))
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusBadRequest, "No user has that email", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+
+	member, err := cfg.db.AddOrganizationMember(membership.ID, user.ID, params.Role)
+	if errors.Is(err, database.ErrConflict) {
+		respondWithError(w, http.StatusConflict, "User is already a member", err)
+		return
+	}
+	if err != nil {
+		respondWithStoreError(w, "Couldn't add member", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, member)
+}
+
+// handlerOrganizationMemberUpdate changes a member's role. Only owners can
+// change the roles of admins and owners, or make someone one.
+func (cfg *apiConfig) handlerOrganizationMemberUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Role string `json:"role"`
+	}
+
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if !validOrganizationRole(params.Role) {
+		respondWithError(w, http.StatusBadRequest, organizationRoleProblem, nil)
+		return
+	}
+
+	membership, ok := cfg.organizationWithRole(w, r, database.OrganizationRoleAdmin, "change the members of")
+	if !ok {
+		return
+	}
+
+	member, err := cfg.db.GetOrganizationMember(membership.ID, userID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get member", err)
+		return
+	}
+	if !canManageMember(membership.Role, member.Role) || !canManageMember(membership.Role, params.Role) {
+		respondWithError(w, http.StatusForbidden, "Only owners can manage admins and owners", nil)
+		return
+	}
+
+	err = cfg.db.SetOrganizationMemberRole(membership.ID, userID, params.Role)
+	if errors.Is(err, database.ErrConflict) {
+		respondWithError(w, http.StatusConflict, "The organization needs another owner first", err)
+		return
+	}
+	if err != nil {
+		respondWithStoreError(w, "Couldn't update member", err)
+		return
+	}
+
+	member.Role = params.Role
+	respondWithJSON(w, http.StatusOK, member)
+}
+
+// handlerOrganizationMemberRemove takes a member out of the organization.
+// Admins can remove members, owners can remove anyone, and members can
+// leave.
+func (cfg *apiConfig) handlerOrganizationMemberRemove(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	role := database.OrganizationRoleAdmin
+	if userID == requestPrincipal(r).UserID {
+		role = database.OrganizationRoleMember
+	}
+	membership, ok := cfg.organizationWithRole(w, r, role, "remove members from")
+	if !ok {
+		return
+	}
+
+	member, err := cfg.db.GetOrganizationMember(membership.ID, userID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get member", err)
+		return
+	}
+	if userID != requestPrincipal(r).UserID && !canManageMember(membership.Role, member.Role) {
+		respondWithError(w, http.StatusForbidden, "Only owners can remove admins and owners", nil)
+		return
+	}
+
+	err = cfg.db.RemoveOrganizationMember(membership.ID, userID)
+	if errors.Is(err, database.ErrConflict) {
+		respondWithError(w, http.StatusConflict, "The organization needs another owner first", err)
+		return
+	}
+	if err != nil {
+		respondWithStoreError(w, "Couldn't remove member", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerActiveOrganizationSet switches the organization the caller is
+// working in, which is where GET /api/videos lists from and new videos go.
+// A null organization_id switches back to their own videos.
+func (cfg *apiConfig) handlerActiveOrganizationSet(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		OrganizationID *uuid.UUID `json:"organization_id"`
+	}
+
+	userID := requestPrincipal(r).UserID
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	if params.OrganizationID != nil {
+		_, err = cfg.db.GetOrganizationMember(*params.OrganizationID, userID)
+		if errors.Is(err, database.ErrNotFound) {
+			respondWithError(w, http.StatusNotFound, "Organization not found", err)
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't check membership", err)
+			return
+		}
+	}
+
+	err = cfg.db.SetActiveOrganization(userID, params.OrganizationID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't update user", err)
+		return
+	}
+
+	user, err := cfg.db.GetUser(userID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get user", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, user)
+}
+
+// handlerVideoOrganizationSet moves one of the caller's own videos into an
+// organization they're an admin or owner of. Its files then count against
+// the organization's quota, and its members can work on it as on the
+// organization's other videos.
+func (cfg *apiConfig) handlerVideoOrganizationSet(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		OrganizationID uuid.UUID `json:"organization_id"`
+	}
+
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+	userID := requestPrincipal(r).UserID
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get video", err)
+		return
+	}
+	if video.OrganizationID != nil {
+		respondWithError(w, http.StatusConflict, "Video already belongs to an organization", nil)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can only move your own videos", nil)
+		return
+	}
+
+	member, err := cfg.db.GetOrganizationMember(params.OrganizationID, userID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Organization not found", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check membership", err)
+		return
+	}
+	if !hasOrganizationRole(member.Role, database.OrganizationRoleAdmin) {
+		respondWithError(w, http.StatusForbidden, "You can't move videos into this organization", nil)
+		return
+	}
+
+	account, err := cfg.accountFor(userID, &params.OrganizationID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get usage", err)
+		return
+	}
+	if account.quota.videosLeft(account.usage) <= 0 {
+		respondWithError(w, http.StatusForbidden, "The organization has reached its video limit", nil)
+		return
+	}
+	if account.quota.storageLeft(account.usage, 0) < video.VideoSize+video.ThumbnailSize {
+		respondWithError(w, http.StatusForbidden, "Video would exceed the organization's storage quota", nil)
+		return
+	}
+
+	err = cfg.db.SetVideoOwner(videoID, userID, &params.OrganizationID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't move video", err)
+		return
+	}
+
+	video, err = cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get video", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, video)
+}
+
+// canManageMember reports whether a member with callerRole can give or take
+// away role. Admins can only manage plain members.
+func canManageMember(callerRole, role string) bool {
+	return callerRole == database.OrganizationRoleOwner || role == database.OrganizationRoleMember
+}
+
+func organizationNameProblem(name string) string {
+	if strings.TrimSpace(name) == "" {
+		return "Name is required"
+	}
+	if utf8.RuneCountInString(name) > maxOrganizationNameLength {
+		return "Name is too long"
+	}
+	return ""
+}
+
+// organizationKeyPrefix is where in the bucket the organization's video
+// files go, unless an admin has set somewhere else.
+func organizationKeyPrefix(org database.Organization) string {
+	if org.KeyPrefix != nil {
+		return *org.KeyPrefix
+	}
+	return "organizations/" + org.ID.String()
+}
+
+// validKeyPrefix reports whether prefix is safe to put in front of S3 keys:
+// slash-separated segments of letters, digits, '-', '_' and '.', none of
+// them empty, "." or "..".
+func validKeyPrefix(prefix string) bool {
+	if prefix == "" || len(prefix) > maxKeyPrefixLength {
+		return false
+	}
+	for _, segment := range strings.Split(prefix, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+		for _, c := range segment {
+			switch {
+			case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
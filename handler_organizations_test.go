@@ -0,0 +1,297 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// testOrganization is an organization with a user in each role, and one who
+// isn't a member.
+type testOrganization struct {
+	database.Membership
+	path   string
+	users  map[string]database.User
+	tokens map[string]string
+}
+
+func (a *testAPI) createOrganization() testOrganization {
+	a.t.Helper()
+
+	org := testOrganization{users: map[string]database.User{}, tokens: map[string]string{}}
+	for _, who := range []string{"owner", "admin", "member", "stranger"} {
+		org.users[who], org.tokens[who] = a.createUser(who+"@example.com", auth.RoleUploader)
+	}
+
+	rec := a.do("POST", "/api/organizations", org.tokens["owner"], map[string]any{"name": "Acme"})
+	requireStatus(a.t, rec, http.StatusCreated)
+	org.Membership = decodeJSON[database.Membership](a.t, rec)
+	org.path = "/api/organizations/" + org.ID.String()
+	for _, role := range []string{database.OrganizationRoleAdmin, database.OrganizationRoleMember} {
+		rec = a.do("POST", org.path+"/members", org.tokens["owner"], map[string]any{"email": org.users[role].Email, "role": role})
+		requireStatus(a.t, rec, http.StatusCreated)
+	}
+	return org
+}
+
+// useOrganization makes org the one the user creates videos in.
+func (a *testAPI) useOrganization(token string, org testOrganization) {
+	a.t.Helper()
+
+	rec := a.do("PUT", "/api/users/me/active_organization", token, map[string]any{"organization_id": org.ID})
+	requireStatus(a.t, rec, http.StatusOK)
+}
+
+func TestHandlerOrganizationsCreate(t *testing.T) {
+	api := newTestAPI(t)
+	_, token := api.createUser("owner@example.com", auth.RoleUploader)
+
+	requireStatus(t, api.do("POST", "/api/organizations", "", map[string]any{"name": "Acme"}), http.StatusUnauthorized)
+	requireStatus(t, api.do("POST", "/api/organizations", token, map[string]any{"name": " "}), http.StatusBadRequest)
+
+	rec := api.do("POST", "/api/organizations", token, map[string]any{"name": "Acme"})
+	requireStatus(t, rec, http.StatusCreated)
+	if org := decodeJSON[database.Membership](t, rec); org.Role != database.OrganizationRoleOwner {
+		t.Errorf("creator's role = %q, want owner", org.Role)
+	}
+}
+
+func TestOrganizationRoles(t *testing.T) {
+	api := newTestAPI(t)
+	org := api.createOrganization()
+
+	tests := []struct {
+		name    string
+		request func(token string) int
+		want    map[string]int
+	}{
+		{
+			"view",
+			func(token string) int { return api.do("GET", org.path, token, nil).Code },
+			map[string]int{"stranger": 404, "member": 200, "admin": 200, "owner": 200},
+		},
+		{
+			"list members",
+			func(token string) int { return api.do("GET", org.path+"/members", token, nil).Code },
+			map[string]int{"stranger": 404, "member": 200, "admin": 200, "owner": 200},
+		},
+		{
+			"rename",
+			func(token string) int {
+				return api.do("PATCH", org.path, token, map[string]any{"name": "Acme Ltd"}).Code
+			},
+			map[string]int{"stranger": 404, "member": 403, "admin": 200, "owner": 200},
+		},
+		{
+			"change a member's role",
+			func(token string) int {
+				path := org.path + "/members/" + org.users["member"].ID.String()
+				return api.do("PATCH", path, token, map[string]any{"role": database.OrganizationRoleMember}).Code
+			},
+			map[string]int{"stranger": 404, "member": 403, "admin": 200, "owner": 200},
+		},
+		{
+			"make someone an owner",
+			func(token string) int {
+				path := org.path + "/members/" + org.users["member"].ID.String()
+				rec := api.do("PATCH", path, token, map[string]any{"role": database.OrganizationRoleOwner})
+				if rec.Code == http.StatusOK {
+					api.do("PATCH", path, org.tokens["owner"], map[string]any{"role": database.OrganizationRoleMember})
+				}
+				return rec.Code
+			},
+			map[string]int{"stranger": 404, "member": 403, "admin": 403, "owner": 200},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for who, want := range tt.want {
+				if got := tt.request(org.tokens[who]); got != want {
+					t.Errorf("%s: status = %d, want %d", who, got, want)
+				}
+			}
+		})
+	}
+
+	members := org.path + "/members"
+	stranger := map[string]any{"email": org.users["stranger"].Email}
+	requireStatus(t, api.do("POST", members, org.tokens["member"], stranger), http.StatusForbidden)
+	requireStatus(t, api.do("POST", members, org.tokens["admin"], map[string]any{"email": org.users["stranger"].Email, "role": "owner"}), http.StatusForbidden)
+	requireStatus(t, api.do("POST", members, org.tokens["admin"], stranger), http.StatusCreated)
+	requireStatus(t, api.do("POST", members, org.tokens["admin"], stranger), http.StatusConflict)
+	requireStatus(t, api.do("GET", org.path, org.tokens["stranger"], nil), http.StatusOK)
+
+	// an organization always keeps an owner
+	ownerPath := members + "/" + org.users["owner"].ID.String()
+	requireStatus(t, api.do("PATCH", ownerPath, org.tokens["owner"], map[string]any{"role": database.OrganizationRoleMember}), http.StatusConflict)
+	requireStatus(t, api.do("DELETE", ownerPath, org.tokens["owner"], nil), http.StatusConflict)
+}
+
+func TestOrganizationVideos(t *testing.T) {
+	api := newTestAPI(t)
+	org := api.createOrganization()
+	owner, member, stranger := org.tokens["owner"], org.tokens["member"], org.tokens["stranger"]
+
+	requireStatus(t, api.do("PUT", "/api/users/me/active_organization", stranger, map[string]any{"organization_id": org.ID}), http.StatusNotFound)
+
+	personal := api.createVideo(owner, map[string]any{"title": "Personal"})
+	api.useOrganization(member, org)
+	video := api.createVideo(member, map[string]any{"title": "Org video"})
+	if video.OrganizationID == nil || *video.OrganizationID != org.ID {
+		t.Fatalf("OrganizationID = %v, want %s", video.OrganizationID, org.ID)
+	}
+	path := "/api/videos/" + video.ID.String()
+
+	listed := decodeJSON[[]database.Video](t, api.do("GET", "/api/videos", member, nil))
+	if len(listed) != 1 || listed[0].ID != video.ID {
+		t.Errorf("member's list = %v, want only the organization's video", listed)
+	}
+	listed = decodeJSON[[]database.Video](t, api.do("GET", "/api/videos", owner, nil))
+	if len(listed) != 1 || listed[0].ID != personal.ID {
+		t.Errorf("owner's personal list = %v, want only their own video", listed)
+	}
+
+	// other members can work on the video, outsiders can't see it
+	requireStatus(t, api.do("GET", path, owner, nil), http.StatusOK)
+	requireStatus(t, api.do("PATCH", path, owner, map[string]any{"title": "Renamed"}), http.StatusOK)
+	requireStatus(t, api.do("GET", path, stranger, nil), http.StatusNotFound)
+
+	// an organization with videos can't be deleted
+	requireStatus(t, api.do("DELETE", org.path, owner, nil), http.StatusConflict)
+
+	// members who leave lose access, even to videos they created
+	requireStatus(t, api.do("DELETE", org.path+"/members/"+org.users["member"].ID.String(), member, nil), http.StatusNoContent)
+	requireStatus(t, api.do("GET", path, member, nil), http.StatusNotFound)
+	user, err := api.db.GetUser(org.users["member"].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ActiveOrganizationID != nil {
+		t.Error("active organization not cleared on leaving")
+	}
+	// nor can they keep working in it if it's left set
+	err = api.db.SetActiveOrganization(user.ID, &org.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if listed := decodeJSON[[]database.Video](t, api.do("GET", "/api/videos", member, nil)); len(listed) != 0 {
+		t.Errorf("former member's list = %v, want none", listed)
+	}
+	if created := api.createVideo(member, map[string]any{"title": "Mine"}); created.OrganizationID != nil {
+		t.Errorf("former member's new video went in organization %s", created.OrganizationID)
+	}
+
+	requireStatus(t, api.do("DELETE", path, owner, nil), http.StatusNoContent)
+	requireStatus(t, api.do("DELETE", org.path, owner, nil), http.StatusNoContent)
+	requireStatus(t, api.do("GET", org.path, owner, nil), http.StatusNotFound)
+}
+
+func TestOrganizationQuotaAndKeyPrefix(t *testing.T) {
+	api := newTestAPI(t)
+	org := api.createOrganization()
+	_, admin := api.createUser("site-admin@example.com", auth.RoleAdmin)
+	member := org.tokens["member"]
+	adminPath := "/admin/organizations/" + org.ID.String()
+
+	requireStatus(t, api.do("PUT", adminPath+"/quota", member, map[string]any{"videos": 1}), http.StatusForbidden)
+	requireStatus(t, api.do("PUT", adminPath+"/quota", admin, map[string]any{"videos": 1}), http.StatusOK)
+	requireStatus(t, api.do("PUT", adminPath+"/key_prefix", admin, map[string]any{"key_prefix": "../acme"}), http.StatusBadRequest)
+	requireStatus(t, api.do("PUT", adminPath+"/key_prefix", admin, map[string]any{"key_prefix": "tenants/acme"}), http.StatusOK)
+
+	api.useOrganization(member, org)
+	api.createVideo(member, map[string]any{"title": "First"})
+	requireStatus(t, api.do("POST", "/api/videos", member, map[string]any{"title": "Second"}), http.StatusForbidden)
+
+	// the member's own quota is untouched
+	api.createVideo(org.tokens["stranger"], map[string]any{"title": "Elsewhere"})
+
+	rec := api.do("GET", org.path+"/usage", member, nil)
+	requireStatus(t, rec, http.StatusOK)
+	usage := decodeJSON[struct {
+		Videos      int64  `json:"videos"`
+		VideosLimit *int64 `json:"videos_limit"`
+	}](t, rec)
+	if usage.Videos != 1 || usage.VideosLimit == nil || *usage.VideosLimit != 1 {
+		t.Errorf("usage = %d of %v, want 1 of 1", usage.Videos, usage.VideosLimit)
+	}
+
+	account, err := api.cfg.accountFor(org.users["member"].ID, &org.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.keyPrefix != "tenants/acme" {
+		t.Errorf("keyPrefix = %q, want %q", account.keyPrefix, "tenants/acme")
+	}
+}
+
+func TestOrganizationVideoMove(t *testing.T) {
+	api := newTestAPI(t)
+	org := api.createOrganization()
+	_, siteAdmin := api.createUser("site-admin@example.com", auth.RoleAdmin)
+	admin, member := org.tokens["admin"], org.tokens["member"]
+	video := api.createVideo(admin, map[string]any{"title": "Boots"})
+	path := "/api/videos/" + video.ID.String() + "/organization"
+	body := map[string]any{"organization_id": org.ID}
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"anonymous", "", http.StatusUnauthorized},
+		{"not the owner", org.tokens["owner"], http.StatusForbidden},
+		{"moved", admin, http.StatusOK},
+		{"already moved", admin, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requireStatus(t, api.do("PUT", path, tt.token, body), tt.status)
+		})
+	}
+
+	// plain members and outsiders can't move their videos in
+	own := api.createVideo(member, map[string]any{"title": "Member's"})
+	requireStatus(t, api.do("PUT", "/api/videos/"+own.ID.String()+"/organization", member, body), http.StatusForbidden)
+	own = api.createVideo(org.tokens["stranger"], map[string]any{"title": "Stranger's"})
+	requireStatus(t, api.do("PUT", "/api/videos/"+own.ID.String()+"/organization", org.tokens["stranger"], body), http.StatusNotFound)
+
+	got := decodeJSON[database.Video](t, api.do("GET", "/api/videos/"+video.ID.String(), member, nil))
+	if got.OrganizationID == nil || *got.OrganizationID != org.ID {
+		t.Errorf("OrganizationID = %v, want %s", got.OrganizationID, org.ID)
+	}
+
+	// moving counts against the organization's quota
+	requireStatus(t, api.do("PUT", "/admin/organizations/"+org.ID.String()+"/quota", siteAdmin, map[string]any{"videos": 1}), http.StatusOK)
+	another := api.createVideo(admin, map[string]any{"title": "Walking"})
+	requireStatus(t, api.do("PUT", "/api/videos/"+another.ID.String()+"/organization", admin, body), http.StatusForbidden)
+
+	// an admin transfer keeps the video in the organization, so only a
+	// member can take it
+	transfer := "/admin/videos/" + video.ID.String() + "/transfer"
+	requireStatus(t, api.do("POST", transfer, siteAdmin, map[string]any{"user_id": org.users["stranger"].ID}), http.StatusConflict)
+	rec := api.do("POST", transfer, siteAdmin, map[string]any{"user_id": org.users["member"].ID})
+	requireStatus(t, rec, http.StatusOK)
+	if got := decodeJSON[database.Video](t, rec); got.UserID != org.users["member"].ID || got.OrganizationID == nil || *got.OrganizationID != org.ID {
+		t.Errorf("transferred = %+v, want the member's, still in the organization", got)
+	}
+}
+
+func TestOrganizationVideoUploadLimit(t *testing.T) {
+	api := newTestAPI(t)
+	org := api.createOrganization()
+	member := org.tokens["member"]
+	api.useOrganization(member, org)
+	video := api.createVideo(member, map[string]any{"title": "Boots"})
+
+	// the uploader's own limit still applies in the organization
+	limit := int64(1024)
+	err := api.db.SetUserMaxUploadSize(org.users["member"].ID, &limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, contentType := multipartFile(t, "video", "video/mp4", make([]byte, 2048))
+	rec := api.do("POST", "/api/video_upload/"+video.ID.String(), member, body, "Content-Type", contentType)
+	requireStatus(t, rec, http.StatusRequestEntityTooLarge)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// handlerPasswordResetRequest emails a password reset link. It responds the
+// same way whether or not the address is registered, so it can't be used to
+// find out who has an account.
+func (cfg *apiConfig) handlerPasswordResetRequest(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Email string `json:"email"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	user, err := cfg.db.GetUserByEmail(params.Email)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	if err == nil && user.DisabledAt == nil {
+		err = cfg.sendPasswordResetEmail(r.Context(), user)
+		if err != nil {
+			log.Printf("Couldn't send password reset email to %s: %v", user.Email, err)
+		}
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handlerPasswordResetConfirm sets a new password using the token from a
+// reset email. Every existing session is signed out.
+func (cfg *apiConfig) handlerPasswordResetConfirm(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.Password == "" {
+		respondWithError(w, http.StatusBadRequest, "Password is required", nil)
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(params.Password)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't hash password", err)
+		return
+	}
+
+	token, err := cfg.db.ConsumeUserToken(database.TokenPurposeResetPassword, auth.HashToken(params.Token))
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusBadRequest, "Reset link is invalid or has expired", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+
+	err = cfg.db.SetUserPassword(token.UserID, hashedPassword)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't reset password", err)
+		return
+	}
+
+	err = cfg.db.RevokeOtherSessions(token.UserID, "")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign out sessions", err)
+		return
+	}
+
+	err = cfg.db.IncrementTokenVersion(token.UserID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't revoke access tokens", err)
+		return
+	}
+
+	// the reset link was delivered to the address, which proves the user
+	// owns it
+	err = cfg.db.MarkEmailVerified(token.UserID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't verify email", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
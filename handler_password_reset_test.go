@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestHandlerPasswordReset(t *testing.T) {
+	api := newTestAPI(t)
+	box := api.useMailbox()
+	user, sessionless := api.createUser("user@example.com", auth.RoleUploader)
+	accessToken, refreshToken := api.login(user.Email)
+
+	requireStatus(t, api.do("POST", "/api/password_reset", "", map[string]any{"email": user.Email}), http.StatusAccepted)
+	token := box.linkToken(t, user.Email, "reset_password")
+
+	const newPassword = "a whole new password"
+	confirm := map[string]any{"token": token, "password": newPassword}
+	requireStatus(t, api.do("POST", "/api/password_reset/confirm", "", confirm), http.StatusNoContent)
+
+	// every session and access token issued before the reset is revoked
+	requireStatus(t, api.do("GET", "/api/videos", accessToken, nil), http.StatusUnauthorized)
+	requireStatus(t, api.do("GET", "/api/videos", sessionless, nil), http.StatusUnauthorized)
+	requireStatus(t, api.do("POST", "/api/refresh", refreshToken, nil), http.StatusUnauthorized)
+
+	oldLogin := api.do("POST", "/api/login", "", map[string]any{"email": user.Email, "password": testPassword})
+	requireStatus(t, oldLogin, http.StatusUnauthorized)
+	newLogin := api.do("POST", "/api/login", "", map[string]any{"email": user.Email, "password": newPassword})
+	requireStatus(t, newLogin, http.StatusOK)
+
+	// the link proved the user owns the address
+	got, err := api.db.GetUser(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.EmailVerifiedAt == nil {
+		t.Error("email not verified by the reset")
+	}
+
+	// the link only works once
+	confirm["password"] = "yet another password"
+	requireStatus(t, api.do("POST", "/api/password_reset/confirm", "", confirm), http.StatusBadRequest)
+}
+
+func TestHandlerPasswordResetRequestUnknownEmail(t *testing.T) {
+	api := newTestAPI(t)
+	box := api.useMailbox()
+
+	requireStatus(t, api.do("POST", "/api/password_reset", "", map[string]any{"email": "nobody@example.com"}), http.StatusAccepted)
+	if len(box.messages) != 0 {
+		t.Errorf("sent %d emails for an unknown address", len(box.messages))
+	}
+}
+
+func TestHandlerPasswordResetConfirmRejects(t *testing.T) {
+	api := newTestAPI(t)
+	user, _ := api.createUser("user@example.com", auth.RoleUploader)
+
+	issue := func(purpose string, expiresAt time.Time) string {
+		t.Helper()
+		token, err := auth.MakeRefreshToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = api.db.CreateUserToken(database.CreateUserTokenParams{
+			TokenHash: auth.HashToken(token),
+			UserID:    user.ID,
+			Purpose:   purpose,
+			ExpiresAt: expiresAt,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	expired := issue(database.TokenPurposeResetPassword, time.Now().Add(-time.Minute))
+	verification := issue(database.TokenPurposeVerifyEmail, time.Now().Add(time.Hour))
+	valid := issue(database.TokenPurposeResetPassword, time.Now().Add(time.Hour))
+
+	tests := []struct {
+		name     string
+		token    string
+		password string
+		status   int
+	}{
+		{"missing password", valid, "", http.StatusBadRequest},
+		{"unknown", "not-a-token", "new password", http.StatusBadRequest},
+		{"expired", expired, "new password", http.StatusBadRequest},
+		{"issued for email verification", verification, "new password", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := api.do("POST", "/api/password_reset/confirm", "", map[string]any{"token": tt.token, "password": tt.password})
+			requireStatus(t, rec, tt.status)
+		})
+	}
+
+	// none of the rejected attempts changed the password
+	api.login(user.Email)
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxPlaylistTitleLength       = 200
+	maxPlaylistDescriptionLength = 5000
+	maxPlaylistVideos            = 500
+)
+
+// playlistResponse is a playlist along with its videos in order.
+type playlistResponse struct {
+	database.Playlist
+	Videos []database.Video `json:"videos"`
+}
+
+func (cfg *apiConfig) handlerPlaylistsCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		Visibility  string `json:"visibility"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.Visibility == "" {
+		params.Visibility = database.VisibilityPrivate
+	}
+	if problem := playlistProblem(params.Title, params.Description, params.Visibility); problem != "" {
+		respondWithError(w, http.StatusBadRequest, problem, nil)
+		return
+	}
+
+	playlist, err := cfg.db.CreatePlaylist(database.CreatePlaylistParams{
+		Title:       params.Title,
+		Description: params.Description,
+		Visibility:  params.Visibility,
+		UserID:      requestPrincipal(r).UserID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create playlist", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, playlist)
+}
+
+// handlerPlaylistsList lists all of the user's own playlists.
+func (cfg *apiConfig) handlerPlaylistsList(w http.ResponseWriter, r *http.Request) {
+	playlists, err := cfg.db.GetPlaylists(requestPrincipal(r).UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve playlists", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, playlists)
+}
+
+func (cfg *apiConfig) handlerPlaylistGet(w http.ResponseWriter, r *http.Request) {
+	playlist, ok := cfg.viewablePlaylist(w, r)
+	if !ok {
+		return
+	}
+
+	cfg.respondWithPlaylist(w, r, playlist)
+}
+
+func (cfg *apiConfig) handlerPlaylistUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Title       *string `json:"title"`
+		Description *string `json:"description"`
+		Visibility  *string `json:"visibility"`
+	}
+
+	playlist, ok := cfg.ownedPlaylist(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	if params.Title != nil {
+		playlist.Title = *params.Title
+	}
+	if params.Description != nil {
+		playlist.Description = *params.Description
+	}
+	if params.Visibility != nil {
+		playlist.Visibility = *params.Visibility
+	}
+	if problem := playlistProblem(playlist.Title, playlist.Description, playlist.Visibility); problem != "" {
+		respondWithError(w, http.StatusBadRequest, problem, nil)
+		return
+	}
+
+	err = cfg.db.UpdatePlaylist(playlist)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't update playlist", err)
+		return
+	}
+
+	playlist, err = cfg.db.GetPlaylist(playlist.ID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get playlist", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, playlist)
+}
+
+func (cfg *apiConfig) handlerPlaylistDelete(w http.ResponseWriter, r *http.Request) {
+	playlist, ok := cfg.ownedPlaylist(w, r)
+	if !ok {
+		return
+	}
+
+	err := cfg.db.DeletePlaylist(playlist.ID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't delete playlist", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerPlaylistVideoAdd adds one of the user's videos to their playlist,
+// at the end unless a position is given.
+func (cfg *apiConfig) handlerPlaylistVideoAdd(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		VideoID  uuid.UUID `json:"video_id"`
+		Position *int      `json:"position"`
+	}
+
+	playlist, ok := cfg.ownedPlaylist(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	position := -1
+	if params.Position != nil {
+		if *params.Position < 0 {
+			respondWithError(w, http.StatusBadRequest, "Position can't be negative", nil)
+			return
+		}
+		position = *params.Position
+	}
+
+	video, err := cfg.db.GetVideo(params.VideoID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != playlist.UserID || video.OrganizationID != nil {
+		respondWithError(w, http.StatusForbidden, "You can only add your own videos", nil)
+		return
+	}
+	if playlist.VideoCount >= maxPlaylistVideos {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Playlists can have at most %d videos", maxPlaylistVideos), nil)
+		return
+	}
+
+	err = cfg.db.AddPlaylistVideo(playlist.ID, video.ID, position)
+	if errors.Is(err, database.ErrConflict) {
+		respondWithError(w, http.StatusConflict, "Video is already in the playlist", err)
+		return
+	}
+	if err != nil {
+		respondWithStoreError(w, "Couldn't add video to playlist", err)
+		return
+	}
+
+	playlist, err = cfg.db.GetPlaylist(playlist.ID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get playlist", err)
+		return
+	}
+	cfg.respondWithPlaylist(w, r, playlist)
+}
+
+func (cfg *apiConfig) handlerPlaylistVideoRemove(w http.ResponseWriter, r *http.Request) {
+	playlist, ok := cfg.ownedPlaylist(w, r)
+	if !ok {
+		return
+	}
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	err = cfg.db.RemovePlaylistVideo(playlist.ID, videoID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't remove video from playlist", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerPlaylistVideosReorder puts the playlist's videos in a new order.
+// The request must list every video in the playlist exactly once.
+func (cfg *apiConfig) handlerPlaylistVideosReorder(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		VideoIDs []uuid.UUID `json:"video_ids"`
+	}
+
+	playlist, ok := cfg.ownedPlaylist(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	err = cfg.db.ReorderPlaylistVideos(playlist.ID, params.VideoIDs)
+	if errors.Is(err, database.ErrConflict) {
+		respondWithError(w, http.StatusConflict, "Video IDs must list each video in the playlist once", err)
+		return
+	}
+	if err != nil {
+		respondWithStoreError(w, "Couldn't reorder playlist", err)
+		return
+	}
+
+	playlist, err = cfg.db.GetPlaylist(playlist.ID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get playlist", err)
+		return
+	}
+	cfg.respondWithPlaylist(w, r, playlist)
+}
+
+// handlerPlaylistM3U8 serves the playlist's ready videos, in order, as an
+// M3U8 playlist that HLS players can step through. Each video is its own
+// segment, separated by discontinuities since they're encoded separately.
+func (cfg *apiConfig) handlerPlaylistM3U8(w http.ResponseWriter, r *http.Request) {
+	playlist, ok := cfg.viewablePlaylist(w, r)
+	if !ok {
+		return
+	}
+
+	videos, err := cfg.playlistVideos(r, playlist)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get playlist videos", err)
+		return
+	}
+
+	var entries strings.Builder
+	var targetDuration float64
+	first := true
+	for _, video := range videos {
+		if video.Status != database.VideoStatusReady || video.VideoURL == nil {
+			continue
+		}
+		if !first {
+			entries.WriteString("#EXT-X-DISCONTINUITY\n")
+		}
+		first = false
+
+		seconds := float64(video.DurationMs) / 1000
+		targetDuration = max(targetDuration, math.Ceil(seconds))
+		fmt.Fprintf(&entries, "#EXTINF:%.3f,%s\n%s\n", seconds, m3uText(video.Title), *video.VideoURL)
+	}
+
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	b.WriteString("#EXT-X-VERSION:3\n")
+	b.WriteString("#EXT-X-PLAYLIST-TYPE:VOD\n")
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", int64(targetDuration))
+	fmt.Fprintf(&b, "#PLAYLIST:%s\n", m3uText(playlist.Title))
+	b.WriteString(entries.String())
+	b.WriteString("#EXT-X-ENDLIST\n")
+
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(b.String()))
+}
+
+// m3uText flattens text onto one line so it can't break out of an M3U tag.
+func m3uText(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func (cfg *apiConfig) respondWithPlaylist(w http.ResponseWriter, r *http.Request, playlist database.Playlist) {
+	videos, err := cfg.playlistVideos(r, playlist)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get playlist videos", err)
+		return
+	}
+	playlist.VideoCount = len(videos)
+
+	respondWithJSON(w, http.StatusOK, playlistResponse{
+		Playlist: playlist,
+		Videos:   videos,
+	})
+}
+
+// playlistVideos returns the videos in the playlist that the caller may
+// see. Sharing a playlist doesn't share the private videos in it.
+func (cfg *apiConfig) playlistVideos(r *http.Request, playlist database.Playlist) ([]database.Video, error) {
+	videos, err := cfg.db.GetPlaylistVideos(playlist.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	p := requestPrincipal(r)
+	visible := []database.Video{}
+	for _, video := range videos {
+		ok, err := cfg.canViewVideo(p, video)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			visible = append(visible, video)
+		}
+	}
+	return visible, nil
+}
+
+// viewablePlaylist looks up the playlist in the request path, responding
+// with an error and returning false if it doesn't exist or the caller may
+// not see it. Private playlists look missing to anyone but their owner.
+func (cfg *apiConfig) viewablePlaylist(w http.ResponseWriter, r *http.Request) (database.Playlist, bool) {
+	playlistID, err := uuid.Parse(r.PathValue("playlistID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid playlist ID", err)
+		return database.Playlist{}, false
+	}
+
+	playlist, err := cfg.db.GetPlaylist(playlistID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get playlist", err)
+		return database.Playlist{}, false
+	}
+
+	if !canView(requestPrincipal(r), playlist.UserID, playlist.Visibility) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get playlist", nil)
+		return database.Playlist{}, false
+	}
+	return playlist, true
+}
+
+// ownedPlaylist looks up the playlist in the request path, responding with
+// an error and returning false unless it belongs to the caller.
+func (cfg *apiConfig) ownedPlaylist(w http.ResponseWriter, r *http.Request) (database.Playlist, bool) {
+	playlistID, err := uuid.Parse(r.PathValue("playlistID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid playlist ID", err)
+		return database.Playlist{}, false
+	}
+
+	playlist, err := cfg.db.GetPlaylist(playlistID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get playlist", err)
+		return database.Playlist{}, false
+	}
+	if playlist.UserID != requestPrincipal(r).UserID {
+		respondWithError(w, http.StatusForbidden, "You can't edit this playlist", nil)
+		return database.Playlist{}, false
+	}
+	return playlist, true
+}
+
+// playlistProblem describes what's wrong with a playlist's title,
+// description or visibility, or returns "" if they're fine.
+func playlistProblem(title, description, visibility string) string {
+	if strings.TrimSpace(title) == "" {
+		return "Title is required"
+	}
+	if utf8.RuneCountInString(title) > maxPlaylistTitleLength {
+		return "Title is too long"
+	}
+	if utf8.RuneCountInString(description) > maxPlaylistDescriptionLength {
+		return "Description is too long"
+	}
+	if !validVisibility(visibility) {
+		return visibilityProblem
+	}
+	return ""
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// createPlaylist creates a playlist through the API, failing the test if it
+// can't.
+func (a *testAPI) createPlaylist(token string, params map[string]any) database.Playlist {
+	a.t.Helper()
+
+	rec := a.do("POST", "/api/playlists", token, params)
+	requireStatus(a.t, rec, http.StatusCreated)
+	return decodeJSON[database.Playlist](a.t, rec)
+}
+
+func playlistVideoTitles(playlist playlistResponse) []string {
+	titles := make([]string, len(playlist.Videos))
+	for i, video := range playlist.Videos {
+		titles[i] = video.Title
+	}
+	return titles
+}
+
+func TestHandlerPlaylists(t *testing.T) {
+	api := newTestAPI(t)
+	_, owner := api.createUser("owner@example.com", auth.RoleUploader)
+	_, other := api.createUser("other@example.com", auth.RoleUploader)
+
+	for _, tt := range []struct {
+		name   string
+		params map[string]any
+	}{
+		{"missing title", map[string]any{"title": " "}},
+		{"title too long", map[string]any{"title": strings.Repeat("a", maxPlaylistTitleLength+1)}},
+		{"unknown visibility", map[string]any{"title": "Trips", "visibility": "friends"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			requireStatus(t, api.do("POST", "/api/playlists", owner, tt.params), http.StatusBadRequest)
+		})
+	}
+	requireStatus(t, api.do("POST", "/api/playlists", "", map[string]any{"title": "Trips"}), http.StatusUnauthorized)
+
+	playlist := api.createPlaylist(owner, map[string]any{"title": "Trips"})
+	if playlist.Visibility != database.VisibilityPrivate {
+		t.Errorf("Visibility = %q, want private by default", playlist.Visibility)
+	}
+	path := "/api/playlists/" + playlist.ID.String()
+
+	// private playlists look missing to everyone else
+	requireStatus(t, api.do("GET", path, "", nil), http.StatusNotFound)
+	requireStatus(t, api.do("GET", path, other, nil), http.StatusNotFound)
+	requireStatus(t, api.do("GET", path, owner, nil), http.StatusOK)
+
+	requireStatus(t, api.do("PATCH", path, other, map[string]any{"title": "Mine"}), http.StatusForbidden)
+	requireStatus(t, api.do("PATCH", path, owner, map[string]any{"visibility": "friends"}), http.StatusBadRequest)
+	rec := api.do("PATCH", path, owner, map[string]any{"title": "Holidays", "visibility": "unlisted"})
+	requireStatus(t, rec, http.StatusOK)
+	if got := decodeJSON[database.Playlist](t, rec); got.Title != "Holidays" || got.Visibility != database.VisibilityUnlisted {
+		t.Errorf("updated = %+v, want Holidays, unlisted", got)
+	}
+	requireStatus(t, api.do("GET", path, "", nil), http.StatusOK)
+
+	rec = api.do("GET", "/api/playlists", owner, nil)
+	requireStatus(t, rec, http.StatusOK)
+	if got := decodeJSON[[]database.Playlist](t, rec); len(got) != 1 || got[0].ID != playlist.ID {
+		t.Errorf("owner's playlists = %+v, want just Holidays", got)
+	}
+	rec = api.do("GET", "/api/playlists", other, nil)
+	requireStatus(t, rec, http.StatusOK)
+	if got := decodeJSON[[]database.Playlist](t, rec); len(got) != 0 {
+		t.Errorf("other user's playlists = %+v, want none", got)
+	}
+
+	requireStatus(t, api.do("DELETE", path, other, nil), http.StatusForbidden)
+	requireStatus(t, api.do("DELETE", path, owner, nil), http.StatusNoContent)
+	requireStatus(t, api.do("GET", path, owner, nil), http.StatusNotFound)
+}
+
+func TestHandlerPlaylistVideos(t *testing.T) {
+	api := newTestAPI(t)
+	_, owner := api.createUser("owner@example.com", auth.RoleUploader)
+	_, other := api.createUser("other@example.com", auth.RoleUploader)
+	boots := api.createVideo(owner, map[string]any{"title": "Boots"})
+	walking := api.createVideo(owner, map[string]any{"title": "Walking"})
+	camping := api.createVideo(owner, map[string]any{"title": "Camping"})
+	elsewhere := api.createVideo(other, map[string]any{"title": "Elsewhere"})
+	playlist := api.createPlaylist(owner, map[string]any{"title": "Trips"})
+	path := "/api/playlists/" + playlist.ID.String() + "/videos"
+
+	tests := []struct {
+		name   string
+		token  string
+		params map[string]any
+		status int
+		want   []string
+	}{
+		{"anonymous", "", map[string]any{"video_id": boots.ID}, http.StatusUnauthorized, nil},
+		{"other user", other, map[string]any{"video_id": elsewhere.ID}, http.StatusForbidden, nil},
+		{"someone else's video", owner, map[string]any{"video_id": elsewhere.ID}, http.StatusForbidden, nil},
+		{"unknown video", owner, map[string]any{"video_id": uuid.New()}, http.StatusNotFound, nil},
+		{"negative position", owner, map[string]any{"video_id": boots.ID, "position": -1}, http.StatusBadRequest, nil},
+		{"first", owner, map[string]any{"video_id": boots.ID}, http.StatusOK, []string{"Boots"}},
+		{"at the end", owner, map[string]any{"video_id": walking.ID}, http.StatusOK, []string{"Boots", "Walking"}},
+		{"at a position", owner, map[string]any{"video_id": camping.ID, "position": 1}, http.StatusOK, []string{"Boots", "Camping", "Walking"}},
+		{"already in it", owner, map[string]any{"video_id": boots.ID}, http.StatusConflict, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := api.do("POST", path, tt.token, tt.params)
+			requireStatus(t, rec, tt.status)
+			if tt.want == nil {
+				return
+			}
+			if got := playlistVideoTitles(decodeJSON[playlistResponse](t, rec)); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("videos = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	for _, ids := range [][]uuid.UUID{
+		{walking.ID, boots.ID},
+		{walking.ID, boots.ID, boots.ID},
+		{walking.ID, boots.ID, elsewhere.ID},
+	} {
+		requireStatus(t, api.do("PUT", path, owner, map[string]any{"video_ids": ids}), http.StatusConflict)
+	}
+	requireStatus(t, api.do("PUT", path, other, map[string]any{"video_ids": []uuid.UUID{walking.ID, boots.ID, camping.ID}}), http.StatusForbidden)
+	rec := api.do("PUT", path, owner, map[string]any{"video_ids": []uuid.UUID{walking.ID, boots.ID, camping.ID}})
+	requireStatus(t, rec, http.StatusOK)
+	if got := playlistVideoTitles(decodeJSON[playlistResponse](t, rec)); strings.Join(got, ",") != "Walking,Boots,Camping" {
+		t.Errorf("reordered = %v, want Walking, Boots, Camping", got)
+	}
+
+	requireStatus(t, api.do("DELETE", path+"/"+boots.ID.String(), other, nil), http.StatusForbidden)
+	requireStatus(t, api.do("DELETE", path+"/"+boots.ID.String(), owner, nil), http.StatusNoContent)
+	requireStatus(t, api.do("DELETE", path+"/"+boots.ID.String(), owner, nil), http.StatusNotFound)
+	requireStatus(t, api.do("DELETE", "/api/videos/"+camping.ID.String(), owner, nil), http.StatusNoContent)
+
+	rec = api.do("GET", "/api/playlists/"+playlist.ID.String(), owner, nil)
+	requireStatus(t, rec, http.StatusOK)
+	got := decodeJSON[playlistResponse](t, rec)
+	if titles := playlistVideoTitles(got); strings.Join(titles, ",") != "Walking" || got.VideoCount != 1 {
+		t.Errorf("playlist = %v with count %d, want just Walking", titles, got.VideoCount)
+	}
+}
+
+func TestHandlerPlaylistM3U8(t *testing.T) {
+	api := newTestAPI(t)
+	user, owner := api.createUser("owner@example.com", auth.RoleUploader)
+	playlist := api.createPlaylist(owner, map[string]any{"title": "Trips\nAbroad", "visibility": "public"})
+	for _, video := range []struct {
+		title      string
+		visibility string
+		duration   time.Duration
+	}{
+		{"Boots", "public", 4500 * time.Millisecond},
+		{"Not uploaded", "public", 0},
+		{"Walking\n#EXT-X-ENDLIST", "unlisted", 10 * time.Second},
+		// private videos stay private in a public playlist
+		{"Secret", "private", 30 * time.Second},
+	} {
+		created := api.createVideo(owner, map[string]any{"title": video.title, "visibility": video.visibility})
+		if video.duration > 0 {
+			err := api.db.RecordUpload(database.RecordUploadParams{
+				UserID:          user.ID,
+				VideoID:         created.ID,
+				URL:             "https://cdn.example.com/" + created.ID.String() + ".mp4",
+				Orientation:     "landscape",
+				Duration:        video.duration,
+				StorageLimit:    -1,
+				UploadTimeLimit: -1,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		requireStatus(t, api.do("POST", "/api/playlists/"+playlist.ID.String()+"/videos", owner, map[string]any{"video_id": created.ID}), http.StatusOK)
+	}
+	got := decodeJSON[playlistResponse](t, api.do("GET", "/api/playlists/"+playlist.ID.String(), owner, nil))
+
+	// public, so no token is needed
+	rec := api.do("GET", "/api/playlists/"+playlist.ID.String()+"/playlist.m3u8", "", nil)
+	requireStatus(t, rec, http.StatusOK)
+	if ct := rec.Header().Get("Content-Type"); ct != "application/vnd.apple.mpegurl" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	want := "#EXTM3U\n" +
+		"#EXT-X-VERSION:3\n" +
+		"#EXT-X-PLAYLIST-TYPE:VOD\n" +
+		"#EXT-X-TARGETDURATION:10\n" +
+		"#PLAYLIST:Trips Abroad\n" +
+		"#EXTINF:4.500,Boots\n" +
+		*got.Videos[0].VideoURL + "\n" +
+		"#EXT-X-DISCONTINUITY\n" +
+		"#EXTINF:10.000,Walking #EXT-X-ENDLIST\n" +
+		*got.Videos[2].VideoURL + "\n" +
+		"#EXT-X-ENDLIST\n"
+	if body := rec.Body.String(); body != want {
+		t.Errorf("body =\n%s\nwant\n%s", body, want)
+	}
+
+	requireStatus(t, api.do("PATCH", "/api/playlists/"+playlist.ID.String(), owner, map[string]any{"visibility": "private"}), http.StatusOK)
+	requireStatus(t, api.do("GET", "/api/playlists/"+playlist.ID.String()+"/playlist.m3u8", "", nil), http.StatusNotFound)
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const (
+	maxDisplayNameLength = 100
+	maxBioLength         = 1000
+)
+
+func (cfg *apiConfig) handlerUserMe(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.db.GetUser(requestPrincipal(r).UserID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get user", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, user)
+}
+
+func (cfg *apiConfig) handlerUserMeUpdate(w http.ResponseWriter, r *http.Request) {
+	// fields left out of the request are left unchanged
+	type parameters struct {
+		DisplayName *string `json:"display_name"`
+		Bio         *string `json:"bio"`
+	}
+
+	userID := requestPrincipal(r).UserID
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	user, err := cfg.db.GetUser(userID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get user", err)
+		return
+	}
+
+	profile := user.UserProfile
+	if params.DisplayName != nil {
+		if utf8.RuneCountInString(*params.DisplayName) > maxDisplayNameLength {
+			respondWithError(w, http.StatusBadRequest, "Display name is too long", nil)
+			return
+		}
+		profile.DisplayName = *params.DisplayName
+	}
+	if params.Bio != nil {
+		if utf8.RuneCountInString(*params.Bio) > maxBioLength {
+			respondWithError(w, http.StatusBadRequest, "Bio is too long", nil)
+			return
+		}
+		profile.Bio = *params.Bio
+	}
+
+	err = cfg.db.UpdateUserProfile(userID, profile)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't update profile", err)
+		return
+	}
+
+	user.UserProfile = profile
+	respondWithJSON(w, http.StatusOK, user)
+}
+
+func (cfg *apiConfig) handlerUserAvatarUpload(w http.ResponseWriter, r *http.Request) {
+	userID := requestPrincipal(r).UserID
+
+	user, err := cfg.db.GetUser(userID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get user", err)
+		return
+	}
+
+	file, err := formFile(r, "avatar")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't read file data", err)
+		return
+	}
+	defer file.Close()
+
+	fileExtension, err := readImageContentType(file.Header.Get("Content-Type"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid file metadata", err)
+		return
+	}
+
+	newURL, _, err := cfg.saveAsset(file, fileExtension)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to save avatar", err)
+		return
+	}
+
+	oldURL := user.AvatarURL
+	user.AvatarURL = &newURL
+	err = cfg.db.UpdateUserProfile(userID, user.UserProfile)
+	if err != nil {
+		cfg.removeAsset(newURL)
+		respondWithStoreError(w, "Couldn't update profile", err)
+		return
+	}
+	if oldURL != nil {
+		err = cfg.removeAsset(*oldURL)
+		if err != nil {
+			log.Printf("Couldn't remove old avatar %s: %v", *oldURL, err)
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, user)
+}
+
+func (cfg *apiConfig) handlerUserAvatarDelete(w http.ResponseWriter, r *http.Request) {
+	userID := requestPrincipal(r).UserID
+
+	user, err := cfg.db.GetUser(userID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get user", err)
+		return
+	}
+	if user.AvatarURL == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	oldURL := *user.AvatarURL
+	user.AvatarURL = nil
+	err = cfg.db.UpdateUserProfile(userID, user.UserProfile)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't update profile", err)
+		return
+	}
+	err = cfg.removeAsset(oldURL)
+	if err != nil {
+		log.Printf("Couldn't remove avatar %s: %v", oldURL, err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerUserPasswordChange sets a new password after checking the current
+// one. Every other session is signed out, and since the old access tokens
+// stop working a fresh one is returned for the current session.
+func (cfg *apiConfig) handlerUserPasswordChange(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	type response struct {
+		Token string `json:"token"`
+	}
+
+	caller := requestPrincipal(r)
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.NewPassword == "" {
+		respondWithError(w, http.StatusBadRequest, "New password is required", nil)
+		return
+	}
+
+	user, ok := cfg.checkCurrentPassword(w, caller, params.CurrentPassword)
+	if !ok {
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(params.NewPassword)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't hash password", err)
+		return
+	}
+
+	err = cfg.db.SetUserPassword(user.ID, hashedPassword)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't change password", err)
+		return
+	}
+
+	err = cfg.db.RevokeOtherSessions(user.ID, caller.SessionID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign out other sessions", err)
+		return
+	}
+
+	err = cfg.db.IncrementTokenVersion(user.ID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't revoke access tokens", err)
+		return
+	}
+
+	user, err = cfg.db.GetUser(user.ID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get user", err)
+		return
+	}
+
+	accessToken, err := auth.MakeSessionJWT(
+		user.ID,
+		caller.SessionID,
+		user.TokenVersion,
+		cfg.jwtKeys,
+		cfg.accessTokenTTL,
+	)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create access JWT", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		Token: accessToken,
+	})
+}
+
+// handlerUserEmailChange moves the account to a new email address, which
+// has to be verified again.
+func (cfg *apiConfig) handlerUserEmailChange(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Email           string `json:"email"`
+		CurrentPassword string `json:"current_password"`
+	}
+
+	caller := requestPrincipal(r)
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if !validEmail(params.Email) {
+		respondWithError(w, http.StatusBadRequest, "Invalid email address", nil)
+		return
+	}
+
+	user, ok := cfg.checkCurrentPassword(w, caller, params.CurrentPassword)
+	if !ok {
+		return
+	}
+	if params.Email == user.Email {
+		respondWithJSON(w, http.StatusOK, user)
+		return
+	}
+
+	err = cfg.db.SetUserEmail(user.ID, params.Email)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't change email", err)
+		return
+	}
+
+	user, err = cfg.db.GetUser(user.ID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get user", err)
+		return
+	}
+
+	err = cfg.sendVerificationEmail(r.Context(), *user)
+	if err != nil {
+		log.Printf("Couldn't send verification email to %s: %v", user.Email, err)
+	}
+
+	respondWithJSON(w, http.StatusOK, user)
+}
+
+// handlerUserDelete deletes the account, its videos and sessions, and the
+// files the videos and avatar were stored in. Videos the user created for an
+// organization stay with it, and an organization's last owner has to hand
+// it over before leaving.
+func (cfg *apiConfig) handlerUserDelete(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		CurrentPassword string `json:"current_password"`
+	}
+
+	caller := requestPrincipal(r)
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	user, ok := cfg.checkCurrentPassword(w, caller, params.CurrentPassword)
+	if !ok {
+		return
+	}
+
+	videos, err := cfg.db.GetVideos(user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
+		return
+	}
+
+	err = cfg.db.DeleteUser(user.ID)
+	if errors.Is(err, database.ErrConflict) {
+		respondWithError(w, http.StatusConflict, "Make someone else an owner of your organizations first", err)
+		return
+	}
+	if err != nil {
+		respondWithStoreError(w, "Couldn't delete account", err)
+		return
+	}
+
+	// the account is gone either way, so failures here are only logged
+	if user.AvatarURL != nil {
+		err = cfg.removeAsset(*user.AvatarURL)
+		if err != nil {
+			log.Printf("Couldn't remove asset %s: %v", *user.AvatarURL, err)
+		}
+	}
+	for _, video := range videos {
+		cfg.removeVideoFiles(r.Context(), video)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkCurrentPassword loads the calling user and confirms they know their
+// password, as sensitive account changes require. It writes an error
+// response and returns false if they don't.
+func (cfg *apiConfig) checkCurrentPassword(w http.ResponseWriter, caller principal, password string) (*database.User, bool) {
+	user, err := cfg.db.GetUser(caller.UserID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get user", err)
+		return nil, false
+	}
+
+	match, err := auth.CheckPasswordHash(password, user.Password)
+	if err != nil || !match {
+		respondWithError(w, http.StatusUnauthorized, "Current password is incorrect", err)
+		return nil, false
+	}
+	return user, true
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestHandlerUserMeUpdate(t *testing.T) {
+	api := newTestAPI(t)
+	user, _ := api.createUser("user@example.com", auth.RoleUploader)
+	token, _ := api.login(user.Email)
+
+	tests := []struct {
+		name            string
+		body            map[string]any
+		status          int
+		wantDisplayName string
+		wantBio         string
+	}{
+		{"display name", map[string]any{"display_name": "Boots"}, http.StatusOK, "Boots", ""},
+		{"bio leaves display name", map[string]any{"bio": "A bear"}, http.StatusOK, "Boots", "A bear"},
+		{"display name too long", map[string]any{"display_name": strings.Repeat("b", maxDisplayNameLength+1)}, http.StatusBadRequest, "Boots", "A bear"},
+		{"bio too long", map[string]any{"bio": strings.Repeat("b", maxBioLength+1)}, http.StatusBadRequest, "Boots", "A bear"},
+		{"cleared", map[string]any{"display_name": "", "bio": ""}, http.StatusOK, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requireStatus(t, api.do("PATCH", "/api/users/me", token, tt.body), tt.status)
+
+			rec := api.do("GET", "/api/users/me", token, nil)
+			requireStatus(t, rec, http.StatusOK)
+			got := decodeJSON[database.User](t, rec)
+			if got.DisplayName != tt.wantDisplayName || got.Bio != tt.wantBio {
+				t.Errorf("profile = %q, %q; want %q, %q", got.DisplayName, got.Bio, tt.wantDisplayName, tt.wantBio)
+			}
+		})
+	}
+}
+
+func TestHandlerUserPasswordChange(t *testing.T) {
+	api := newTestAPI(t)
+	user, _ := api.createUser("user@example.com", auth.RoleUploader)
+	accessToken, refreshToken := api.login(user.Email)
+	_, otherRefreshToken := api.login(user.Email)
+
+	const newPassword = "a whole new password"
+	tests := []struct {
+		name    string
+		current string
+		new     string
+		status  int
+	}{
+		{"wrong current password", "wrong", newPassword, http.StatusUnauthorized},
+		{"missing new password", testPassword, "", http.StatusBadRequest},
+		{"changed", testPassword, newPassword, http.StatusOK},
+	}
+	var changed string
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := api.do("PUT", "/api/users/me/password", accessToken, map[string]any{"current_password": tt.current, "new_password": tt.new})
+			requireStatus(t, rec, tt.status)
+			if tt.status == http.StatusOK {
+				changed = decodeJSON[struct {
+					Token string `json:"token"`
+				}](t, rec).Token
+			}
+		})
+	}
+
+	// old access tokens stop working, but the current session carries on with
+	// the returned one
+	requireStatus(t, api.do("GET", "/api/users/me", accessToken, nil), http.StatusUnauthorized)
+	requireStatus(t, api.do("GET", "/api/users/me", changed, nil), http.StatusOK)
+	requireStatus(t, api.do("POST", "/api/refresh", refreshToken, nil), http.StatusOK)
+	requireStatus(t, api.do("POST", "/api/refresh", otherRefreshToken, nil), http.StatusUnauthorized)
+
+	rec := api.do("POST", "/api/login", "", map[string]any{"email": user.Email, "password": testPassword})
+	requireStatus(t, rec, http.StatusUnauthorized)
+	rec = api.do("POST", "/api/login", "", map[string]any{"email": user.Email, "password": newPassword})
+	requireStatus(t, rec, http.StatusOK)
+}
+
+func TestHandlerUserEmailChange(t *testing.T) {
+	api := newTestAPI(t)
+	box := api.useMailbox()
+	user, _ := api.createUser("user@example.com", auth.RoleUploader)
+	api.createUser("taken@example.com", auth.RoleUploader)
+	token, _ := api.login(user.Email)
+	if err := api.db.MarkEmailVerified(user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		status   int
+	}{
+		{"invalid email", "not an email", testPassword, http.StatusBadRequest},
+		{"wrong password", "new@example.com", "wrong", http.StatusUnauthorized},
+		{"taken", "taken@example.com", testPassword, http.StatusConflict},
+		{"changed", "new@example.com", testPassword, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := api.do("PUT", "/api/users/me/email", token, map[string]any{"email": tt.email, "current_password": tt.password})
+			requireStatus(t, rec, tt.status)
+		})
+	}
+
+	// the new address has to be verified again
+	got, err := api.db.GetUser(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Email != "new@example.com" || got.EmailVerifiedAt != nil {
+		t.Errorf("user = %s, verified at %v; want new@example.com, unverified", got.Email, got.EmailVerifiedAt)
+	}
+	verifyToken := box.linkToken(t, "new@example.com", "verify_email")
+	requireStatus(t, api.do("POST", "/api/verify_email", "", map[string]any{"token": verifyToken}), http.StatusNoContent)
+
+	api.login("new@example.com")
+}
+
+func TestHandlerUserDelete(t *testing.T) {
+	api := newTestAPI(t)
+	user, _ := api.createUser("user@example.com", auth.RoleUploader)
+	_, otherToken := api.createUser("other@example.com", auth.RoleUploader)
+	token, refreshToken := api.login(user.Email)
+	video := api.createVideo(token, map[string]any{"title": "Boots"})
+	otherVideo := api.createVideo(otherToken, map[string]any{"title": "Other"})
+
+	requireStatus(t, api.do("DELETE", "/api/users/me", token, map[string]any{"current_password": "wrong"}), http.StatusUnauthorized)
+	requireStatus(t, api.do("DELETE", "/api/users/me", token, map[string]any{"current_password": testPassword}), http.StatusNoContent)
+
+	// the account, its sessions and its videos are gone
+	requireStatus(t, api.do("GET", "/api/users/me", token, nil), http.StatusUnauthorized)
+	requireStatus(t, api.do("POST", "/api/refresh", refreshToken, nil), http.StatusUnauthorized)
+	rec := api.do("POST", "/api/login", "", map[string]any{"email": user.Email, "password": testPassword})
+	requireStatus(t, rec, http.StatusUnauthorized)
+	requireStatus(t, api.do("GET", "/api/videos/"+video.ID.String(), otherToken, nil), http.StatusNotFound)
+
+	// other users' videos are untouched
+	requireStatus(t, api.do("GET", "/api/videos/"+otherVideo.ID.String(), otherToken, nil), http.StatusOK)
+}
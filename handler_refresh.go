@@ -1,15 +1,19 @@
 package main
 
 import (
+	"errors"
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 )
 
 func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 	type response struct {
-		Token string `json:"token"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
 	}
 
 	refreshToken, err := auth.GetBearerToken(r.Header)
@@ -18,16 +22,72 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := cfg.db.GetUserByRefreshToken(refreshToken)
+	storedToken, err := cfg.db.GetRefreshToken(refreshToken)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusUnauthorized, "Invalid refresh token", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get refresh token", err)
+		return
+	}
+
+	if storedToken.RevokedAt != nil {
+		// A rotated token should never be presented again. If it is, either
+		// the client or an attacker holds a stale copy, so end the session.
+		if storedToken.Rotated() {
+			cfg.revokeStolenSession(storedToken)
+		}
+		respondWithError(w, http.StatusUnauthorized, "Refresh token has been revoked", nil)
+		return
+	}
+	if time.Now().UTC().After(storedToken.ExpiresAt) {
+		respondWithError(w, http.StatusUnauthorized, "Refresh token has expired", nil)
+		return
+	}
+
+	user, err := cfg.db.GetUser(storedToken.UserID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get user for refresh token", err)
+		return
+	}
+	if user.DisabledAt != nil {
+		respondWithError(w, http.StatusForbidden, "Account has been disabled", nil)
+		return
+	}
+
+	newRefreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create refresh token", err)
+		return
+	}
+
+	_, err = cfg.db.RotateRefreshToken(refreshToken, database.CreateRefreshTokenParams{
+		Token:     newRefreshToken,
+		UserID:    storedToken.UserID,
+		ExpiresAt: time.Now().UTC().Add(cfg.refreshTokenTTL),
+		FamilyID:  storedToken.FamilyID,
+		UserAgent: r.UserAgent(),
+		IPAddress: clientIP(r),
+	})
+	if errors.Is(err, database.ErrConflict) {
+		// Lost a race with another refresh using the same token. The token
+		// was still current when this request read it, so this is a client
+		// retrying in parallel rather than reuse; only this request fails.
+		respondWithError(w, http.StatusUnauthorized, "Refresh token has been revoked", nil)
+		return
+	}
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't get user for refresh token", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't rotate refresh token", err)
 		return
 	}
 
-	accessToken, err := auth.MakeJWT(
+	accessToken, err := auth.MakeSessionJWT(
 		user.ID,
-		cfg.jwtSecret,
-		time.Hour,
+		storedToken.FamilyID,
+		user.TokenVersion,
+		cfg.jwtKeys,
+		cfg.accessTokenTTL,
 	)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't validate token", err)
@@ -35,10 +95,21 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 	}
 
 	respondWithJSON(w, http.StatusOK, response{
-		Token: accessToken,
+		Token:        accessToken,
+		RefreshToken: newRefreshToken,
 	})
 }
 
+// revokeStolenSession revokes every token in the family of a refresh token
+// that was presented after it had already been rotated.
+func (cfg *apiConfig) revokeStolenSession(rt database.RefreshToken) {
+	log.Printf("Refresh token reuse detected for user %s, revoking token family %s", rt.UserID, rt.FamilyID)
+	err := cfg.db.RevokeRefreshTokenFamily(rt.FamilyID)
+	if err != nil {
+		log.Printf("Couldn't revoke token family %s: %v", rt.FamilyID, err)
+	}
+}
+
 func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 	refreshToken, err := auth.GetBearerToken(r.Header)
 	if err != nil {
@@ -48,7 +119,7 @@ func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 
 	err = cfg.db.RevokeRefreshToken(refreshToken)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke session", err)
+		respondWithStoreError(w, "Couldn't revoke session", err)
 		return
 	}
 
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+type refreshResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func TestHandlerRefreshRejects(t *testing.T) {
+	api := newTestAPI(t)
+	user, _ := api.createUser("user@example.com", auth.RoleUploader)
+	_, loggedOut := api.login(user.Email)
+	requireStatus(t, api.do("POST", "/api/revoke", loggedOut, nil), http.StatusNoContent)
+
+	expired, err := auth.MakeRefreshToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = api.db.CreateRefreshToken(database.CreateRefreshTokenParams{
+		Token:     expired,
+		UserID:    user.ID,
+		ExpiresAt: time.Now().UTC().Add(-time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"no token", "", http.StatusBadRequest},
+		{"unknown token", "not-a-refresh-token", http.StatusUnauthorized},
+		{"logged out", loggedOut, http.StatusUnauthorized},
+		{"expired", expired, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requireStatus(t, api.do("POST", "/api/refresh", tt.token, nil), tt.status)
+		})
+	}
+}
+
+func TestHandlerRefreshRotates(t *testing.T) {
+	api := newTestAPI(t)
+	user, _ := api.createUser("user@example.com", auth.RoleUploader)
+	_, refreshToken := api.login(user.Email)
+
+	rec := api.do("POST", "/api/refresh", refreshToken, nil)
+	requireStatus(t, rec, http.StatusOK)
+	rotated := decodeJSON[refreshResponse](t, rec)
+	if rotated.RefreshToken == "" || rotated.RefreshToken == refreshToken {
+		t.Fatalf("refresh token wasn't rotated: %q", rotated.RefreshToken)
+	}
+	requireStatus(t, api.do("GET", "/api/videos", rotated.Token, nil), http.StatusOK)
+
+	// the replacement keeps working
+	requireStatus(t, api.do("POST", "/api/refresh", rotated.RefreshToken, nil), http.StatusOK)
+}
+
+func TestHandlerRefreshReuseRevokesFamily(t *testing.T) {
+	api := newTestAPI(t)
+	user, _ := api.createUser("user@example.com", auth.RoleUploader)
+	_, stolen := api.login(user.Email)
+	_, otherSession := api.login(user.Email)
+
+	rec := api.do("POST", "/api/refresh", stolen, nil)
+	requireStatus(t, rec, http.StatusOK)
+	rotated := decodeJSON[refreshResponse](t, rec)
+
+	// presenting the rotated token again ends the whole session
+	requireStatus(t, api.do("POST", "/api/refresh", stolen, nil), http.StatusUnauthorized)
+	requireStatus(t, api.do("POST", "/api/refresh", rotated.RefreshToken, nil), http.StatusUnauthorized)
+	requireStatus(t, api.do("GET", "/api/videos", rotated.Token, nil), http.StatusUnauthorized)
+
+	// but not the user's other sessions
+	requireStatus(t, api.do("POST", "/api/refresh", otherSession, nil), http.StatusOK)
+}
+
+// racingStore makes every refresh token rotation lose a race with another
+// rotation of the same token that completes just before it.
+type racingStore struct {
+	*database.MemoryStore
+	winner string
+}
+
+func (s *racingStore) RotateRefreshToken(oldToken string, params database.CreateRefreshTokenParams) (database.RefreshToken, error) {
+	winner := params
+	winner.Token = params.Token + "-winner"
+	_, err := s.MemoryStore.RotateRefreshToken(oldToken, winner)
+	if err != nil {
+		return database.RefreshToken{}, err
+	}
+	s.winner = winner.Token
+	return s.MemoryStore.RotateRefreshToken(oldToken, params)
+}
+
+func TestHandlerRefreshLostRaceKeepsSession(t *testing.T) {
+	api := newTestAPI(t)
+	user, _ := api.createUser("user@example.com", auth.RoleUploader)
+	_, refreshToken := api.login(user.Email)
+
+	store := &racingStore{MemoryStore: api.db}
+	api.cfg.db = store
+	requireStatus(t, api.do("POST", "/api/refresh", refreshToken, nil), http.StatusUnauthorized)
+	api.cfg.db = api.db
+
+	// the request that won the race got a working token
+	requireStatus(t, api.do("POST", "/api/refresh", store.winner, nil), http.StatusOK)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func (cfg *apiConfig) handlerSessionsList(w http.ResponseWriter, r *http.Request) {
+	type session struct {
+		database.Session
+		Current bool `json:"current"`
+	}
+
+	caller := requestPrincipal(r)
+
+	sessions, err := cfg.db.GetSessions(caller.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve sessions", err)
+		return
+	}
+
+	resp := make([]session, 0, len(sessions))
+	for _, s := range sessions {
+		resp = append(resp, session{
+			Session: s,
+			Current: s.ID == caller.SessionID,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+func (cfg *apiConfig) handlerSessionRevoke(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.PathValue("sessionID")
+
+	userID := requestPrincipal(r).UserID
+
+	err := cfg.db.RevokeSession(userID, sessionID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't revoke session", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerSessionsRevokeOthers signs the user out everywhere except the
+// session the request itself was made from.
+func (cfg *apiConfig) handlerSessionsRevokeOthers(w http.ResponseWriter, r *http.Request) {
+	caller := requestPrincipal(r)
+	if caller.SessionID == "" {
+		respondWithError(w, http.StatusBadRequest, "Access token isn't tied to a session", nil)
+		return
+	}
+
+	err := cfg.db.RevokeOtherSessions(caller.UserID, caller.SessionID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke sessions", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// clientIP returns the address of the peer that made the request. Forwarding
+// headers are ignored since they can be set by the client.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
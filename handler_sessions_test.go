@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+)
+
+type sessionResponse struct {
+	ID        string `json:"id"`
+	UserAgent string `json:"user_agent"`
+	IPAddress string `json:"ip_address"`
+	Current   bool   `json:"current"`
+}
+
+// loginFrom logs the user in from a client with the given user agent,
+// returning their access and refresh tokens.
+func (a *testAPI) loginFrom(email, userAgent string) (string, string) {
+	a.t.Helper()
+
+	body := map[string]any{"email": email, "password": testPassword}
+	rec := a.do("POST", "/api/login", "", body, "User-Agent", userAgent)
+	requireStatus(a.t, rec, http.StatusOK)
+	tokens := decodeJSON[refreshResponse](a.t, rec)
+	return tokens.Token, tokens.RefreshToken
+}
+
+func (a *testAPI) sessions(token string) []sessionResponse {
+	a.t.Helper()
+
+	rec := a.do("GET", "/api/sessions", token, nil)
+	requireStatus(a.t, rec, http.StatusOK)
+	return decodeJSON[[]sessionResponse](a.t, rec)
+}
+
+func TestHandlerSessionsList(t *testing.T) {
+	api := newTestAPI(t)
+	user, _ := api.createUser("user@example.com", auth.RoleUploader)
+	laptop, _ := api.loginFrom(user.Email, "laptop")
+	api.loginFrom(user.Email, "phone")
+
+	requireStatus(t, api.do("GET", "/api/sessions", "", nil), http.StatusUnauthorized)
+
+	sessions := api.sessions(laptop)
+	if len(sessions) != 2 {
+		t.Fatalf("%d sessions, want 2", len(sessions))
+	}
+	for _, s := range sessions {
+		if s.IPAddress != "192.0.2.1" {
+			t.Errorf("IPAddress = %q, want the client's", s.IPAddress)
+		}
+		if s.Current != (s.UserAgent == "laptop") {
+			t.Errorf("session from %q has Current = %v", s.UserAgent, s.Current)
+		}
+	}
+}
+
+func TestHandlerSessionRevoke(t *testing.T) {
+	api := newTestAPI(t)
+	user, _ := api.createUser("user@example.com", auth.RoleUploader)
+	other, otherToken := api.createUser("other@example.com", auth.RoleUploader)
+	laptop, _ := api.loginFrom(user.Email, "laptop")
+	_, phoneRefresh := api.loginFrom(user.Email, "phone")
+	api.loginFrom(other.Email, "laptop")
+
+	var phone string
+	for _, s := range api.sessions(laptop) {
+		if s.UserAgent == "phone" {
+			phone = s.ID
+		}
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		id     string
+		status int
+	}{
+		{"anonymous", "", phone, http.StatusUnauthorized},
+		{"unknown session", laptop, "not-a-session", http.StatusNotFound},
+		{"someone else's session", otherToken, phone, http.StatusNotFound},
+		{"revoked", laptop, phone, http.StatusNoContent},
+		{"already revoked", laptop, phone, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requireStatus(t, api.do("DELETE", "/api/sessions/"+tt.id, tt.token, nil), tt.status)
+		})
+	}
+
+	requireStatus(t, api.do("POST", "/api/refresh", phoneRefresh, nil), http.StatusUnauthorized)
+	if sessions := api.sessions(laptop); len(sessions) != 1 || !sessions[0].Current {
+		t.Errorf("sessions = %+v, want only the current one", sessions)
+	}
+}
+
+func TestHandlerSessionsRevokeOthers(t *testing.T) {
+	api := newTestAPI(t)
+	user, token := api.createUser("user@example.com", auth.RoleUploader)
+	laptop, laptopRefresh := api.loginFrom(user.Email, "laptop")
+	_, phoneRefresh := api.loginFrom(user.Email, "phone")
+
+	// a token from outside any login can't say which session to keep
+	requireStatus(t, api.do("DELETE", "/api/sessions", token, nil), http.StatusBadRequest)
+
+	requireStatus(t, api.do("DELETE", "/api/sessions", laptop, nil), http.StatusNoContent)
+	requireStatus(t, api.do("POST", "/api/refresh", phoneRefresh, nil), http.StatusUnauthorized)
+	requireStatus(t, api.do("POST", "/api/refresh", laptopRefresh, nil), http.StatusOK)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// handlerShareLinkCreate makes a link that shares a video the user manages
+// with anyone who has it, optionally until an expiry, for a number of views
+// or behind a password.
+func (cfg *apiConfig) handlerShareLinkCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		ExpiresAt *time.Time `json:"expires_at"`
+		MaxViews  *int64     `json:"max_views"`
+		Password  string     `json:"password"`
+	}
+	type response struct {
+		database.ShareLink
+		// Token and URL are only ever returned here; they can't be
+		// recovered later.
+		Token string `json:"token"`
+		URL   string `json:"url"`
+	}
+
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.ExpiresAt != nil && !params.ExpiresAt.After(time.Now()) {
+		respondWithError(w, http.StatusBadRequest, "Expiry must be in the future", nil)
+		return
+	}
+	if params.MaxViews != nil && *params.MaxViews < 1 {
+		respondWithError(w, http.StatusBadRequest, "Max views must be at least 1", nil)
+		return
+	}
+
+	_, ok := cfg.videoWithRole(w, r, videoID, database.VideoRoleManager, "share")
+	if !ok {
+		return
+	}
+
+	var passwordHash *string
+	if params.Password != "" {
+		hash, err := auth.HashPassword(params.Password)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't hash password", err)
+			return
+		}
+		passwordHash = &hash
+	}
+
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create share link", err)
+		return
+	}
+
+	link, err := cfg.db.CreateShareLink(database.CreateShareLinkParams{
+		VideoID:      videoID,
+		TokenHash:    auth.HashToken(token),
+		PasswordHash: passwordHash,
+		ExpiresAt:    params.ExpiresAt,
+		MaxViews:     params.MaxViews,
+	})
+	if err != nil {
+		respondWithStoreError(w, "Couldn't save share link", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, response{
+		ShareLink: link,
+		Token:     token,
+		URL:       cfg.appURL + "/s/" + token,
+	})
+}
+
+func (cfg *apiConfig) handlerShareLinksList(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	_, ok := cfg.videoWithRole(w, r, videoID, database.VideoRoleManager, "see the share links of")
+	if !ok {
+		return
+	}
+
+	links, err := cfg.db.GetShareLinks(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve share links", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, links)
+}
+
+func (cfg *apiConfig) handlerShareLinkRevoke(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+	shareID, err := uuid.Parse(r.PathValue("shareID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid share link ID", err)
+		return
+	}
+
+	_, ok := cfg.videoWithRole(w, r, videoID, database.VideoRoleManager, "revoke the share links of")
+	if !ok {
+		return
+	}
+
+	err = cfg.db.RevokeShareLink(videoID, shareID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't revoke share link", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerShareLinkView shows the video a share link points at to anyone
+// holding the link, counting the view. Passwords are sent with HTTP Basic
+// auth, so browsers prompt for them; the username is ignored.
+func (cfg *apiConfig) handlerShareLinkView(w http.ResponseWriter, r *http.Request) {
+	link, err := cfg.db.GetShareLinkByHash(auth.HashToken(r.PathValue("token")))
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get share link", err)
+		return
+	}
+	if !link.Usable(time.Now()) {
+		respondWithError(w, http.StatusGone, "Share link is no longer available", nil)
+		return
+	}
+
+	if link.PasswordHash != nil {
+		key := sharePasswordKey(link.ID)
+		if !allowAttempt(w, r, cfg.shareLimiter, key) {
+			return
+		}
+		_, password, ok := r.BasicAuth()
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Shared video"`)
+			respondWithError(w, http.StatusUnauthorized, "Password required", nil)
+			return
+		}
+		match, err := auth.CheckPasswordHash(password, *link.PasswordHash)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't check password", err)
+			return
+		}
+		if !match {
+			_, err := cfg.shareLimiter.Fail(key)
+			if err != nil {
+				log.Printf("Couldn't record share link password failure: %v", err)
+			}
+			w.Header().Set("WWW-Authenticate", `Basic realm="Shared video"`)
+			respondWithError(w, http.StatusUnauthorized, "Incorrect password", nil)
+			return
+		}
+		err = cfg.shareLimiter.Succeed(key)
+		if err != nil {
+			log.Printf("Couldn't record share link password success: %v", err)
+		}
+	}
+
+	err = cfg.db.UseShareLink(link.ID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusGone, "Share link is no longer available", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't record view", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(link.VideoID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get video", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, video)
+}
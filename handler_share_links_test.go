@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// shareLink is the part of a created share link the tests need.
+type shareLink struct {
+	ID    string `json:"id"`
+	Token string `json:"token"`
+}
+
+func (a *testAPI) createShareLink(token string, video database.Video, params map[string]any) shareLink {
+	a.t.Helper()
+
+	rec := a.do("POST", "/api/videos/"+video.ID.String()+"/shares", token, params)
+	requireStatus(a.t, rec, http.StatusCreated)
+	return decodeJSON[shareLink](a.t, rec)
+}
+
+func TestHandlerShareLinkCreate(t *testing.T) {
+	api := newTestAPI(t)
+	_, owner := api.createUser("owner@example.com", auth.RoleUploader)
+	_, other := api.createUser("other@example.com", auth.RoleUploader)
+	video := api.createVideo(owner, map[string]any{"title": "Boots"})
+	path := "/api/videos/" + video.ID.String() + "/shares"
+
+	tests := []struct {
+		name   string
+		token  string
+		body   map[string]any
+		status int
+	}{
+		{"anonymous", "", map[string]any{}, http.StatusUnauthorized},
+		{"other user", other, map[string]any{}, http.StatusForbidden},
+		{"expiry in the past", owner, map[string]any{"expires_at": time.Now().Add(-time.Hour)}, http.StatusBadRequest},
+		{"zero max views", owner, map[string]any{"max_views": 0}, http.StatusBadRequest},
+		{"created", owner, map[string]any{"expires_at": time.Now().Add(time.Hour), "max_views": 5}, http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requireStatus(t, api.do("POST", path, tt.token, tt.body), tt.status)
+		})
+	}
+}
+
+func TestHandlerShareLinkView(t *testing.T) {
+	api := newTestAPI(t)
+	_, owner := api.createUser("owner@example.com", auth.RoleUploader)
+	video := api.createVideo(owner, map[string]any{"title": "Boots"})
+
+	link := api.createShareLink(owner, video, map[string]any{})
+	rec := api.do("GET", "/s/"+link.Token, "", nil)
+	requireStatus(t, rec, http.StatusOK)
+	if got := decodeJSON[database.Video](t, rec); got.ID != video.ID {
+		t.Errorf("viewed video %s, want %s", got.ID, video.ID)
+	}
+
+	requireStatus(t, api.do("GET", "/s/not-a-token", "", nil), http.StatusNotFound)
+}
+
+func TestHandlerShareLinkViewLimit(t *testing.T) {
+	api := newTestAPI(t)
+	_, owner := api.createUser("owner@example.com", auth.RoleUploader)
+	video := api.createVideo(owner, map[string]any{"title": "Boots"})
+
+	link := api.createShareLink(owner, video, map[string]any{"max_views": 2})
+	requireStatus(t, api.do("GET", "/s/"+link.Token, "", nil), http.StatusOK)
+	requireStatus(t, api.do("GET", "/s/"+link.Token, "", nil), http.StatusOK)
+	requireStatus(t, api.do("GET", "/s/"+link.Token, "", nil), http.StatusGone)
+}
+
+func TestHandlerShareLinkViewExpired(t *testing.T) {
+	api := newTestAPI(t)
+	_, owner := api.createUser("owner@example.com", auth.RoleUploader)
+	video := api.createVideo(owner, map[string]any{"title": "Boots"})
+
+	expiresAt := time.Now().Add(-time.Minute)
+	_, err := api.db.CreateShareLink(database.CreateShareLinkParams{
+		VideoID:   video.ID,
+		TokenHash: auth.HashToken("expired-token"),
+		ExpiresAt: &expiresAt,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	requireStatus(t, api.do("GET", "/s/expired-token", "", nil), http.StatusGone)
+}
+
+func TestHandlerShareLinkViewPassword(t *testing.T) {
+	api := newTestAPI(t)
+	_, owner := api.createUser("owner@example.com", auth.RoleUploader)
+	video := api.createVideo(owner, map[string]any{"title": "Boots"})
+	link := api.createShareLink(owner, video, map[string]any{"password": "open sesame"})
+	path := "/s/" + link.Token
+
+	tests := []struct {
+		name     string
+		password string
+		status   int
+	}{
+		{"no password", "", http.StatusUnauthorized},
+		{"wrong password", "wrong", http.StatusUnauthorized},
+		{"right password", "open sesame", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var headers []string
+			if tt.password != "" {
+				credentials := base64.StdEncoding.EncodeToString([]byte("viewer:" + tt.password))
+				headers = []string{"Authorization", "Basic " + credentials}
+			}
+			rec := api.do("GET", path, "", nil, headers...)
+			requireStatus(t, rec, tt.status)
+			if tt.status == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("missing WWW-Authenticate")
+			}
+		})
+	}
+}
+
+func TestHandlerShareLinkRevoke(t *testing.T) {
+	api := newTestAPI(t)
+	_, owner := api.createUser("owner@example.com", auth.RoleUploader)
+	_, other := api.createUser("other@example.com", auth.RoleUploader)
+	video := api.createVideo(owner, map[string]any{"title": "Boots"})
+	link := api.createShareLink(owner, video, map[string]any{})
+	path := "/api/videos/" + video.ID.String() + "/shares/" + link.ID
+
+	requireStatus(t, api.do("DELETE", path, other, nil), http.StatusForbidden)
+	requireStatus(t, api.do("DELETE", path, owner, nil), http.StatusNoContent)
+	requireStatus(t, api.do("GET", "/s/"+link.Token, "", nil), http.StatusGone)
+}
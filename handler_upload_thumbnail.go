@@ -1,22 +1,16 @@
 package main
 
 import (
-	"crypto/rand"
-	"encoding/base64"
 	"fmt"
-	"io"
+	"log"
 	"mime"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strings"
 
-	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 	"github.com/google/uuid"
 )
 
-const maxMemory int64 = 10 << 20
-
 func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Request) {
 	videoIDString := r.PathValue("videoID")
 	videoID, err := uuid.Parse(videoIDString)
@@ -25,46 +19,37 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
-		return
-	}
-
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
-		return
-	}
+	userID := requestPrincipal(r).UserID
 
 	fmt.Println("uploading thumbnail for video", videoID, "by user", userID)
 
-	videoMetadata, err := cfg.db.GetVideo(videoID)
-	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Couldn't find video data", err)
+	videoMetadata, ok := cfg.videoWithRole(w, r, videoID, database.VideoRoleEditor, "change the thumbnail of")
+	if !ok {
 		return
 	}
 
-	// validate that authenticated user owns the video
-	if videoMetadata.CreateVideoParams.UserID != userID {
-		respondWithError(w, http.StatusUnauthorized, "User is not owner of video", nil)
+	// the thumbnail counts against the owner's or organization's quota,
+	// whoever uploads it
+	account, err := cfg.videoAccountFor(videoMetadata)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get usage", err)
 		return
 	}
-
-	err = r.ParseMultipartForm(maxMemory)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Improper form body", err)
+	// the thumbnail being replaced no longer counts once this one is saved
+	storageLeft := account.quota.storageLeft(account.usage, videoMetadata.ThumbnailSize)
+	if storageLeft <= 0 || r.ContentLength > storageLeft {
+		respondWithError(w, http.StatusForbidden, "Thumbnail would exceed your storage quota", nil)
 		return
 	}
 
-	newFile, newFileHeader, err := r.FormFile("thumbnail")
+	newFile, err := formFile(r, "thumbnail")
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, "Couldn't read file data", err)
 		return
 	}
 	defer newFile.Close()
 
-	fileType := newFileHeader.Header.Get("Content-Type")
+	fileType := newFile.Header.Get("Content-Type")
 	if fileType == "" {
 		respondWithError(w, http.StatusBadRequest, "Improper file metadata", nil)
 		return
@@ -76,32 +61,38 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	// read a random name for the new file
-	randBytes := make([]byte, 32)
-	rand.Read(randBytes)
-	newFileName := base64.RawURLEncoding.EncodeToString(randBytes)
-
-	newFilePath := filepath.Join(cfg.assetsRoot, fmt.Sprintf("%s.%s", newFileName, fileExtension))
-
-	newFileCopy, err := os.Create(newFilePath)
+	newURL, size, err := cfg.saveAsset(newFile, fileExtension)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to create local thumbnail file", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to save thumbnail data", err)
+		return
+	}
+	if size > storageLeft {
+		cfg.removeAsset(newURL)
+		respondWithError(w, http.StatusForbidden, "Thumbnail would exceed your storage quota", nil)
 		return
 	}
-	defer newFileCopy.Close()
 
-	_, err = io.Copy(newFileCopy, newFile)
+	oldURL := videoMetadata.ThumbnailURL
+	err = cfg.db.SetVideoThumbnail(videoID, newURL, size)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to save thumbnail data", err)
+		cfg.removeAsset(newURL)
+		respondWithStoreError(w, "Couldn't update video", err)
 		return
 	}
+	if oldURL != nil {
+		err = cfg.removeAsset(*oldURL)
+		if err != nil {
+			log.Printf("Couldn't remove old thumbnail %s: %v", *oldURL, err)
+		}
+	}
 
-	newURL := fmt.Sprintf("http://localhost:%s/assets/%s.%s", cfg.port, newFileName, fileExtension)
-
-	videoMetadata.ThumbnailURL = &newURL
-	cfg.db.UpdateVideo(videoMetadata)
-
-	respondWithJSON(w, http.StatusOK, videoMetadata)
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get video", err)
+		return
+	}
+	w.Header().Set("ETag", videoETag(video))
+	respondWithJSON(w, http.StatusOK, video)
 }
 
 /*
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestHandlerUploadThumbnail(t *testing.T) {
+	api := newTestAPI(t)
+	_, owner := api.createUser("owner@example.com", auth.RoleUploader)
+	_, other := api.createUser("other@example.com", auth.RoleUploader)
+	video := api.createVideo(owner, map[string]any{"title": "Boots"})
+	path := "/api/thumbnail_upload/" + video.ID.String()
+
+	tests := []struct {
+		name        string
+		token       string
+		path        string
+		contentType string
+		status      int
+	}{
+		{"anonymous", "", path, "image/png", http.StatusUnauthorized},
+		{"other user", other, path, "image/png", http.StatusForbidden},
+		{"unknown video", owner, "/api/thumbnail_upload/" + uuid.NewString(), "image/png", http.StatusNotFound},
+		{"not an image", owner, path, "text/plain", http.StatusBadRequest},
+		{"uploaded", owner, path, "image/png", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, contentType := multipartFile(t, "thumbnail", tt.contentType, []byte("image data"))
+			rec := api.do("POST", tt.path, tt.token, body, "Content-Type", contentType)
+			requireStatus(t, rec, tt.status)
+		})
+	}
+}
+
+func TestHandlerUploadThumbnailRespondsWithStoredVideo(t *testing.T) {
+	api := newTestAPI(t)
+	_, token := api.createUser("owner@example.com", auth.RoleUploader)
+	video := api.createVideo(token, map[string]any{"title": "Boots"})
+
+	body, contentType := multipartFile(t, "thumbnail", "image/png", []byte("image data"))
+	rec := api.do("POST", "/api/thumbnail_upload/"+video.ID.String(), token, body, "Content-Type", contentType)
+	requireStatus(t, rec, http.StatusOK)
+	got := decodeJSON[database.Video](t, rec)
+
+	stored, err := api.db.GetVideo(video.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ThumbnailURL == nil || stored.ThumbnailURL == nil || *got.ThumbnailURL != *stored.ThumbnailURL {
+		t.Errorf("ThumbnailURL = %v, stored %v", got.ThumbnailURL, stored.ThumbnailURL)
+	}
+	if etag := rec.Header().Get("ETag"); etag != videoETag(stored) {
+		t.Errorf("ETag = %q, want %q", etag, videoETag(stored))
+	}
+}
+
+// staleReadStore finishes a video upload straight after the first read of
+// the video, as if it completed while the request was in flight.
+type staleReadStore struct {
+	*database.MemoryStore
+	file database.RecordUploadParams
+	done bool
+}
+
+func (s *staleReadStore) GetVideo(id uuid.UUID) (database.Video, error) {
+	video, err := s.MemoryStore.GetVideo(id)
+	if err == nil && !s.done {
+		s.done = true
+		s.file.VideoID = id
+		err = s.MemoryStore.RecordUpload(s.file)
+	}
+	return video, err
+}
+
+func TestHandlerUploadThumbnailKeepsConcurrentUpload(t *testing.T) {
+	api := newTestAPI(t)
+	_, token := api.createUser("owner@example.com", auth.RoleUploader)
+	video := api.createVideo(token, map[string]any{"title": "Boots"})
+	api.cfg.db = &staleReadStore{
+		MemoryStore: api.db,
+		file: database.RecordUploadParams{
+			UserID:          video.UserID,
+			URL:             "https://cdn.example.com/video.mp4",
+			Size:            100,
+			StorageLimit:    -1,
+			UploadTimeLimit: -1,
+		},
+	}
+
+	body, contentType := multipartFile(t, "thumbnail", "image/png", []byte("image data"))
+	rec := api.do("POST", "/api/thumbnail_upload/"+video.ID.String(), token, body, "Content-Type", contentType)
+	requireStatus(t, rec, http.StatusOK)
+
+	stored, err := api.db.GetVideo(video.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.VideoURL == nil || stored.VideoSize != 100 {
+		t.Errorf("concurrent upload undone: VideoURL %v, VideoSize %d", stored.VideoURL, stored.VideoSize)
+	}
+	if stored.ThumbnailURL == nil {
+		t.Error("thumbnail not saved")
+	}
+}
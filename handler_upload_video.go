@@ -3,92 +3,133 @@ package main
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"mime"
 	"net/http"
 	"os"
+	"time"
 
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/content"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 	"github.com/google/uuid"
 )
 
-const maxUploadSize int64 = 1 << 30 // 1 GB
-
 func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request) {
-	_ = http.MaxBytesReader(w, r.Body, maxUploadSize) // not sure if this is correct
-
 	videoID, err := uuid.Parse(r.PathValue("videoID"))
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
 		return
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "unable to find JWT", err)
+	userID := requestPrincipal(r).UserID
+
+	videoMetadata, ok := cfg.videoWithRole(w, r, videoID, database.VideoRoleManager, "upload the file of")
+	if !ok {
 		return
 	}
 
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	// the file counts against the owner's or organization's limits and
+	// quota, whoever uploads it
+	account, err := cfg.videoAccountFor(videoMetadata)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Unable to validate JWT", err)
+		respondWithStoreError(w, "Couldn't get usage", err)
 		return
 	}
-
-	videoMetadata, err := cfg.db.GetVideo(videoID)
-	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Unable to find video data", err)
+	limit := account.uploadLimit
+	if videoMetadata.OrganizationID != nil {
+		// the uploader's own limit still applies to organization videos
+		uploader, err := cfg.db.GetUser(userID)
+		if err != nil {
+			respondWithStoreError(w, "Couldn't get user", err)
+			return
+		}
+		limit = min(limit, cfg.uploadLimit(*uploader))
+	}
+	if r.ContentLength > limit {
+		respondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Video is larger than your %s upload limit", formatBytes(limit)), nil)
 		return
 	}
+	setBodyLimit(w, r, limit)
 
-	// validate that authenticated user owns the video object
-	if videoMetadata.CreateVideoParams.UserID != userID {
-		respondWithError(w, http.StatusUnauthorized, "User is not owner of video", nil)
+	quota, usage := account.quota, account.usage
+	if quota.uploadTimeLeft(usage) <= 0 {
+		respondWithError(w, http.StatusForbidden, "You've used this month's upload minutes", nil)
+		return
+	}
+	// the video file being replaced no longer counts once this one is stored
+	storageLeft := quota.storageLeft(usage, videoMetadata.VideoSize)
+	if storageLeft <= 0 || r.ContentLength > storageLeft {
+		respondWithError(w, http.StatusForbidden, "Video would exceed your storage quota", nil)
 		return
 	}
 
 	fmt.Println("uploading video", videoID, "by user", userID)
 
-	err = r.ParseMultipartForm(maxUploadSize)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Improper form body", err)
-		return
+	report := cfg.newUploadReporter(videoID)
+	processing := false
+	fail := func(code int, msg string, err error) {
+		report.fail(msg)
+		if processing {
+			// a failed replacement leaves the previous file playable
+			status := database.VideoStatusFailed
+			if videoMetadata.VideoURL != nil {
+				status = database.VideoStatusReady
+			}
+			statusErr := cfg.db.SetVideoStatus(videoID, status)
+			if statusErr != nil {
+				log.Printf("Couldn't reset status of video %s: %v", videoID, statusErr)
+			}
+		}
+		respondWithError(w, code, msg, err)
 	}
 
-	newFile, newFileHeader, err := r.FormFile("video")
+	newFile, err := formFile(r, "video")
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Unable to read file data", err)
+		fail(http.StatusBadRequest, "Unable to read file data", err)
 		return
 	}
 	defer newFile.Close()
 
-	fileType := newFileHeader.Header.Get("Content-Type")
+	fileType := newFile.Header.Get("Content-Type")
 	if fileType == "" {
-		respondWithError(w, http.StatusBadRequest, "Improper file metadata", nil)
+		fail(http.StatusBadRequest, "Improper file metadata", nil)
 		return
 	}
 
 	err = readVideoContentType(fileType)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid file metadata", err)
+		fail(http.StatusBadRequest, "Invalid file metadata", err)
 		return
 	}
 	var fileExtension string = "mp4"
 
+	err = cfg.db.SetVideoStatus(videoID, database.VideoStatusProcessing)
+	if err != nil {
+		fail(http.StatusInternalServerError, "Couldn't update video", err)
+		return
+	}
+	processing = true
+
 	tempFile, err := os.CreateTemp("", fmt.Sprintf("tubely_upload_*.%s", fileExtension))
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to create server-side temp file", err)
+		fail(http.StatusInternalServerError, "Failed to create server-side temp file", err)
 		return
 	}
 	defer os.Remove(tempFile.Name())
 	// defer tempFile.Close() // Closed explicitly after data is copied in
 
-	_, err = io.Copy(tempFile, newFile)
+	received := &progressReader{
+		r: newFile,
+		report: func(read int64) {
+			report.received(read, max(r.ContentLength, 0))
+		},
+	}
+	_, err = io.Copy(tempFile, received)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to upload file", err)
+		fail(http.StatusInternalServerError, "Failed to upload file", err)
 		return
 	}
 	// tempFile.Seek(0, io.SeekStart) // resets file pointer to beginning for reading
@@ -97,10 +138,27 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 	// but ffmpeg will when it does preprocessing
 	tempFile.Close()
 
+	// needed to count upload minutes, but otherwise only used to show
+	// progress, so carry on without it when minutes are unlimited
+	duration, err := content.GetVideoDuration(tempFile.Name())
+	if err != nil {
+		if quota.UploadMinutes >= 0 {
+			fail(http.StatusBadRequest, "Couldn't read video duration", err)
+			return
+		}
+		log.Printf("Couldn't read duration of %s: %v", tempFile.Name(), err)
+	}
+	if duration > quota.uploadTimeLeft(usage) {
+		fail(http.StatusForbidden, "Video is longer than your remaining upload minutes this month", nil)
+		return
+	}
+
 	// Moves the "moov" atom to the front of the video file, for faster streaming start
-	processedTempFilePath, err := content.ProcessVideoForFastStart(tempFile.Name())
+	processedTempFilePath, err := content.ProcessVideoForFastStartWithProgress(tempFile.Name(), func(done time.Duration) {
+		report.processed(done, duration)
+	})
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to preprocess video", err)
+		fail(http.StatusInternalServerError, "Failed to preprocess video", err)
 		return
 	}
 	defer os.Remove(processedTempFilePath)
@@ -108,44 +166,93 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 	// prefix will be "landscape", "portrait", or "other" if no error
 	newFilePrefix, err := content.GetVideoAspectRatio(processedTempFilePath)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to read video aspect ratio", err)
+		fail(http.StatusInternalServerError, "Failed to read video aspect ratio", err)
 		return
 	}
 
 	processedTempFile, err := os.Open(processedTempFilePath)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to open preprocessed video file", err)
+		fail(http.StatusInternalServerError, "Failed to open preprocessed video file", err)
 		return
 	}
 	defer processedTempFile.Close()
 
+	processedInfo, err := processedTempFile.Stat()
+	if err != nil {
+		fail(http.StatusInternalServerError, "Failed to read preprocessed video file", err)
+		return
+	}
+	if processedInfo.Size() > storageLeft {
+		fail(http.StatusForbidden, "Video would exceed your storage quota", nil)
+		return
+	}
+
 	// read a random name for the new file
 	randBytes := make([]byte, 32)
 	rand.Read(randBytes)
 	newFileName := base64.RawURLEncoding.EncodeToString(randBytes)
 
 	newFileKey := fmt.Sprintf("%s/%s.%s", newFilePrefix, newFileName, fileExtension)
-	contentMimeType := fmt.Sprintf("video/%s", fileExtension)
-
-	putObjectInput := s3.PutObjectInput{
-		Bucket:      &cfg.s3Bucket,
-		Key:         &newFileKey,
-		Body:        processedTempFile,
-		ContentType: &contentMimeType,
+	if account.keyPrefix != "" {
+		newFileKey = account.keyPrefix + "/" + newFileKey
 	}
+	contentMimeType := fmt.Sprintf("video/%s", fileExtension)
 
-	_, err = cfg.s3Client.PutObject(r.Context(), &putObjectInput)
+	err = cfg.putLargeObject(r.Context(), newFileKey, contentMimeType, processedTempFile, report.stored)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to store video file", err)
+		fail(http.StatusInternalServerError, "Failed to store video file", err)
 		return
 	}
 
 	// newURL := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", cfg.s3Bucket, cfg.s3Region, newFileKey)
 	newURL := fmt.Sprintf("%s/%s", cfg.s3CfDistribution, newFileKey)
-	videoMetadata.VideoURL = &newURL
-	cfg.db.UpdateVideo(videoMetadata)
+	// checked again here, as other uploads may have used up the quota
+	// while this one was being processed
+	err = cfg.db.RecordUpload(database.RecordUploadParams{
+		UserID:          videoMetadata.UserID,
+		OrganizationID:  videoMetadata.OrganizationID,
+		VideoID:         videoID,
+		URL:             newURL,
+		Size:            processedInfo.Size(),
+		Orientation:     newFilePrefix,
+		Duration:        duration,
+		StorageLimit:    quota.StorageBytes,
+		UploadTimeLimit: quota.uploadTimeLimit(),
+		Since:           usagePeriodStart(time.Now()),
+	})
+	if errors.Is(err, database.ErrQuotaExceeded) {
+		cfg.removeVideoObject(r.Context(), newURL)
+		fail(http.StatusForbidden, "Video would exceed your quota", err)
+		return
+	}
+	if err != nil {
+		cfg.removeVideoObject(r.Context(), newURL)
+		fail(http.StatusInternalServerError, "Couldn't update video", err)
+		return
+	}
+	if oldURL := videoMetadata.VideoURL; oldURL != nil {
+		err = cfg.removeVideoObject(r.Context(), *oldURL)
+		if err != nil {
+			log.Printf("Couldn't remove old video object %s: %v", *oldURL, err)
+		}
+	}
+
+	report.complete()
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get video", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, video)
+}
 
-	respondWithJSON(w, http.StatusOK, videoMetadata)
+// uploadLimit is the largest video upload, in bytes, the user may make.
+func (cfg *apiConfig) uploadLimit(user database.User) int64 {
+	if user.MaxUploadSize != nil {
+		return *user.MaxUploadSize
+	}
+	return cfg.maxUploadSize
 }
 
 /*
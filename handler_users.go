@@ -2,7 +2,9 @@ package main
 
 import (
 	"encoding/json"
+	"log"
 	"net/http"
+	"net/mail"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
@@ -27,20 +29,48 @@ func (cfg *apiConfig) handlerUsersCreate(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if !validEmail(params.Email) {
+		respondWithError(w, http.StatusBadRequest, "Invalid email address", nil)
+		return
+	}
+
+	if !allowAttempt(w, r, cfg.signupLimiter, signupIPKey(r)) {
+		return
+	}
+
 	hashedPassword, err := auth.HashPassword(params.Password)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't hash password", err)
 		return
 	}
 
+	role := auth.RoleUploader
+	if cfg.adminEmails[params.Email] {
+		role = auth.RoleAdmin
+	}
+
 	user, err := cfg.db.CreateUser(database.CreateUserParams{
 		Email:    params.Email,
 		Password: hashedPassword,
+		Role:     string(role),
 	})
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't create user", err)
+		respondWithStoreError(w, "Couldn't create user", err)
 		return
 	}
 
+	err = cfg.sendVerificationEmail(r.Context(), *user)
+	if err != nil {
+		// the user can ask for another link, so don't fail the signup
+		log.Printf("Couldn't send verification email to %s: %v", user.Email, err)
+	}
+
 	respondWithJSON(w, http.StatusCreated, user)
 }
+
+// validEmail reports whether email is a bare address such as
+// "user@example.com", without a display name.
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
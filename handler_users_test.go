@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+)
+
+func TestHandlerUsersCreate(t *testing.T) {
+	api := newTestAPI(t)
+	api.createUser("taken@example.com", auth.RoleUploader)
+
+	tests := []struct {
+		name   string
+		body   map[string]any
+		status int
+	}{
+		{"missing password", map[string]any{"email": "new@example.com"}, http.StatusBadRequest},
+		{"missing email", map[string]any{"password": testPassword}, http.StatusBadRequest},
+		{"email taken", map[string]any{"email": "taken@example.com", "password": testPassword}, http.StatusConflict},
+		{"created", map[string]any{"email": "new@example.com", "password": testPassword}, http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requireStatus(t, api.do("POST", "/api/users", "", tt.body), tt.status)
+		})
+	}
+}
+
+func TestHandlerLogin(t *testing.T) {
+	api := newTestAPI(t)
+	user, _ := api.createUser("user@example.com", auth.RoleUploader)
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		status   int
+	}{
+		{"unknown email", "nobody@example.com", testPassword, http.StatusUnauthorized},
+		{"wrong password", user.Email, "wrong", http.StatusUnauthorized},
+		{"logged in", user.Email, testPassword, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := api.do("POST", "/api/login", "", map[string]any{"email": tt.email, "password": tt.password})
+			requireStatus(t, rec, tt.status)
+		})
+	}
+
+	// the access token from a login works on authenticated routes
+	rec := api.do("POST", "/api/login", "", map[string]any{"email": user.Email, "password": testPassword})
+	tokens := decodeJSON[struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}](t, rec)
+	if tokens.Token == "" || tokens.RefreshToken == "" {
+		t.Fatalf("login response lacks tokens: %s", rec.Body.String())
+	}
+	requireStatus(t, api.do("GET", "/api/videos", tokens.Token, nil), http.StatusOK)
+}
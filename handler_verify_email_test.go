@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestHandlerVerifyEmail(t *testing.T) {
+	api := newTestAPI(t)
+	box := api.useMailbox()
+
+	rec := api.do("POST", "/api/users", "", map[string]any{"email": "user@example.com", "password": testPassword})
+	requireStatus(t, rec, http.StatusCreated)
+	user := decodeJSON[database.User](t, rec)
+	token := box.linkToken(t, user.Email, "verify_email")
+
+	verified := func() bool {
+		t.Helper()
+		got, err := api.db.GetUser(user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got.EmailVerifiedAt != nil
+	}
+	if verified() {
+		t.Fatal("new user's email is already verified")
+	}
+
+	requireStatus(t, api.do("POST", "/api/verify_email", "", map[string]any{"token": token}), http.StatusNoContent)
+	if !verified() {
+		t.Error("email not verified")
+	}
+
+	// the link only works once
+	requireStatus(t, api.do("POST", "/api/verify_email", "", map[string]any{"token": token}), http.StatusBadRequest)
+}
+
+func TestHandlerVerifyEmailRejects(t *testing.T) {
+	api := newTestAPI(t)
+	user, _ := api.createUser("user@example.com", auth.RoleUploader)
+
+	expired, err := auth.MakeRefreshToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = api.db.CreateUserToken(database.CreateUserTokenParams{
+		TokenHash: auth.HashToken(expired),
+		UserID:    user.ID,
+		Purpose:   database.TokenPurposeVerifyEmail,
+		ExpiresAt: time.Now().Add(-time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	box := api.useMailbox()
+	requireStatus(t, api.do("POST", "/api/password_reset", "", map[string]any{"email": user.Email}), http.StatusAccepted)
+	resetToken := box.linkToken(t, user.Email, "reset_password")
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"unknown", "not-a-token"},
+		{"expired", expired},
+		{"issued for a password reset", resetToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := api.do("POST", "/api/verify_email", "", map[string]any{"token": tt.token})
+			requireStatus(t, rec, http.StatusBadRequest)
+		})
+	}
+}
+
+func TestHandlerVerifyEmailResend(t *testing.T) {
+	api := newTestAPI(t)
+	box := api.useMailbox()
+	user, _ := api.createUser("user@example.com", auth.RoleUploader)
+
+	requireStatus(t, api.do("POST", "/api/verify_email/resend", "", map[string]any{"email": user.Email}), http.StatusAccepted)
+	first := box.linkToken(t, user.Email, "verify_email")
+	requireStatus(t, api.do("POST", "/api/verify_email/resend", "", map[string]any{"email": user.Email}), http.StatusAccepted)
+	second := box.linkToken(t, user.Email, "verify_email")
+
+	// only the latest link works
+	requireStatus(t, api.do("POST", "/api/verify_email", "", map[string]any{"token": first}), http.StatusBadRequest)
+	requireStatus(t, api.do("POST", "/api/verify_email", "", map[string]any{"token": second}), http.StatusNoContent)
+
+	// unknown and verified addresses get the same response but no email
+	sent := len(box.messages)
+	requireStatus(t, api.do("POST", "/api/verify_email/resend", "", map[string]any{"email": "nobody@example.com"}), http.StatusAccepted)
+	requireStatus(t, api.do("POST", "/api/verify_email/resend", "", map[string]any{"email": user.Email}), http.StatusAccepted)
+	if len(box.messages) != sent {
+		t.Errorf("sent %d more emails, want none", len(box.messages)-sent)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// handlerVideoCollaboratorsList lists the users given a role on the video.
+func (cfg *apiConfig) handlerVideoCollaboratorsList(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	_, ok := cfg.videoWithRole(w, r, videoID, database.VideoRoleManager, "see the collaborators of")
+	if !ok {
+		return
+	}
+
+	permissions, err := cfg.db.GetVideoPermissions(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve collaborators", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, permissions)
+}
+
+// handlerVideoCollaboratorAdd gives the user with an email a role on the
+// video.
+func (cfg *apiConfig) handlerVideoCollaboratorAdd(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if !validVideoRole(params.Role) {
+		respondWithError(w, http.StatusBadRequest, videoRoleProblem, nil)
+		return
+	}
+
+	video, ok := cfg.videoWithRole(w, r, videoID, database.VideoRoleManager, "add collaborators to")
+	if !ok {
+		return
+	}
+
+	user, err := cfg.db.GetUserByEmail(strings.TrimSpace(params.Email))
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusBadRequest, "No user has that email", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	if user.ID == video.UserID && video.OrganizationID == nil {
+		respondWithError(w, http.StatusBadRequest, "The owner can already do everything", nil)
+		return
+	}
+
+	_, err = cfg.db.GetVideoPermission(videoID, user.ID)
+	if err == nil {
+		respondWithError(w, http.StatusConflict, "User is already a collaborator", nil)
+		return
+	}
+	if !errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check collaborators", err)
+		return
+	}
+
+	permission, err := cfg.db.SetVideoPermission(videoID, user.ID, params.Role)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't add collaborator", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, permission)
+}
+
+// handlerVideoCollaboratorUpdate changes a collaborator's role.
+func (cfg *apiConfig) handlerVideoCollaboratorUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Role string `json:"role"`
+	}
+
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if !validVideoRole(params.Role) {
+		respondWithError(w, http.StatusBadRequest, videoRoleProblem, nil)
+		return
+	}
+
+	_, ok := cfg.videoWithRole(w, r, videoID, database.VideoRoleManager, "change the collaborators of")
+	if !ok {
+		return
+	}
+
+	_, err = cfg.db.GetVideoPermission(videoID, userID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get collaborator", err)
+		return
+	}
+
+	permission, err := cfg.db.SetVideoPermission(videoID, userID, params.Role)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't update collaborator", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, permission)
+}
+
+// handlerVideoCollaboratorRemove takes away a collaborator's role. Managers
+// can remove anyone, and collaborators can remove themselves.
+func (cfg *apiConfig) handlerVideoCollaboratorRemove(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	if userID != requestPrincipal(r).UserID {
+		_, ok := cfg.videoWithRole(w, r, videoID, database.VideoRoleManager, "remove collaborators from")
+		if !ok {
+			return
+		}
+	}
+
+	err = cfg.db.DeleteVideoPermission(videoID, userID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't remove collaborator", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerSharedVideosList lists the videos other users have given the
+// caller a role on.
+func (cfg *apiConfig) handlerSharedVideosList(w http.ResponseWriter, r *http.Request) {
+	videos, err := cfg.db.GetSharedVideos(requestPrincipal(r).UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, videos)
+}
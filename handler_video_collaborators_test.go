@@ -0,0 +1,133 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestVideoCollaboratorRoles(t *testing.T) {
+	api := newTestAPI(t)
+	_, owner := api.createUser("owner@example.com", auth.RoleUploader)
+	_, stranger := api.createUser("stranger@example.com", auth.RoleUploader)
+	roles := []string{database.VideoRoleViewer, database.VideoRoleEditor, database.VideoRoleManager}
+	tokens := map[string]string{"owner": owner, "stranger": stranger}
+	users := map[string]database.User{}
+	for _, role := range roles {
+		users[role], tokens[role] = api.createUser(role+"@example.com", auth.RoleUploader)
+	}
+
+	// sharedVideo is a new private video with a collaborator in each role.
+	sharedVideo := func() database.Video {
+		video := api.createVideo(owner, map[string]any{"title": "Boots"})
+		for _, role := range roles {
+			_, err := api.db.SetVideoPermission(video.ID, users[role].ID, role)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		return video
+	}
+	thumbnail, thumbnailType := multipartFile(t, "thumbnail", "image/png", []byte("image data"))
+
+	tests := []struct {
+		name    string
+		request func(token string, video database.Video) int
+		want    map[string]int
+	}{
+		{
+			"view",
+			func(token string, video database.Video) int {
+				return api.do("GET", "/api/videos/"+video.ID.String(), token, nil).Code
+			},
+			map[string]int{"stranger": 404, "viewer": 200, "editor": 200, "manager": 200, "owner": 200},
+		},
+		{
+			"edit title",
+			func(token string, video database.Video) int {
+				return api.do("PATCH", "/api/videos/"+video.ID.String(), token, map[string]any{"title": "Renamed"}).Code
+			},
+			map[string]int{"stranger": 403, "viewer": 403, "editor": 200, "manager": 200, "owner": 200},
+		},
+		{
+			"change thumbnail",
+			func(token string, video database.Video) int {
+				return api.do("POST", "/api/thumbnail_upload/"+video.ID.String(), token, thumbnail, "Content-Type", thumbnailType).Code
+			},
+			map[string]int{"stranger": 403, "viewer": 403, "editor": 200, "manager": 200, "owner": 200},
+		},
+		{
+			"change visibility",
+			func(token string, video database.Video) int {
+				return api.do("PATCH", "/api/videos/"+video.ID.String(), token, map[string]any{"visibility": database.VisibilityPublic}).Code
+			},
+			map[string]int{"stranger": 403, "viewer": 403, "editor": 403, "manager": 200, "owner": 200},
+		},
+		{
+			"create share link",
+			func(token string, video database.Video) int {
+				return api.do("POST", "/api/videos/"+video.ID.String()+"/shares", token, map[string]any{}).Code
+			},
+			map[string]int{"stranger": 403, "viewer": 403, "editor": 403, "manager": 201, "owner": 201},
+		},
+		{
+			"list collaborators",
+			func(token string, video database.Video) int {
+				return api.do("GET", "/api/videos/"+video.ID.String()+"/collaborators", token, nil).Code
+			},
+			map[string]int{"stranger": 403, "viewer": 403, "editor": 403, "manager": 200, "owner": 200},
+		},
+		{
+			"delete",
+			func(token string, video database.Video) int {
+				return api.do("DELETE", "/api/videos/"+video.ID.String(), token, nil).Code
+			},
+			map[string]int{"stranger": 403, "viewer": 403, "editor": 403, "manager": 204, "owner": 204},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for who, want := range tt.want {
+				if got := tt.request(tokens[who], sharedVideo()); got != want {
+					t.Errorf("%s: status = %d, want %d", who, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestHandlerVideoCollaboratorAdd(t *testing.T) {
+	api := newTestAPI(t)
+	ownerUser, owner := api.createUser("owner@example.com", auth.RoleUploader)
+	editorUser, editor := api.createUser("editor@example.com", auth.RoleUploader)
+	other, _ := api.createUser("other@example.com", auth.RoleUploader)
+	video := api.createVideo(owner, map[string]any{"title": "Boots"})
+	path := "/api/videos/" + video.ID.String() + "/collaborators"
+	requireStatus(t, api.do("POST", path, owner, map[string]any{"email": editorUser.Email, "role": "editor"}), http.StatusCreated)
+
+	tests := []struct {
+		name   string
+		token  string
+		body   map[string]any
+		status int
+	}{
+		{"unknown role", owner, map[string]any{"email": other.Email, "role": "owner"}, http.StatusBadRequest},
+		{"unknown email", owner, map[string]any{"email": "nobody@example.com", "role": "viewer"}, http.StatusBadRequest},
+		{"the owner", owner, map[string]any{"email": ownerUser.Email, "role": "viewer"}, http.StatusBadRequest},
+		{"already a collaborator", owner, map[string]any{"email": editorUser.Email, "role": "viewer"}, http.StatusConflict},
+		{"editor can't add", editor, map[string]any{"email": other.Email, "role": "viewer"}, http.StatusForbidden},
+		{"added", owner, map[string]any{"email": other.Email, "role": "viewer"}, http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requireStatus(t, api.do("POST", path, tt.token, tt.body), tt.status)
+		})
+	}
+
+	// removing a collaborator takes their access away
+	requireStatus(t, api.do("GET", "/api/videos/"+video.ID.String(), editor, nil), http.StatusOK)
+	requireStatus(t, api.do("DELETE", path+"/"+editorUser.ID.String(), owner, nil), http.StatusNoContent)
+	requireStatus(t, api.do("GET", "/api/videos/"+video.ID.String(), editor, nil), http.StatusNotFound)
+}
@@ -2,37 +2,65 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 
-	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 	"github.com/google/uuid"
 )
 
+const (
+	maxVideoTitleLength       = 200
+	maxVideoDescriptionLength = 5000
+)
+
 func (cfg *apiConfig) handlerVideoMetaCreate(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
 		database.CreateVideoParams
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
+	userID := requestPrincipal(r).UserID
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
 		return
 	}
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+	params.UserID = userID
+	if params.Visibility == "" {
+		params.Visibility = database.VisibilityPrivate
+	}
+
+	if problem := videoMetaProblem(params.Title, params.Description); problem != "" {
+		respondWithError(w, http.StatusBadRequest, problem, nil)
+		return
+	}
+	if !validVisibility(params.Visibility) {
+		respondWithError(w, http.StatusBadRequest, visibilityProblem, nil)
 		return
 	}
 
-	decoder := json.NewDecoder(r.Body)
-	params := parameters{}
-	err = decoder.Decode(&params)
+	// new videos go in the organization the caller is working in
+	params.OrganizationID, err = cfg.activeOrganization(userID)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+		respondWithStoreError(w, "Couldn't get user", err)
+		return
+	}
+	account, err := cfg.accountFor(userID, params.OrganizationID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get usage", err)
+		return
+	}
+	if account.quota.videosLeft(account.usage) <= 0 {
+		respondWithError(w, http.StatusForbidden, "You've reached your video limit", nil)
 		return
 	}
-	params.UserID = userID
 
 	video, err := cfg.db.CreateVideo(params.CreateVideoParams)
 	if err != nil {
@@ -40,81 +68,176 @@ func (cfg *apiConfig) handlerVideoMetaCreate(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	w.Header().Set("ETag", videoETag(video))
 	respondWithJSON(w, http.StatusCreated, video)
 }
 
-func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Request) {
-	videoIDString := r.PathValue("videoID")
-	videoID, err := uuid.Parse(videoIDString)
+// handlerVideoMetaUpdate changes a video's title, description and
+// visibility. Fields left out of the request are left unchanged. When
+// If-Match is sent the update only goes through if the video hasn't changed
+// since the client fetched it.
+func (cfg *apiConfig) handlerVideoMetaUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Title       *string `json:"title"`
+		Description *string `json:"description"`
+		Visibility  *string `json:"visibility"`
+	}
+
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
 		return
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
 		return
 	}
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+
+	video, ok := cfg.videoWithRole(w, r, videoID, database.VideoRoleEditor, "edit")
+	if !ok {
 		return
 	}
+	// changing who can see the video is sharing it
+	if params.Visibility != nil && *params.Visibility != video.Visibility {
+		_, ok = cfg.videoWithRole(w, r, videoID, database.VideoRoleManager, "change the visibility of")
+		if !ok {
+			return
+		}
+	}
 
-	video, err := cfg.db.GetVideo(videoID)
-	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch != "" && !etagMatches(ifMatch, videoETag(video)) {
+		respondWithError(w, http.StatusPreconditionFailed, "Video has changed since it was fetched", nil)
+		return
+	}
+
+	title, description := video.Title, video.Description
+	if params.Title != nil {
+		title = *params.Title
+	}
+	if params.Description != nil {
+		description = *params.Description
+	}
+	if problem := videoMetaProblem(title, description); problem != "" {
+		respondWithError(w, http.StatusBadRequest, problem, nil)
 		return
 	}
-	if video.UserID != userID {
-		respondWithError(w, http.StatusForbidden, "You can't delete this video", err)
+	if params.Visibility != nil && !validVisibility(*params.Visibility) {
+		respondWithError(w, http.StatusBadRequest, visibilityProblem, nil)
 		return
 	}
 
-	err = cfg.db.DeleteVideo(videoID)
+	update := database.UpdateVideoMetaParams{
+		Title:       params.Title,
+		Description: params.Description,
+		Visibility:  params.Visibility,
+	}
+	if ifMatch != "" {
+		update.UnmodifiedSince = &video.UpdatedAt
+	}
+	err = cfg.db.UpdateVideoMeta(videoID, update)
+	if errors.Is(err, database.ErrModified) {
+		respondWithError(w, http.StatusPreconditionFailed, "Video has changed since it was fetched", err)
+		return
+	}
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't delete video", err)
+		respondWithStoreError(w, "Couldn't update video", err)
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	video, err = cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get video", err)
+		return
+	}
+
+	w.Header().Set("ETag", videoETag(video))
+	respondWithJSON(w, http.StatusOK, video)
 }
 
-func (cfg *apiConfig) handlerVideoGet(w http.ResponseWriter, r *http.Request) {
+// videoMetaProblem describes what's wrong with a video's title or
+// description, or returns "" if they're fine.
+func videoMetaProblem(title, description string) string {
+	if strings.TrimSpace(title) == "" {
+		return "Title is required"
+	}
+	if utf8.RuneCountInString(title) > maxVideoTitleLength {
+		return "Title is too long"
+	}
+	if utf8.RuneCountInString(description) > maxVideoDescriptionLength {
+		return "Description is too long"
+	}
+	return ""
+}
+
+// videoETag is the video's version, which changes whenever it's updated.
+func videoETag(video database.Video) string {
+	return fmt.Sprintf(`"%s"`, strconv.FormatInt(video.UpdatedAt.UnixNano(), 36))
+}
+
+// etagMatches reports whether an If-Match header matches etag, using the
+// strong comparison RFC 9110 requires for If-Match.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Request) {
 	videoIDString := r.PathValue("videoID")
 	videoID, err := uuid.Parse(videoIDString)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
 		return
 	}
 
-	video, err := cfg.db.GetVideo(videoID)
+	video, ok := cfg.videoWithRole(w, r, videoID, database.VideoRoleManager, "delete")
+	if !ok {
+		return
+	}
+
+	err = cfg.db.DeleteVideo(videoID)
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		respondWithStoreError(w, "Couldn't delete video", err)
 		return
 	}
+	cfg.removeVideoFiles(r.Context(), video)
 
-	respondWithJSON(w, http.StatusOK, video)
+	w.WriteHeader(http.StatusNoContent)
 }
 
-func (cfg *apiConfig) handlerVideosRetrieve(w http.ResponseWriter, r *http.Request) {
-	token, err := auth.GetBearerToken(r.Header)
+func (cfg *apiConfig) handlerVideoGet(w http.ResponseWriter, r *http.Request) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
 		return
 	}
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+
+	video, err := cfg.db.GetVideo(videoID)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		respondWithStoreError(w, "Couldn't get video", err)
 		return
 	}
-
-	videos, err := cfg.db.GetVideos(userID)
+	// private videos look missing to anyone but their owner and collaborators
+	viewable, err := cfg.canViewVideo(requestPrincipal(r), video)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check permissions", err)
+		return
+	}
+	if !viewable {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, videos)
+	w.Header().Set("ETag", videoETag(video))
+	respondWithJSON(w, http.StatusOK, video)
 }
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestHandlerVideoMetaCreate(t *testing.T) {
+	api := newTestAPI(t)
+	_, token := api.createUser("uploader@example.com", auth.RoleUploader)
+
+	tests := []struct {
+		name   string
+		token  string
+		body   any
+		status int
+	}{
+		{"anonymous", "", map[string]any{"title": "Boots"}, http.StatusUnauthorized},
+		{"bad token", "not-a-jwt", map[string]any{"title": "Boots"}, http.StatusUnauthorized},
+		{"invalid JSON", token, `{"title": `, http.StatusBadRequest},
+		{"missing title", token, map[string]any{"description": "no title"}, http.StatusBadRequest},
+		{"created", token, map[string]any{"title": "Boots", "description": "A video"}, http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := api.do("POST", "/api/videos", tt.token, tt.body)
+			requireStatus(t, rec, tt.status)
+		})
+	}
+}
+
+func TestHandlerVideoMetaCreateSetsOwner(t *testing.T) {
+	api := newTestAPI(t)
+	user, token := api.createUser("uploader@example.com", auth.RoleUploader)
+
+	// the owner comes from the token, whatever the body says
+	video := api.createVideo(token, map[string]any{"title": "Boots", "user_id": uuid.New()})
+	if video.UserID != user.ID {
+		t.Errorf("UserID = %s, want %s", video.UserID, user.ID)
+	}
+}
+
+func TestHandlerVideosRetrieve(t *testing.T) {
+	api := newTestAPI(t)
+	_, owner := api.createUser("owner@example.com", auth.RoleUploader)
+	_, other := api.createUser("other@example.com", auth.RoleUploader)
+	api.createVideo(owner, map[string]any{"title": "Boots"})
+	api.createVideo(other, map[string]any{"title": "Someone else's"})
+
+	requireStatus(t, api.do("GET", "/api/videos", "", nil), http.StatusUnauthorized)
+
+	rec := api.do("GET", "/api/videos", owner, nil)
+	requireStatus(t, rec, http.StatusOK)
+	videos := decodeJSON[[]database.Video](t, rec)
+	if len(videos) != 1 || videos[0].Title != "Boots" {
+		t.Errorf("videos = %+v, want only the owner's", videos)
+	}
+}
+
+func TestHandlerVideoGet(t *testing.T) {
+	api := newTestAPI(t)
+	_, owner := api.createUser("owner@example.com", auth.RoleUploader)
+	video := api.createVideo(owner, map[string]any{"title": "Boots"})
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{"found", "/api/videos/" + video.ID.String(), http.StatusOK},
+		{"invalid ID", "/api/videos/not-a-uuid", http.StatusBadRequest},
+		{"unknown ID", "/api/videos/" + uuid.NewString(), http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requireStatus(t, api.do("GET", tt.path, owner, nil), tt.status)
+		})
+	}
+}
+
+func TestHandlerVideoGetVisibility(t *testing.T) {
+	api := newTestAPI(t)
+	_, owner := api.createUser("owner@example.com", auth.RoleUploader)
+	_, other := api.createUser("other@example.com", auth.RoleUploader)
+	video := api.createVideo(owner, map[string]any{"title": "Boots"})
+	if video.Visibility != database.VisibilityPrivate {
+		t.Errorf("Visibility = %q, want private by default", video.Visibility)
+	}
+	path := "/api/videos/" + video.ID.String()
+
+	// private videos look missing to everyone but their owner
+	requireStatus(t, api.do("GET", path, "", nil), http.StatusNotFound)
+	requireStatus(t, api.do("GET", path, other, nil), http.StatusNotFound)
+	requireStatus(t, api.do("GET", path, owner, nil), http.StatusOK)
+
+	requireStatus(t, api.do("PATCH", path, owner, map[string]any{"visibility": "unlisted"}), http.StatusOK)
+	requireStatus(t, api.do("GET", path, "", nil), http.StatusOK)
+	requireStatus(t, api.do("GET", path, other, nil), http.StatusOK)
+}
+
+func TestHandlerVideoMetaUpdate(t *testing.T) {
+	api := newTestAPI(t)
+	_, owner := api.createUser("owner@example.com", auth.RoleUploader)
+	_, other := api.createUser("other@example.com", auth.RoleUploader)
+	video := api.createVideo(owner, map[string]any{"title": "Boots", "description": "A video"})
+	path := "/api/videos/" + video.ID.String()
+
+	tests := []struct {
+		name   string
+		token  string
+		body   any
+		status int
+	}{
+		{"anonymous", "", map[string]any{"title": "Renamed"}, http.StatusUnauthorized},
+		{"other user", other, map[string]any{"title": "Renamed"}, http.StatusForbidden},
+		{"invalid JSON", owner, `{"title": `, http.StatusBadRequest},
+		{"blank title", owner, map[string]any{"title": " "}, http.StatusBadRequest},
+		{"unknown visibility", owner, map[string]any{"visibility": "friends"}, http.StatusBadRequest},
+		{"renamed", owner, map[string]any{"title": "Renamed"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requireStatus(t, api.do("PATCH", path, tt.token, tt.body), tt.status)
+		})
+	}
+
+	got := decodeJSON[database.Video](t, api.do("GET", path, owner, nil))
+	if got.Title != "Renamed" || got.Description != "A video" {
+		t.Errorf("metadata = %q, %q; want the title changed and the description kept", got.Title, got.Description)
+	}
+}
+
+func TestHandlerVideoMetaUpdateIfMatch(t *testing.T) {
+	api := newTestAPI(t)
+	_, token := api.createUser("owner@example.com", auth.RoleUploader)
+	video := api.createVideo(token, map[string]any{"title": "Boots"})
+	path := "/api/videos/" + video.ID.String()
+
+	rec := api.do("GET", path, token, nil)
+	requireStatus(t, rec, http.StatusOK)
+	etag := rec.Header().Get("ETag")
+
+	rec = api.do("PATCH", path, token, map[string]any{"title": "First"}, "If-Match", etag)
+	requireStatus(t, rec, http.StatusOK)
+	newETag := rec.Header().Get("ETag")
+	if newETag == "" || newETag == etag {
+		t.Fatalf("ETag after update = %q, was %q", newETag, etag)
+	}
+
+	// a client still holding the old version can't overwrite the update
+	rec = api.do("PATCH", path, token, map[string]any{"title": "Second"}, "If-Match", etag)
+	requireStatus(t, rec, http.StatusPreconditionFailed)
+	requireStatus(t, api.do("PATCH", path, token, map[string]any{"title": "Second"}, "If-Match", newETag), http.StatusOK)
+}
+
+func TestHandlerVideoMetaUpdateKeepsConcurrentUpload(t *testing.T) {
+	for _, ifMatch := range []bool{false, true} {
+		t.Run(fmt.Sprintf("If-Match %v", ifMatch), func(t *testing.T) {
+			api := newTestAPI(t)
+			_, token := api.createUser("owner@example.com", auth.RoleUploader)
+			video := api.createVideo(token, map[string]any{"title": "Boots"})
+			api.cfg.db = &staleReadStore{
+				MemoryStore: api.db,
+				file: database.RecordUploadParams{
+					UserID:          video.UserID,
+					URL:             "https://cdn.example.com/video.mp4",
+					Size:            100,
+					StorageLimit:    -1,
+					UploadTimeLimit: -1,
+				},
+			}
+
+			var headers []string
+			want := http.StatusOK
+			if ifMatch {
+				// the upload changed the video after the client fetched it
+				headers = []string{"If-Match", videoETag(video)}
+				want = http.StatusPreconditionFailed
+			}
+			rec := api.do("PATCH", "/api/videos/"+video.ID.String(), token, map[string]any{"title": "Renamed"}, headers...)
+			requireStatus(t, rec, want)
+
+			stored, err := api.db.GetVideo(video.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.VideoURL == nil || stored.VideoSize != 100 {
+				t.Errorf("concurrent upload undone: VideoURL %v, VideoSize %d", stored.VideoURL, stored.VideoSize)
+			}
+		})
+	}
+}
+
+func TestHandlerVideoMetaDelete(t *testing.T) {
+	api := newTestAPI(t)
+	_, owner := api.createUser("owner@example.com", auth.RoleUploader)
+	_, other := api.createUser("other@example.com", auth.RoleUploader)
+	video := api.createVideo(owner, map[string]any{"title": "Boots"})
+	path := "/api/videos/" + video.ID.String()
+
+	requireStatus(t, api.do("DELETE", path, "", nil), http.StatusUnauthorized)
+	requireStatus(t, api.do("DELETE", path, other, nil), http.StatusForbidden)
+	requireStatus(t, api.do("DELETE", path, owner, nil), http.StatusNoContent)
+	requireStatus(t, api.do("GET", path, owner, nil), http.StatusNotFound)
+	requireStatus(t, api.do("DELETE", path, owner, nil), http.StatusNotFound)
+}
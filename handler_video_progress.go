@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/progress"
+	"github.com/google/uuid"
+)
+
+const (
+	// progressInterval is the least time between progress events for a
+	// stage that reports continuously.
+	progressInterval = 250 * time.Millisecond
+	// sseKeepAlive is how often an idle progress stream gets a comment, so
+	// proxies don't time it out.
+	sseKeepAlive = 15 * time.Second
+)
+
+// uploadReporter publishes the progress of one video upload.
+type uploadReporter struct {
+	tracker *progress.Tracker
+	key     string
+
+	mu       sync.Mutex
+	last     time.Time
+	finished bool
+}
+
+func (cfg *apiConfig) newUploadReporter(videoID uuid.UUID) *uploadReporter {
+	return &uploadReporter{tracker: cfg.uploadProgress, key: videoID.String()}
+}
+
+// publish records ev, dropping it if it is a continuous update that comes
+// too soon after the last one.
+func (u *uploadReporter) publish(ev progress.Event, continuous bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.finished {
+		return
+	}
+	now := time.Now()
+	if continuous && now.Sub(u.last) < progressInterval {
+		return
+	}
+	u.last = now
+	u.finished = ev.Stage.Finished()
+	u.tracker.Publish(u.key, ev)
+}
+
+func (u *uploadReporter) received(done, total int64) {
+	u.publish(progress.Event{Stage: progress.StageReceiving, Done: done, Total: total}, true)
+}
+
+func (u *uploadReporter) processed(done, total time.Duration) {
+	u.publish(progress.Event{
+		Stage: progress.StageProcessing,
+		Done:  done.Milliseconds(),
+		Total: total.Milliseconds(),
+	}, true)
+}
+
+func (u *uploadReporter) stored(part, parts int, done, total int64) {
+	u.publish(progress.Event{
+		Stage: progress.StageUploading,
+		Done:  done,
+		Total: total,
+		Part:  part,
+		Parts: parts,
+	}, false)
+}
+
+func (u *uploadReporter) complete() {
+	u.publish(progress.Event{Stage: progress.StageComplete}, false)
+}
+
+func (u *uploadReporter) fail(msg string) {
+	u.publish(progress.Event{Stage: progress.StageFailed, Error: msg}, false)
+}
+
+// progressReader counts the bytes read through it.
+type progressReader struct {
+	r      io.Reader
+	read   int64
+	report func(read int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.read += int64(n)
+	p.report(p.read)
+	return n, err
+}
+
+// handlerVideoProgress streams the progress of the video's upload as
+// Server-Sent Events, from the bytes arriving through to the file being
+// stored. The stream ends after a complete or failed event.
+func (cfg *apiConfig) handlerVideoProgress(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	_, ok := cfg.videoWithRole(w, r, videoID, database.VideoRoleViewer, "watch uploads to")
+	if !ok {
+		return
+	}
+
+	watcher := cfg.uploadProgress.Watch(videoID.String())
+	defer watcher.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	err = rc.Flush()
+	if err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			_, err = io.WriteString(w, ": keep-alive\n\n")
+		case <-watcher.Updated():
+			ev, ok := watcher.Latest()
+			if !ok {
+				continue
+			}
+			err = writeSSE(w, string(ev.Stage), ev)
+			if err == nil && ev.Stage.Finished() {
+				rc.Flush()
+				return
+			}
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func writeSSE(w io.Writer, event string, data any) error {
+	dat, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, dat)
+	return err
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/progress"
+)
+
+// sseEvent is one event read from a Server-Sent Events stream.
+type sseEvent struct {
+	name string
+	data progress.Event
+}
+
+// readSSE reads the next event from the stream, skipping comments. It
+// returns false at the end of the stream.
+func readSSE(t *testing.T, r *bufio.Reader) (sseEvent, bool) {
+	t.Helper()
+
+	var ev sseEvent
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return sseEvent{}, false
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && ev.name != "":
+			return ev, true
+		case strings.HasPrefix(line, "event: "):
+			ev.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			err = json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ev.data)
+			if err != nil {
+				t.Fatalf("bad event data %q: %v", line, err)
+			}
+		}
+	}
+}
+
+func TestHandlerVideoProgress(t *testing.T) {
+	api := newTestAPI(t)
+	_, token := api.createUser("uploader@example.com", auth.RoleUploader)
+	video := api.createVideo(token, map[string]any{"title": "Boots"})
+	key := video.ID.String()
+	server := httptest.NewServer(api.handler)
+	defer server.Close()
+
+	// an upload already under way is reported as soon as the stream opens
+	api.cfg.uploadProgress.Publish(key, progress.Event{Stage: progress.StageReceiving, Done: 50, Total: 200})
+
+	req, err := http.NewRequest("GET", server.URL+"/api/videos/"+key+"/progress", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("status = %d, Content-Type = %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	stream := bufio.NewReader(resp.Body)
+
+	ev, ok := readSSE(t, stream)
+	if !ok || ev.name != "receiving" || ev.data.Done != 50 || ev.data.Percent != 25 {
+		t.Fatalf("first event = %+v, want receiving at 25%%", ev)
+	}
+
+	api.cfg.uploadProgress.Publish(key, progress.Event{Stage: progress.StageUploading, Done: 1, Total: 2, Part: 1, Parts: 2})
+	ev, ok = readSSE(t, stream)
+	if !ok || ev.name != "uploading" || ev.data.Part != 1 || ev.data.Parts != 2 || ev.data.Seq != 2 {
+		t.Fatalf("second event = %+v, want uploading part 1 of 2", ev)
+	}
+
+	// the stream ends after the upload finishes
+	api.cfg.uploadProgress.Publish(key, progress.Event{Stage: progress.StageComplete})
+	ev, ok = readSSE(t, stream)
+	if !ok || ev.name != "complete" {
+		t.Fatalf("last event = %+v, want complete", ev)
+	}
+	if ev, ok := readSSE(t, stream); ok {
+		t.Errorf("event %+v after complete", ev)
+	}
+}
+
+func TestHandlerVideoProgressAccess(t *testing.T) {
+	api := newTestAPI(t)
+	_, token := api.createUser("uploader@example.com", auth.RoleUploader)
+	_, other := api.createUser("other@example.com", auth.RoleUploader)
+	video := api.createVideo(token, map[string]any{"title": "Boots"})
+
+	tests := []struct {
+		name   string
+		path   string
+		token  string
+		status int
+	}{
+		{"anonymous", "/api/videos/" + video.ID.String() + "/progress", "", http.StatusUnauthorized},
+		{"not the owner", "/api/videos/" + video.ID.String() + "/progress", other, http.StatusForbidden},
+		{"invalid video ID", "/api/videos/not-a-uuid/progress", token, http.StatusBadRequest},
+		{"unknown video", "/api/videos/00000000-0000-0000-0000-000000000000/progress", token, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requireStatus(t, api.do("GET", tt.path, tt.token, nil), tt.status)
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const (
+	defaultSearchPageSize = 20
+	maxSearchPageSize     = 100
+)
+
+// videoSearchResult is a matching video with its title and a snippet of its
+// description as HTML, with the matched words wrapped in <mark>.
+type videoSearchResult struct {
+	database.Video
+	TitleHTML       string `json:"title_html"`
+	DescriptionHTML string `json:"description_html"`
+}
+
+// handlerVideosSearch searches the titles and descriptions of the videos
+// handlerVideosRetrieve would list, and those shared with the caller, for
+// the words in q, best matches first when SQLite has FTS5. It pages with
+// limit and offset, and the Link header points at the next page when there
+// is one.
+func (cfg *apiConfig) handlerVideosSearch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := query.Get("q")
+	if len(database.SearchTerms(q)) == 0 {
+		respondWithError(w, http.StatusBadRequest, "Search query is required", nil)
+		return
+	}
+
+	limit := defaultSearchPageSize
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxSearchPageSize {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Limit must be between 1 and %d", maxSearchPageSize), nil)
+			return
+		}
+		limit = n
+	}
+	offset := 0
+	if value := query.Get("offset"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			respondWithError(w, http.StatusBadRequest, "Offset must be a whole number", nil)
+			return
+		}
+		offset = n
+	}
+
+	userID := requestPrincipal(r).UserID
+	orgID, err := cfg.activeOrganization(userID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get user", err)
+		return
+	}
+
+	// fetch one extra to find out whether there's another page
+	matches, err := cfg.db.SearchVideos(database.SearchVideosParams{
+		UserID:         userID,
+		OrganizationID: orgID,
+		IncludeShared:  true,
+		Query:          q,
+		Limit:          limit + 1,
+		Offset:         offset,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't search videos", err)
+		return
+	}
+
+	if len(matches) > limit {
+		matches = matches[:limit]
+		query.Set("offset", strconv.Itoa(offset+limit))
+		next := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.String()))
+	}
+
+	results := make([]videoSearchResult, len(matches))
+	for i, match := range matches {
+		results[i] = videoSearchResult{
+			Video:           match.Video,
+			TitleHTML:       highlightHTML(match.TitleHighlight),
+			DescriptionHTML: highlightHTML(match.DescriptionSnippet),
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, results)
+}
+
+// highlightHTML escapes text highlighted by the store and turns its
+// highlight markers into <mark> elements.
+func highlightHTML(text string) string {
+	return strings.NewReplacer(
+		database.HighlightStart, "<mark>",
+		database.HighlightEnd, "</mark>",
+	).Replace(html.EscapeString(text))
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/google/uuid"
+)
+
+func TestHandlerVideosSearch(t *testing.T) {
+	api := newTestAPI(t)
+	_, token := api.createUser("user@example.com", auth.RoleUploader)
+	api.createVideo(token, map[string]any{"title": "Boots"})
+
+	tests := []struct {
+		name   string
+		token  string
+		path   string
+		status int
+	}{
+		{"anonymous", "", "/api/videos/search?q=boots", http.StatusUnauthorized},
+		{"no query", token, "/api/videos/search", http.StatusBadRequest},
+		{"punctuation only", token, "/api/videos/search?q=%21%21", http.StatusBadRequest},
+		{"limit too large", token, "/api/videos/search?q=boots&limit=101", http.StatusBadRequest},
+		{"negative offset", token, "/api/videos/search?q=boots&offset=-1", http.StatusBadRequest},
+		{"searched", token, "/api/videos/search?q=boots", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requireStatus(t, api.do("GET", tt.path, tt.token, nil), tt.status)
+		})
+	}
+}
+
+func TestHandlerVideosSearchResults(t *testing.T) {
+	api := newTestAPI(t)
+	_, owner := api.createUser("owner@example.com", auth.RoleUploader)
+	_, token := api.createUser("user@example.com", auth.RoleUploader)
+	api.createVideo(owner, map[string]any{"title": "Someone else's boots"})
+	api.createVideo(token, map[string]any{"title": "Boots"})
+	own := api.createVideo(token, map[string]any{"title": "Walking", "description": "Red <b>boots</b>"})
+
+	rec := api.do("GET", "/api/videos/search?q=boots", token, nil)
+	requireStatus(t, rec, http.StatusOK)
+	results := decodeJSON[[]videoSearchResult](t, rec)
+	if len(results) != 2 || results[0].Title != "Boots" || results[1].ID != own.ID {
+		t.Fatalf("results = %s, want the user's two videos, title match first", rec.Body.String())
+	}
+	if got := results[0].TitleHTML; got != "<mark>Boots</mark>" {
+		t.Errorf("TitleHTML = %q", got)
+	}
+	if got := results[1].DescriptionHTML; got != "Red &lt;b&gt;<mark>boots</mark>&lt;/b&gt;" {
+		t.Errorf("DescriptionHTML = %q", got)
+	}
+
+	// paging
+	rec = api.do("GET", "/api/videos/search?q=boots&limit=1", token, nil)
+	requireStatus(t, rec, http.StatusOK)
+	if len(decodeJSON[[]videoSearchResult](t, rec)) != 1 || rec.Header().Get("Link") == "" {
+		t.Errorf("first page: %s, Link %q", rec.Body.String(), rec.Header().Get("Link"))
+	}
+	rec = api.do("GET", "/api/videos/search?q=boots&limit=1&offset=1", token, nil)
+	if len(decodeJSON[[]videoSearchResult](t, rec)) != 1 || rec.Header().Get("Link") != "" {
+		t.Errorf("last page: %s, Link %q", rec.Body.String(), rec.Header().Get("Link"))
+	}
+}
+
+func TestHandlerVideosSearchFindsSharedVideos(t *testing.T) {
+	api := newTestAPI(t)
+	_, owner := api.createUser("owner@example.com", auth.RoleUploader)
+	collaborator, token := api.createUser("collaborator@example.com", auth.RoleUploader)
+	shared := api.createVideo(owner, map[string]any{"title": "Shared boots"})
+	api.createVideo(owner, map[string]any{"title": "Private boots"})
+	own := api.createVideo(token, map[string]any{"title": "My boots"})
+
+	rec := api.do("POST", "/api/videos/"+shared.ID.String()+"/collaborators", owner, map[string]any{"email": collaborator.Email, "role": "viewer"})
+	requireStatus(t, rec, http.StatusCreated)
+
+	rec = api.do("GET", "/api/videos/search?q=boots", token, nil)
+	requireStatus(t, rec, http.StatusOK)
+	found := map[uuid.UUID]bool{}
+	for _, result := range decodeJSON[[]videoSearchResult](t, rec) {
+		found[result.ID] = true
+	}
+	if len(found) != 2 || !found[own.ID] || !found[shared.ID] {
+		t.Errorf("results = %s, want own and shared videos", rec.Body.String())
+	}
+}
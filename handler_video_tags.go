@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxTagLength    = 50
+	maxTagsPerVideo = 50
+)
+
+// normalizeTag lowercases a tag and collapses its whitespace, so that
+// "Spring  Launch" and "spring launch" are the same tag. It reports false if
+// the tag is empty or too long.
+func normalizeTag(name string) (string, bool) {
+	name = strings.ToLower(strings.Join(strings.Fields(name), " "))
+	if name == "" || utf8.RuneCountInString(name) > maxTagLength {
+		return "", false
+	}
+	return name, true
+}
+
+// handlerVideoTagsAdd adds tags to one of the user's videos. Tags the video
+// already has are ignored.
+func (cfg *apiConfig) handlerVideoTagsAdd(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Tags []string `json:"tags"`
+	}
+
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	names := make([]string, 0, len(params.Tags))
+	for _, tag := range params.Tags {
+		name, ok := normalizeTag(tag)
+		if !ok {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Tags must be 1 to %d characters long", maxTagLength), nil)
+			return
+		}
+		names = append(names, name)
+	}
+
+	video, ok := cfg.videoWithRole(w, r, videoID, database.VideoRoleEditor, "tag")
+	if !ok {
+		return
+	}
+
+	tags := map[string]bool{}
+	for _, name := range append(video.Tags, names...) {
+		tags[name] = true
+	}
+	if len(tags) > maxTagsPerVideo {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Videos can have at most %d tags", maxTagsPerVideo), nil)
+		return
+	}
+
+	err = cfg.db.AddVideoTags(videoID, names)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't add tags", err)
+		return
+	}
+
+	video, err = cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get video", err)
+		return
+	}
+	w.Header().Set("ETag", videoETag(video))
+	respondWithJSON(w, http.StatusOK, video)
+}
+
+func (cfg *apiConfig) handlerVideoTagDelete(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+	name, ok := normalizeTag(r.PathValue("tag"))
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Invalid tag", nil)
+		return
+	}
+
+	_, ok = cfg.videoWithRole(w, r, videoID, database.VideoRoleEditor, "tag")
+	if !ok {
+		return
+	}
+
+	err = cfg.db.RemoveVideoTag(videoID, name)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't remove tag", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerTagsList lists the tags on the user's videos with how many videos
+// have each.
+func (cfg *apiConfig) handlerTagsList(w http.ResponseWriter, r *http.Request) {
+	counts, err := cfg.db.GetTagCounts(requestPrincipal(r).UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve tags", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, counts)
+}
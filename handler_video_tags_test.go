@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestHandlerVideoTagsAdd(t *testing.T) {
+	api := newTestAPI(t)
+	_, owner := api.createUser("owner@example.com", auth.RoleUploader)
+	_, other := api.createUser("other@example.com", auth.RoleUploader)
+	video := api.createVideo(owner, map[string]any{"title": "Boots"})
+	path := "/api/videos/" + video.ID.String() + "/tags"
+
+	tooMany := make([]string, maxTagsPerVideo+1)
+	for i := range tooMany {
+		tooMany[i] = uuid.NewString()
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		path   string
+		tags   []string
+		status int
+	}{
+		{"anonymous", "", path, []string{"outdoors"}, http.StatusUnauthorized},
+		{"other user", other, path, []string{"outdoors"}, http.StatusForbidden},
+		{"unknown video", owner, "/api/videos/" + uuid.NewString() + "/tags", []string{"outdoors"}, http.StatusNotFound},
+		{"blank tag", owner, path, []string{"  "}, http.StatusBadRequest},
+		{"tag too long", owner, path, []string{strings.Repeat("a", maxTagLength+1)}, http.StatusBadRequest},
+		{"too many tags", owner, path, tooMany, http.StatusBadRequest},
+		{"added", owner, path, []string{"Spring  Launch", "outdoors", "spring launch"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := api.do("POST", tt.path, tt.token, map[string]any{"tags": tt.tags})
+			requireStatus(t, rec, tt.status)
+		})
+	}
+
+	got := decodeJSON[database.Video](t, api.do("GET", "/api/videos/"+video.ID.String(), owner, nil))
+	if want := []string{"outdoors", "spring launch"}; !reflect.DeepEqual(got.Tags, want) {
+		t.Errorf("Tags = %v, want %v", got.Tags, want)
+	}
+}
+
+func TestHandlerVideoTagDelete(t *testing.T) {
+	api := newTestAPI(t)
+	_, owner := api.createUser("owner@example.com", auth.RoleUploader)
+	_, other := api.createUser("other@example.com", auth.RoleUploader)
+	video := api.createVideo(owner, map[string]any{"title": "Boots"})
+	requireStatus(t, api.do("POST", "/api/videos/"+video.ID.String()+"/tags", owner, map[string]any{"tags": []string{"spring launch"}}), http.StatusOK)
+	path := "/api/videos/" + video.ID.String() + "/tags/Spring%20Launch"
+
+	requireStatus(t, api.do("DELETE", path, "", nil), http.StatusUnauthorized)
+	requireStatus(t, api.do("DELETE", path, other, nil), http.StatusForbidden)
+	requireStatus(t, api.do("DELETE", path, owner, nil), http.StatusNoContent)
+	requireStatus(t, api.do("DELETE", path, owner, nil), http.StatusNotFound)
+
+	got := decodeJSON[database.Video](t, api.do("GET", "/api/videos/"+video.ID.String(), owner, nil))
+	if len(got.Tags) != 0 {
+		t.Errorf("Tags = %v, want none", got.Tags)
+	}
+}
+
+func TestHandlerTagsList(t *testing.T) {
+	api := newTestAPI(t)
+	_, token := api.createUser("owner@example.com", auth.RoleUploader)
+	_, other := api.createUser("other@example.com", auth.RoleUploader)
+	tag := func(token string, title string, tags ...string) {
+		video := api.createVideo(token, map[string]any{"title": title})
+		requireStatus(t, api.do("POST", "/api/videos/"+video.ID.String()+"/tags", token, map[string]any{"tags": tags}), http.StatusOK)
+	}
+	tag(token, "Boots", "outdoors", "boots")
+	tag(token, "Walking", "outdoors")
+	tag(other, "Elsewhere", "outdoors")
+
+	requireStatus(t, api.do("GET", "/api/tags", "", nil), http.StatusUnauthorized)
+
+	rec := api.do("GET", "/api/tags", token, nil)
+	requireStatus(t, rec, http.StatusOK)
+	want := []database.TagCount{{Name: "boots", Videos: 1}, {Name: "outdoors", Videos: 2}}
+	if got := decodeJSON[[]database.TagCount](t, rec); !reflect.DeepEqual(got, want) {
+		t.Errorf("tags = %v, want %v", got, want)
+	}
+
+	rec = api.do("GET", "/api/videos?tag=Outdoors&tag=boots", token, nil)
+	requireStatus(t, rec, http.StatusOK)
+	if videos := decodeJSON[[]database.Video](t, rec); len(videos) != 1 || videos[0].Title != "Boots" {
+		t.Errorf("tagged outdoors and boots = %+v, want Boots", videos)
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultVideoPageSize = 50
+	maxVideoPageSize     = 200
+)
+
+// videoCursor is what a cursor query parameter decodes to. It records the
+// sort it was made for, since it means nothing under another one.
+type videoCursor struct {
+	Sort       string    `json:"sort"`
+	ID         uuid.UUID `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	Title      string    `json:"title,omitempty"`
+	DurationMs int64     `json:"duration_ms,omitempty"`
+}
+
+// handlerVideosRetrieve lists a page of the videos in the caller's active
+// organization, or of their own videos when they have none. The query can
+// set sort ("created", "title" or "duration", prefixed with "-" for
+// descending), limit, and the filters has_video, has_thumbnail,
+// orientation, status, tag (repeatable, all must match), created_after and
+// created_before. When there are more videos the Link header points at the
+// next page.
+func (cfg *apiConfig) handlerVideosRetrieve(w http.ResponseWriter, r *http.Request) {
+	params, sort, err := parseListVideosQuery(r.URL.Query())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid query: "+err.Error(), nil)
+		return
+	}
+	params.UserID = requestPrincipal(r).UserID
+	params.OrganizationID, err = cfg.activeOrganization(params.UserID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get user", err)
+		return
+	}
+
+	// fetch one extra to find out whether there's another page
+	limit := params.Limit
+	params.Limit++
+	videos, err := cfg.db.ListVideos(params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
+		return
+	}
+
+	if len(videos) > limit {
+		videos = videos[:limit]
+		last := videos[len(videos)-1]
+		cursor, err := encodeVideoCursor(videoCursor{
+			Sort:       sort,
+			ID:         last.ID,
+			CreatedAt:  last.CreatedAt,
+			Title:      last.Title,
+			DurationMs: last.DurationMs,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't create cursor", err)
+			return
+		}
+		query := r.URL.Query()
+		query.Set("cursor", cursor)
+		next := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.String()))
+	}
+
+	respondWithJSON(w, http.StatusOK, videos)
+}
+
+// parseListVideosQuery reads the listing options out of a query string. It
+// also returns the sort as written, for building the next cursor.
+func parseListVideosQuery(query url.Values) (database.ListVideosParams, string, error) {
+	params := database.ListVideosParams{
+		Sort:       database.VideoSortCreated,
+		Descending: true,
+		Limit:      defaultVideoPageSize,
+	}
+
+	sort := query.Get("sort")
+	if sort == "" {
+		sort = "-created"
+	}
+	field, descending := strings.CutPrefix(sort, "-")
+	switch database.VideoSort(field) {
+	case database.VideoSortCreated, database.VideoSortTitle, database.VideoSortDuration:
+		params.Sort = database.VideoSort(field)
+		params.Descending = descending
+	default:
+		return params, "", errors.New("sort must be created, title or duration, optionally prefixed with -")
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxVideoPageSize {
+			return params, "", fmt.Errorf("limit must be between 1 and %d", maxVideoPageSize)
+		}
+		params.Limit = limit
+	}
+
+	if value := query.Get("cursor"); value != "" {
+		cursor, err := decodeVideoCursor(value)
+		if err != nil {
+			return params, "", errors.New("invalid cursor")
+		}
+		if cursor.Sort != sort {
+			return params, "", errors.New("cursor was made for a different sort")
+		}
+		params.After = &database.VideoCursor{
+			ID:         cursor.ID,
+			CreatedAt:  cursor.CreatedAt,
+			Title:      cursor.Title,
+			DurationMs: cursor.DurationMs,
+		}
+	}
+
+	var err error
+	params.HasVideo, err = parseBoolFilter(query, "has_video")
+	if err != nil {
+		return params, "", err
+	}
+	params.HasThumbnail, err = parseBoolFilter(query, "has_thumbnail")
+	if err != nil {
+		return params, "", err
+	}
+
+	params.Orientation = query.Get("orientation")
+	switch params.Orientation {
+	case "", "landscape", "portrait", "other":
+	default:
+		return params, "", errors.New("orientation must be landscape, portrait or other")
+	}
+
+	params.Status = query.Get("status")
+	switch params.Status {
+	case "", database.VideoStatusDraft, database.VideoStatusProcessing, database.VideoStatusReady, database.VideoStatusFailed:
+	default:
+		return params, "", errors.New("status must be draft, processing, ready or failed")
+	}
+
+	for _, tag := range query["tag"] {
+		name, ok := normalizeTag(tag)
+		if !ok {
+			return params, "", errors.New("invalid tag")
+		}
+		params.Tags = append(params.Tags, name)
+	}
+
+	params.CreatedAfter, err = parseTimeFilter(query, "created_after")
+	if err != nil {
+		return params, "", err
+	}
+	params.CreatedBefore, err = parseTimeFilter(query, "created_before")
+	if err != nil {
+		return params, "", err
+	}
+
+	return params, sort, nil
+}
+
+func parseBoolFilter(query url.Values, key string) (*bool, error) {
+	value := query.Get(key)
+	if value == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be true or false", key)
+	}
+	return &b, nil
+}
+
+func parseTimeFilter(query url.Values, key string) (*time.Time, error) {
+	value := query.Get(key)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an RFC 3339 timestamp", key)
+	}
+	return &t, nil
+}
+
+func encodeVideoCursor(cursor videoCursor) (string, error) {
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeVideoCursor(value string) (videoCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return videoCursor{}, err
+	}
+	var cursor videoCursor
+	err = json.Unmarshal(data, &cursor)
+	return cursor, err
+}
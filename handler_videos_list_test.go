@@ -0,0 +1,151 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// nextPage returns the path in the response's Link header, or "" on the
+// last page.
+func nextPage(t *testing.T, header http.Header) string {
+	t.Helper()
+
+	link := header.Get("Link")
+	if link == "" {
+		return ""
+	}
+	target, ok := strings.CutSuffix(link, `>; rel="next"`)
+	if !ok || !strings.HasPrefix(target, "<") {
+		t.Fatalf("Link = %q", link)
+	}
+	return target[1:]
+}
+
+func TestHandlerVideosRetrievePages(t *testing.T) {
+	api := newTestAPI(t)
+	_, token := api.createUser("owner@example.com", auth.RoleUploader)
+	for _, title := range []string{"c", "a", "e", "b", "d"} {
+		api.createVideo(token, map[string]any{"title": title})
+	}
+
+	var got string
+	path := "/api/videos?sort=title&limit=2"
+	for pages := 0; path != ""; pages++ {
+		if pages == 3 {
+			t.Fatal("more pages than videos")
+		}
+		rec := api.do("GET", path, token, nil)
+		requireStatus(t, rec, http.StatusOK)
+		for _, video := range decodeJSON[[]database.Video](t, rec) {
+			got += video.Title
+		}
+		path = nextPage(t, rec.Header())
+	}
+	if got != "abcde" {
+		t.Errorf("titles = %q, want abcde", got)
+	}
+}
+
+func TestHandlerVideosRetrieveCursorSort(t *testing.T) {
+	api := newTestAPI(t)
+	_, token := api.createUser("owner@example.com", auth.RoleUploader)
+	for _, title := range []string{"a", "b", "c"} {
+		api.createVideo(token, map[string]any{"title": title})
+	}
+
+	rec := api.do("GET", "/api/videos?sort=title&limit=1", token, nil)
+	requireStatus(t, rec, http.StatusOK)
+	next, err := url.Parse(nextPage(t, rec.Header()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cursor := next.Query().Get("cursor")
+	if cursor == "" {
+		t.Fatalf("next page %q has no cursor", next)
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		status int
+	}{
+		{"same sort", "sort=title&cursor=" + cursor, http.StatusOK},
+		{"reversed sort", "sort=-title&cursor=" + cursor, http.StatusBadRequest},
+		{"default sort", "cursor=" + cursor, http.StatusBadRequest},
+		{"not a cursor", "sort=title&cursor=not-a-cursor", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requireStatus(t, api.do("GET", "/api/videos?"+tt.query, token, nil), tt.status)
+		})
+	}
+
+	rec = api.do("GET", "/api/videos?sort=title&cursor="+cursor, token, nil)
+	videos := decodeJSON[[]database.Video](t, rec)
+	if len(videos) != 2 || videos[0].Title != "b" {
+		t.Errorf("after the cursor = %+v, want b and c", videos)
+	}
+}
+
+func TestHandlerVideosRetrieveFilters(t *testing.T) {
+	api := newTestAPI(t)
+	user, token := api.createUser("owner@example.com", auth.RoleUploader)
+	uploaded := api.createVideo(token, map[string]any{"title": "Uploaded"})
+	api.createVideo(token, map[string]any{"title": "Draft"})
+	err := api.db.RecordUpload(database.RecordUploadParams{
+		UserID:          user.ID,
+		VideoID:         uploaded.ID,
+		URL:             "https://cdn.example.com/video.mp4",
+		Orientation:     "portrait",
+		StorageLimit:    -1,
+		UploadTimeLimit: -1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"has_video=true", "Uploaded"},
+		{"has_video=false", "Draft"},
+		{"orientation=portrait", "Uploaded"},
+		{"status=draft", "Draft"},
+		{"status=ready", "Uploaded"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := api.do("GET", "/api/videos?"+tt.query, token, nil)
+			requireStatus(t, rec, http.StatusOK)
+			videos := decodeJSON[[]database.Video](t, rec)
+			if len(videos) != 1 || videos[0].Title != tt.want {
+				t.Errorf("videos = %+v, want only %q", videos, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlerVideosRetrieveInvalidQuery(t *testing.T) {
+	api := newTestAPI(t)
+	_, token := api.createUser("owner@example.com", auth.RoleUploader)
+
+	for _, query := range []string{
+		"sort=views",
+		"limit=0",
+		"limit=201",
+		"has_video=maybe",
+		"orientation=square",
+		"status=deleted",
+		"created_after=yesterday",
+	} {
+		t.Run(query, func(t *testing.T) {
+			requireStatus(t, api.do("GET", "/api/videos?"+query, token, nil), http.StatusBadRequest)
+		})
+	}
+}
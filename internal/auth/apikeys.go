@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// Scopes an API key can be granted. Access tokens issued at login are not
+// scoped and may do anything the user can.
+const (
+	ScopeVideosRead  = "videos:read"
+	ScopeVideosWrite = "videos:write"
+	ScopeUpload      = "upload"
+)
+
+var validScopes = map[string]bool{
+	ScopeVideosRead:  true,
+	ScopeVideosWrite: true,
+	ScopeUpload:      true,
+}
+
+const (
+	apiKeyPrefix       = "tubely_"
+	apiKeyDisplayChars = len(apiKeyPrefix) + 8
+)
+
+// MakeAPIKey returns a new random API key along with the short, non-secret
+// prefix shown to users so they can tell their keys apart.
+func MakeAPIKey() (key string, displayPrefix string, err error) {
+	raw := make([]byte, 32)
+	_, err = rand.Read(raw)
+	if err != nil {
+		return "", "", err
+	}
+	key = apiKeyPrefix + hex.EncodeToString(raw)
+	return key, key[:apiKeyDisplayChars], nil
+}
+
+// ValidScope reports whether scope is one API keys can be granted.
+func ValidScope(scope string) bool {
+	return validScopes[scope]
+}
+
+// HasScope reports whether scopes includes want.
+func HasScope(scopes []string, want string) bool {
+	for _, scope := range scopes {
+		if scope == want {
+			return true
+		}
+	}
+	return false
+}
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -22,6 +23,26 @@ const (
 
 var ErrNoAuthHeaderIncluded = errors.New("no auth header included in request")
 
+// ErrTokenRevoked is returned by a ClaimsCheck that rejects an otherwise
+// valid token.
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// AccessClaims are the claims carried by a Tubely access token.
+type AccessClaims struct {
+	jwt.RegisteredClaims
+	// SessionID is the refresh token family the access token was issued
+	// from. It is empty for tokens not tied to a login session.
+	SessionID string `json:"sid,omitempty"`
+	// Version is the user's token version when the token was issued. Bumping
+	// the stored version invalidates every access token issued before it.
+	Version int `json:"ver"`
+}
+
+// ClaimsCheck is an extra validation step run on a token's claims after its
+// signature and expiry have been verified, such as a lookup of whether the
+// token has since been revoked.
+type ClaimsCheck func(userID uuid.UUID, claims AccessClaims) error
+
 func HashPassword(password string) (string, error) {
 	hash, err := argon2id.CreateHash(password, argon2id.DefaultParams)
 	if err != nil {
@@ -40,48 +61,86 @@ func CheckPasswordHash(password, hash string) (bool, error) {
 
 func MakeJWT(
 	userID uuid.UUID,
-	tokenSecret string,
+	keys *KeySet,
 	expiresIn time.Duration,
 ) (string, error) {
-	signingKey := []byte(tokenSecret)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Issuer:    string(TokenTypeAccess),
-		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
-		Subject:   userID.String(),
+	return MakeSessionJWT(userID, "", 0, keys, expiresIn)
+}
+
+// MakeSessionJWT is like MakeJWT but ties the access token to a login
+// session and to the user's current token version, so that either can be
+// revoked later.
+func MakeSessionJWT(
+	userID uuid.UUID,
+	sessionID string,
+	tokenVersion int,
+	keys *KeySet,
+	expiresIn time.Duration,
+) (string, error) {
+	return keys.sign(AccessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    string(TokenTypeAccess),
+			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+			Subject:   userID.String(),
+		},
+		SessionID: sessionID,
+		Version:   tokenVersion,
 	})
-	return token.SignedString(signingKey)
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	claimsStruct := jwt.RegisteredClaims{}
+func ValidateJWT(tokenString string, keys *KeySet, checks ...ClaimsCheck) (uuid.UUID, error) {
+	userID, _, err := ParseJWT(tokenString, keys, checks...)
+	return userID, err
+}
+
+// ParseJWT validates an access token, runs any extra checks on it, and
+// returns its user ID along with the rest of its claims.
+func ParseJWT(tokenString string, keys *KeySet, checks ...ClaimsCheck) (uuid.UUID, AccessClaims, error) {
+	id, claims, err := parseToken(tokenString, keys, TokenTypeAccess)
+	if err != nil {
+		return uuid.Nil, AccessClaims{}, err
+	}
+
+	for _, check := range checks {
+		if err := check(id, claims); err != nil {
+			return uuid.Nil, AccessClaims{}, err
+		}
+	}
+	return id, claims, nil
+}
+
+// parseToken verifies a token's signature and expiry and that it was issued
+// as tokenType.
+func parseToken(tokenString string, keys *KeySet, tokenType TokenType) (uuid.UUID, AccessClaims, error) {
+	claimsStruct := AccessClaims{}
 	token, err := jwt.ParseWithClaims(
 		tokenString,
 		&claimsStruct,
-		func(token *jwt.Token) (interface{}, error) { return []byte(tokenSecret), nil },
+		keys.keyFunc,
 	)
 	if err != nil {
-		return uuid.Nil, err
+		return uuid.Nil, AccessClaims{}, err
 	}
 
 	userIDString, err := token.Claims.GetSubject()
 	if err != nil {
-		return uuid.Nil, err
+		return uuid.Nil, AccessClaims{}, err
 	}
 
 	issuer, err := token.Claims.GetIssuer()
 	if err != nil {
-		return uuid.Nil, err
+		return uuid.Nil, AccessClaims{}, err
 	}
-	if issuer != string(TokenTypeAccess) {
-		return uuid.Nil, errors.New("invalid issuer")
+	if issuer != string(tokenType) {
+		return uuid.Nil, AccessClaims{}, errors.New("invalid issuer")
 	}
 
 	id, err := uuid.Parse(userIDString)
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("invalid user ID: %w", err)
+		return uuid.Nil, AccessClaims{}, fmt.Errorf("invalid user ID: %w", err)
 	}
-	return id, nil
+	return id, claimsStruct, nil
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -106,6 +165,14 @@ func MakeRefreshToken() (string, error) {
 	return hex.EncodeToString(token), nil
 }
 
+// HashToken returns the digest random secrets, such as API keys and password
+// reset tokens, are stored and looked up by. They carry enough entropy that a
+// fast hash is enough.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 func GetAPIKey(headers http.Header) (string, error) {
 	authHeader := headers.Get("Authorization")
 	if authHeader == "" {
@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key is a single key that access tokens can be signed or verified with.
+type Key struct {
+	ID        string
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// KeySet holds every key that access tokens may be verified with, one of
+// which is used to sign new tokens. A key is retired by removing it from the
+// set, after which tokens it signed no longer validate.
+type KeySet struct {
+	signing *Key
+	keys    map[string]*Key
+	// legacy verifies tokens issued without a "kid" header, which is how
+	// tokens were signed before key rotation existed.
+	legacy *Key
+}
+
+func NewKeySet() *KeySet {
+	return &KeySet{
+		keys: map[string]*Key{},
+	}
+}
+
+// NewHMACKeySet returns a key set that signs and verifies with a single
+// shared HS256 secret.
+func NewHMACKeySet(secret string) *KeySet {
+	ks := NewKeySet()
+	ks.AddHMAC("", secret)
+	return ks
+}
+
+// AddHMAC adds an HS256 shared secret. An HMAC key with an empty ID verifies
+// tokens that carry no key ID. HMAC keys are never published in the JWKS.
+func (ks *KeySet) AddHMAC(kid, secret string) {
+	key := &Key{
+		ID:        kid,
+		method:    jwt.SigningMethodHS256,
+		signKey:   []byte(secret),
+		verifyKey: []byte(secret),
+	}
+	if kid == "" {
+		ks.legacy = key
+	} else {
+		ks.keys[kid] = key
+	}
+	if ks.signing == nil {
+		ks.signing = key
+	}
+}
+
+// AddPrivateKeyPEM adds an RSA (RS256) or Ed25519 (EdDSA) private key. The
+// first asymmetric key added becomes the signing key.
+func (ks *KeySet) AddPrivateKeyPEM(kid string, pemBytes []byte) error {
+	if kid == "" {
+		return errors.New("asymmetric keys must have a key ID")
+	}
+	if _, ok := ks.keys[kid]; ok {
+		return fmt.Errorf("duplicate key ID %q", kid)
+	}
+
+	var key *Key
+	if rsaKey, err := jwt.ParseRSAPrivateKeyFromPEM(pemBytes); err == nil {
+		key = &Key{
+			ID:        kid,
+			method:    jwt.SigningMethodRS256,
+			signKey:   rsaKey,
+			verifyKey: &rsaKey.PublicKey,
+		}
+	} else if edKey, err := jwt.ParseEdPrivateKeyFromPEM(pemBytes); err == nil {
+		key = &Key{
+			ID:        kid,
+			method:    jwt.SigningMethodEdDSA,
+			signKey:   edKey,
+			verifyKey: edKey.(crypto.Signer).Public(),
+		}
+	} else {
+		return fmt.Errorf("key %q is neither an RSA nor an Ed25519 private key", kid)
+	}
+
+	ks.keys[kid] = key
+	if ks.signing == nil || ks.signing.method == jwt.SigningMethodHS256 {
+		ks.signing = key
+	}
+	return nil
+}
+
+// AddPrivateKeyFile reads a PEM encoded private key from disk and adds it.
+func (ks *KeySet) AddPrivateKeyFile(kid, path string) error {
+	pemBytes, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("couldn't read key %q: %w", kid, err)
+	}
+	return ks.AddPrivateKeyPEM(kid, pemBytes)
+}
+
+// SetSigningKey chooses which key new tokens are signed with.
+func (ks *KeySet) SetSigningKey(kid string) error {
+	key, ok := ks.keys[kid]
+	if !ok {
+		return fmt.Errorf("unknown key ID %q", kid)
+	}
+	ks.signing = key
+	return nil
+}
+
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	if ks.signing == nil {
+		return "", errors.New("no signing key configured")
+	}
+	token := jwt.NewWithClaims(ks.signing.method, claims)
+	if ks.signing.ID != "" {
+		token.Header["kid"] = ks.signing.ID
+	}
+	return token.SignedString(ks.signing.signKey)
+}
+
+// keyFunc picks the verification key named by the token's "kid" header and
+// refuses tokens whose algorithm doesn't match that key.
+func (ks *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	key := ks.legacy
+	if kid, ok := token.Header["kid"].(string); ok {
+		key = ks.keys[kid]
+	}
+	if key == nil {
+		return nil, errors.New("unknown or retired signing key")
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return key.verifyKey, nil
+}
+
+// JWK is a public key in JSON Web Key format.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set, as served from /.well-known/jwks.json.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public halves of every asymmetric key in the set so that
+// other services can verify tokens without holding a signing secret.
+func (ks *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range ks.keys {
+		switch pub := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				KeyType:   "RSA",
+				KeyID:     key.ID,
+				Use:       "sig",
+				Algorithm: key.method.Alg(),
+				N:         base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				KeyType:   "OKP",
+				KeyID:     key.ID,
+				Use:       "sig",
+				Algorithm: key.method.Alg(),
+				Curve:     "Ed25519",
+				X:         base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+	sort.Slice(set.Keys, func(i, j int) bool {
+		return set.Keys[i].KeyID < set.Keys[j].KeyID
+	})
+	return set
+}
@@ -0,0 +1,261 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func rsaKeyPEM(t *testing.T) ([]byte, *rsa.PublicKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), &key.PublicKey
+}
+
+func ed25519KeyPEM(t *testing.T) ([]byte, ed25519.PublicKey) {
+	t.Helper()
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), pub
+}
+
+func tokenKeyID(t *testing.T, token string) string {
+	t.Helper()
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &AccessClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
+
+func TestKeySetRotation(t *testing.T) {
+	oldPEM, _ := ed25519KeyPEM(t)
+	newPEM, _ := rsaKeyPEM(t)
+	userID := uuid.New()
+
+	keys := NewKeySet()
+	if err := keys.AddPrivateKeyPEM("old", oldPEM); err != nil {
+		t.Fatal(err)
+	}
+	oldToken, err := MakeJWT(userID, keys, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid := tokenKeyID(t, oldToken); kid != "old" {
+		t.Errorf("kid = %q, want %q", kid, "old")
+	}
+
+	// the new key is added and made active while the old one still verifies
+	if err := keys.AddPrivateKeyPEM("new", newPEM); err != nil {
+		t.Fatal(err)
+	}
+	if err := keys.SetSigningKey("new"); err != nil {
+		t.Fatal(err)
+	}
+	newToken, err := MakeJWT(userID, keys, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid := tokenKeyID(t, newToken); kid != "new" {
+		t.Errorf("kid = %q, want %q", kid, "new")
+	}
+	for name, token := range map[string]string{"old": oldToken, "new": newToken} {
+		got, err := ValidateJWT(token, keys)
+		if err != nil || got != userID {
+			t.Errorf("token signed by %s key: ValidateJWT = %s, %v", name, got, err)
+		}
+	}
+
+	// retiring the old key leaves its tokens unverifiable
+	retired := NewKeySet()
+	if err := retired.AddPrivateKeyPEM("new", newPEM); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateJWT(oldToken, retired); err == nil {
+		t.Error("token signed by a retired key validated")
+	}
+	if _, err := ValidateJWT(newToken, retired); err != nil {
+		t.Errorf("token signed by the active key: %v", err)
+	}
+}
+
+func TestKeySetLookup(t *testing.T) {
+	aPEM, _ := ed25519KeyPEM(t)
+	bPEM, _ := ed25519KeyPEM(t)
+	userID := uuid.New()
+
+	signer := NewKeySet()
+	if err := signer.AddPrivateKeyPEM("a", aPEM); err != nil {
+		t.Fatal(err)
+	}
+	token, err := MakeJWT(userID, signer, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a key set holding a different key under the same ID must not accept it
+	impostor := NewKeySet()
+	if err := impostor.AddPrivateKeyPEM("a", bPEM); err != nil {
+		t.Fatal(err)
+	}
+
+	hmacWithKid := jwt.NewWithClaims(jwt.SigningMethodHS256, AccessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   userID.String(),
+			Issuer:    string(TokenTypeAccess),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	})
+	hmacWithKid.Header["kid"] = "a"
+	// an HS256 token naming an Ed25519 key is refused whatever it was signed
+	// with
+	confused, err := hmacWithKid.SignedString([]byte("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		keys  *KeySet
+		ok    bool
+	}{
+		{"key named by kid", token, signer, true},
+		{"other key under the same kid", token, impostor, false},
+		{"unknown kid", token, NewHMACKeySet("secret"), false},
+		{"algorithm doesn't match the key", confused, signer, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ValidateJWT(tt.token, tt.keys)
+			if tt.ok && (err != nil || got != userID) {
+				t.Errorf("ValidateJWT = %s, %v; want %s", got, err, userID)
+			}
+			if !tt.ok && err == nil {
+				t.Error("ValidateJWT succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestKeySetLegacyHS256(t *testing.T) {
+	edPEM, _ := ed25519KeyPEM(t)
+	userID := uuid.New()
+
+	legacyToken, err := MakeJWT(userID, NewHMACKeySet("secret"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid := tokenKeyID(t, legacyToken); kid != "" {
+		t.Errorf("HS256 token has kid %q, want none", kid)
+	}
+
+	// after switching to an asymmetric key, the old secret still verifies
+	// the tokens issued before the switch
+	keys := NewHMACKeySet("secret")
+	if err := keys.AddPrivateKeyPEM("ed", edPEM); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ValidateJWT(legacyToken, keys); err != nil || got != userID {
+		t.Errorf("legacy token: ValidateJWT = %s, %v", got, err)
+	}
+	newToken, err := MakeJWT(userID, keys, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid := tokenKeyID(t, newToken); kid != "ed" {
+		t.Errorf("new tokens signed with kid %q, want the asymmetric key", kid)
+	}
+
+	if _, err := ValidateJWT(legacyToken, NewHMACKeySet("other secret")); err == nil {
+		t.Error("legacy token validated with the wrong secret")
+	}
+	withoutSecret := NewKeySet()
+	if err := withoutSecret.AddPrivateKeyPEM("ed", edPEM); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateJWT(legacyToken, withoutSecret); err == nil {
+		t.Error("legacy token validated once the secret was removed")
+	}
+}
+
+func TestKeySetJWKS(t *testing.T) {
+	rsaPEM, rsaPub := rsaKeyPEM(t)
+	edPEM, edPub := ed25519KeyPEM(t)
+
+	keys := NewHMACKeySet("secret")
+	keys.AddHMAC("shared", "another secret")
+	if err := keys.AddPrivateKeyPEM("rsa", rsaPEM); err != nil {
+		t.Fatal(err)
+	}
+	if err := keys.AddPrivateKeyPEM("ed", edPEM); err != nil {
+		t.Fatal(err)
+	}
+
+	set := keys.JWKS()
+	if len(set.Keys) != 2 {
+		t.Fatalf("JWKS has %d keys, want the 2 asymmetric ones: %+v", len(set.Keys), set.Keys)
+	}
+
+	ed, rsaKey := set.Keys[0], set.Keys[1]
+	if ed.KeyID != "ed" || ed.KeyType != "OKP" || ed.Curve != "Ed25519" || ed.Algorithm != "EdDSA" || ed.Use != "sig" {
+		t.Errorf("Ed25519 JWK = %+v", ed)
+	}
+	if x, _ := base64.RawURLEncoding.DecodeString(ed.X); !edPub.Equal(ed25519.PublicKey(x)) {
+		t.Error("Ed25519 JWK x doesn't match the public key")
+	}
+
+	if rsaKey.KeyID != "rsa" || rsaKey.KeyType != "RSA" || rsaKey.Algorithm != "RS256" || rsaKey.Use != "sig" {
+		t.Errorf("RSA JWK = %+v", rsaKey)
+	}
+	n, _ := base64.RawURLEncoding.DecodeString(rsaKey.N)
+	e, _ := base64.RawURLEncoding.DecodeString(rsaKey.E)
+	got := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	if !rsaPub.Equal(got) {
+		t.Error("RSA JWK n and e don't match the public key")
+	}
+}
+
+func TestKeySetRejectsBadKeys(t *testing.T) {
+	edPEM, _ := ed25519KeyPEM(t)
+	keys := NewKeySet()
+
+	if err := keys.AddPrivateKeyPEM("", edPEM); err == nil {
+		t.Error("added an asymmetric key without a key ID")
+	}
+	if err := keys.AddPrivateKeyPEM("ed", []byte("not a key")); err == nil {
+		t.Error("added a key that isn't PEM")
+	}
+	if err := keys.AddPrivateKeyPEM("ed", edPEM); err != nil {
+		t.Fatal(err)
+	}
+	if err := keys.AddPrivateKeyPEM("ed", edPEM); err == nil {
+		t.Error("added a duplicate key ID")
+	}
+	if err := keys.SetSigningKey("missing"); err == nil {
+		t.Error("made an unknown key the signing key")
+	}
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"crypto/rand"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	// TokenTypeMFAChallenge is the issuer of the token handed out after a
+	// correct password when the account also needs a second factor. It
+	// can't be used as an access token.
+	TokenTypeMFAChallenge TokenType = "tubely-mfa-challenge"
+
+	recoveryCodeCount    = 10
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+	recoveryCodeLength   = 10
+)
+
+// MakeMFAChallengeJWT returns a token proving the user got their password
+// right, to be exchanged together with a second factor for a session. It is
+// bound to the user's token version, so changing the password voids it.
+func MakeMFAChallengeJWT(userID uuid.UUID, tokenVersion int, keys *KeySet, expiresIn time.Duration) (string, error) {
+	return keys.sign(AccessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    string(TokenTypeMFAChallenge),
+			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+			Subject:   userID.String(),
+		},
+		Version: tokenVersion,
+	})
+}
+
+// ParseMFAChallengeJWT validates a token made by MakeMFAChallengeJWT and
+// returns its user ID and token version.
+func ParseMFAChallengeJWT(tokenString string, keys *KeySet) (uuid.UUID, int, error) {
+	userID, claims, err := parseToken(tokenString, keys, TokenTypeMFAChallenge)
+	if err != nil {
+		return uuid.Nil, 0, err
+	}
+	return userID, claims.Version, nil
+}
+
+// MakeRecoveryCodes returns a fresh set of single-use recovery codes, in the
+// form "xxxxx-xxxxx", for signing in without the authenticator app.
+func MakeRecoveryCodes() ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	raw := make([]byte, recoveryCodeLength)
+	for range recoveryCodeCount {
+		_, err := rand.Read(raw)
+		if err != nil {
+			return nil, err
+		}
+		var b strings.Builder
+		for i, c := range raw {
+			if i == recoveryCodeLength/2 {
+				b.WriteByte('-')
+			}
+			b.WriteByte(recoveryCodeAlphabet[int(c)%len(recoveryCodeAlphabet)])
+		}
+		codes = append(codes, b.String())
+	}
+	return codes, nil
+}
+
+// NormalizeRecoveryCode puts a recovery code as typed by a user into the form
+// MakeRecoveryCodes produced it in, so it can be hashed and looked up.
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.ReplaceAll(code, " ", "")
+	code = strings.ReplaceAll(code, "-", "")
+	if len(code) != recoveryCodeLength {
+		return code
+	}
+	return code[:recoveryCodeLength/2] + "-" + code[recoveryCodeLength/2:]
+}
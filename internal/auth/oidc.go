@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// TokenTypeOIDCState is the issuer of the token that carries an OpenID
+// Connect login across the round trip to the identity provider.
+const TokenTypeOIDCState TokenType = "tubely-oidc-state"
+
+// OIDCState is what Tubely has to remember between sending a user to an
+// identity provider and the provider sending them back.
+type OIDCState struct {
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	// Verifier is the PKCE code verifier. Only its challenge is sent to
+	// the provider.
+	Verifier string `json:"verifier"`
+}
+
+type oidcStateClaims struct {
+	jwt.RegisteredClaims
+	OIDCState
+}
+
+// MakeOIDCStateJWT signs state so it can be kept in a cookie on the user's
+// browser until the callback.
+func MakeOIDCStateJWT(state OIDCState, keys *KeySet, expiresIn time.Duration) (string, error) {
+	return keys.sign(oidcStateClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    string(TokenTypeOIDCState),
+			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+		},
+		OIDCState: state,
+	})
+}
+
+// ParseOIDCStateJWT validates a token made by MakeOIDCStateJWT and returns
+// the state it carries.
+func ParseOIDCStateJWT(tokenString string, keys *KeySet) (OIDCState, error) {
+	claims := oidcStateClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, &claims, keys.keyFunc)
+	if err != nil {
+		return OIDCState{}, err
+	}
+	if claims.Issuer != string(TokenTypeOIDCState) {
+		return OIDCState{}, errors.New("invalid issuer")
+	}
+	return claims.OIDCState, nil
+}
@@ -0,0 +1,34 @@
+package auth
+
+// Role is a user's account-wide role.
+type Role string
+
+const (
+	// RoleAdmin can do anything, including moderating other users' content.
+	RoleAdmin Role = "admin"
+	// RoleUploader can create and manage their own videos.
+	RoleUploader Role = "uploader"
+	// RoleViewer can only read.
+	RoleViewer Role = "viewer"
+)
+
+// ValidRole reports whether role names one of the known roles.
+func ValidRole(role string) bool {
+	switch Role(role) {
+	case RoleAdmin, RoleUploader, RoleViewer:
+		return true
+	}
+	return false
+}
+
+// Allows reports whether a user with this role may act with scope, whatever
+// credential they authenticate with.
+func (r Role) Allows(scope string) bool {
+	switch r {
+	case RoleAdmin, RoleUploader:
+		return true
+	case RoleViewer:
+		return scope == ScopeVideosRead
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key from the RFC 6238 test vectors, base32 encoded.
+var rfcSecret = totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestValidateTOTP(t *testing.T) {
+	// The RFC vectors are eight digits; these are their last six.
+	tests := []struct {
+		name string
+		unix int64
+		code string
+		ok   bool
+	}{
+		{"rfc 59", 59, "287082", true},
+		{"rfc 1111111109", 1111111109, "081804", true},
+		{"rfc 1111111111", 1111111111, "050471", true},
+		{"rfc 1234567890", 1234567890, "005924", true},
+		{"rfc 2000000000", 2000000000, "279037", true},
+		{"spaces ignored", 1234567890, "005 924", true},
+		{"previous step", 1234567890 + totpPeriod, "005924", true},
+		{"next step", 1234567890 - totpPeriod, "005924", true},
+		{"two steps late", 1234567890 + 2*totpPeriod, "005924", false},
+		{"wrong code", 1234567890, "123456", false},
+		{"too short", 1234567890, "05924", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, ok := ValidateTOTP(rfcSecret, tt.code, time.Unix(tt.unix, 0))
+			if ok != tt.ok {
+				t.Errorf("ValidateTOTP(%q) at %d = %v, want %v", tt.code, tt.unix, ok, tt.ok)
+			}
+		})
+	}
+}
+
+func TestValidateTOTPReturnsStep(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	step, ok := ValidateTOTP(rfcSecret, "005924", now.Add(totpPeriod*time.Second))
+	if !ok {
+		t.Fatal("code rejected")
+	}
+	if want := now.Unix() / totpPeriod; step != want {
+		t.Errorf("step = %d, want %d", step, want)
+	}
+}
+
+func TestValidateTOTPInvalidSecret(t *testing.T) {
+	_, ok := ValidateTOTP("not base32!", "000000", time.Now())
+	if ok {
+		t.Error("code accepted for an invalid secret")
+	}
+}
@@ -1,11 +1,16 @@
 package content
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"math"
 	"os/exec"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type ffmpegVideoStreams struct {
@@ -117,13 +122,75 @@ func GetVideoAspectRatio(filePath string) (string, error) {
 }
 
 func ProcessVideoForFastStart(filePath string) (string, error) {
+	return ProcessVideoForFastStartWithProgress(filePath, nil)
+}
+
+// ProcessVideoForFastStartWithProgress is ProcessVideoForFastStart, calling
+// onProgress with how much of the video ffmpeg has written so far.
+func ProcessVideoForFastStartWithProgress(filePath string, onProgress func(done time.Duration)) (string, error) {
 	newFilePath := fmt.Sprintf("%s.processed", filePath)
-	cmdToRun := exec.Command("ffmpeg", "-i", filePath, "-c", "copy", "-movflags", "faststart", "-f", "mp4", newFilePath)
+	cmdToRun := exec.Command("ffmpeg", "-i", filePath, "-c", "copy", "-movflags", "faststart", "-f", "mp4", "-progress", "pipe:1", "-nostats", newFilePath)
 
-	err := cmdToRun.Run()
+	progressOutput, err := cmdToRun.StdoutPipe()
+	if err != nil {
+		return "", fmt.Errorf("error configuring video file for fast start: %w", err)
+	}
+	err = cmdToRun.Start()
+	if err != nil {
+		return "", fmt.Errorf("error configuring video file for fast start: %w", err)
+	}
+
+	err = readFFmpegProgress(progressOutput, onProgress)
+	if err != nil {
+		// progress is only informational, but ffmpeg can't finish until
+		// its output is read
+		io.Copy(io.Discard, progressOutput)
+	}
+
+	err = cmdToRun.Wait()
 	if err != nil {
 		return "", fmt.Errorf("error configuring video file for fast start: %w", err)
 	}
 
 	return newFilePath, nil
 }
+
+// readFFmpegProgress reads the output of ffmpeg's -progress option, calling
+// onProgress, if set, with each out_time_us it reports.
+func readFFmpegProgress(r io.Reader, onProgress func(done time.Duration)) error {
+	// ffmpeg reports progress as key=value lines, in blocks ending with
+	// progress=continue or progress=end
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok || key != "out_time_us" || onProgress == nil {
+			continue
+		}
+		us, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			// N/A until the first frame is written
+			continue
+		}
+		onProgress(time.Duration(us) * time.Microsecond)
+	}
+	return scanner.Err()
+}
+
+// GetVideoDuration returns the length of the video at filePath.
+func GetVideoDuration(filePath string) (time.Duration, error) {
+	var outputBuffer bytes.Buffer
+
+	cmdToRun := exec.Command("ffprobe", "-v", "error", "-show_entries", "format=duration", "-of", "default=noprint_wrappers=1:nokey=1", filePath)
+	cmdToRun.Stdout = &outputBuffer
+
+	err := cmdToRun.Run()
+	if err != nil {
+		return 0, fmt.Errorf("error running ffprobe command: %w", err)
+	}
+
+	seconds, err := strconv.ParseFloat(strings.TrimSpace(outputBuffer.String()), 64)
+	if err != nil {
+		return 0, fmt.Errorf("error reading video duration: %w", err)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
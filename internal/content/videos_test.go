@@ -0,0 +1,64 @@
+package content
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadFFmpegProgress(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []time.Duration
+	}{
+		{
+			name: "blocks until the end",
+			output: `frame=0
+out_time_us=N/A
+out_time_ms=N/A
+progress=continue
+frame=120
+out_time_us=1500000
+out_time_ms=1500000
+out_time=00:00:01.500000
+progress=continue
+frame=240
+out_time_us=4000000
+progress=end
+`,
+			want: []time.Duration{1500 * time.Millisecond, 4 * time.Second},
+		},
+		{
+			name:   "no out_time_us",
+			output: "frame=0\nspeed=N/A\nprogress=end\n",
+		},
+		{
+			name:   "malformed lines",
+			output: "out_time_us\nout_time_us=soon\n=5\nout_time_us=250\n",
+			want:   []time.Duration{250 * time.Microsecond},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []time.Duration
+			err := readFFmpegProgress(strings.NewReader(tt.output), func(done time.Duration) {
+				got = append(got, done)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("progress = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadFFmpegProgressWithoutCallback(t *testing.T) {
+	err := readFFmpegProgress(strings.NewReader("out_time_us=1000\nprogress=end\n"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
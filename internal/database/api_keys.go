@@ -0,0 +1,153 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type APIKey struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreateAPIKeyParams
+}
+
+type CreateAPIKeyParams struct {
+	UserID uuid.UUID `json:"user_id"`
+	Name   string    `json:"name"`
+	// Prefix is the first few characters of the key, kept in the clear so
+	// users can recognise it. The key itself is only stored hashed.
+	Prefix  string   `json:"prefix"`
+	KeyHash string   `json:"-"`
+	Scopes  []string `json:"scopes"`
+}
+
+func (c Client) CreateAPIKey(params CreateAPIKeyParams) (APIKey, error) {
+	id := uuid.New()
+	query := `
+		INSERT INTO api_keys (
+			id,
+			created_at,
+			user_id,
+			name,
+			prefix,
+			key_hash,
+			scopes
+		) VALUES (?, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?)
+	`
+	_, err := c.db.Exec(
+		query,
+		id.String(),
+		params.UserID.String(),
+		params.Name,
+		params.Prefix,
+		params.KeyHash,
+		strings.Join(params.Scopes, " "),
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return APIKey{}, ErrConflict
+		}
+		return APIKey{}, err
+	}
+
+	return c.getAPIKey("id = ?", id.String())
+}
+
+// GetAPIKeys returns the user's API keys that haven't been revoked.
+func (c Client) GetAPIKeys(userID uuid.UUID) ([]APIKey, error) {
+	query := `
+		SELECT id, created_at, last_used_at, revoked_at, user_id, name, prefix, key_hash, scopes
+		FROM api_keys
+		WHERE user_id = ? AND revoked_at IS NULL
+		ORDER BY created_at DESC
+	`
+	rows, err := c.db.Query(query, userID.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// GetAPIKeyByHash looks up an API key, revoked or not, by the hash of its
+// secret.
+func (c Client) GetAPIKeyByHash(keyHash string) (APIKey, error) {
+	return c.getAPIKey("key_hash = ?", keyHash)
+}
+
+// RevokeAPIKey revokes one of the user's API keys. It returns ErrNotFound if
+// the user has no active key with that ID.
+func (c Client) RevokeAPIKey(userID, id uuid.UUID) error {
+	query := `
+		UPDATE api_keys
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND user_id = ? AND revoked_at IS NULL
+	`
+	return requireRowsAffected(c.db.Exec(query, id.String(), userID.String()))
+}
+
+// TouchAPIKey records that the API key was just used.
+func (c Client) TouchAPIKey(id uuid.UUID) error {
+	query := `
+		UPDATE api_keys
+		SET last_used_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	return requireRowsAffected(c.db.Exec(query, id.String()))
+}
+
+func (c Client) getAPIKey(where string, args ...interface{}) (APIKey, error) {
+	query := `
+		SELECT id, created_at, last_used_at, revoked_at, user_id, name, prefix, key_hash, scopes
+		FROM api_keys
+		WHERE ` + where
+	key, err := scanAPIKey(c.db.QueryRow(query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return APIKey{}, ErrNotFound
+	}
+	return key, err
+}
+
+func scanAPIKey(row rowScanner) (APIKey, error) {
+	var key APIKey
+	var id, userID, scopes string
+	err := row.Scan(
+		&id,
+		&key.CreatedAt,
+		&key.LastUsedAt,
+		&key.RevokedAt,
+		&userID,
+		&key.Name,
+		&key.Prefix,
+		&key.KeyHash,
+		&scopes,
+	)
+	if err != nil {
+		return APIKey{}, err
+	}
+	key.ID, err = uuid.Parse(id)
+	if err != nil {
+		return APIKey{}, err
+	}
+	key.UserID, err = uuid.Parse(userID)
+	if err != nil {
+		return APIKey{}, err
+	}
+	key.Scopes = strings.Fields(scopes)
+	return key, nil
+}
@@ -2,21 +2,40 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
+)
+
+var (
+	// ErrNotFound is returned when the requested row does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a write would violate a uniqueness constraint.
+	ErrConflict = errors.New("conflict")
+	// ErrQuotaExceeded is returned when a write would take a user past
+	// their quota.
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	// ErrModified is returned when a conditional write finds the row has
+	// changed since it was read.
+	ErrModified = errors.New("modified")
 )
 
 type Client struct {
 	db *sql.DB
+	// fts is whether SQLite was built with FTS5 for full-text search.
+	fts bool
 }
 
 func NewClient(pathToDB string) (Client, error) {
-	db, err := sql.Open("sqlite3", pathToDB)
+	// SQLite leaves foreign keys unenforced unless asked, and playlists
+	// rely on them to drop videos that are deleted
+	db, err := sql.Open("sqlite3", pathToDB+"?_foreign_keys=on")
 	if err != nil {
 		return Client{}, err
 	}
-	c := Client{db}
+	c := Client{db: db}
 	err = c.autoMigrate()
 	if err != nil {
 		return Client{}, err
@@ -32,13 +51,88 @@ func (c *Client) autoMigrate() error {
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		password TEXT NOT NULL,
-		email TEXT UNIQUE NOT NULL
+		email TEXT UNIQUE NOT NULL,
+		token_version INTEGER NOT NULL DEFAULT 0,
+		role TEXT NOT NULL DEFAULT 'uploader',
+		disabled_at TIMESTAMP,
+		email_verified_at TIMESTAMP,
+		display_name TEXT NOT NULL DEFAULT '',
+		bio TEXT NOT NULL DEFAULT '',
+		avatar_url TEXT,
+		totp_secret TEXT,
+		totp_enabled_at TIMESTAMP,
+		totp_last_step INTEGER NOT NULL DEFAULT 0,
+		max_upload_size INTEGER,
+		quota_storage_bytes INTEGER,
+		quota_videos INTEGER,
+		quota_upload_minutes INTEGER,
+		active_organization_id TEXT
 	);
 	`
 	_, err := c.db.Exec(userTable)
 	if err != nil {
 		return err
 	}
+	err = c.addColumn("users", "token_version", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	err = c.addColumn("users", "role", "TEXT NOT NULL DEFAULT 'uploader'")
+	if err != nil {
+		return err
+	}
+	err = c.addColumn("users", "disabled_at", "TIMESTAMP")
+	if err != nil {
+		return err
+	}
+	err = c.addColumn("users", "email_verified_at", "TIMESTAMP")
+	if err != nil {
+		return err
+	}
+	err = c.addColumn("users", "display_name", "TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+	err = c.addColumn("users", "bio", "TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+	err = c.addColumn("users", "avatar_url", "TEXT")
+	if err != nil {
+		return err
+	}
+	err = c.addColumn("users", "totp_secret", "TEXT")
+	if err != nil {
+		return err
+	}
+	err = c.addColumn("users", "totp_enabled_at", "TIMESTAMP")
+	if err != nil {
+		return err
+	}
+	err = c.addColumn("users", "totp_last_step", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	err = c.addColumn("users", "max_upload_size", "INTEGER")
+	if err != nil {
+		return err
+	}
+	err = c.addColumn("users", "quota_storage_bytes", "INTEGER")
+	if err != nil {
+		return err
+	}
+	err = c.addColumn("users", "quota_videos", "INTEGER")
+	if err != nil {
+		return err
+	}
+	err = c.addColumn("users", "quota_upload_minutes", "INTEGER")
+	if err != nil {
+		return err
+	}
+	err = c.addColumn("users", "active_organization_id", "TEXT")
+	if err != nil {
+		return err
+	}
 	refreshTokenTable := `
 	CREATE TABLE IF NOT EXISTS refresh_tokens (
 		token TEXT PRIMARY KEY,
@@ -47,6 +141,11 @@ func (c *Client) autoMigrate() error {
 		revoked_at TIMESTAMP,
 		user_id TEXT NOT NULL,
 		expires_at TIMESTAMP NOT NULL,
+		family_id TEXT,
+		replaced_by TEXT,
+		user_agent TEXT,
+		ip_address TEXT,
+		last_used_at TIMESTAMP,
 		FOREIGN KEY(user_id) REFERENCES users(id)
 	);
 	`
@@ -54,6 +153,62 @@ func (c *Client) autoMigrate() error {
 	if err != nil {
 		return err
 	}
+	err = c.addColumn("refresh_tokens", "family_id", "TEXT")
+	if err != nil {
+		return err
+	}
+	err = c.addColumn("refresh_tokens", "replaced_by", "TEXT")
+	if err != nil {
+		return err
+	}
+	err = c.addColumn("refresh_tokens", "user_agent", "TEXT")
+	if err != nil {
+		return err
+	}
+	err = c.addColumn("refresh_tokens", "ip_address", "TEXT")
+	if err != nil {
+		return err
+	}
+	err = c.addColumn("refresh_tokens", "last_used_at", "TIMESTAMP")
+	if err != nil {
+		return err
+	}
+	// tokens issued before rotation existed each start their own family
+	_, err = c.db.Exec(`UPDATE refresh_tokens SET family_id = lower(hex(randomblob(16))) WHERE family_id IS NULL`)
+	if err != nil {
+		return err
+	}
+	_, err = c.db.Exec(`UPDATE refresh_tokens SET last_used_at = created_at WHERE last_used_at IS NULL`)
+	if err != nil {
+		return err
+	}
+
+	organizationTable := `
+	CREATE TABLE IF NOT EXISTS organizations (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		name TEXT NOT NULL,
+		key_prefix TEXT,
+		quota_storage_bytes INTEGER,
+		quota_videos INTEGER,
+		quota_upload_minutes INTEGER
+	);
+	CREATE TABLE IF NOT EXISTS organization_members (
+		organization_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		role TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY(organization_id, user_id),
+		FOREIGN KEY(organization_id) REFERENCES organizations(id) ON DELETE CASCADE,
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	CREATE INDEX IF NOT EXISTS organization_members_user ON organization_members(user_id);
+	`
+	_, err = c.db.Exec(organizationTable)
+	if err != nil {
+		return err
+	}
 
 	videoTable := `
 	CREATE TABLE IF NOT EXISTS videos (
@@ -64,14 +219,286 @@ func (c *Client) autoMigrate() error {
 		description TEXT,
 		thumbnail_url TEXT,
 		video_url TEXT TEXT,
+		video_size INTEGER NOT NULL DEFAULT 0,
+		thumbnail_size INTEGER NOT NULL DEFAULT 0,
+		status TEXT NOT NULL DEFAULT 'draft',
+		orientation TEXT,
+		duration_ms INTEGER NOT NULL DEFAULT 0,
+		visibility TEXT NOT NULL DEFAULT 'private',
 		user_id INTEGER,
-		FOREIGN KEY(user_id) REFERENCES users(id)
+		organization_id TEXT,
+		FOREIGN KEY(user_id) REFERENCES users(id),
+		FOREIGN KEY(organization_id) REFERENCES organizations(id)
 	);
 	`
 	_, err = c.db.Exec(videoTable)
 	if err != nil {
 		return err
 	}
+	err = c.addColumn("videos", "video_size", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	err = c.addColumn("videos", "thumbnail_size", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	err = c.addColumn("videos", "status", "TEXT NOT NULL DEFAULT 'draft'")
+	if err != nil {
+		return err
+	}
+	err = c.addColumn("videos", "orientation", "TEXT")
+	if err != nil {
+		return err
+	}
+	err = c.addColumn("videos", "duration_ms", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	err = c.addColumn("videos", "visibility", "TEXT NOT NULL DEFAULT 'private'")
+	if err != nil {
+		return err
+	}
+	err = c.addColumn("videos", "organization_id", "TEXT REFERENCES organizations(id)")
+	if err != nil {
+		return err
+	}
+	// videos uploaded before statuses were tracked are ready to watch
+	_, err = c.db.Exec(`UPDATE videos SET status = 'ready' WHERE status = 'draft' AND video_url IS NOT NULL`)
+	if err != nil {
+		return err
+	}
+	_, err = c.db.Exec(`CREATE INDEX IF NOT EXISTS videos_user_created ON videos(user_id, created_at, id)`)
+	if err != nil {
+		return err
+	}
+	_, err = c.db.Exec(`CREATE INDEX IF NOT EXISTS videos_organization_created ON videos(organization_id, created_at, id)`)
+	if err != nil {
+		return err
+	}
+	err = c.migrateSearch()
+	if err != nil {
+		return err
+	}
+
+	apiKeyTable := `
+	CREATE TABLE IF NOT EXISTS api_keys (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		last_used_at TIMESTAMP,
+		revoked_at TIMESTAMP,
+		user_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		prefix TEXT NOT NULL,
+		key_hash TEXT UNIQUE NOT NULL,
+		scopes TEXT NOT NULL,
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	`
+	_, err = c.db.Exec(apiKeyTable)
+	if err != nil {
+		return err
+	}
+
+	userTokenTable := `
+	CREATE TABLE IF NOT EXISTS user_tokens (
+		token_hash TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		used_at TIMESTAMP,
+		user_id TEXT NOT NULL,
+		purpose TEXT NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	`
+	_, err = c.db.Exec(userTokenTable)
+	if err != nil {
+		return err
+	}
+
+	recoveryCodeTable := `
+	CREATE TABLE IF NOT EXISTS recovery_codes (
+		user_id TEXT NOT NULL,
+		code_hash TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		used_at TIMESTAMP,
+		PRIMARY KEY(user_id, code_hash),
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	`
+	_, err = c.db.Exec(recoveryCodeTable)
+	if err != nil {
+		return err
+	}
+
+	identityTable := `
+	CREATE TABLE IF NOT EXISTS user_identities (
+		provider TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		last_login_at TIMESTAMP,
+		user_id TEXT NOT NULL,
+		email TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY(provider, subject),
+		UNIQUE(user_id, provider),
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	`
+	_, err = c.db.Exec(identityTable)
+	if err != nil {
+		return err
+	}
+
+	uploadTable := `
+	CREATE TABLE IF NOT EXISTS uploads (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		user_id TEXT NOT NULL,
+		video_id TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		duration_ms INTEGER NOT NULL,
+		organization_id TEXT,
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	CREATE INDEX IF NOT EXISTS uploads_user_created ON uploads(user_id, created_at);
+	`
+	_, err = c.db.Exec(uploadTable)
+	if err != nil {
+		return err
+	}
+	err = c.addColumn("uploads", "organization_id", "TEXT")
+	if err != nil {
+		return err
+	}
+	_, err = c.db.Exec(`CREATE INDEX IF NOT EXISTS uploads_organization_created ON uploads(organization_id, created_at)`)
+	if err != nil {
+		return err
+	}
+
+	tagTable := `
+	CREATE TABLE IF NOT EXISTS tags (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		name TEXT UNIQUE NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS video_tags (
+		video_id TEXT NOT NULL,
+		tag_id TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY(video_id, tag_id),
+		FOREIGN KEY(video_id) REFERENCES videos(id),
+		FOREIGN KEY(tag_id) REFERENCES tags(id)
+	);
+	CREATE INDEX IF NOT EXISTS video_tags_tag ON video_tags(tag_id);
+	`
+	_, err = c.db.Exec(tagTable)
+	if err != nil {
+		return err
+	}
+
+	playlistTable := `
+	CREATE TABLE IF NOT EXISTS playlists (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		title TEXT NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		visibility TEXT NOT NULL DEFAULT 'private',
+		user_id TEXT NOT NULL,
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	CREATE INDEX IF NOT EXISTS playlists_user_created ON playlists(user_id, created_at);
+	CREATE TABLE IF NOT EXISTS playlist_videos (
+		playlist_id TEXT NOT NULL,
+		video_id TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY(playlist_id, video_id),
+		FOREIGN KEY(playlist_id) REFERENCES playlists(id) ON DELETE CASCADE,
+		FOREIGN KEY(video_id) REFERENCES videos(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS playlist_videos_video ON playlist_videos(video_id);
+	`
+	_, err = c.db.Exec(playlistTable)
+	if err != nil {
+		return err
+	}
+
+	shareLinkTable := `
+	CREATE TABLE IF NOT EXISTS share_links (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		video_id TEXT NOT NULL,
+		token_hash TEXT UNIQUE NOT NULL,
+		password_hash TEXT,
+		expires_at TIMESTAMP,
+		max_views INTEGER,
+		views INTEGER NOT NULL DEFAULT 0,
+		last_viewed_at TIMESTAMP,
+		revoked_at TIMESTAMP,
+		FOREIGN KEY(video_id) REFERENCES videos(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS share_links_video ON share_links(video_id);
+	`
+	_, err = c.db.Exec(shareLinkTable)
+	if err != nil {
+		return err
+	}
+
+	videoPermissionTable := `
+	CREATE TABLE IF NOT EXISTS video_permissions (
+		video_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		role TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY(video_id, user_id),
+		FOREIGN KEY(video_id) REFERENCES videos(id) ON DELETE CASCADE,
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	CREATE INDEX IF NOT EXISTS video_permissions_user ON video_permissions(user_id);
+	`
+	_, err = c.db.Exec(videoPermissionTable)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// addColumn brings a table created by an older version of autoMigrate up to
+// date by adding the column if it is missing.
+func (c *Client) addColumn(table, column, definition string) error {
+	rows, err := c.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = c.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+	}
 	return nil
 }
 
@@ -79,11 +506,98 @@ func (c Client) Reset() error {
 	if _, err := c.db.Exec("DELETE FROM refresh_tokens"); err != nil {
 		return fmt.Errorf("failed to reset table refresh_tokens: %w", err)
 	}
-	if _, err := c.db.Exec("DELETE FROM users"); err != nil {
-		return fmt.Errorf("failed to reset table users: %w", err)
+	if _, err := c.db.Exec("DELETE FROM api_keys"); err != nil {
+		return fmt.Errorf("failed to reset table api_keys: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM user_tokens"); err != nil {
+		return fmt.Errorf("failed to reset table user_tokens: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM recovery_codes"); err != nil {
+		return fmt.Errorf("failed to reset table recovery_codes: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM user_identities"); err != nil {
+		return fmt.Errorf("failed to reset table user_identities: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM uploads"); err != nil {
+		return fmt.Errorf("failed to reset table uploads: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM video_tags"); err != nil {
+		return fmt.Errorf("failed to reset table video_tags: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM tags"); err != nil {
+		return fmt.Errorf("failed to reset table tags: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM playlist_videos"); err != nil {
+		return fmt.Errorf("failed to reset table playlist_videos: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM playlists"); err != nil {
+		return fmt.Errorf("failed to reset table playlists: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM share_links"); err != nil {
+		return fmt.Errorf("failed to reset table share_links: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM video_permissions"); err != nil {
+		return fmt.Errorf("failed to reset table video_permissions: %w", err)
 	}
 	if _, err := c.db.Exec("DELETE FROM videos"); err != nil {
 		return fmt.Errorf("failed to reset table videos: %w", err)
 	}
+	if _, err := c.db.Exec("DELETE FROM organization_members"); err != nil {
+		return fmt.Errorf("failed to reset table organization_members: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM organizations"); err != nil {
+		return fmt.Errorf("failed to reset table organizations: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM users"); err != nil {
+		return fmt.Errorf("failed to reset table users: %w", err)
+	}
+	return nil
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// isUniqueViolation reports whether err came from SQLite rejecting a write
+// because of a UNIQUE or PRIMARY KEY constraint.
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique ||
+		sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+}
+
+// parseTimestamp parses a timestamp returned by an expression, such as an
+// aggregate, that SQLite doesn't report as a TIMESTAMP column.
+func parseTimestamp(value string) (time.Time, error) {
+	for _, layout := range sqlite3.SQLiteTimestampFormats {
+		t, err := time.ParseInLocation(layout, value, time.UTC)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized timestamp %q", value)
+}
+
+// requireRowsAffected turns a write that matched no rows into ErrNotFound.
+func requireRowsAffected(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
 	return nil
 }
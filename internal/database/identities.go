@@ -0,0 +1,127 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Identity links a user to an account at an external OpenID Connect
+// provider.
+type Identity struct {
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+	CreateIdentityParams
+}
+
+type CreateIdentityParams struct {
+	UserID   uuid.UUID `json:"user_id"`
+	Provider string    `json:"provider"`
+	// Subject is the provider's stable identifier for the account.
+	Subject string `json:"subject"`
+	// Email is the address the provider reported when the identity was
+	// linked. It is informational only.
+	Email string `json:"email"`
+}
+
+// CreateIdentity links an external identity to a user. It returns
+// ErrConflict if the identity is already linked, or if the user already has
+// an identity at the provider.
+func (c Client) CreateIdentity(params CreateIdentityParams) (Identity, error) {
+	query := `
+		INSERT INTO user_identities (
+			provider,
+			subject,
+			created_at,
+			user_id,
+			email
+		) VALUES (?, ?, CURRENT_TIMESTAMP, ?, ?)
+	`
+	_, err := c.db.Exec(query, params.Provider, params.Subject, params.UserID.String(), params.Email)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return Identity{}, ErrConflict
+		}
+		return Identity{}, err
+	}
+	return c.GetIdentity(params.Provider, params.Subject)
+}
+
+func (c Client) GetIdentity(provider, subject string) (Identity, error) {
+	query := `
+		SELECT provider, subject, created_at, last_login_at, user_id, email
+		FROM user_identities
+		WHERE provider = ? AND subject = ?
+	`
+	identity, err := scanIdentity(c.db.QueryRow(query, provider, subject))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Identity{}, ErrNotFound
+	}
+	return identity, err
+}
+
+func (c Client) GetIdentities(userID uuid.UUID) ([]Identity, error) {
+	query := `
+		SELECT provider, subject, created_at, last_login_at, user_id, email
+		FROM user_identities
+		WHERE user_id = ?
+		ORDER BY created_at
+	`
+	rows, err := c.db.Query(query, userID.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []Identity{}
+	for rows.Next() {
+		identity, err := scanIdentity(rows)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+	return identities, rows.Err()
+}
+
+// TouchIdentity records that the user just logged in with the identity.
+func (c Client) TouchIdentity(provider, subject string) error {
+	query := `
+		UPDATE user_identities
+		SET last_login_at = CURRENT_TIMESTAMP
+		WHERE provider = ? AND subject = ?
+	`
+	return requireRowsAffected(c.db.Exec(query, provider, subject))
+}
+
+// DeleteIdentity unlinks the user's identity at provider.
+func (c Client) DeleteIdentity(userID uuid.UUID, provider string) error {
+	query := `
+		DELETE FROM user_identities
+		WHERE user_id = ? AND provider = ?
+	`
+	return requireRowsAffected(c.db.Exec(query, userID.String(), provider))
+}
+
+func scanIdentity(row rowScanner) (Identity, error) {
+	var identity Identity
+	var userID string
+	err := row.Scan(
+		&identity.Provider,
+		&identity.Subject,
+		&identity.CreatedAt,
+		&identity.LastLoginAt,
+		&userID,
+		&identity.Email,
+	)
+	if err != nil {
+		return Identity{}, err
+	}
+	identity.UserID, err = uuid.Parse(userID)
+	if err != nil {
+		return Identity{}, err
+	}
+	return identity, nil
+}
@@ -0,0 +1,1874 @@
+package database
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemoryStore is a thread-safe, in-memory implementation of Store. It mirrors
+// the behaviour of Client closely enough to back handler tests without a
+// SQLite file.
+type MemoryStore struct {
+	mu            sync.RWMutex
+	users         map[uuid.UUID]User
+	videos        map[uuid.UUID]Video
+	refreshTokens map[string]RefreshToken
+	apiKeys       map[uuid.UUID]APIKey
+	userTokens    map[string]UserToken
+	// recoveryCodes maps user ID to code hash to when it was used.
+	recoveryCodes map[uuid.UUID]map[string]*time.Time
+	identities    map[identityKey]Identity
+	uploads       []upload
+	playlists     map[uuid.UUID]Playlist
+	// playlistVideos maps playlist ID to its videos in order.
+	playlistVideos map[uuid.UUID][]uuid.UUID
+	shareLinks     map[uuid.UUID]ShareLink
+	// videoPermissions holds roles without the collaborator's email, which
+	// is filled in when they're read.
+	videoPermissions map[videoPermissionKey]VideoPermission
+	organizations    map[uuid.UUID]Organization
+	// organizationMembers holds members without their email, which is
+	// filled in when they're read.
+	organizationMembers map[organizationMemberKey]OrganizationMember
+}
+
+type upload struct {
+	createdAt time.Time
+	RecordUploadParams
+}
+
+type identityKey struct {
+	provider, subject string
+}
+
+type videoPermissionKey struct {
+	videoID, userID uuid.UUID
+}
+
+type organizationMemberKey struct {
+	orgID, userID uuid.UUID
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:          map[uuid.UUID]User{},
+		videos:         map[uuid.UUID]Video{},
+		refreshTokens:  map[string]RefreshToken{},
+		apiKeys:        map[uuid.UUID]APIKey{},
+		userTokens:     map[string]UserToken{},
+		recoveryCodes:  map[uuid.UUID]map[string]*time.Time{},
+		identities:     map[identityKey]Identity{},
+		playlists:      map[uuid.UUID]Playlist{},
+		playlistVideos: map[uuid.UUID][]uuid.UUID{},
+		shareLinks:     map[uuid.UUID]ShareLink{},
+
+		videoPermissions: map[videoPermissionKey]VideoPermission{},
+		organizations:    map[uuid.UUID]Organization{},
+
+		organizationMembers: map[organizationMemberKey]OrganizationMember{},
+	}
+}
+
+func (m *MemoryStore) Reset() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.users = map[uuid.UUID]User{}
+	m.videos = map[uuid.UUID]Video{}
+	m.refreshTokens = map[string]RefreshToken{}
+	m.apiKeys = map[uuid.UUID]APIKey{}
+	m.userTokens = map[string]UserToken{}
+	m.recoveryCodes = map[uuid.UUID]map[string]*time.Time{}
+	m.identities = map[identityKey]Identity{}
+	m.uploads = nil
+	m.playlists = map[uuid.UUID]Playlist{}
+	m.playlistVideos = map[uuid.UUID][]uuid.UUID{}
+	m.shareLinks = map[uuid.UUID]ShareLink{}
+	m.videoPermissions = map[videoPermissionKey]VideoPermission{}
+	m.organizations = map[uuid.UUID]Organization{}
+	m.organizationMembers = map[organizationMemberKey]OrganizationMember{}
+	return nil
+}
+
+func (m *MemoryStore) GetUsers() ([]User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	users := []User{}
+	for _, user := range m.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].CreatedAt.Before(users[j].CreatedAt)
+	})
+	return users, nil
+}
+
+func (m *MemoryStore) GetUserByEmail(email string) (User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, user := range m.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return User{}, ErrNotFound
+}
+
+func (m *MemoryStore) GetUserByRefreshToken(token string) (*User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rt, ok := m.refreshTokens[token]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	user, ok := m.users[rt.UserID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &user, nil
+}
+
+func (m *MemoryStore) CreateUser(params CreateUserParams) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, user := range m.users {
+		if user.Email == params.Email {
+			return nil, fmt.Errorf("%w: email already in use", ErrConflict)
+		}
+	}
+
+	if params.Role == "" {
+		params.Role = defaultUserRole
+	}
+
+	now := time.Now().UTC()
+	user := User{
+		ID:               uuid.New(),
+		CreatedAt:        now,
+		UpdatedAt:        now,
+		CreateUserParams: params,
+	}
+	m.users[user.ID] = user
+	return &user, nil
+}
+
+func (m *MemoryStore) GetUser(id uuid.UUID) (*User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &user, nil
+}
+
+func (m *MemoryStore) IncrementTokenVersion(id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	user.TokenVersion++
+	user.UpdatedAt = time.Now().UTC()
+	m.users[id] = user
+	return nil
+}
+
+func (m *MemoryStore) SetUserRole(id uuid.UUID, role string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Role = role
+	user.UpdatedAt = time.Now().UTC()
+	m.users[id] = user
+	return nil
+}
+
+func (m *MemoryStore) SetUserDisabled(id uuid.UUID, disabled bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	now := time.Now().UTC()
+	user.DisabledAt = nil
+	if disabled {
+		user.DisabledAt = &now
+		user.TokenVersion++
+	}
+	user.UpdatedAt = now
+	m.users[id] = user
+	return nil
+}
+
+func (m *MemoryStore) SetUserMaxUploadSize(id uuid.UUID, size *int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	user.MaxUploadSize = size
+	user.UpdatedAt = time.Now().UTC()
+	m.users[id] = user
+	return nil
+}
+
+func (m *MemoryStore) SetUserPassword(id uuid.UUID, passwordHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Password = passwordHash
+	user.UpdatedAt = time.Now().UTC()
+	m.users[id] = user
+	return nil
+}
+
+func (m *MemoryStore) MarkEmailVerified(id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	now := time.Now().UTC()
+	if user.EmailVerifiedAt == nil {
+		user.EmailVerifiedAt = &now
+	}
+	user.UpdatedAt = now
+	m.users[id] = user
+	return nil
+}
+
+func (m *MemoryStore) UpdateUserProfile(id uuid.UUID, profile UserProfile) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	user.UserProfile = profile
+	user.UpdatedAt = time.Now().UTC()
+	m.users[id] = user
+	return nil
+}
+
+func (m *MemoryStore) SetUserEmail(id uuid.UUID, email string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	for otherID, other := range m.users {
+		if otherID != id && other.Email == email {
+			return fmt.Errorf("%w: email already in use", ErrConflict)
+		}
+	}
+	user.Email = email
+	user.EmailVerifiedAt = nil
+	user.UpdatedAt = time.Now().UTC()
+	m.users[id] = user
+	return nil
+}
+
+func (m *MemoryStore) DeleteUser(id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[id]; !ok {
+		return ErrNotFound
+	}
+	for key, member := range m.organizationMembers {
+		if key.userID != id || member.Role != OrganizationRoleOwner {
+			continue
+		}
+		if _, ok := m.otherOwner(key.orgID, id); !ok {
+			return fmt.Errorf("%w: user is the last owner of an organization", ErrConflict)
+		}
+	}
+	delete(m.users, id)
+	for videoID, video := range m.videos {
+		if video.UserID != id {
+			continue
+		}
+		if video.OrganizationID != nil {
+			video.UserID, _ = m.otherOwner(*video.OrganizationID, id)
+			m.videos[videoID] = video
+			continue
+		}
+		m.deleteVideo(videoID)
+	}
+	for key := range m.organizationMembers {
+		if key.userID == id {
+			delete(m.organizationMembers, key)
+		}
+	}
+	for playlistID, playlist := range m.playlists {
+		if playlist.UserID == id {
+			delete(m.playlists, playlistID)
+			delete(m.playlistVideos, playlistID)
+		}
+	}
+	for key := range m.videoPermissions {
+		if key.userID == id {
+			delete(m.videoPermissions, key)
+		}
+	}
+	for token, rt := range m.refreshTokens {
+		if rt.UserID == id {
+			delete(m.refreshTokens, token)
+		}
+	}
+	for keyID, key := range m.apiKeys {
+		if key.UserID == id {
+			delete(m.apiKeys, keyID)
+		}
+	}
+	for hash, token := range m.userTokens {
+		if token.UserID == id {
+			delete(m.userTokens, hash)
+		}
+	}
+	delete(m.recoveryCodes, id)
+	for key, identity := range m.identities {
+		if identity.UserID == id {
+			delete(m.identities, key)
+		}
+	}
+	uploads := m.uploads[:0]
+	for _, u := range m.uploads {
+		if u.UserID != id {
+			uploads = append(uploads, u)
+			continue
+		}
+		if u.OrganizationID != nil {
+			u.UserID, _ = m.otherOwner(*u.OrganizationID, id)
+			uploads = append(uploads, u)
+		}
+	}
+	m.uploads = uploads
+	return nil
+}
+
+func (m *MemoryStore) GetVideos(userID uuid.UUID) ([]Video, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	videos := []Video{}
+	for _, video := range m.videos {
+		if inVideoScope(video, userID, nil) {
+			videos = append(videos, video)
+		}
+	}
+	sort.Slice(videos, func(i, j int) bool {
+		if videos[i].CreatedAt.Equal(videos[j].CreatedAt) {
+			return videos[i].ID.String() > videos[j].ID.String()
+		}
+		return videos[i].CreatedAt.After(videos[j].CreatedAt)
+	})
+	return videos, nil
+}
+
+func (m *MemoryStore) CreateVideo(params CreateVideoParams) (Video, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	video := Video{
+		ID:                uuid.New(),
+		CreatedAt:         now,
+		UpdatedAt:         now,
+		Status:            VideoStatusDraft,
+		Tags:              []string{},
+		CreateVideoParams: params,
+	}
+	m.videos[video.ID] = video
+	return video, nil
+}
+
+func (m *MemoryStore) GetVideo(id uuid.UUID) (Video, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	video, ok := m.videos[id]
+	if !ok {
+		return Video{}, ErrNotFound
+	}
+	return video, nil
+}
+
+func (m *MemoryStore) UpdateVideo(video Video) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.updateVideo(video)
+}
+
+func (m *MemoryStore) UpdateVideoMeta(id uuid.UUID, params UpdateVideoMetaParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	video, ok := m.videos[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if params.UnmodifiedSince != nil && !video.UpdatedAt.Equal(*params.UnmodifiedSince) {
+		return ErrModified
+	}
+	if params.Title != nil {
+		video.Title = *params.Title
+	}
+	if params.Description != nil {
+		video.Description = *params.Description
+	}
+	if params.Visibility != nil {
+		video.Visibility = *params.Visibility
+	}
+	video.UpdatedAt = time.Now().UTC()
+	m.videos[id] = video
+	return nil
+}
+
+func (m *MemoryStore) updateVideo(video Video) error {
+	existing, ok := m.videos[video.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	existing.UpdatedAt = time.Now().UTC()
+	existing.Title = video.Title
+	existing.Description = video.Description
+	existing.ThumbnailURL = video.ThumbnailURL
+	existing.VideoURL = video.VideoURL
+	existing.VideoSize = video.VideoSize
+	existing.ThumbnailSize = video.ThumbnailSize
+	existing.Status = video.Status
+	existing.Orientation = video.Orientation
+	existing.DurationMs = video.DurationMs
+	existing.Visibility = video.Visibility
+	existing.UserID = video.UserID
+	existing.OrganizationID = video.OrganizationID
+	m.videos[video.ID] = existing
+	return nil
+}
+
+func (m *MemoryStore) SetVideoStatus(id uuid.UUID, status string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	video, ok := m.videos[id]
+	if !ok {
+		return ErrNotFound
+	}
+	video.Status = status
+	video.UpdatedAt = time.Now().UTC()
+	m.videos[id] = video
+	return nil
+}
+
+func (m *MemoryStore) SetVideoOwner(id, userID uuid.UUID, organizationID *uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	video, ok := m.videos[id]
+	if !ok {
+		return ErrNotFound
+	}
+	video.UserID = userID
+	video.OrganizationID = organizationID
+	video.UpdatedAt = time.Now().UTC()
+	m.videos[id] = video
+	return nil
+}
+
+func (m *MemoryStore) SetVideoThumbnail(id uuid.UUID, url string, size int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	video, ok := m.videos[id]
+	if !ok {
+		return ErrNotFound
+	}
+	video.ThumbnailURL = &url
+	video.ThumbnailSize = size
+	video.UpdatedAt = time.Now().UTC()
+	m.videos[id] = video
+	return nil
+}
+
+func (m *MemoryStore) ListVideos(params ListVideosParams) ([]Video, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	// compare orders videos the way ListVideos is asked to, ignoring
+	// direction
+	compare := func(a, b Video) int {
+		var c int
+		switch params.Sort {
+		case VideoSortTitle:
+			c = strings.Compare(a.Title, b.Title)
+		case VideoSortDuration:
+			c = cmp.Compare(a.DurationMs, b.DurationMs)
+		default:
+			c = a.CreatedAt.Compare(b.CreatedAt)
+		}
+		if c == 0 {
+			c = strings.Compare(a.ID.String(), b.ID.String())
+		}
+		if params.Descending {
+			c = -c
+		}
+		return c
+	}
+
+	var after Video
+	if params.After != nil {
+		after = Video{
+			ID:                params.After.ID,
+			CreatedAt:         params.After.CreatedAt,
+			DurationMs:        params.After.DurationMs,
+			CreateVideoParams: CreateVideoParams{Title: params.After.Title},
+		}
+	}
+
+	videos := []Video{}
+	for _, video := range m.videos {
+		if !inVideoScope(video, params.UserID, params.OrganizationID) {
+			continue
+		}
+		if params.HasVideo != nil && (video.VideoURL != nil) != *params.HasVideo {
+			continue
+		}
+		if params.HasThumbnail != nil && (video.ThumbnailURL != nil) != *params.HasThumbnail {
+			continue
+		}
+		if params.Orientation != "" && (video.Orientation == nil || *video.Orientation != params.Orientation) {
+			continue
+		}
+		if params.Status != "" && video.Status != params.Status {
+			continue
+		}
+		if !hasAllTags(video, params.Tags) {
+			continue
+		}
+		if params.CreatedAfter != nil && video.CreatedAt.Before(*params.CreatedAfter) {
+			continue
+		}
+		if params.CreatedBefore != nil && !video.CreatedAt.Before(*params.CreatedBefore) {
+			continue
+		}
+		if params.After != nil && compare(video, after) <= 0 {
+			continue
+		}
+		videos = append(videos, video)
+	}
+	slices.SortFunc(videos, compare)
+	if len(videos) > params.Limit {
+		videos = videos[:params.Limit]
+	}
+	return videos, nil
+}
+
+func (m *MemoryStore) DeleteVideo(id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.videos[id]; !ok {
+		return ErrNotFound
+	}
+	m.deleteVideo(id)
+	return nil
+}
+
+// deleteVideo deletes the video, its share links and collaborators and
+// takes it out of every playlist, as the foreign keys do in SQLite.
+func (m *MemoryStore) deleteVideo(id uuid.UUID) {
+	delete(m.videos, id)
+	for linkID, link := range m.shareLinks {
+		if link.VideoID == id {
+			delete(m.shareLinks, linkID)
+		}
+	}
+	for key := range m.videoPermissions {
+		if key.videoID == id {
+			delete(m.videoPermissions, key)
+		}
+	}
+	for playlistID, ids := range m.playlistVideos {
+		m.playlistVideos[playlistID] = slices.DeleteFunc(ids, func(videoID uuid.UUID) bool {
+			return videoID == id
+		})
+	}
+}
+
+func (m *MemoryStore) CreateRefreshToken(params CreateRefreshTokenParams) (RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.createRefreshToken(params)
+}
+
+func (m *MemoryStore) createRefreshToken(params CreateRefreshTokenParams) (RefreshToken, error) {
+	if _, ok := m.refreshTokens[params.Token]; ok {
+		return RefreshToken{}, ErrConflict
+	}
+	if params.FamilyID == "" {
+		params.FamilyID = uuid.NewString()
+	}
+
+	now := time.Now().UTC()
+	rt := RefreshToken{
+		CreateRefreshTokenParams: params,
+		CreatedAt:                now,
+		UpdatedAt:                now,
+		LastUsedAt:               now,
+	}
+	m.refreshTokens[params.Token] = rt
+	return rt, nil
+}
+
+func (m *MemoryStore) RotateRefreshToken(oldToken string, params CreateRefreshTokenParams) (RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	old, ok := m.refreshTokens[oldToken]
+	if !ok || old.RevokedAt != nil {
+		return RefreshToken{}, ErrConflict
+	}
+	rt, err := m.createRefreshToken(params)
+	if err != nil {
+		return RefreshToken{}, err
+	}
+
+	now := time.Now().UTC()
+	old.RevokedAt = &now
+	old.UpdatedAt = now
+	old.ReplacedBy = &params.Token
+	m.refreshTokens[oldToken] = old
+	return rt, nil
+}
+
+func (m *MemoryStore) RevokeRefreshTokenFamily(familyID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.revokeRefreshTokensWhere(func(rt RefreshToken) bool {
+		return rt.FamilyID == familyID
+	})
+	return nil
+}
+
+func (m *MemoryStore) RevokeRefreshToken(token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rt, ok := m.refreshTokens[token]
+	if !ok {
+		return ErrNotFound
+	}
+	now := time.Now().UTC()
+	rt.RevokedAt = &now
+	m.refreshTokens[token] = rt
+	return nil
+}
+
+func (m *MemoryStore) GetRefreshToken(token string) (RefreshToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rt, ok := m.refreshTokens[token]
+	if !ok {
+		return RefreshToken{}, ErrNotFound
+	}
+	return rt, nil
+}
+
+func (m *MemoryStore) DeleteRefreshToken(token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.refreshTokens[token]; !ok {
+		return ErrNotFound
+	}
+	delete(m.refreshTokens, token)
+	return nil
+}
+
+func (m *MemoryStore) GetSessions(userID uuid.UUID) ([]Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	started := map[string]time.Time{}
+	for _, rt := range m.refreshTokens {
+		if first, ok := started[rt.FamilyID]; !ok || rt.CreatedAt.Before(first) {
+			started[rt.FamilyID] = rt.CreatedAt
+		}
+	}
+
+	now := time.Now().UTC()
+	sessions := []Session{}
+	for _, rt := range m.refreshTokens {
+		if rt.UserID != userID || rt.RevokedAt != nil || !rt.ExpiresAt.After(now) {
+			continue
+		}
+		sessions = append(sessions, Session{
+			ID:         rt.FamilyID,
+			UserID:     rt.UserID,
+			CreatedAt:  started[rt.FamilyID],
+			LastUsedAt: rt.LastUsedAt,
+			ExpiresAt:  rt.ExpiresAt,
+			UserAgent:  rt.UserAgent,
+			IPAddress:  rt.IPAddress,
+		})
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+	})
+	return sessions, nil
+}
+
+func (m *MemoryStore) IsSessionActive(sessionID string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, rt := range m.refreshTokens {
+		if rt.FamilyID == sessionID && rt.RevokedAt == nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MemoryStore) RevokeSession(userID uuid.UUID, sessionID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := m.revokeRefreshTokensWhere(func(rt RefreshToken) bool {
+		return rt.UserID == userID && rt.FamilyID == sessionID
+	})
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *MemoryStore) RevokeOtherSessions(userID uuid.UUID, keepSessionID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.revokeRefreshTokensWhere(func(rt RefreshToken) bool {
+		return rt.UserID == userID && rt.FamilyID != keepSessionID
+	})
+	return nil
+}
+
+// revokeRefreshTokensWhere revokes every active token matching the predicate
+// and returns how many were revoked. The caller must hold the write lock.
+func (m *MemoryStore) revokeRefreshTokensWhere(match func(RefreshToken) bool) int {
+	now := time.Now().UTC()
+	n := 0
+	for token, rt := range m.refreshTokens {
+		if rt.RevokedAt == nil && match(rt) {
+			rt.RevokedAt = &now
+			rt.UpdatedAt = now
+			m.refreshTokens[token] = rt
+			n++
+		}
+	}
+	return n
+}
+
+func (m *MemoryStore) CreateAPIKey(params CreateAPIKeyParams) (APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, key := range m.apiKeys {
+		if key.KeyHash == params.KeyHash {
+			return APIKey{}, ErrConflict
+		}
+	}
+
+	key := APIKey{
+		ID:                 uuid.New(),
+		CreatedAt:          time.Now().UTC(),
+		CreateAPIKeyParams: params,
+	}
+	key.Scopes = append([]string(nil), params.Scopes...)
+	m.apiKeys[key.ID] = key
+	return key, nil
+}
+
+func (m *MemoryStore) GetAPIKeys(userID uuid.UUID) ([]APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := []APIKey{}
+	for _, key := range m.apiKeys {
+		if key.UserID == userID && key.RevokedAt == nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+func (m *MemoryStore) GetAPIKeyByHash(keyHash string) (APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, key := range m.apiKeys {
+		if key.KeyHash == keyHash {
+			return key, nil
+		}
+	}
+	return APIKey{}, ErrNotFound
+}
+
+func (m *MemoryStore) RevokeAPIKey(userID, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, ok := m.apiKeys[id]
+	if !ok || key.UserID != userID || key.RevokedAt != nil {
+		return ErrNotFound
+	}
+	now := time.Now().UTC()
+	key.RevokedAt = &now
+	m.apiKeys[id] = key
+	return nil
+}
+
+func (m *MemoryStore) TouchAPIKey(id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, ok := m.apiKeys[id]
+	if !ok {
+		return ErrNotFound
+	}
+	now := time.Now().UTC()
+	key.LastUsedAt = &now
+	m.apiKeys[id] = key
+	return nil
+}
+
+func (m *MemoryStore) CreateUserToken(params CreateUserTokenParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.userTokens[params.TokenHash]; ok {
+		return ErrConflict
+	}
+	for hash, token := range m.userTokens {
+		if token.UserID == params.UserID && token.Purpose == params.Purpose && token.UsedAt == nil {
+			delete(m.userTokens, hash)
+		}
+	}
+	m.userTokens[params.TokenHash] = UserToken{
+		CreatedAt:             time.Now().UTC(),
+		CreateUserTokenParams: params,
+	}
+	return nil
+}
+
+func (m *MemoryStore) ConsumeUserToken(purpose, tokenHash string) (UserToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, ok := m.userTokens[tokenHash]
+	if !ok || token.Purpose != purpose || token.UsedAt != nil || time.Now().After(token.ExpiresAt) {
+		return UserToken{}, ErrNotFound
+	}
+	now := time.Now().UTC()
+	token.UsedAt = &now
+	m.userTokens[tokenHash] = token
+	return token, nil
+}
+
+func (m *MemoryStore) SetTOTPSecret(id uuid.UUID, secret string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	user.TOTPSecret = &secret
+	user.TOTPEnabledAt = nil
+	user.TOTPLastStep = 0
+	user.UpdatedAt = time.Now().UTC()
+	m.users[id] = user
+	return nil
+}
+
+func (m *MemoryStore) EnableTOTP(id uuid.UUID, codeHashes []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok || user.TOTPSecret == nil {
+		return ErrNotFound
+	}
+	now := time.Now().UTC()
+	user.TOTPEnabledAt = &now
+	user.UpdatedAt = now
+	m.users[id] = user
+	m.replaceRecoveryCodes(id, codeHashes)
+	return nil
+}
+
+func (m *MemoryStore) DisableTOTP(id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	user.TOTPSecret = nil
+	user.TOTPEnabledAt = nil
+	user.TOTPLastStep = 0
+	user.UpdatedAt = time.Now().UTC()
+	m.users[id] = user
+	delete(m.recoveryCodes, id)
+	return nil
+}
+
+func (m *MemoryStore) UseTOTPStep(id uuid.UUID, step int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok || user.TOTPLastStep >= step {
+		return fmt.Errorf("%w: code already used", ErrConflict)
+	}
+	user.TOTPLastStep = step
+	m.users[id] = user
+	return nil
+}
+
+func (m *MemoryStore) ReplaceRecoveryCodes(id uuid.UUID, codeHashes []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.replaceRecoveryCodes(id, codeHashes)
+	return nil
+}
+
+// replaceRecoveryCodes must be called with the write lock held.
+func (m *MemoryStore) replaceRecoveryCodes(id uuid.UUID, codeHashes []string) {
+	codes := map[string]*time.Time{}
+	for _, hash := range codeHashes {
+		codes[hash] = nil
+	}
+	m.recoveryCodes[id] = codes
+}
+
+func (m *MemoryStore) UseRecoveryCode(id uuid.UUID, codeHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	usedAt, ok := m.recoveryCodes[id][codeHash]
+	if !ok || usedAt != nil {
+		return ErrNotFound
+	}
+	now := time.Now().UTC()
+	m.recoveryCodes[id][codeHash] = &now
+	return nil
+}
+
+func (m *MemoryStore) CountRecoveryCodes(id uuid.UUID) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	n := 0
+	for _, usedAt := range m.recoveryCodes[id] {
+		if usedAt == nil {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *MemoryStore) CreateIdentity(params CreateIdentityParams) (Identity, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := identityKey{params.Provider, params.Subject}
+	if _, ok := m.identities[key]; ok {
+		return Identity{}, ErrConflict
+	}
+	for _, identity := range m.identities {
+		if identity.UserID == params.UserID && identity.Provider == params.Provider {
+			return Identity{}, ErrConflict
+		}
+	}
+	identity := Identity{
+		CreatedAt:            time.Now().UTC(),
+		CreateIdentityParams: params,
+	}
+	m.identities[key] = identity
+	return identity, nil
+}
+
+func (m *MemoryStore) GetIdentity(provider, subject string) (Identity, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	identity, ok := m.identities[identityKey{provider, subject}]
+	if !ok {
+		return Identity{}, ErrNotFound
+	}
+	return identity, nil
+}
+
+func (m *MemoryStore) GetIdentities(userID uuid.UUID) ([]Identity, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	identities := []Identity{}
+	for _, identity := range m.identities {
+		if identity.UserID == userID {
+			identities = append(identities, identity)
+		}
+	}
+	sort.Slice(identities, func(i, j int) bool {
+		return identities[i].CreatedAt.Before(identities[j].CreatedAt)
+	})
+	return identities, nil
+}
+
+func (m *MemoryStore) TouchIdentity(provider, subject string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := identityKey{provider, subject}
+	identity, ok := m.identities[key]
+	if !ok {
+		return ErrNotFound
+	}
+	now := time.Now().UTC()
+	identity.LastLoginAt = &now
+	m.identities[key] = identity
+	return nil
+}
+
+func (m *MemoryStore) DeleteIdentity(userID uuid.UUID, provider string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, identity := range m.identities {
+		if identity.UserID == userID && identity.Provider == provider {
+			delete(m.identities, key)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *MemoryStore) GetUsage(userID uuid.UUID, since time.Time) (Usage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.usage(userID, since), nil
+}
+
+// usage is GetUsage for callers already holding the lock.
+func (m *MemoryStore) usage(userID uuid.UUID, since time.Time) Usage {
+	var usage Usage
+	for _, video := range m.videos {
+		if inVideoScope(video, userID, nil) {
+			usage.StorageBytes += video.VideoSize + video.ThumbnailSize
+			usage.Videos++
+		}
+	}
+	for _, u := range m.uploads {
+		if u.UserID == userID && u.OrganizationID == nil && !u.createdAt.Before(since) {
+			usage.UploadDuration += u.Duration
+		}
+	}
+	return usage
+}
+
+func (m *MemoryStore) GetOrganizationUsage(orgID uuid.UUID, since time.Time) (Usage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.organizationUsage(orgID, since), nil
+}
+
+// organizationUsage is GetOrganizationUsage for callers already holding the
+// lock.
+func (m *MemoryStore) organizationUsage(orgID uuid.UUID, since time.Time) Usage {
+	var usage Usage
+	for _, video := range m.videos {
+		if inVideoScope(video, uuid.Nil, &orgID) {
+			usage.StorageBytes += video.VideoSize + video.ThumbnailSize
+			usage.Videos++
+		}
+	}
+	for _, u := range m.uploads {
+		if u.OrganizationID != nil && *u.OrganizationID == orgID && !u.createdAt.Before(since) {
+			usage.UploadDuration += u.Duration
+		}
+	}
+	return usage
+}
+
+func (m *MemoryStore) RecordUpload(params RecordUploadParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	video, ok := m.videos[params.VideoID]
+	if !ok {
+		return ErrNotFound
+	}
+	old := video
+	video.VideoURL = &params.URL
+	video.VideoSize = params.Size
+	video.Orientation = &params.Orientation
+	video.DurationMs = params.Duration.Milliseconds()
+	video.Status = VideoStatusReady
+	video.UpdatedAt = time.Now().UTC()
+	m.videos[params.VideoID] = video
+
+	usage := m.usage(params.UserID, params.Since)
+	if params.OrganizationID != nil {
+		usage = m.organizationUsage(*params.OrganizationID, params.Since)
+	}
+	if !params.fits(usage) {
+		m.videos[params.VideoID] = old
+		return ErrQuotaExceeded
+	}
+
+	m.uploads = append(m.uploads, upload{
+		createdAt:          time.Now().UTC(),
+		RecordUploadParams: params,
+	})
+	return nil
+}
+
+func (m *MemoryStore) SetUserQuota(id uuid.UUID, quota Quota) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Quota = quota
+	user.UpdatedAt = time.Now().UTC()
+	m.users[id] = user
+	return nil
+}
+
+func (m *MemoryStore) SetOrganizationQuota(id uuid.UUID, quota Quota) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	org, ok := m.organizations[id]
+	if !ok {
+		return ErrNotFound
+	}
+	org.Quota = quota
+	org.UpdatedAt = time.Now().UTC()
+	m.organizations[id] = org
+	return nil
+}
+
+func (m *MemoryStore) SearchVideos(params SearchVideosParams) ([]VideoSearchResult, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	terms := SearchTerms(params.Query)
+	if len(terms) == 0 {
+		return []VideoSearchResult{}, nil
+	}
+
+	videos := []Video{}
+	for _, video := range m.videos {
+		_, shared := m.videoPermissions[videoPermissionKey{video.ID, params.UserID}]
+		if !inVideoScope(video, params.UserID, params.OrganizationID) && !(params.IncludeShared && shared) {
+			continue
+		}
+		text := strings.ToLower(video.Title + " " + video.Description)
+		matched := true
+		for _, term := range terms {
+			if !strings.Contains(text, term) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			videos = append(videos, video)
+		}
+	}
+	return orderSearchResults(videos, terms, params.Limit, params.Offset), nil
+}
+
+// AddVideoTags never changes a video's Tags slice in place, so videos
+// already handed out keep the tags they had.
+func (m *MemoryStore) AddVideoTags(videoID uuid.UUID, names []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	video, ok := m.videos[videoID]
+	if !ok {
+		return ErrNotFound
+	}
+	tags := slices.Clone(video.Tags)
+	for _, name := range names {
+		if !slices.Contains(tags, name) {
+			tags = append(tags, name)
+		}
+	}
+	slices.Sort(tags)
+	video.Tags = tags
+	video.UpdatedAt = time.Now().UTC()
+	m.videos[videoID] = video
+	return nil
+}
+
+func (m *MemoryStore) RemoveVideoTag(videoID uuid.UUID, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	video, ok := m.videos[videoID]
+	if !ok || !slices.Contains(video.Tags, name) {
+		return ErrNotFound
+	}
+	video.Tags = slices.DeleteFunc(slices.Clone(video.Tags), func(tag string) bool {
+		return tag == name
+	})
+	video.UpdatedAt = time.Now().UTC()
+	m.videos[videoID] = video
+	return nil
+}
+
+func (m *MemoryStore) GetTagCounts(userID uuid.UUID) ([]TagCount, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	videos := map[string]int64{}
+	for _, video := range m.videos {
+		if video.UserID != userID {
+			continue
+		}
+		for _, tag := range video.Tags {
+			videos[tag]++
+		}
+	}
+
+	counts := []TagCount{}
+	for name, n := range videos {
+		counts = append(counts, TagCount{Name: name, Videos: n})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		return counts[i].Name < counts[j].Name
+	})
+	return counts, nil
+}
+
+func hasAllTags(video Video, tags []string) bool {
+	for _, tag := range tags {
+		if !slices.Contains(video.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *MemoryStore) CreatePlaylist(params CreatePlaylistParams) (Playlist, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	playlist := Playlist{
+		ID:                   uuid.New(),
+		CreatedAt:            now,
+		UpdatedAt:            now,
+		CreatePlaylistParams: params,
+	}
+	m.playlists[playlist.ID] = playlist
+	return playlist, nil
+}
+
+func (m *MemoryStore) GetPlaylist(id uuid.UUID) (Playlist, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	playlist, ok := m.playlists[id]
+	if !ok {
+		return Playlist{}, ErrNotFound
+	}
+	playlist.VideoCount = len(m.playlistVideos[id])
+	return playlist, nil
+}
+
+func (m *MemoryStore) GetPlaylists(userID uuid.UUID) ([]Playlist, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	playlists := []Playlist{}
+	for _, playlist := range m.playlists {
+		if playlist.UserID == userID {
+			playlist.VideoCount = len(m.playlistVideos[playlist.ID])
+			playlists = append(playlists, playlist)
+		}
+	}
+	sort.Slice(playlists, func(i, j int) bool {
+		return playlists[i].CreatedAt.After(playlists[j].CreatedAt)
+	})
+	return playlists, nil
+}
+
+func (m *MemoryStore) UpdatePlaylist(playlist Playlist) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, ok := m.playlists[playlist.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	existing.Title = playlist.Title
+	existing.Description = playlist.Description
+	existing.Visibility = playlist.Visibility
+	existing.UpdatedAt = time.Now().UTC()
+	m.playlists[playlist.ID] = existing
+	return nil
+}
+
+func (m *MemoryStore) DeletePlaylist(id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.playlists[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.playlists, id)
+	delete(m.playlistVideos, id)
+	return nil
+}
+
+func (m *MemoryStore) GetPlaylistVideos(id uuid.UUID) ([]Video, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	videos := []Video{}
+	for _, videoID := range m.playlistVideos[id] {
+		videos = append(videos, m.videos[videoID])
+	}
+	return videos, nil
+}
+
+func (m *MemoryStore) AddPlaylistVideo(playlistID, videoID uuid.UUID, position int) error {
+	return m.changePlaylistVideos(playlistID, func(ids []uuid.UUID) ([]uuid.UUID, error) {
+		if _, ok := m.videos[videoID]; !ok {
+			return nil, ErrNotFound
+		}
+		if slices.Contains(ids, videoID) {
+			return nil, ErrConflict
+		}
+		if position < 0 || position > len(ids) {
+			position = len(ids)
+		}
+		return slices.Insert(ids, position, videoID), nil
+	})
+}
+
+func (m *MemoryStore) RemovePlaylistVideo(playlistID, videoID uuid.UUID) error {
+	return m.changePlaylistVideos(playlistID, func(ids []uuid.UUID) ([]uuid.UUID, error) {
+		i := slices.Index(ids, videoID)
+		if i < 0 {
+			return nil, ErrNotFound
+		}
+		return slices.Delete(ids, i, i+1), nil
+	})
+}
+
+func (m *MemoryStore) ReorderPlaylistVideos(playlistID uuid.UUID, videoIDs []uuid.UUID) error {
+	return m.changePlaylistVideos(playlistID, func(ids []uuid.UUID) ([]uuid.UUID, error) {
+		if !sameVideos(ids, videoIDs) {
+			return nil, ErrConflict
+		}
+		return slices.Clone(videoIDs), nil
+	})
+}
+
+// changePlaylistVideos gives change a copy of the playlist's videos, so a
+// failed change leaves them as they were.
+func (m *MemoryStore) changePlaylistVideos(playlistID uuid.UUID, change func(ids []uuid.UUID) ([]uuid.UUID, error)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	playlist, ok := m.playlists[playlistID]
+	if !ok {
+		return ErrNotFound
+	}
+	ids, err := change(slices.Clone(m.playlistVideos[playlistID]))
+	if err != nil {
+		return err
+	}
+	m.playlistVideos[playlistID] = ids
+	playlist.UpdatedAt = time.Now().UTC()
+	m.playlists[playlistID] = playlist
+	return nil
+}
+
+func (m *MemoryStore) CreateShareLink(params CreateShareLinkParams) (ShareLink, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, link := range m.shareLinks {
+		if link.TokenHash == params.TokenHash {
+			return ShareLink{}, ErrConflict
+		}
+	}
+	if params.ExpiresAt != nil {
+		utc := params.ExpiresAt.UTC()
+		params.ExpiresAt = &utc
+	}
+	link := ShareLink{
+		ID:                    uuid.New(),
+		CreatedAt:             time.Now().UTC(),
+		PasswordProtected:     params.PasswordHash != nil,
+		CreateShareLinkParams: params,
+	}
+	m.shareLinks[link.ID] = link
+	return link, nil
+}
+
+func (m *MemoryStore) GetShareLinks(videoID uuid.UUID) ([]ShareLink, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	links := []ShareLink{}
+	for _, link := range m.shareLinks {
+		if link.VideoID == videoID && link.RevokedAt == nil {
+			links = append(links, link)
+		}
+	}
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].CreatedAt.After(links[j].CreatedAt)
+	})
+	return links, nil
+}
+
+func (m *MemoryStore) GetShareLinkByHash(tokenHash string) (ShareLink, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, link := range m.shareLinks {
+		if link.TokenHash == tokenHash {
+			return link, nil
+		}
+	}
+	return ShareLink{}, ErrNotFound
+}
+
+func (m *MemoryStore) RevokeShareLink(videoID, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	link, ok := m.shareLinks[id]
+	if !ok || link.VideoID != videoID || link.RevokedAt != nil {
+		return ErrNotFound
+	}
+	now := time.Now().UTC()
+	link.RevokedAt = &now
+	m.shareLinks[id] = link
+	return nil
+}
+
+func (m *MemoryStore) UseShareLink(id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	link, ok := m.shareLinks[id]
+	if !ok || link.RevokedAt != nil || (link.MaxViews != nil && link.Views >= *link.MaxViews) {
+		return ErrNotFound
+	}
+	now := time.Now().UTC()
+	link.Views++
+	link.LastViewedAt = &now
+	m.shareLinks[id] = link
+	return nil
+}
+
+func (m *MemoryStore) SetVideoPermission(videoID, userID uuid.UUID, role string) (VideoPermission, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.videos[videoID]; !ok {
+		return VideoPermission{}, ErrNotFound
+	}
+	if _, ok := m.users[userID]; !ok {
+		return VideoPermission{}, ErrNotFound
+	}
+	key := videoPermissionKey{videoID: videoID, userID: userID}
+	now := time.Now().UTC()
+	permission, ok := m.videoPermissions[key]
+	if !ok {
+		permission = VideoPermission{
+			CreatedAt: now,
+			VideoID:   videoID,
+			UserID:    userID,
+		}
+	}
+	permission.Role = role
+	permission.UpdatedAt = now
+	m.videoPermissions[key] = permission
+	return m.withEmail(permission), nil
+}
+
+func (m *MemoryStore) GetVideoPermission(videoID, userID uuid.UUID) (VideoPermission, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	permission, ok := m.videoPermissions[videoPermissionKey{videoID: videoID, userID: userID}]
+	if !ok {
+		return VideoPermission{}, ErrNotFound
+	}
+	return m.withEmail(permission), nil
+}
+
+func (m *MemoryStore) GetVideoPermissions(videoID uuid.UUID) ([]VideoPermission, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	permissions := []VideoPermission{}
+	for key, permission := range m.videoPermissions {
+		if key.videoID == videoID {
+			permissions = append(permissions, m.withEmail(permission))
+		}
+	}
+	sort.Slice(permissions, func(i, j int) bool {
+		if permissions[i].CreatedAt.Equal(permissions[j].CreatedAt) {
+			return permissions[i].Email < permissions[j].Email
+		}
+		return permissions[i].CreatedAt.Before(permissions[j].CreatedAt)
+	})
+	return permissions, nil
+}
+
+func (m *MemoryStore) DeleteVideoPermission(videoID, userID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := videoPermissionKey{videoID: videoID, userID: userID}
+	if _, ok := m.videoPermissions[key]; !ok {
+		return ErrNotFound
+	}
+	delete(m.videoPermissions, key)
+	return nil
+}
+
+func (m *MemoryStore) GetSharedVideos(userID uuid.UUID) ([]Video, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	videos := []Video{}
+	for key := range m.videoPermissions {
+		if key.userID == userID {
+			videos = append(videos, m.videos[key.videoID])
+		}
+	}
+	sort.Slice(videos, func(i, j int) bool {
+		return videos[i].CreatedAt.After(videos[j].CreatedAt)
+	})
+	return videos, nil
+}
+
+func (m *MemoryStore) withEmail(permission VideoPermission) VideoPermission {
+	permission.Email = m.users[permission.UserID].Email
+	return permission
+}
+
+// inVideoScope is videoScope for the memory store.
+func inVideoScope(video Video, userID uuid.UUID, organizationID *uuid.UUID) bool {
+	if organizationID != nil {
+		return video.OrganizationID != nil && *video.OrganizationID == *organizationID
+	}
+	return video.UserID == userID && video.OrganizationID == nil
+}
+
+func (m *MemoryStore) CreateOrganization(name string, ownerID uuid.UUID) (Organization, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[ownerID]; !ok {
+		return Organization{}, ErrNotFound
+	}
+	now := time.Now().UTC()
+	org := Organization{
+		ID:        uuid.New(),
+		CreatedAt: now,
+		UpdatedAt: now,
+		Name:      name,
+	}
+	m.organizations[org.ID] = org
+	m.organizationMembers[organizationMemberKey{orgID: org.ID, userID: ownerID}] = OrganizationMember{
+		CreatedAt:      now,
+		OrganizationID: org.ID,
+		UserID:         ownerID,
+		Role:           OrganizationRoleOwner,
+	}
+	return org, nil
+}
+
+func (m *MemoryStore) GetOrganization(id uuid.UUID) (Organization, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	org, ok := m.organizations[id]
+	if !ok {
+		return Organization{}, ErrNotFound
+	}
+	return org, nil
+}
+
+func (m *MemoryStore) GetMemberships(userID uuid.UUID) ([]Membership, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	memberships := []Membership{}
+	for key, member := range m.organizationMembers {
+		if key.userID == userID {
+			memberships = append(memberships, Membership{
+				Organization: m.organizations[key.orgID],
+				Role:         member.Role,
+			})
+		}
+	}
+	sort.Slice(memberships, func(i, j int) bool {
+		if memberships[i].Name == memberships[j].Name {
+			return memberships[i].ID.String() < memberships[j].ID.String()
+		}
+		return memberships[i].Name < memberships[j].Name
+	})
+	return memberships, nil
+}
+
+func (m *MemoryStore) RenameOrganization(id uuid.UUID, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	org, ok := m.organizations[id]
+	if !ok {
+		return ErrNotFound
+	}
+	org.Name = name
+	org.UpdatedAt = time.Now().UTC()
+	m.organizations[id] = org
+	return nil
+}
+
+func (m *MemoryStore) SetOrganizationKeyPrefix(id uuid.UUID, prefix *string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	org, ok := m.organizations[id]
+	if !ok {
+		return ErrNotFound
+	}
+	org.KeyPrefix = prefix
+	org.UpdatedAt = time.Now().UTC()
+	m.organizations[id] = org
+	return nil
+}
+
+func (m *MemoryStore) DeleteOrganization(id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.organizations[id]; !ok {
+		return ErrNotFound
+	}
+	for _, video := range m.videos {
+		if inVideoScope(video, uuid.Nil, &id) {
+			return fmt.Errorf("%w: organization still has videos", ErrConflict)
+		}
+	}
+	delete(m.organizations, id)
+	for key := range m.organizationMembers {
+		if key.orgID == id {
+			delete(m.organizationMembers, key)
+		}
+	}
+	for userID, user := range m.users {
+		if user.ActiveOrganizationID != nil && *user.ActiveOrganizationID == id {
+			user.ActiveOrganizationID = nil
+			m.users[userID] = user
+		}
+	}
+	uploads := m.uploads[:0]
+	for _, u := range m.uploads {
+		if u.OrganizationID == nil || *u.OrganizationID != id {
+			uploads = append(uploads, u)
+		}
+	}
+	m.uploads = uploads
+	return nil
+}
+
+func (m *MemoryStore) AddOrganizationMember(orgID, userID uuid.UUID, role string) (OrganizationMember, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.organizations[orgID]; !ok {
+		return OrganizationMember{}, ErrNotFound
+	}
+	if _, ok := m.users[userID]; !ok {
+		return OrganizationMember{}, ErrNotFound
+	}
+	key := organizationMemberKey{orgID: orgID, userID: userID}
+	if _, ok := m.organizationMembers[key]; ok {
+		return OrganizationMember{}, ErrConflict
+	}
+	member := OrganizationMember{
+		CreatedAt:      time.Now().UTC(),
+		OrganizationID: orgID,
+		UserID:         userID,
+		Role:           role,
+	}
+	m.organizationMembers[key] = member
+	return m.withMemberEmail(member), nil
+}
+
+func (m *MemoryStore) GetOrganizationMember(orgID, userID uuid.UUID) (OrganizationMember, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	member, ok := m.organizationMembers[organizationMemberKey{orgID: orgID, userID: userID}]
+	if !ok {
+		return OrganizationMember{}, ErrNotFound
+	}
+	return m.withMemberEmail(member), nil
+}
+
+func (m *MemoryStore) GetOrganizationMembers(orgID uuid.UUID) ([]OrganizationMember, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	members := []OrganizationMember{}
+	for key, member := range m.organizationMembers {
+		if key.orgID == orgID {
+			members = append(members, m.withMemberEmail(member))
+		}
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].CreatedAt.Equal(members[j].CreatedAt) {
+			return members[i].Email < members[j].Email
+		}
+		return members[i].CreatedAt.Before(members[j].CreatedAt)
+	})
+	return members, nil
+}
+
+func (m *MemoryStore) SetOrganizationMemberRole(orgID, userID uuid.UUID, role string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := organizationMemberKey{orgID: orgID, userID: userID}
+	member, ok := m.organizationMembers[key]
+	if !ok {
+		return ErrNotFound
+	}
+	if role != OrganizationRoleOwner && member.Role == OrganizationRoleOwner {
+		if _, ok := m.otherOwner(orgID, userID); !ok {
+			return fmt.Errorf("%w: organization needs another owner", ErrConflict)
+		}
+	}
+	member.Role = role
+	m.organizationMembers[key] = member
+	return nil
+}
+
+func (m *MemoryStore) RemoveOrganizationMember(orgID, userID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := organizationMemberKey{orgID: orgID, userID: userID}
+	member, ok := m.organizationMembers[key]
+	if !ok {
+		return ErrNotFound
+	}
+	if member.Role == OrganizationRoleOwner {
+		if _, ok := m.otherOwner(orgID, userID); !ok {
+			return fmt.Errorf("%w: organization needs another owner", ErrConflict)
+		}
+	}
+	delete(m.organizationMembers, key)
+	user, ok := m.users[userID]
+	if ok && user.ActiveOrganizationID != nil && *user.ActiveOrganizationID == orgID {
+		user.ActiveOrganizationID = nil
+		m.users[userID] = user
+	}
+	return nil
+}
+
+func (m *MemoryStore) SetActiveOrganization(userID uuid.UUID, orgID *uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	user.ActiveOrganizationID = orgID
+	user.UpdatedAt = time.Now().UTC()
+	m.users[userID] = user
+	return nil
+}
+
+// otherOwner returns the organization's longest-standing owner other than
+// the user, if it has one.
+func (m *MemoryStore) otherOwner(orgID, userID uuid.UUID) (uuid.UUID, bool) {
+	var owner OrganizationMember
+	found := false
+	for key, member := range m.organizationMembers {
+		if key.orgID != orgID || key.userID == userID || member.Role != OrganizationRoleOwner {
+			continue
+		}
+		if !found || member.CreatedAt.Before(owner.CreatedAt) {
+			owner = member
+			found = true
+		}
+	}
+	return owner.UserID, found
+}
+
+func (m *MemoryStore) withMemberEmail(member OrganizationMember) OrganizationMember {
+	member.Email = m.users[member.UserID].Email
+	return member
+}
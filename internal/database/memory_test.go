@@ -0,0 +1,75 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreDisableTOTP(t *testing.T) {
+	m := NewMemoryStore()
+	user, err := m.CreateUser(CreateUserParams{Email: "user@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.CreateIdentity(CreateIdentityParams{UserID: user.ID, Provider: "google", Subject: "123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	video, err := m.CreateVideo(CreateVideoParams{UserID: user.ID, Title: "Boots"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.RecordUpload(RecordUploadParams{
+		UserID:          user.ID,
+		VideoID:         video.ID,
+		Duration:        time.Minute,
+		StorageLimit:    -1,
+		UploadTimeLimit: -1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.SetTOTPSecret(user.ID, "SECRET")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.EnableTOTP(user.ID, []string{"code-hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.DisableTOTP(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := m.GetUser(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.TOTPSecret != nil || got.TOTPEnabledAt != nil {
+		t.Errorf("TOTP still set: secret %v, enabled at %v", got.TOTPSecret, got.TOTPEnabledAt)
+	}
+	codes, err := m.CountRecoveryCodes(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if codes != 0 {
+		t.Errorf("%d recovery codes left, want 0", codes)
+	}
+
+	identities, err := m.GetIdentities(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(identities) != 1 {
+		t.Errorf("%d identities left, want 1", len(identities))
+	}
+	usage, err := m.GetUsage(user.ID, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.UploadDuration != time.Minute {
+		t.Errorf("UploadDuration = %v, want %v", usage.UploadDuration, time.Minute)
+	}
+}
@@ -0,0 +1,138 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// SetTOTPSecret starts enrolling the user in two-factor authentication. The
+// secret isn't enforced at login until EnableTOTP is called.
+func (c Client) SetTOTPSecret(id uuid.UUID, secret string) error {
+	query := `
+		UPDATE users
+		SET totp_secret = ?, totp_enabled_at = NULL, totp_last_step = 0, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	return requireRowsAffected(c.db.Exec(query, secret, id.String()))
+}
+
+// EnableTOTP turns on two-factor authentication for a user who has been
+// given a secret, replacing any recovery codes they had with codeHashes.
+func (c Client) EnableTOTP(id uuid.UUID, codeHashes []string) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = requireRowsAffected(tx.Exec(`
+		UPDATE users
+		SET totp_enabled_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND totp_secret IS NOT NULL
+	`, id.String()))
+	if err != nil {
+		return err
+	}
+
+	err = replaceRecoveryCodes(tx, id, codeHashes)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DisableTOTP removes the user's TOTP secret and recovery codes.
+func (c Client) DisableTOTP(id uuid.UUID) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = requireRowsAffected(tx.Exec(`
+		UPDATE users
+		SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = 0, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, id.String()))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, id.String())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UseTOTPStep records that the code for TOTP time step was used. It returns
+// ErrConflict if that step or a later one has already been used, so a code
+// can't be replayed.
+func (c Client) UseTOTPStep(id uuid.UUID, step int64) error {
+	query := `
+		UPDATE users
+		SET totp_last_step = ?
+		WHERE id = ? AND totp_last_step < ?
+	`
+	err := requireRowsAffected(c.db.Exec(query, step, id.String(), step))
+	if errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("%w: code already used", ErrConflict)
+	}
+	return err
+}
+
+// ReplaceRecoveryCodes swaps the user's recovery codes for codeHashes.
+func (c Client) ReplaceRecoveryCodes(id uuid.UUID, codeHashes []string) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = replaceRecoveryCodes(tx, id, codeHashes)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UseRecoveryCode marks one of the user's recovery codes as used. It returns
+// ErrNotFound if the user has no unused code with that hash.
+func (c Client) UseRecoveryCode(id uuid.UUID, codeHash string) error {
+	query := `
+		UPDATE recovery_codes
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = ? AND code_hash = ? AND used_at IS NULL
+	`
+	return requireRowsAffected(c.db.Exec(query, id.String(), codeHash))
+}
+
+// CountRecoveryCodes returns how many unused recovery codes the user has.
+func (c Client) CountRecoveryCodes(id uuid.UUID) (int, error) {
+	var n int
+	err := c.db.QueryRow(`
+		SELECT COUNT(*) FROM recovery_codes
+		WHERE user_id = ? AND used_at IS NULL
+	`, id.String()).Scan(&n)
+	return n, err
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, id uuid.UUID, codeHashes []string) error {
+	_, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, id.String())
+	if err != nil {
+		return err
+	}
+	for _, hash := range codeHashes {
+		_, err = tx.Exec(`
+			INSERT INTO recovery_codes (code_hash, created_at, user_id)
+			VALUES (?, CURRENT_TIMESTAMP, ?)
+		`, hash, id.String())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,346 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Roles members can have in an organization. Members can see and edit all
+// of its videos, admins can also do anything to them and manage members,
+// and owners can also manage admins and delete the organization. Every
+// organization keeps at least one owner.
+const (
+	OrganizationRoleMember = "member"
+	OrganizationRoleAdmin  = "admin"
+	OrganizationRoleOwner  = "owner"
+)
+
+// Organization owns videos on behalf of its members, so they outlast any
+// one member's account.
+type Organization struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Name      string    `json:"name"`
+	// KeyPrefix overrides where in the bucket the organization's video
+	// files are stored, when set.
+	KeyPrefix *string `json:"key_prefix"`
+	Quota     Quota   `json:"quota"`
+}
+
+type OrganizationMember struct {
+	CreatedAt      time.Time `json:"created_at"`
+	OrganizationID uuid.UUID `json:"organization_id"`
+	UserID         uuid.UUID `json:"user_id"`
+	// Email is the member's, so they can be recognised in listings.
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+// Membership is an organization along with the role a user has in it.
+type Membership struct {
+	Organization
+	Role string `json:"role"`
+}
+
+const organizationColumns = `id, created_at, updated_at, name, key_prefix, quota_storage_bytes, quota_videos, quota_upload_minutes`
+
+func scanOrganization(row rowScanner, extra ...interface{}) (Organization, error) {
+	var org Organization
+	dest := []interface{}{
+		&org.ID,
+		&org.CreatedAt,
+		&org.UpdatedAt,
+		&org.Name,
+		&org.KeyPrefix,
+		&org.Quota.StorageBytes,
+		&org.Quota.Videos,
+		&org.Quota.UploadMinutes,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	return org, err
+}
+
+const organizationMemberColumns = `m.created_at, m.organization_id, m.user_id, u.email, m.role`
+
+func scanOrganizationMember(row rowScanner) (OrganizationMember, error) {
+	var member OrganizationMember
+	err := row.Scan(
+		&member.CreatedAt,
+		&member.OrganizationID,
+		&member.UserID,
+		&member.Email,
+		&member.Role,
+	)
+	return member, err
+}
+
+// CreateOrganization creates an organization with the user as its owner.
+func (c Client) CreateOrganization(name string, ownerID uuid.UUID) (Organization, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return Organization{}, err
+	}
+	defer tx.Rollback()
+
+	id := uuid.New()
+	_, err = tx.Exec(`
+	INSERT INTO organizations (id, created_at, updated_at, name)
+	VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?)
+	`, id, name)
+	if err != nil {
+		return Organization{}, err
+	}
+	_, err = tx.Exec(`
+	INSERT INTO organization_members (organization_id, user_id, role, created_at)
+	VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+	`, id, ownerID, OrganizationRoleOwner)
+	if err != nil {
+		return Organization{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return Organization{}, err
+	}
+	return c.GetOrganization(id)
+}
+
+func (c Client) GetOrganization(id uuid.UUID) (Organization, error) {
+	query := `
+	SELECT ` + organizationColumns + `
+	FROM organizations
+	WHERE id = ?
+	`
+	org, err := scanOrganization(c.db.QueryRow(query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Organization{}, ErrNotFound
+	}
+	return org, err
+}
+
+// GetMemberships returns the organizations the user belongs to, by name.
+func (c Client) GetMemberships(userID uuid.UUID) ([]Membership, error) {
+	query := `
+	SELECT ` + prefixColumns("o", organizationColumns) + `, m.role
+	FROM organization_members m
+	JOIN organizations o ON o.id = m.organization_id
+	WHERE m.user_id = ?
+	ORDER BY o.name, o.id
+	`
+	rows, err := c.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	memberships := []Membership{}
+	for rows.Next() {
+		var membership Membership
+		membership.Organization, err = scanOrganization(rows, &membership.Role)
+		if err != nil {
+			return nil, err
+		}
+		memberships = append(memberships, membership)
+	}
+	return memberships, rows.Err()
+}
+
+func (c Client) RenameOrganization(id uuid.UUID, name string) error {
+	query := `
+	UPDATE organizations
+	SET name = ?, updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	return requireRowsAffected(c.db.Exec(query, name, id))
+}
+
+func (c Client) SetOrganizationKeyPrefix(id uuid.UUID, prefix *string) error {
+	query := `
+	UPDATE organizations
+	SET key_prefix = ?, updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	return requireRowsAffected(c.db.Exec(query, prefix, id))
+}
+
+// DeleteOrganization deletes the organization along with its members and
+// upload history. It returns ErrConflict while the organization still owns
+// videos, so their files aren't left behind.
+func (c Client) DeleteOrganization(id uuid.UUID) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var videos int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM videos WHERE organization_id = ?`, id).Scan(&videos)
+	if err != nil {
+		return err
+	}
+	if videos > 0 {
+		return fmt.Errorf("%w: organization still has videos", ErrConflict)
+	}
+
+	_, err = tx.Exec(`UPDATE users SET active_organization_id = NULL WHERE active_organization_id = ?`, id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM uploads WHERE organization_id = ?`, id)
+	if err != nil {
+		return err
+	}
+	err = requireRowsAffected(tx.Exec(`DELETE FROM organizations WHERE id = ?`, id))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// AddOrganizationMember adds the user to the organization. It returns
+// ErrConflict if they're already a member.
+func (c Client) AddOrganizationMember(orgID, userID uuid.UUID, role string) (OrganizationMember, error) {
+	query := `
+	INSERT INTO organization_members (organization_id, user_id, role, created_at)
+	VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+	`
+	_, err := c.db.Exec(query, orgID, userID, role)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return OrganizationMember{}, ErrConflict
+		}
+		return OrganizationMember{}, err
+	}
+	return c.GetOrganizationMember(orgID, userID)
+}
+
+func (c Client) GetOrganizationMember(orgID, userID uuid.UUID) (OrganizationMember, error) {
+	query := `
+	SELECT ` + organizationMemberColumns + `
+	FROM organization_members m
+	JOIN users u ON u.id = m.user_id
+	WHERE m.organization_id = ? AND m.user_id = ?
+	`
+	member, err := scanOrganizationMember(c.db.QueryRow(query, orgID, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return OrganizationMember{}, ErrNotFound
+	}
+	return member, err
+}
+
+// GetOrganizationMembers returns the organization's members in the order
+// they joined.
+func (c Client) GetOrganizationMembers(orgID uuid.UUID) ([]OrganizationMember, error) {
+	query := `
+	SELECT ` + organizationMemberColumns + `
+	FROM organization_members m
+	JOIN users u ON u.id = m.user_id
+	WHERE m.organization_id = ?
+	ORDER BY m.created_at, u.email
+	`
+	rows, err := c.db.Query(query, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []OrganizationMember{}
+	for rows.Next() {
+		member, err := scanOrganizationMember(rows)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+// SetOrganizationMemberRole changes a member's role. It returns ErrConflict
+// if that would leave the organization without an owner.
+func (c Client) SetOrganizationMemberRole(orgID, userID uuid.UUID, role string) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if role != OrganizationRoleOwner {
+		err = requireOtherOwner(tx, orgID, userID)
+		if err != nil {
+			return err
+		}
+	}
+	err = requireRowsAffected(tx.Exec(`
+	UPDATE organization_members
+	SET role = ?
+	WHERE organization_id = ? AND user_id = ?
+	`, role, orgID, userID))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RemoveOrganizationMember takes the user out of the organization. The
+// videos they created for it stay with it. It returns ErrConflict if they
+// are its last owner.
+func (c Client) RemoveOrganizationMember(orgID, userID uuid.UUID) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = requireOtherOwner(tx, orgID, userID)
+	if err != nil {
+		return err
+	}
+	err = requireRowsAffected(tx.Exec(`DELETE FROM organization_members WHERE organization_id = ? AND user_id = ?`, orgID, userID))
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE users SET active_organization_id = NULL WHERE id = ? AND active_organization_id = ?`, userID, orgID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// requireOtherOwner returns ErrConflict if the user is the organization's
+// only owner, so can't stop being one.
+func requireOtherOwner(tx *sql.Tx, orgID, userID uuid.UUID) error {
+	var lastOwner bool
+	err := tx.QueryRow(`
+	SELECT EXISTS (
+		SELECT 1 FROM organization_members
+		WHERE organization_id = ? AND user_id = ? AND role = ?
+	) AND NOT EXISTS (
+		SELECT 1 FROM organization_members
+		WHERE organization_id = ? AND user_id != ? AND role = ?
+	)
+	`, orgID, userID, OrganizationRoleOwner, orgID, userID, OrganizationRoleOwner).Scan(&lastOwner)
+	if err != nil {
+		return err
+	}
+	if lastOwner {
+		return fmt.Errorf("%w: organization needs another owner", ErrConflict)
+	}
+	return nil
+}
+
+// SetActiveOrganization sets the organization the user is working in, or
+// with nil goes back to their own videos. Callers check the user is a
+// member.
+func (c Client) SetActiveOrganization(userID uuid.UUID, orgID *uuid.UUID) error {
+	query := `
+	UPDATE users
+	SET active_organization_id = ?, updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	return requireRowsAffected(c.db.Exec(query, orgID, userID.String()))
+}
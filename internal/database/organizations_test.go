@@ -0,0 +1,54 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDeleteUserOrganizations(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			owner, err := store.CreateUser(CreateUserParams{Email: "owner@example.com", Password: "hash"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			admin, err := store.CreateUser(CreateUserParams{Email: "admin@example.com", Password: "hash"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			org, err := store.CreateOrganization("Acme", owner.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = store.AddOrganizationMember(org.ID, admin.ID, OrganizationRoleAdmin)
+			if err != nil {
+				t.Fatal(err)
+			}
+			video, err := store.CreateVideo(CreateVideoParams{UserID: admin.ID, OrganizationID: &org.ID, Title: "Boots"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = store.DeleteUser(owner.ID)
+			if !errors.Is(err, ErrConflict) {
+				t.Errorf("deleting the last owner: err = %v, want ErrConflict", err)
+			}
+
+			err = store.DeleteUser(admin.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := store.GetVideo(video.ID)
+			if err != nil {
+				t.Fatalf("organization's video deleted with its creator: %v", err)
+			}
+			if got.UserID != owner.ID {
+				t.Errorf("video credited to %s, want the owner %s", got.UserID, owner.ID)
+			}
+			_, err = store.GetOrganizationMember(org.ID, admin.ID)
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("deleted user's membership: err = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
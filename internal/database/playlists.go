@@ -0,0 +1,268 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Playlist struct {
+	ID         uuid.UUID `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	VideoCount int       `json:"video_count"`
+	CreatePlaylistParams
+}
+
+type CreatePlaylistParams struct {
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Visibility  string    `json:"visibility"`
+	UserID      uuid.UUID `json:"user_id"`
+}
+
+const playlistColumns = `p.id, p.created_at, p.updated_at, p.title, p.description, p.visibility, p.user_id,
+	(SELECT COUNT(*) FROM playlist_videos pv WHERE pv.playlist_id = p.id)`
+
+func scanPlaylist(row rowScanner) (Playlist, error) {
+	var playlist Playlist
+	err := row.Scan(
+		&playlist.ID,
+		&playlist.CreatedAt,
+		&playlist.UpdatedAt,
+		&playlist.Title,
+		&playlist.Description,
+		&playlist.Visibility,
+		&playlist.UserID,
+		&playlist.VideoCount,
+	)
+	return playlist, err
+}
+
+func (c Client) CreatePlaylist(params CreatePlaylistParams) (Playlist, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO playlists (
+		id,
+		created_at,
+		updated_at,
+		title,
+		description,
+		visibility,
+		user_id
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?)
+	`
+	_, err := c.db.Exec(query, id, params.Title, params.Description, params.Visibility, params.UserID)
+	if err != nil {
+		return Playlist{}, err
+	}
+
+	return c.GetPlaylist(id)
+}
+
+func (c Client) GetPlaylist(id uuid.UUID) (Playlist, error) {
+	query := `
+	SELECT ` + playlistColumns + `
+	FROM playlists p
+	WHERE p.id = ?
+	`
+
+	playlist, err := scanPlaylist(c.db.QueryRow(query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Playlist{}, ErrNotFound
+	}
+	return playlist, err
+}
+
+// GetPlaylists lists the user's playlists, newest first.
+func (c Client) GetPlaylists(userID uuid.UUID) ([]Playlist, error) {
+	query := `
+	SELECT ` + playlistColumns + `
+	FROM playlists p
+	WHERE p.user_id = ?
+	ORDER BY p.created_at DESC, p.id
+	`
+
+	rows, err := c.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	playlists := []Playlist{}
+	for rows.Next() {
+		playlist, err := scanPlaylist(rows)
+		if err != nil {
+			return nil, err
+		}
+		playlists = append(playlists, playlist)
+	}
+	return playlists, rows.Err()
+}
+
+// UpdatePlaylist saves the playlist's title, description and visibility.
+func (c Client) UpdatePlaylist(playlist Playlist) error {
+	query := `
+	UPDATE playlists
+	SET
+		updated_at = ?,
+		title = ?,
+		description = ?,
+		visibility = ?
+	WHERE id = ?
+	`
+	return requireRowsAffected(c.db.Exec(
+		query,
+		time.Now().UTC(),
+		playlist.Title,
+		playlist.Description,
+		playlist.Visibility,
+		playlist.ID,
+	))
+}
+
+// DeletePlaylist deletes the playlist. The videos in it are left alone.
+func (c Client) DeletePlaylist(id uuid.UUID) error {
+	return requireRowsAffected(c.db.Exec(`DELETE FROM playlists WHERE id = ?`, id))
+}
+
+// GetPlaylistVideos returns the videos in the playlist in order.
+func (c Client) GetPlaylistVideos(id uuid.UUID) ([]Video, error) {
+	query := `
+	SELECT ` + prefixColumns("v", videoColumns) + `
+	FROM playlist_videos pv
+	JOIN videos v ON v.id = pv.video_id
+	WHERE pv.playlist_id = ?
+	ORDER BY pv.position
+	`
+
+	rows, err := c.db.Query(query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	videos := []Video{}
+	for rows.Next() {
+		video, err := scanVideo(rows)
+		if err != nil {
+			return nil, err
+		}
+		videos = append(videos, video)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return c.withTags(videos)
+}
+
+// AddPlaylistVideo inserts the video into the playlist before the given
+// position, or at the end if position is negative or past the end. It
+// returns ErrConflict if the video is already in the playlist.
+func (c Client) AddPlaylistVideo(playlistID, videoID uuid.UUID, position int) error {
+	return c.changePlaylistVideos(playlistID, func(ids []uuid.UUID) ([]uuid.UUID, error) {
+		if slices.Contains(ids, videoID) {
+			return nil, ErrConflict
+		}
+		if position < 0 || position > len(ids) {
+			position = len(ids)
+		}
+		return slices.Insert(ids, position, videoID), nil
+	})
+}
+
+// RemovePlaylistVideo takes the video out of the playlist. It returns
+// ErrNotFound if the video isn't in it.
+func (c Client) RemovePlaylistVideo(playlistID, videoID uuid.UUID) error {
+	return c.changePlaylistVideos(playlistID, func(ids []uuid.UUID) ([]uuid.UUID, error) {
+		i := slices.Index(ids, videoID)
+		if i < 0 {
+			return nil, ErrNotFound
+		}
+		return slices.Delete(ids, i, i+1), nil
+	})
+}
+
+// ReorderPlaylistVideos puts the playlist's videos in the order of
+// videoIDs. It returns ErrConflict unless videoIDs lists exactly the videos
+// in the playlist.
+func (c Client) ReorderPlaylistVideos(playlistID uuid.UUID, videoIDs []uuid.UUID) error {
+	return c.changePlaylistVideos(playlistID, func(ids []uuid.UUID) ([]uuid.UUID, error) {
+		if !sameVideos(ids, videoIDs) {
+			return nil, ErrConflict
+		}
+		return videoIDs, nil
+	})
+}
+
+// changePlaylistVideos rewrites the playlist's videos as change orders
+// them, numbering their positions from zero, and bumps the playlist's
+// updated_at.
+func (c Client) changePlaylistVideos(playlistID uuid.UUID, change func(ids []uuid.UUID) ([]uuid.UUID, error)) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = requireRowsAffected(tx.Exec(`UPDATE playlists SET updated_at = ? WHERE id = ?`, time.Now().UTC(), playlistID))
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`SELECT video_id FROM playlist_videos WHERE playlist_id = ? ORDER BY position`, playlistID)
+	if err != nil {
+		return err
+	}
+	ids := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	ids, err = change(ids)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM playlist_videos WHERE playlist_id = ?`, playlistID)
+	if err != nil {
+		return err
+	}
+	for i, id := range ids {
+		_, err = tx.Exec(`INSERT INTO playlist_videos (playlist_id, video_id, position) VALUES (?, ?, ?)`, playlistID, id, i)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// sameVideos reports whether a and b hold the same IDs, each once.
+func sameVideos(a, b []uuid.UUID) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	seen := map[uuid.UUID]bool{}
+	for _, id := range a {
+		seen[id] = true
+	}
+	for _, id := range b {
+		if !seen[id] {
+			return false
+		}
+		delete(seen, id)
+	}
+	return true
+}
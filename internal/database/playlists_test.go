@@ -0,0 +1,146 @@
+package database
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestPlaylists(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			first := createTestVideo(t, store)
+			videos := []Video{first}
+			for _, title := range []string{"Walking", "Camping"} {
+				video, err := store.CreateVideo(CreateVideoParams{UserID: first.UserID, Title: title})
+				if err != nil {
+					t.Fatal(err)
+				}
+				videos = append(videos, video)
+			}
+
+			playlist, err := store.CreatePlaylist(CreatePlaylistParams{
+				Title:      "Trips",
+				Visibility: VisibilityPrivate,
+				UserID:     first.UserID,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			order := func() []uuid.UUID {
+				t.Helper()
+				got, err := store.GetPlaylistVideos(playlist.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				ids := make([]uuid.UUID, len(got))
+				for i, video := range got {
+					ids[i] = video.ID
+				}
+				return ids
+			}
+			check := func(step string, want ...Video) {
+				t.Helper()
+				ids := make([]uuid.UUID, len(want))
+				for i, video := range want {
+					ids[i] = video.ID
+				}
+				if got := order(); !reflect.DeepEqual(got, ids) {
+					t.Errorf("%s: videos = %v, want %v", step, got, ids)
+				}
+			}
+
+			// appended, then the third put in front of the second
+			for _, add := range []struct {
+				video    Video
+				position int
+			}{{videos[0], -1}, {videos[1], 5}, {videos[2], 1}} {
+				err := store.AddPlaylistVideo(playlist.ID, add.video.ID, add.position)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			check("added", videos[0], videos[2], videos[1])
+
+			err = store.AddPlaylistVideo(playlist.ID, videos[0].ID, 0)
+			if !errors.Is(err, ErrConflict) {
+				t.Errorf("adding again: err = %v, want ErrConflict", err)
+			}
+
+			for _, ids := range [][]uuid.UUID{
+				{videos[0].ID, videos[1].ID},
+				{videos[0].ID, videos[1].ID, videos[1].ID},
+				{videos[0].ID, videos[1].ID, uuid.New()},
+			} {
+				err := store.ReorderPlaylistVideos(playlist.ID, ids)
+				if !errors.Is(err, ErrConflict) {
+					t.Errorf("reordering to %v: err = %v, want ErrConflict", ids, err)
+				}
+			}
+			check("bad reorders", videos[0], videos[2], videos[1])
+
+			err = store.ReorderPlaylistVideos(playlist.ID, []uuid.UUID{videos[1].ID, videos[0].ID, videos[2].ID})
+			if err != nil {
+				t.Fatal(err)
+			}
+			check("reordered", videos[1], videos[0], videos[2])
+
+			err = store.RemovePlaylistVideo(playlist.ID, videos[0].ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = store.RemovePlaylistVideo(playlist.ID, videos[0].ID)
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("removing again: err = %v, want ErrNotFound", err)
+			}
+			err = store.DeleteVideo(videos[2].ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			check("removed and deleted", videos[1])
+
+			playlist.Title = "Holidays"
+			playlist.Visibility = VisibilityUnlisted
+			err = store.UpdatePlaylist(playlist)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := store.GetPlaylist(playlist.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Title != "Holidays" || got.Visibility != VisibilityUnlisted || got.VideoCount != 1 {
+				t.Errorf("updated playlist = %+v, want Holidays, unlisted, with 1 video", got)
+			}
+
+			playlists, err := store.GetPlaylists(first.UserID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(playlists) != 1 || playlists[0].ID != playlist.ID {
+				t.Errorf("playlists = %+v, want just Holidays", playlists)
+			}
+
+			err = store.DeletePlaylist(playlist.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = store.GetPlaylist(playlist.ID)
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("after delete: err = %v, want ErrNotFound", err)
+			}
+			// the videos themselves are kept
+			_, err = store.GetVideo(videos[1].ID)
+			if err != nil {
+				t.Errorf("video after playlist delete: %v", err)
+			}
+			err = store.AddPlaylistVideo(playlist.ID, videos[1].ID, -1)
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("adding to deleted playlist: err = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
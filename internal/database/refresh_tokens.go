@@ -2,6 +2,7 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
@@ -9,29 +10,103 @@ import (
 
 type RefreshToken struct {
 	CreateRefreshTokenParams
-	CreatedAt time.Time  `json:"created_at"`
-	UpdatedAt time.Time  `json:"updated_at"`
-	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	ReplacedBy *string    `json:"replaced_by"`
+	LastUsedAt time.Time  `json:"last_used_at"`
 }
 
 type CreateRefreshTokenParams struct {
 	Token     string    `json:"token"`
 	UserID    uuid.UUID `json:"user_id"`
 	ExpiresAt time.Time `json:"expires_at"`
+	// FamilyID links every token produced by rotating the one issued at
+	// login. A new family is started when it is left empty.
+	FamilyID  string `json:"family_id"`
+	UserAgent string `json:"user_agent"`
+	IPAddress string `json:"ip_address"`
+}
+
+// Rotated reports whether the token was revoked because it was exchanged
+// for a newer one, as opposed to being revoked by a logout.
+func (rt RefreshToken) Rotated() bool {
+	return rt.ReplacedBy != nil
 }
 
 func (c Client) CreateRefreshToken(params CreateRefreshTokenParams) (RefreshToken, error) {
+	if params.FamilyID == "" {
+		params.FamilyID = uuid.NewString()
+	}
+
 	query := `
 		INSERT INTO refresh_tokens (
 			token,
 			created_at,
 			updated_at,
 			user_id,
-			expires_at
-		) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?)
+			expires_at,
+			family_id,
+			user_agent,
+			ip_address,
+			last_used_at
+		) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
 	`
-	_, err := c.db.Exec(query, params.Token, params.UserID.String(), params.ExpiresAt)
+	_, err := c.db.Exec(query, params.Token, params.UserID.String(), params.ExpiresAt, params.FamilyID, params.UserAgent, params.IPAddress)
 	if err != nil {
+		if isUniqueViolation(err) {
+			return RefreshToken{}, ErrConflict
+		}
+		return RefreshToken{}, err
+	}
+
+	return c.GetRefreshToken(params.Token)
+}
+
+// RotateRefreshToken atomically revokes oldToken and issues the replacement
+// described by params. It returns ErrConflict if oldToken has already been
+// revoked or rotated, so two concurrent refreshes cannot both succeed.
+func (c Client) RotateRefreshToken(oldToken string, params CreateRefreshTokenParams) (RefreshToken, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE refresh_tokens
+		SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP, replaced_by = ?
+		WHERE token = ? AND revoked_at IS NULL
+	`, params.Token, oldToken)
+	err = requireRowsAffected(result, err)
+	if errors.Is(err, ErrNotFound) {
+		return RefreshToken{}, ErrConflict
+	}
+	if err != nil {
+		return RefreshToken{}, err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO refresh_tokens (
+			token,
+			created_at,
+			updated_at,
+			user_id,
+			expires_at,
+			family_id,
+			user_agent,
+			ip_address,
+			last_used_at
+		) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+	`, params.Token, params.UserID.String(), params.ExpiresAt, params.FamilyID, params.UserAgent, params.IPAddress)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return RefreshToken{}, ErrConflict
+		}
+		return RefreshToken{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
 		return RefreshToken{}, err
 	}
 
@@ -44,23 +119,39 @@ func (c Client) RevokeRefreshToken(token string) error {
 		SET revoked_at = CURRENT_TIMESTAMP
 		WHERE token = ?
 	`
-	_, err := c.db.Exec(query, token)
+	return requireRowsAffected(c.db.Exec(query, token))
+}
+
+// RevokeRefreshTokenFamily revokes every still-active token descended from
+// the same login.
+func (c Client) RevokeRefreshTokenFamily(familyID string) error {
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE family_id = ? AND revoked_at IS NULL
+	`
+	_, err := c.db.Exec(query, familyID)
 	return err
 }
 
 func (c Client) GetRefreshToken(token string) (RefreshToken, error) {
 	query := `
-		SELECT token, created_at, updated_at, user_id, expires_at, revoked_at
+		SELECT
+			token, created_at, updated_at, user_id, expires_at, revoked_at, family_id, replaced_by,
+			COALESCE(user_agent, ''), COALESCE(ip_address, ''), last_used_at
 		FROM refresh_tokens
 		WHERE token = ?
 	`
 	var rt RefreshToken
 	var userID string
 	err := c.db.QueryRow(query, token).
-		Scan(&rt.Token, &rt.CreatedAt, &rt.UpdatedAt, &userID, &rt.ExpiresAt, &rt.RevokedAt)
+		Scan(
+			&rt.Token, &rt.CreatedAt, &rt.UpdatedAt, &userID, &rt.ExpiresAt, &rt.RevokedAt, &rt.FamilyID, &rt.ReplacedBy,
+			&rt.UserAgent, &rt.IPAddress, &rt.LastUsedAt,
+		)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return RefreshToken{}, nil
+		if errors.Is(err, sql.ErrNoRows) {
+			return RefreshToken{}, ErrNotFound
 		}
 		return RefreshToken{}, err
 	}
@@ -78,6 +169,5 @@ func (c Client) DeleteRefreshToken(token string) error {
 		DELETE FROM refresh_tokens
 		WHERE token = ?
 	`
-	_, err := c.db.Exec(query, token)
-	return err
+	return requireRowsAffected(c.db.Exec(query, token))
 }
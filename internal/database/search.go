@@ -0,0 +1,373 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// Search results mark the matched terms in their highlighted fields by
+// wrapping them in HighlightStart and HighlightEnd. They come from Unicode's
+// private use area, so they can't clash with markup in the text itself.
+const (
+	HighlightStart = "\uE000"
+	HighlightEnd   = "\uE001"
+)
+
+// snippetRunes is roughly how much of a long description a search result
+// shows around the first match.
+const snippetRunes = 120
+
+type SearchVideosParams struct {
+	UserID uuid.UUID
+	Query  string
+	Limit  int
+	Offset int
+	// OrganizationID searches the organization's videos rather than the
+	// user's own.
+	OrganizationID *uuid.UUID
+	// IncludeShared also searches the videos the user has been given a
+	// role on.
+	IncludeShared bool
+}
+
+// VideoSearchResult is a video that matched a search, with its title and a
+// snippet of its description highlighted.
+type VideoSearchResult struct {
+	Video
+	TitleHighlight     string
+	DescriptionSnippet string
+}
+
+// SearchTerms splits a search query into the words it matches on.
+func SearchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// migrateSearch sets up the full-text index of video titles and
+// descriptions. SQLite only has FTS5 when built with the sqlite_fts5 tag,
+// so without it search falls back to substring matching.
+func (c *Client) migrateSearch() error {
+	err := c.db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&c.fts)
+	if err != nil {
+		return err
+	}
+	if !c.fts {
+		// triggers left by an FTS5 build would fail every write to videos
+		for _, trigger := range []string{"videos_fts_insert", "videos_fts_update", "videos_fts_delete"} {
+			_, err = c.db.Exec(`DROP TRIGGER IF EXISTS ` + trigger)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// an external content table, so the index holds only the terms and
+	// highlight and snippet read the text from videos by rowid
+	_, err = c.db.Exec(`
+	CREATE VIRTUAL TABLE IF NOT EXISTS videos_fts USING fts5(
+		title,
+		description,
+		content='videos',
+		content_rowid='rowid'
+	);
+	CREATE TRIGGER IF NOT EXISTS videos_fts_insert AFTER INSERT ON videos BEGIN
+		INSERT INTO videos_fts (rowid, title, description) VALUES (new.rowid, new.title, new.description);
+	END;
+	CREATE TRIGGER IF NOT EXISTS videos_fts_update AFTER UPDATE OF title, description ON videos
+	WHEN old.title IS NOT new.title OR old.description IS NOT new.description BEGIN
+		INSERT INTO videos_fts (videos_fts, rowid, title, description) VALUES ('delete', old.rowid, old.title, old.description);
+		INSERT INTO videos_fts (rowid, title, description) VALUES (new.rowid, new.title, new.description);
+	END;
+	CREATE TRIGGER IF NOT EXISTS videos_fts_delete AFTER DELETE ON videos BEGIN
+		INSERT INTO videos_fts (videos_fts, rowid, title, description) VALUES ('delete', old.rowid, old.title, old.description);
+	END;
+	`)
+	if err != nil {
+		return err
+	}
+
+	// writes may have gone unindexed while running without FTS5, and videos
+	// has no INTEGER PRIMARY KEY, so a VACUUM can renumber the rowids the
+	// index refers to. Rebuilding from videos covers both.
+	_, err = c.db.Exec(`INSERT INTO videos_fts (videos_fts) VALUES ('rebuild')`)
+	return err
+}
+
+// FullTextSearch reports whether searches use the FTS5 index rather than
+// substring matching.
+func (c Client) FullTextSearch() bool {
+	return c.fts
+}
+
+// SearchVideos finds the user's videos, and with IncludeShared those shared
+// with them, whose title or description contain every term in the query.
+// With FTS5 terms match word prefixes and results are ranked by bm25,
+// weighting title matches above description matches. Without it
+// searchVideosByLike matches substrings instead.
+func (c Client) SearchVideos(params SearchVideosParams) ([]VideoSearchResult, error) {
+	terms := SearchTerms(params.Query)
+	if len(terms) == 0 {
+		return []VideoSearchResult{}, nil
+	}
+	if !c.fts {
+		return c.searchVideosByLike(params, terms)
+	}
+
+	// terms are only letters and digits, so quoting them is enough to keep
+	// FTS5 from reading them as query syntax
+	match := make([]string, len(terms))
+	for i, term := range terms {
+		match[i] = fmt.Sprintf(`"%s"*`, term)
+	}
+
+	scope, scopeArgs := searchScope("v", params)
+	query := `
+	SELECT ` + prefixColumns("v", videoColumns) + `,
+		highlight(videos_fts, 0, ?, ?),
+		snippet(videos_fts, 1, ?, ?, '…', 24)
+	FROM videos_fts
+	JOIN videos v ON v.rowid = videos_fts.rowid
+	WHERE videos_fts MATCH ? AND ` + scope + `
+	ORDER BY bm25(videos_fts, 10, 1), v.created_at DESC
+	LIMIT ? OFFSET ?
+	`
+	args := []interface{}{
+		HighlightStart, HighlightEnd,
+		HighlightStart, HighlightEnd,
+		strings.Join(match, " "),
+	}
+	args = append(args, scopeArgs...)
+	args = append(args, params.Limit, params.Offset)
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []VideoSearchResult{}
+	for rows.Next() {
+		var result VideoSearchResult
+		var description *string
+		err := rows.Scan(
+			&result.ID,
+			&result.CreatedAt,
+			&result.UpdatedAt,
+			&result.Title,
+			&result.Description,
+			&result.ThumbnailURL,
+			&result.VideoURL,
+			&result.VideoSize,
+			&result.ThumbnailSize,
+			&result.Status,
+			&result.Orientation,
+			&result.DurationMs,
+			&result.Visibility,
+			&result.UserID,
+			&result.OrganizationID,
+			&result.TitleHighlight,
+			&description,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if description != nil {
+			result.DescriptionSnippet = *description
+		}
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ids := make([]uuid.UUID, len(results))
+	for i, result := range results {
+		ids[i] = result.ID
+	}
+	tags, err := c.videoTags(ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range results {
+		results[i].Tags = tags[results[i].ID]
+		if results[i].Tags == nil {
+			results[i].Tags = []string{}
+		}
+	}
+	return results, nil
+}
+
+// searchVideosByLike is SearchVideos for SQLite builds without FTS5. It
+// matches terms anywhere in the text and isn't relevance ranked; see
+// orderSearchResults.
+func (c Client) searchVideosByLike(params SearchVideosParams, terms []string) ([]VideoSearchResult, error) {
+	scope, args := searchScope("", params)
+	where := []string{scope}
+	for _, term := range terms {
+		where = append(where, `(title LIKE ? ESCAPE '\' OR description LIKE ? ESCAPE '\')`)
+		pattern := "%" + escapeLike(term) + "%"
+		args = append(args, pattern, pattern)
+	}
+
+	rows, err := c.db.Query(`
+	SELECT `+videoColumns+`
+	FROM videos
+	WHERE `+strings.Join(where, " AND "), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	videos := []Video{}
+	for rows.Next() {
+		video, err := scanVideo(rows)
+		if err != nil {
+			return nil, err
+		}
+		videos = append(videos, video)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	videos, err = c.withTags(videos)
+	if err != nil {
+		return nil, err
+	}
+	return orderSearchResults(videos, terms, params.Limit, params.Offset), nil
+}
+
+// orderSearchResults orders videos that matched a substring search by how
+// often the terms occur, counting one in the title as worth ten in the
+// description, and highlights them.
+func orderSearchResults(videos []Video, terms []string, limit, offset int) []VideoSearchResult {
+	score := func(video Video) int {
+		title := strings.ToLower(video.Title)
+		description := strings.ToLower(video.Description)
+		n := 0
+		for _, term := range terms {
+			n += 10*strings.Count(title, term) + strings.Count(description, term)
+		}
+		return n
+	}
+	sort.SliceStable(videos, func(i, j int) bool {
+		si, sj := score(videos[i]), score(videos[j])
+		if si != sj {
+			return si > sj
+		}
+		return videos[i].CreatedAt.After(videos[j].CreatedAt)
+	})
+
+	results := []VideoSearchResult{}
+	for i := offset; i < len(videos) && len(results) < limit; i++ {
+		results = append(results, VideoSearchResult{
+			Video:              videos[i],
+			TitleHighlight:     highlightTerms(videos[i].Title, terms),
+			DescriptionSnippet: highlightTerms(snippetAround(videos[i].Description, terms), terms),
+		})
+	}
+	return results
+}
+
+// highlightTerms marks every case-insensitive occurrence of the terms in
+// text.
+func highlightTerms(text string, terms []string) string {
+	lower := strings.ToLower(text)
+	if len(lower) != len(text) {
+		// lowercasing changed byte offsets, so matches can't be mapped back
+		return text
+	}
+
+	marked := make([]bool, len(text))
+	for _, term := range terms {
+		for start := 0; ; {
+			i := strings.Index(lower[start:], term)
+			if i < 0 {
+				break
+			}
+			for j := start + i; j < start+i+len(term); j++ {
+				marked[j] = true
+			}
+			start += i + len(term)
+		}
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(text); i++ {
+		if marked[i] && (i == 0 || !marked[i-1]) {
+			b.WriteString(HighlightStart)
+		}
+		b.WriteByte(text[i])
+		if marked[i] && (i == len(text)-1 || !marked[i+1]) {
+			b.WriteString(HighlightEnd)
+		}
+	}
+	return b.String()
+}
+
+// snippetAround cuts a long text down to the part around the first term
+// found in it.
+func snippetAround(text string, terms []string) string {
+	if utf8.RuneCountInString(text) <= snippetRunes {
+		return text
+	}
+	lower := strings.ToLower(text)
+	first := -1
+	if len(lower) == len(text) {
+		for _, term := range terms {
+			if i := strings.Index(lower, term); i >= 0 && (first < 0 || i < first) {
+				first = i
+			}
+		}
+	}
+
+	runes := []rune(text)
+	start := 0
+	if first > 0 {
+		start = max(utf8.RuneCountInString(text[:first])-snippetRunes/4, 0)
+	}
+	end := min(start+snippetRunes, len(runes))
+
+	snippet := string(runes[start:end])
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(runes) {
+		snippet += "…"
+	}
+	return snippet
+}
+
+// searchScope is videoScope, widened to the videos shared with the user
+// when params.IncludeShared is set.
+func searchScope(alias string, params SearchVideosParams) (string, []interface{}) {
+	scope, owner := videoScope(alias, params.UserID, params.OrganizationID)
+	if !params.IncludeShared {
+		return scope, []interface{}{owner}
+	}
+	if alias != "" {
+		alias += "."
+	}
+	shared := alias + "id IN (SELECT video_id FROM video_permissions WHERE user_id = ?)"
+	return "((" + scope + ") OR " + shared + ")", []interface{}{owner, params.UserID}
+}
+
+// escapeLike escapes the characters LIKE treats as wildcards.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// prefixColumns qualifies a comma separated column list with a table alias.
+func prefixColumns(alias, columns string) string {
+	parts := strings.Split(columns, ",")
+	for i, column := range parts {
+		parts[i] = alias + "." + strings.TrimSpace(column)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,197 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOrderSearchResults(t *testing.T) {
+	now := time.Now()
+	video := func(title, description string, createdAt time.Time) Video {
+		v := Video{CreatedAt: createdAt}
+		v.Title, v.Description = title, description
+		return v
+	}
+	videos := []Video{
+		video("Cooking", "Boots in the kitchen", now),
+		video("Boots", "Walking", now.Add(-time.Hour)),
+		video("Hiking", "New boots", now.Add(-time.Minute)),
+	}
+
+	results := orderSearchResults(videos, []string{"boots"}, 10, 0)
+	got := []string{}
+	for _, result := range results {
+		got = append(got, result.Title)
+	}
+	// a title match first, then description matches newest first
+	want := []string{"Boots", "Cooking", "Hiking"}
+	if len(got) != len(want) {
+		t.Fatalf("results = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("results = %v, want %v", got, want)
+		}
+	}
+	if h := results[0].TitleHighlight; h != HighlightStart+"Boots"+HighlightEnd {
+		t.Errorf("TitleHighlight = %q", h)
+	}
+
+	if page := orderSearchResults(videos, []string{"boots"}, 1, 1); len(page) != 1 || page[0].Title != "Cooking" {
+		t.Errorf("second page = %v", page)
+	}
+}
+
+func TestSearchVideos(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			video := createTestVideo(t, store)
+			other, err := store.CreateUser(CreateUserParams{Email: "other@example.com", Password: "hash"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = store.CreateVideo(CreateVideoParams{UserID: other.ID, Title: "Boots"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			described, err := store.CreateVideo(CreateVideoParams{
+				UserID:      video.UserID,
+				Title:       "Walking",
+				Description: "A long walk in new boots",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			search := func(query string) []string {
+				t.Helper()
+				results, err := store.SearchVideos(SearchVideosParams{UserID: video.UserID, Query: query, Limit: 10})
+				if err != nil {
+					t.Fatal(err)
+				}
+				titles := []string{}
+				for _, result := range results {
+					titles = append(titles, result.Title)
+				}
+				return titles
+			}
+
+			// a title match ranks first, and the other user's video is left out
+			if got := search("boots"); len(got) != 2 || got[0] != "Boots" || got[1] != "Walking" {
+				t.Errorf("boots = %v, want Boots then Walking", got)
+			}
+			if got := search("boots walk"); len(got) != 1 || got[0] != "Walking" {
+				t.Errorf("boots walk = %v, want Walking", got)
+			}
+
+			// the index follows edits and deletes
+			title := "Hiking"
+			err = store.UpdateVideoMeta(described.ID, UpdateVideoMetaParams{Title: &title})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := search("walking"); len(got) != 0 {
+				t.Errorf("walking after rename = %v, want nothing", got)
+			}
+			if got := search("hiking"); len(got) != 1 {
+				t.Errorf("hiking after rename = %v, want Hiking", got)
+			}
+			err = store.DeleteVideo(video.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := search("boots"); len(got) != 1 || got[0] != "Hiking" {
+				t.Errorf("boots after delete = %v, want Hiking", got)
+			}
+		})
+	}
+}
+
+// Running a build without FTS5 drops the triggers, so videos written then
+// have to be indexed when an FTS5 build next opens the database.
+func TestSearchVideosIndexesUnindexedWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tubely.db")
+	client, err := NewClient(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, trigger := range []string{"videos_fts_insert", "videos_fts_update", "videos_fts_delete"} {
+		_, err = client.db.Exec(`DROP TRIGGER IF EXISTS ` + trigger)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	video := createTestVideo(t, client)
+	client.db.Close()
+
+	client, err = NewClient(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.db.Close()
+	results, err := client.SearchVideos(SearchVideosParams{UserID: video.UserID, Query: "boots", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].ID != video.ID {
+		t.Errorf("results = %+v, want the video", results)
+	}
+}
+
+func TestSearchVideosIncludeShared(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			owner, err := store.CreateUser(CreateUserParams{Email: "owner@example.com", Password: "hash"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			collaborator, err := store.CreateUser(CreateUserParams{Email: "collaborator@example.com", Password: "hash"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			shared, err := store.CreateVideo(CreateVideoParams{UserID: owner.ID, Title: "Shared boots"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = store.CreateVideo(CreateVideoParams{UserID: owner.ID, Title: "Private boots"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			own, err := store.CreateVideo(CreateVideoParams{UserID: collaborator.ID, Title: "My boots"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = store.SetVideoPermission(shared.ID, collaborator.ID, VideoRoleViewer)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			search := func(includeShared bool) map[string]bool {
+				results, err := store.SearchVideos(SearchVideosParams{
+					UserID:        collaborator.ID,
+					Query:         "boots",
+					Limit:         10,
+					IncludeShared: includeShared,
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				found := map[string]bool{}
+				for _, result := range results {
+					found[result.ID.String()] = true
+				}
+				return found
+			}
+
+			found := search(false)
+			if len(found) != 1 || !found[own.ID.String()] {
+				t.Errorf("own videos only: found %v", found)
+			}
+			found = search(true)
+			if len(found) != 2 || !found[own.ID.String()] || !found[shared.ID.String()] {
+				t.Errorf("with shared videos: found %v", found)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session is a login as seen by the user: one refresh token family, described
+// by its still-active token.
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     uuid.UUID `json:"user_id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+}
+
+// GetSessions returns the user's sessions that still hold an unrevoked,
+// unexpired refresh token, most recently used first.
+func (c Client) GetSessions(userID uuid.UUID) ([]Session, error) {
+	query := `
+		SELECT
+			rt.family_id,
+			(SELECT MIN(f.created_at) FROM refresh_tokens f WHERE f.family_id = rt.family_id),
+			rt.last_used_at,
+			rt.expires_at,
+			COALESCE(rt.user_agent, ''),
+			COALESCE(rt.ip_address, '')
+		FROM refresh_tokens rt
+		WHERE rt.user_id = ? AND rt.revoked_at IS NULL AND rt.expires_at > ?
+		ORDER BY rt.last_used_at DESC
+	`
+
+	rows, err := c.db.Query(query, userID.String(), time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		session := Session{UserID: userID}
+		var createdAt string
+		if err := rows.Scan(
+			&session.ID,
+			&createdAt,
+			&session.LastUsedAt,
+			&session.ExpiresAt,
+			&session.UserAgent,
+			&session.IPAddress,
+		); err != nil {
+			return nil, err
+		}
+		session.CreatedAt, err = parseTimestamp(createdAt)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// IsSessionActive reports whether the session still has a refresh token that
+// hasn't been revoked, i.e. the user hasn't logged out of it.
+func (c Client) IsSessionActive(sessionID string) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM refresh_tokens
+			WHERE family_id = ? AND revoked_at IS NULL
+		)
+	`
+	var active bool
+	err := c.db.QueryRow(query, sessionID).Scan(&active)
+	return active, err
+}
+
+// RevokeSession revokes one of the user's sessions. It returns ErrNotFound if
+// the user has no active session with that ID.
+func (c Client) RevokeSession(userID uuid.UUID, sessionID string) error {
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = ? AND family_id = ? AND revoked_at IS NULL
+	`
+	return requireRowsAffected(c.db.Exec(query, userID.String(), sessionID))
+}
+
+// RevokeOtherSessions revokes all of the user's sessions except keepSessionID.
+func (c Client) RevokeOtherSessions(userID uuid.UUID, keepSessionID string) error {
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = ? AND family_id != ? AND revoked_at IS NULL
+	`
+	_, err := c.db.Exec(query, userID.String(), keepSessionID)
+	return err
+}
@@ -0,0 +1,157 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ShareLink lets anyone holding its token watch a video, whatever the
+// video's visibility.
+type ShareLink struct {
+	ID                uuid.UUID  `json:"id"`
+	CreatedAt         time.Time  `json:"created_at"`
+	Views             int64      `json:"views"`
+	LastViewedAt      *time.Time `json:"last_viewed_at"`
+	RevokedAt         *time.Time `json:"revoked_at"`
+	PasswordProtected bool       `json:"password_protected"`
+	CreateShareLinkParams
+}
+
+type CreateShareLinkParams struct {
+	VideoID uuid.UUID `json:"video_id"`
+	// The token itself is only stored hashed.
+	TokenHash    string     `json:"-"`
+	PasswordHash *string    `json:"-"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+	MaxViews     *int64     `json:"max_views"`
+}
+
+// Usable reports whether the link can still be viewed at now.
+func (l ShareLink) Usable(now time.Time) bool {
+	if l.RevokedAt != nil {
+		return false
+	}
+	if l.ExpiresAt != nil && !now.Before(*l.ExpiresAt) {
+		return false
+	}
+	return l.MaxViews == nil || l.Views < *l.MaxViews
+}
+
+const shareLinkColumns = `id, created_at, views, last_viewed_at, revoked_at, video_id, token_hash, password_hash, expires_at, max_views`
+
+func scanShareLink(row rowScanner) (ShareLink, error) {
+	var link ShareLink
+	err := row.Scan(
+		&link.ID,
+		&link.CreatedAt,
+		&link.Views,
+		&link.LastViewedAt,
+		&link.RevokedAt,
+		&link.VideoID,
+		&link.TokenHash,
+		&link.PasswordHash,
+		&link.ExpiresAt,
+		&link.MaxViews,
+	)
+	link.PasswordProtected = link.PasswordHash != nil
+	return link, err
+}
+
+func (c Client) CreateShareLink(params CreateShareLinkParams) (ShareLink, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO share_links (
+		id,
+		created_at,
+		video_id,
+		token_hash,
+		password_hash,
+		expires_at,
+		max_views
+	) VALUES (?, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?)
+	`
+	var expiresAt *time.Time
+	if params.ExpiresAt != nil {
+		utc := params.ExpiresAt.UTC()
+		expiresAt = &utc
+	}
+	_, err := c.db.Exec(query, id, params.VideoID, params.TokenHash, params.PasswordHash, expiresAt, params.MaxViews)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ShareLink{}, ErrConflict
+		}
+		return ShareLink{}, err
+	}
+
+	return c.getShareLink("id = ?", id)
+}
+
+// GetShareLinks returns the video's share links that haven't been revoked,
+// newest first.
+func (c Client) GetShareLinks(videoID uuid.UUID) ([]ShareLink, error) {
+	query := `
+	SELECT ` + shareLinkColumns + `
+	FROM share_links
+	WHERE video_id = ? AND revoked_at IS NULL
+	ORDER BY created_at DESC
+	`
+	rows, err := c.db.Query(query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []ShareLink{}
+	for rows.Next() {
+		link, err := scanShareLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+// GetShareLinkByHash looks up a share link, usable or not, by the hash of
+// its token.
+func (c Client) GetShareLinkByHash(tokenHash string) (ShareLink, error) {
+	return c.getShareLink("token_hash = ?", tokenHash)
+}
+
+// RevokeShareLink revokes one of the video's share links. It returns
+// ErrNotFound if the video has no active link with that ID.
+func (c Client) RevokeShareLink(videoID, id uuid.UUID) error {
+	query := `
+	UPDATE share_links
+	SET revoked_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND video_id = ? AND revoked_at IS NULL
+	`
+	return requireRowsAffected(c.db.Exec(query, id, videoID))
+}
+
+// UseShareLink counts a view of the link. It returns ErrNotFound if the
+// link has been revoked or has no views left, so concurrent viewers can't
+// go over its limit.
+func (c Client) UseShareLink(id uuid.UUID) error {
+	query := `
+	UPDATE share_links
+	SET views = views + 1, last_viewed_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND revoked_at IS NULL AND (max_views IS NULL OR views < max_views)
+	`
+	return requireRowsAffected(c.db.Exec(query, id))
+}
+
+func (c Client) getShareLink(where string, args ...interface{}) (ShareLink, error) {
+	query := `
+	SELECT ` + shareLinkColumns + `
+	FROM share_links
+	WHERE ` + where
+	link, err := scanShareLink(c.db.QueryRow(query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return ShareLink{}, ErrNotFound
+	}
+	return link, err
+}
@@ -0,0 +1,186 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserStore persists user accounts.
+type UserStore interface {
+	GetUsers() ([]User, error)
+	GetUserByEmail(email string) (User, error)
+	GetUserByRefreshToken(token string) (*User, error)
+	CreateUser(params CreateUserParams) (*User, error)
+	GetUser(id uuid.UUID) (*User, error)
+	IncrementTokenVersion(id uuid.UUID) error
+	SetUserRole(id uuid.UUID, role string) error
+	SetUserDisabled(id uuid.UUID, disabled bool) error
+	SetUserMaxUploadSize(id uuid.UUID, size *int64) error
+	SetUserPassword(id uuid.UUID, passwordHash string) error
+	MarkEmailVerified(id uuid.UUID) error
+	UpdateUserProfile(id uuid.UUID, profile UserProfile) error
+	SetUserEmail(id uuid.UUID, email string) error
+	DeleteUser(id uuid.UUID) error
+}
+
+// VideoStore persists video metadata.
+type VideoStore interface {
+	GetVideos(userID uuid.UUID) ([]Video, error)
+	CreateVideo(params CreateVideoParams) (Video, error)
+	GetVideo(id uuid.UUID) (Video, error)
+	UpdateVideo(video Video) error
+	SetVideoOwner(id, userID uuid.UUID, organizationID *uuid.UUID) error
+	SetVideoThumbnail(id uuid.UUID, url string, size int64) error
+	UpdateVideoMeta(id uuid.UUID, params UpdateVideoMetaParams) error
+	SetVideoStatus(id uuid.UUID, status string) error
+	ListVideos(params ListVideosParams) ([]Video, error)
+	SearchVideos(params SearchVideosParams) ([]VideoSearchResult, error)
+	DeleteVideo(id uuid.UUID) error
+}
+
+// TagStore persists the tags on videos.
+type TagStore interface {
+	AddVideoTags(videoID uuid.UUID, names []string) error
+	RemoveVideoTag(videoID uuid.UUID, name string) error
+	GetTagCounts(userID uuid.UUID) ([]TagCount, error)
+}
+
+// PlaylistStore persists playlists and the order of the videos in them.
+type PlaylistStore interface {
+	CreatePlaylist(params CreatePlaylistParams) (Playlist, error)
+	GetPlaylist(id uuid.UUID) (Playlist, error)
+	GetPlaylists(userID uuid.UUID) ([]Playlist, error)
+	UpdatePlaylist(playlist Playlist) error
+	DeletePlaylist(id uuid.UUID) error
+	GetPlaylistVideos(id uuid.UUID) ([]Video, error)
+	AddPlaylistVideo(playlistID, videoID uuid.UUID, position int) error
+	RemovePlaylistVideo(playlistID, videoID uuid.UUID) error
+	ReorderPlaylistVideos(playlistID uuid.UUID, videoIDs []uuid.UUID) error
+}
+
+// ShareLinkStore persists links that share a video with people who can't
+// otherwise see it.
+type ShareLinkStore interface {
+	CreateShareLink(params CreateShareLinkParams) (ShareLink, error)
+	GetShareLinks(videoID uuid.UUID) ([]ShareLink, error)
+	GetShareLinkByHash(tokenHash string) (ShareLink, error)
+	RevokeShareLink(videoID, id uuid.UUID) error
+	UseShareLink(id uuid.UUID) error
+}
+
+// PermissionStore persists the roles collaborators have on videos they
+// don't own.
+type PermissionStore interface {
+	SetVideoPermission(videoID, userID uuid.UUID, role string) (VideoPermission, error)
+	GetVideoPermission(videoID, userID uuid.UUID) (VideoPermission, error)
+	GetVideoPermissions(videoID uuid.UUID) ([]VideoPermission, error)
+	DeleteVideoPermission(videoID, userID uuid.UUID) error
+	GetSharedVideos(userID uuid.UUID) ([]Video, error)
+}
+
+// OrganizationStore persists organizations and their members.
+type OrganizationStore interface {
+	CreateOrganization(name string, ownerID uuid.UUID) (Organization, error)
+	GetOrganization(id uuid.UUID) (Organization, error)
+	GetMemberships(userID uuid.UUID) ([]Membership, error)
+	RenameOrganization(id uuid.UUID, name string) error
+	SetOrganizationKeyPrefix(id uuid.UUID, prefix *string) error
+	DeleteOrganization(id uuid.UUID) error
+	AddOrganizationMember(orgID, userID uuid.UUID, role string) (OrganizationMember, error)
+	GetOrganizationMember(orgID, userID uuid.UUID) (OrganizationMember, error)
+	GetOrganizationMembers(orgID uuid.UUID) ([]OrganizationMember, error)
+	SetOrganizationMemberRole(orgID, userID uuid.UUID, role string) error
+	RemoveOrganizationMember(orgID, userID uuid.UUID) error
+	SetActiveOrganization(userID uuid.UUID, orgID *uuid.UUID) error
+}
+
+// RefreshTokenStore persists refresh tokens issued at login.
+type RefreshTokenStore interface {
+	CreateRefreshToken(params CreateRefreshTokenParams) (RefreshToken, error)
+	RotateRefreshToken(oldToken string, params CreateRefreshTokenParams) (RefreshToken, error)
+	RevokeRefreshToken(token string) error
+	RevokeRefreshTokenFamily(familyID string) error
+	GetRefreshToken(token string) (RefreshToken, error)
+	DeleteRefreshToken(token string) error
+}
+
+// SessionStore exposes refresh token families as user-facing login sessions.
+type SessionStore interface {
+	GetSessions(userID uuid.UUID) ([]Session, error)
+	IsSessionActive(sessionID string) (bool, error)
+	RevokeSession(userID uuid.UUID, sessionID string) error
+	RevokeOtherSessions(userID uuid.UUID, keepSessionID string) error
+}
+
+// APIKeyStore persists API keys used by machine clients.
+type APIKeyStore interface {
+	CreateAPIKey(params CreateAPIKeyParams) (APIKey, error)
+	GetAPIKeys(userID uuid.UUID) ([]APIKey, error)
+	GetAPIKeyByHash(keyHash string) (APIKey, error)
+	RevokeAPIKey(userID, id uuid.UUID) error
+	TouchAPIKey(id uuid.UUID) error
+}
+
+// UserTokenStore persists single-use tokens sent to users by email.
+type UserTokenStore interface {
+	CreateUserToken(params CreateUserTokenParams) error
+	ConsumeUserToken(purpose, tokenHash string) (UserToken, error)
+}
+
+// MFAStore persists two-factor authentication state.
+type MFAStore interface {
+	SetTOTPSecret(id uuid.UUID, secret string) error
+	EnableTOTP(id uuid.UUID, codeHashes []string) error
+	DisableTOTP(id uuid.UUID) error
+	UseTOTPStep(id uuid.UUID, step int64) error
+	ReplaceRecoveryCodes(id uuid.UUID, codeHashes []string) error
+	UseRecoveryCode(id uuid.UUID, codeHash string) error
+	CountRecoveryCodes(id uuid.UUID) (int, error)
+}
+
+// IdentityStore persists links between users and their accounts at external
+// identity providers.
+type IdentityStore interface {
+	CreateIdentity(params CreateIdentityParams) (Identity, error)
+	GetIdentity(provider, subject string) (Identity, error)
+	GetIdentities(userID uuid.UUID) ([]Identity, error)
+	TouchIdentity(provider, subject string) error
+	DeleteIdentity(userID uuid.UUID, provider string) error
+}
+
+// UsageStore accounts for what users and organizations store and upload,
+// and the quotas that limit it.
+type UsageStore interface {
+	GetUsage(userID uuid.UUID, since time.Time) (Usage, error)
+	GetOrganizationUsage(orgID uuid.UUID, since time.Time) (Usage, error)
+	RecordUpload(params RecordUploadParams) error
+	SetUserQuota(id uuid.UUID, quota Quota) error
+	SetOrganizationQuota(id uuid.UUID, quota Quota) error
+}
+
+// Store is everything the HTTP handlers need from the persistence layer.
+// Client implements it on top of SQLite and MemoryStore implements it in
+// memory for tests.
+type Store interface {
+	UserStore
+	VideoStore
+	TagStore
+	PlaylistStore
+	ShareLinkStore
+	PermissionStore
+	OrganizationStore
+	RefreshTokenStore
+	SessionStore
+	APIKeyStore
+	UserTokenStore
+	MFAStore
+	IdentityStore
+	UsageStore
+	Reset() error
+}
+
+var (
+	_ Store = Client{}
+	_ Store = (*MemoryStore)(nil)
+)
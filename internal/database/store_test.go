@@ -0,0 +1,37 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// testStores returns an empty SQLite database and MemoryStore, so tests can
+// check both implementations behave the same.
+func testStores(t *testing.T) map[string]Store {
+	t.Helper()
+
+	client, err := NewClient(filepath.Join(t.TempDir(), "tubely.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.db.Close() })
+	return map[string]Store{
+		"sqlite": client,
+		"memory": NewMemoryStore(),
+	}
+}
+
+// createTestVideo adds a user and a video they own.
+func createTestVideo(t *testing.T, store Store) Video {
+	t.Helper()
+
+	user, err := store.CreateUser(CreateUserParams{Email: "user@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	video, err := store.CreateVideo(CreateVideoParams{UserID: user.ID, Title: "Boots"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return video
+}
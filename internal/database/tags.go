@@ -0,0 +1,157 @@
+package database
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TagCount is a tag and how many of a user's videos have it.
+type TagCount struct {
+	Name   string `json:"name"`
+	Videos int64  `json:"videos"`
+}
+
+// AddVideoTags tags the video with each of the names, creating tags that
+// don't exist yet. Tags the video already has are left alone.
+func (c Client) AddVideoTags(videoID uuid.UUID, names []string) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = requireRowsAffected(tx.Exec(`UPDATE videos SET updated_at = ? WHERE id = ?`, time.Now().UTC(), videoID))
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		_, err = tx.Exec(`INSERT OR IGNORE INTO tags (id, name) VALUES (?, ?)`, uuid.NewString(), name)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`
+		INSERT OR IGNORE INTO video_tags (video_id, tag_id)
+		SELECT ?, id FROM tags WHERE name = ?
+		`, videoID, name)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// RemoveVideoTag takes a tag off the video. It returns ErrNotFound if the
+// video doesn't have the tag.
+func (c Client) RemoveVideoTag(videoID uuid.UUID, name string) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = requireRowsAffected(tx.Exec(`
+	DELETE FROM video_tags
+	WHERE video_id = ? AND tag_id = (SELECT id FROM tags WHERE name = ?)
+	`, videoID, name))
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE videos SET updated_at = ? WHERE id = ?`, time.Now().UTC(), videoID)
+	if err != nil {
+		return err
+	}
+	err = deleteUnusedTags(tx)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetTagCounts lists the tags on the user's videos in order of name.
+func (c Client) GetTagCounts(userID uuid.UUID) ([]TagCount, error) {
+	rows, err := c.db.Query(`
+	SELECT t.name, COUNT(*)
+	FROM tags t
+	JOIN video_tags vt ON vt.tag_id = t.id
+	JOIN videos v ON v.id = vt.video_id
+	WHERE v.user_id = ?
+	GROUP BY t.id
+	ORDER BY t.name
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []TagCount{}
+	for rows.Next() {
+		var count TagCount
+		if err := rows.Scan(&count.Name, &count.Videos); err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+	return counts, rows.Err()
+}
+
+// videoTags looks up the tags on each of the videos, in order of name.
+func (c Client) videoTags(ids []uuid.UUID) (map[uuid.UUID][]string, error) {
+	tags := map[uuid.UUID][]string{}
+	if len(ids) == 0 {
+		return tags, nil
+	}
+
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := c.db.Query(`
+	SELECT vt.video_id, t.name
+	FROM video_tags vt
+	JOIN tags t ON t.id = vt.tag_id
+	WHERE vt.video_id IN (?`+strings.Repeat(", ?", len(ids)-1)+`)
+	ORDER BY t.name
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id uuid.UUID
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		tags[id] = append(tags[id], name)
+	}
+	return tags, rows.Err()
+}
+
+// withTags fills in the Tags of each video.
+func (c Client) withTags(videos []Video) ([]Video, error) {
+	ids := make([]uuid.UUID, len(videos))
+	for i, video := range videos {
+		ids[i] = video.ID
+	}
+	tags, err := c.videoTags(ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range videos {
+		videos[i].Tags = tags[videos[i].ID]
+		if videos[i].Tags == nil {
+			videos[i].Tags = []string{}
+		}
+	}
+	return videos, nil
+}
+
+// deleteUnusedTags removes tags that are no longer on any video.
+func deleteUnusedTags(db execer) error {
+	_, err := db.Exec(`DELETE FROM tags WHERE NOT EXISTS (SELECT 1 FROM video_tags WHERE tag_id = tags.id)`)
+	return err
+}
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestVideoTags(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			first := createTestVideo(t, store)
+			second, err := store.CreateVideo(CreateVideoParams{UserID: first.UserID, Title: "Walking"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			other, err := store.CreateUser(CreateUserParams{Email: "other@example.com", Password: "hash"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			others, err := store.CreateVideo(CreateVideoParams{UserID: other.ID, Title: "Elsewhere"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, tag := range []struct {
+				video Video
+				names []string
+			}{
+				{first, []string{"outdoors", "boots"}},
+				// already tagged outdoors, which is left alone
+				{first, []string{"outdoors"}},
+				{second, []string{"outdoors"}},
+				{others, []string{"outdoors", "elsewhere"}},
+			} {
+				err := store.AddVideoTags(tag.video.ID, tag.names)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := store.GetVideo(first.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := []string{"boots", "outdoors"}; !reflect.DeepEqual(got.Tags, want) {
+				t.Errorf("Tags = %v, want %v", got.Tags, want)
+			}
+			counts := func() []TagCount {
+				t.Helper()
+				counts, err := store.GetTagCounts(first.UserID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return counts
+			}
+			// the other user's videos aren't counted
+			if want := []TagCount{{"boots", 1}, {"outdoors", 2}}; !reflect.DeepEqual(counts(), want) {
+				t.Errorf("counts = %v, want %v", counts(), want)
+			}
+
+			videos, err := store.ListVideos(ListVideosParams{UserID: first.UserID, Sort: VideoSortTitle, Limit: 10, Tags: []string{"outdoors", "boots"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(videos) != 1 || videos[0].ID != first.ID {
+				t.Errorf("tagged outdoors and boots = %+v, want the first video", videos)
+			}
+
+			err = store.RemoveVideoTag(first.ID, "boots")
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = store.RemoveVideoTag(first.ID, "boots")
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("removing again: err = %v, want ErrNotFound", err)
+			}
+			err = store.DeleteVideo(second.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := []TagCount{{"outdoors", 1}}; !reflect.DeepEqual(counts(), want) {
+				t.Errorf("counts after removing = %v, want %v", counts(), want)
+			}
+		})
+	}
+}
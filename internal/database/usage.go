@@ -0,0 +1,225 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Quota overrides the server's default limits for one user or organization.
+// A nil limit falls back to the default, and a negative one means unlimited.
+type Quota struct {
+	StorageBytes  *int64 `json:"storage_bytes"`
+	Videos        *int64 `json:"videos"`
+	UploadMinutes *int64 `json:"upload_minutes"`
+}
+
+// Usage is what a user or organization is counted as using against their
+// quota.
+type Usage struct {
+	StorageBytes int64 `json:"storage_bytes"`
+	Videos       int64 `json:"videos"`
+	// UploadDuration is the total length of the videos uploaded in the
+	// period asked for, including any since deleted or replaced.
+	UploadDuration time.Duration `json:"upload_duration"`
+}
+
+// RecordUploadParams describe a finished video upload. Limits are checked
+// against usage counted the same way GetUsage, or GetOrganizationUsage for
+// an organization's video, counts it, and a negative limit means unlimited.
+type RecordUploadParams struct {
+	UserID  uuid.UUID
+	VideoID uuid.UUID
+	URL     string
+	Size    int64
+	// Orientation is "landscape", "portrait" or "other".
+	Orientation string
+	Duration    time.Duration
+	// OrganizationID is set for uploads to an organization's videos, which
+	// count against its quota rather than the user's.
+	OrganizationID *uuid.UUID
+
+	StorageLimit    int64
+	UploadTimeLimit time.Duration
+	// Since is the start of the period upload time is counted over.
+	Since time.Time
+}
+
+// GetUsage adds up the user's stored files and videos, and the videos they
+// uploaded since the given time, leaving out what belongs to organizations.
+func (c Client) GetUsage(userID uuid.UUID, since time.Time) (Usage, error) {
+	return getUsage(c.db, userID, since)
+}
+
+// queryRower is what getUsage and getOrganizationUsage need from a *sql.DB
+// or *sql.Tx.
+type queryRower interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func getUsage(db queryRower, userID uuid.UUID, since time.Time) (Usage, error) {
+	var usage Usage
+	err := db.QueryRow(`
+		SELECT COALESCE(SUM(video_size + thumbnail_size), 0), COUNT(*)
+		FROM videos
+		WHERE user_id = ? AND organization_id IS NULL
+	`, userID.String()).Scan(&usage.StorageBytes, &usage.Videos)
+	if err != nil {
+		return Usage{}, err
+	}
+
+	var durationMs int64
+	err = db.QueryRow(`
+		SELECT COALESCE(SUM(duration_ms), 0)
+		FROM uploads
+		WHERE user_id = ? AND organization_id IS NULL AND created_at >= ?
+	`, userID.String(), since.UTC()).Scan(&durationMs)
+	if err != nil {
+		return Usage{}, err
+	}
+	usage.UploadDuration = time.Duration(durationMs) * time.Millisecond
+	return usage, nil
+}
+
+// RecordUpload points the video at its newly stored file, marking it ready,
+// and adds the upload to the user's upload history, in one transaction so
+// concurrent uploads can't both fit in what's left of the quota, which is
+// the organization's for its videos. It returns
+// ErrQuotaExceeded, changing nothing, if the upload doesn't fit.
+func (c Client) RecordUpload(params RecordUploadParams) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// writing first takes SQLite's write lock, so no other upload can be
+	// recorded between counting usage and committing
+	update := `
+		UPDATE videos
+		SET
+			video_url = ?,
+			video_size = ?,
+			orientation = ?,
+			duration_ms = ?,
+			status = ?,
+			updated_at = ?
+		WHERE id = ?
+	`
+	err = requireRowsAffected(tx.Exec(
+		update,
+		params.URL,
+		params.Size,
+		params.Orientation,
+		params.Duration.Milliseconds(),
+		VideoStatusReady,
+		time.Now().UTC(),
+		params.VideoID,
+	))
+	if err != nil {
+		return err
+	}
+
+	// counted with the new file in place of the one it replaces
+	var usage Usage
+	if params.OrganizationID != nil {
+		usage, err = getOrganizationUsage(tx, *params.OrganizationID, params.Since)
+	} else {
+		usage, err = getUsage(tx, params.UserID, params.Since)
+	}
+	if err != nil {
+		return err
+	}
+	if !params.fits(usage) {
+		return ErrQuotaExceeded
+	}
+
+	query := `
+		INSERT INTO uploads (
+			id,
+			created_at,
+			user_id,
+			video_id,
+			size,
+			duration_ms,
+			organization_id
+		) VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err = tx.Exec(
+		query,
+		uuid.NewString(),
+		time.Now().UTC(),
+		params.UserID.String(),
+		params.VideoID.String(),
+		params.Size,
+		params.Duration.Milliseconds(),
+		params.OrganizationID,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// fits reports whether usage, already counting the new file but not yet
+// this upload's duration, leaves room for the upload.
+func (params RecordUploadParams) fits(usage Usage) bool {
+	if params.StorageLimit >= 0 && usage.StorageBytes > params.StorageLimit {
+		return false
+	}
+	if params.UploadTimeLimit >= 0 && usage.UploadDuration+params.Duration > params.UploadTimeLimit {
+		return false
+	}
+	return true
+}
+
+// SetUserQuota replaces the user's quota overrides.
+func (c Client) SetUserQuota(id uuid.UUID, quota Quota) error {
+	query := `
+		UPDATE users
+		SET quota_storage_bytes = ?, quota_videos = ?, quota_upload_minutes = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	return requireRowsAffected(c.db.Exec(query, quota.StorageBytes, quota.Videos, quota.UploadMinutes, id.String()))
+}
+
+// GetOrganizationUsage adds up the organization's stored files and videos,
+// and the videos uploaded to it since the given time.
+func (c Client) GetOrganizationUsage(orgID uuid.UUID, since time.Time) (Usage, error) {
+	return getOrganizationUsage(c.db, orgID, since)
+}
+
+func getOrganizationUsage(db queryRower, orgID uuid.UUID, since time.Time) (Usage, error) {
+	var usage Usage
+	err := db.QueryRow(`
+		SELECT COALESCE(SUM(video_size + thumbnail_size), 0), COUNT(*)
+		FROM videos
+		WHERE organization_id = ?
+	`, orgID).Scan(&usage.StorageBytes, &usage.Videos)
+	if err != nil {
+		return Usage{}, err
+	}
+
+	var durationMs int64
+	err = db.QueryRow(`
+		SELECT COALESCE(SUM(duration_ms), 0)
+		FROM uploads
+		WHERE organization_id = ? AND created_at >= ?
+	`, orgID, since.UTC()).Scan(&durationMs)
+	if err != nil {
+		return Usage{}, err
+	}
+	usage.UploadDuration = time.Duration(durationMs) * time.Millisecond
+	return usage, nil
+}
+
+// SetOrganizationQuota replaces the organization's quota overrides.
+func (c Client) SetOrganizationQuota(id uuid.UUID, quota Quota) error {
+	query := `
+		UPDATE organizations
+		SET quota_storage_bytes = ?, quota_videos = ?, quota_upload_minutes = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	return requireRowsAffected(c.db.Exec(query, quota.StorageBytes, quota.Videos, quota.UploadMinutes, id))
+}
@@ -0,0 +1,188 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestRecordUpload(t *testing.T) {
+	since := time.Now().Add(-time.Hour)
+	upload := func(video Video, size int64, duration time.Duration) RecordUploadParams {
+		return RecordUploadParams{
+			UserID:          video.UserID,
+			VideoID:         video.ID,
+			URL:             "https://cdn.example.com/" + uuid.NewString() + ".mp4",
+			Size:            size,
+			Orientation:     "landscape",
+			Duration:        duration,
+			StorageLimit:    1000,
+			UploadTimeLimit: 10 * time.Minute,
+			Since:           since,
+		}
+	}
+
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			video := createTestVideo(t, store)
+			first := upload(video, 600, 4*time.Minute)
+			if err := store.RecordUpload(first); err != nil {
+				t.Fatal(err)
+			}
+
+			// the file being replaced doesn't count against its replacement
+			second := upload(video, 900, 4*time.Minute)
+			if err := store.RecordUpload(second); err != nil {
+				t.Fatalf("replacing the file: %v", err)
+			}
+
+			rejected := []struct {
+				name   string
+				params RecordUploadParams
+			}{
+				{"over storage", upload(video, 1001, time.Minute)},
+				{"over upload time", upload(video, 100, 3*time.Minute)},
+			}
+			for _, tt := range rejected {
+				err := store.RecordUpload(tt.params)
+				if !errors.Is(err, ErrQuotaExceeded) {
+					t.Errorf("%s: err = %v, want ErrQuotaExceeded", tt.name, err)
+				}
+			}
+
+			got, err := store.GetVideo(video.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.VideoURL == nil || *got.VideoURL != second.URL || got.VideoSize != 900 {
+				t.Errorf("video file = %v, %d bytes; want the second upload kept", got.VideoURL, got.VideoSize)
+			}
+			if got.Status != VideoStatusReady || got.DurationMs != second.Duration.Milliseconds() {
+				t.Errorf("status %q, duration %dms; want ready and the second upload's duration", got.Status, got.DurationMs)
+			}
+			usage, err := store.GetUsage(video.UserID, since)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := Usage{StorageBytes: 900, Videos: 1, UploadDuration: 8 * time.Minute}
+			if usage != want {
+				t.Errorf("usage = %+v, want %+v", usage, want)
+			}
+
+			unlimited := upload(video, 5000, time.Hour)
+			unlimited.StorageLimit = -1
+			unlimited.UploadTimeLimit = -1
+			if err := store.RecordUpload(unlimited); err != nil {
+				t.Errorf("unlimited: %v", err)
+			}
+
+			err = store.RecordUpload(upload(Video{ID: uuid.New(), CreateVideoParams: video.CreateVideoParams}, 1, 0))
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("unknown video: err = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestRecordUploadConcurrent(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			user, err := store.CreateUser(CreateUserParams{Email: "user@example.com", Password: "hash"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			const uploads = 5
+			errs := make(chan error, uploads)
+			for i := 0; i < uploads; i++ {
+				video, err := store.CreateVideo(CreateVideoParams{UserID: user.ID, Title: "Boots"})
+				if err != nil {
+					t.Fatal(err)
+				}
+				go func() {
+					errs <- store.RecordUpload(RecordUploadParams{
+						UserID:          user.ID,
+						VideoID:         video.ID,
+						URL:             "https://cdn.example.com/video.mp4",
+						Size:            400,
+						StorageLimit:    1000,
+						UploadTimeLimit: -1,
+					})
+				}()
+			}
+
+			recorded := 0
+			for i := 0; i < uploads; i++ {
+				err := <-errs
+				switch {
+				case err == nil:
+					recorded++
+				case !errors.Is(err, ErrQuotaExceeded):
+					t.Errorf("RecordUpload: %v", err)
+				}
+			}
+			if recorded != 2 {
+				t.Errorf("%d uploads recorded, want the 2 that fit", recorded)
+			}
+		})
+	}
+}
+
+func TestRecordUploadOrganization(t *testing.T) {
+	since := time.Now().Add(-time.Hour)
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			personal := createTestVideo(t, store)
+			org, err := store.CreateOrganization("Acme", personal.UserID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			video, err := store.CreateVideo(CreateVideoParams{UserID: personal.UserID, OrganizationID: &org.ID, Title: "Walking"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			upload := func(video Video, size int64) RecordUploadParams {
+				return RecordUploadParams{
+					UserID:          video.UserID,
+					OrganizationID:  video.OrganizationID,
+					VideoID:         video.ID,
+					URL:             "https://cdn.example.com/" + uuid.NewString() + ".mp4",
+					Size:            size,
+					Orientation:     "landscape",
+					Duration:        time.Minute,
+					StorageLimit:    1000,
+					UploadTimeLimit: -1,
+					Since:           since,
+				}
+			}
+
+			// the user's own files don't use up the organization's quota
+			if err := store.RecordUpload(upload(personal, 900)); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.RecordUpload(upload(video, 800)); err != nil {
+				t.Fatalf("organization upload: %v", err)
+			}
+			if err := store.RecordUpload(upload(video, 1001)); !errors.Is(err, ErrQuotaExceeded) {
+				t.Errorf("over the organization's storage: err = %v, want ErrQuotaExceeded", err)
+			}
+
+			usage, err := store.GetOrganizationUsage(org.ID, since)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := (Usage{StorageBytes: 800, Videos: 1, UploadDuration: time.Minute}); usage != want {
+				t.Errorf("organization usage = %+v, want %+v", usage, want)
+			}
+			usage, err = store.GetUsage(personal.UserID, since)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := (Usage{StorageBytes: 900, Videos: 1, UploadDuration: time.Minute}); usage != want {
+				t.Errorf("user usage = %+v, want %+v", usage, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Purposes a UserToken can be issued for. A token is only accepted for the
+// purpose it was issued for.
+const (
+	TokenPurposeVerifyEmail   = "verify_email"
+	TokenPurposeResetPassword = "reset_password"
+	TokenPurposeOIDCLogin     = "oidc_login"
+)
+
+// UserToken is a single-use token emailed to a user, such as an email
+// verification or password reset link.
+type UserToken struct {
+	CreatedAt time.Time  `json:"created_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreateUserTokenParams
+}
+
+type CreateUserTokenParams struct {
+	// TokenHash is the digest of the token; the token itself is only ever
+	// sent to the user.
+	TokenHash string    `json:"-"`
+	UserID    uuid.UUID `json:"user_id"`
+	Purpose   string    `json:"purpose"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// CreateUserToken stores a new token. Any unused tokens the user already has
+// for the same purpose are invalidated, so only the latest link works.
+func (c Client) CreateUserToken(params CreateUserTokenParams) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		DELETE FROM user_tokens
+		WHERE user_id = ? AND purpose = ? AND used_at IS NULL
+	`, params.UserID.String(), params.Purpose)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO user_tokens (
+			token_hash,
+			created_at,
+			user_id,
+			purpose,
+			expires_at
+		) VALUES (?, CURRENT_TIMESTAMP, ?, ?, ?)
+	`, params.TokenHash, params.UserID.String(), params.Purpose, params.ExpiresAt.UTC())
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrConflict
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ConsumeUserToken marks the token as used and returns it. It returns
+// ErrNotFound if no token with that hash was issued for purpose, or if it has
+// expired or already been used.
+func (c Client) ConsumeUserToken(purpose, tokenHash string) (UserToken, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return UserToken{}, err
+	}
+	defer tx.Rollback()
+
+	var token UserToken
+	var userID string
+	err = tx.QueryRow(`
+		SELECT token_hash, created_at, used_at, user_id, purpose, expires_at
+		FROM user_tokens
+		WHERE token_hash = ? AND purpose = ?
+	`, tokenHash, purpose).Scan(
+		&token.TokenHash,
+		&token.CreatedAt,
+		&token.UsedAt,
+		&userID,
+		&token.Purpose,
+		&token.ExpiresAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return UserToken{}, ErrNotFound
+	}
+	if err != nil {
+		return UserToken{}, err
+	}
+	if token.UsedAt != nil || time.Now().After(token.ExpiresAt) {
+		return UserToken{}, ErrNotFound
+	}
+	token.UserID, err = uuid.Parse(userID)
+	if err != nil {
+		return UserToken{}, err
+	}
+
+	err = requireRowsAffected(tx.Exec(`
+		UPDATE user_tokens
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE token_hash = ? AND used_at IS NULL
+	`, tokenHash))
+	if err != nil {
+		return UserToken{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return UserToken{}, err
+	}
+	now := time.Now().UTC()
+	token.UsedAt = &now
+	return token, nil
+}
@@ -3,29 +3,100 @@ package database
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// defaultUserRole is the role given to users created without one.
+const defaultUserRole = "uploader"
+
 type User struct {
 	ID        uuid.UUID `json:"id"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	// TokenVersion is embedded in access tokens; incrementing it
+	// invalidates every access token issued before.
+	TokenVersion int        `json:"-"`
+	DisabledAt   *time.Time `json:"disabled_at"`
+	// EmailVerifiedAt is set once the user follows the link in their
+	// verification email.
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	// TOTPSecret is set once the user starts enrolling in two-factor
+	// authentication, but is only enforced once TOTPEnabledAt is set.
+	TOTPSecret    *string    `json:"-"`
+	TOTPEnabledAt *time.Time `json:"totp_enabled_at"`
+	// TOTPLastStep is the time step of the last TOTP code accepted.
+	TOTPLastStep int64 `json:"-"`
+	// MaxUploadSize overrides the server's limit on the size of a video
+	// upload, in bytes, when set.
+	MaxUploadSize *int64 `json:"max_upload_size"`
+	Quota         Quota  `json:"quota"`
+	// ActiveOrganizationID is the organization the user is working in,
+	// whose videos they list and create, or nil for their own.
+	ActiveOrganizationID *uuid.UUID `json:"active_organization_id"`
 	CreateUserParams
+	UserProfile
 }
 
 type CreateUserParams struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email string `json:"email"`
+	// Password is the argon2id hash, never the plaintext, and is never
+	// serialized.
+	Password string `json:"-"`
+	Role     string `json:"role"`
+}
+
+// UserProfile is the part of a user the user can edit freely.
+type UserProfile struct {
+	DisplayName string  `json:"display_name"`
+	Bio         string  `json:"bio"`
+	AvatarURL   *string `json:"avatar_url"`
+}
+
+const userColumns = `id, created_at, updated_at, email, password, token_version, role, disabled_at, email_verified_at, display_name, bio, avatar_url, totp_secret, totp_enabled_at, totp_last_step, max_upload_size, quota_storage_bytes, quota_videos, quota_upload_minutes, active_organization_id`
+
+func scanUser(row rowScanner) (User, error) {
+	var user User
+	var id string
+	err := row.Scan(
+		&id,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&user.Email,
+		&user.Password,
+		&user.TokenVersion,
+		&user.Role,
+		&user.DisabledAt,
+		&user.EmailVerifiedAt,
+		&user.DisplayName,
+		&user.Bio,
+		&user.AvatarURL,
+		&user.TOTPSecret,
+		&user.TOTPEnabledAt,
+		&user.TOTPLastStep,
+		&user.MaxUploadSize,
+		&user.Quota.StorageBytes,
+		&user.Quota.Videos,
+		&user.Quota.UploadMinutes,
+		&user.ActiveOrganizationID,
+	)
+	if err != nil {
+		return User{}, err
+	}
+	user.ID, err = uuid.Parse(id)
+	if err != nil {
+		return User{}, err
+	}
+	return user, nil
 }
 
 func (c Client) GetUsers() ([]User, error) {
 	query := `
-		SELECT
-			id,
-			email
+		SELECT ` + userColumns + `
 		FROM users
+		ORDER BY created_at
 	`
 
 	rows, err := c.db.Query(query)
@@ -36,65 +107,45 @@ func (c Client) GetUsers() ([]User, error) {
 
 	users := []User{}
 	for rows.Next() {
-		var user User
-		var id string
-		if err := rows.Scan(&id, &user.Email); err != nil {
-			return nil, err
-		}
-		user.ID, err = uuid.Parse(id)
+		user, err := scanUser(rows)
 		if err != nil {
 			return nil, err
 		}
 		users = append(users, user)
 	}
 
-	return users, nil
+	return users, rows.Err()
 }
 
 func (c Client) GetUserByEmail(email string) (User, error) {
 	query := `
-		SELECT id, created_at, updated_at, email, password
+		SELECT ` + userColumns + `
 		FROM users
 		WHERE email = ?
 	`
-	var user User
-	var id string
-	err := c.db.QueryRow(query, email).Scan(&id, &user.CreatedAt, &user.UpdatedAt, &user.Email, &user.Password)
+	user, err := scanUser(c.db.QueryRow(query, email))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return User{}, nil
+			return User{}, ErrNotFound
 		}
 		return User{}, err
 	}
-	user.ID, err = uuid.Parse(id)
-	if err != nil {
-		return User{}, err
-	}
 	return user, nil
 }
 
 func (c Client) GetUserByRefreshToken(token string) (*User, error) {
 	query := `
-		SELECT u.id, u.email, u.created_at, u.updated_at, u.password
-		FROM users u
-		JOIN refresh_tokens rt ON u.id = rt.user_id
-		WHERE rt.token = ?
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE id = (SELECT user_id FROM refresh_tokens WHERE token = ?)
 	`
-
-	var user User
-	var id string
-	err := c.db.QueryRow(query, token).Scan(&id, &user.Email, &user.CreatedAt, &user.UpdatedAt, &user.Password)
+	user, err := scanUser(c.db.QueryRow(query, token))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil
+			return nil, ErrNotFound
 		}
 		return nil, err
 	}
-	user.ID, err = uuid.Parse(id)
-	if err != nil {
-		return nil, err
-	}
-
 	return &user, nil
 }
 
@@ -103,12 +154,19 @@ func (c Client) CreateUser(params CreateUserParams) (*User, error) {
 
 	query := `
 		INSERT INTO users
-		    (id, created_at, updated_at, email, password)
+		    (id, created_at, updated_at, email, password, role)
 		VALUES
-		    (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?)
+		    (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?)
 	`
-	_, err := c.db.Exec(query, id.String(), params.Email, params.Password)
+	role := params.Role
+	if role == "" {
+		role = defaultUserRole
+	}
+	_, err := c.db.Exec(query, id.String(), params.Email, params.Password, role)
 	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, fmt.Errorf("%w: email already in use", ErrConflict)
+		}
 		return nil, err
 	}
 
@@ -117,31 +175,183 @@ func (c Client) CreateUser(params CreateUserParams) (*User, error) {
 
 func (c Client) GetUser(id uuid.UUID) (*User, error) {
 	query := `
-		SELECT id, created_at, updated_at, email, password
+		SELECT ` + userColumns + `
 		FROM users
 		WHERE id = ?
 	`
-	var user User
-	var idStr string
-	err := c.db.QueryRow(query, id.String()).Scan(&idStr, &user.CreatedAt, &user.UpdatedAt, &user.Email, &user.Password)
+	user, err := scanUser(c.db.QueryRow(query, id.String()))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil
+			return nil, ErrNotFound
 		}
 		return nil, err
 	}
-	user.ID, err = uuid.Parse(idStr)
-	if err != nil {
-		return nil, err
-	}
 	return &user, nil
 }
 
-func (c Client) DeleteUser(id uuid.UUID) error {
+// IncrementTokenVersion invalidates every access token issued to the user so
+// far, e.g. after a password change.
+func (c Client) IncrementTokenVersion(id uuid.UUID) error {
+	query := `
+		UPDATE users
+		SET token_version = token_version + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	return requireRowsAffected(c.db.Exec(query, id.String()))
+}
+
+func (c Client) SetUserRole(id uuid.UUID, role string) error {
+	query := `
+		UPDATE users
+		SET role = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	return requireRowsAffected(c.db.Exec(query, role, id.String()))
+}
+
+// SetUserDisabled disables or re-enables an account. Disabling also bumps the
+// token version so the user's outstanding access tokens stop working.
+func (c Client) SetUserDisabled(id uuid.UUID, disabled bool) error {
+	query := `
+		UPDATE users
+		SET disabled_at = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	if disabled {
+		query = `
+		UPDATE users
+		SET disabled_at = CURRENT_TIMESTAMP, token_version = token_version + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	}
+	return requireRowsAffected(c.db.Exec(query, id.String()))
+}
+
+// SetUserMaxUploadSize overrides the user's video upload size limit. A nil
+// size puts them back on the server default.
+func (c Client) SetUserMaxUploadSize(id uuid.UUID, size *int64) error {
+	query := `
+		UPDATE users
+		SET max_upload_size = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	return requireRowsAffected(c.db.Exec(query, size, id.String()))
+}
+
+// SetUserPassword replaces the user's password hash. Callers should also
+// call IncrementTokenVersion so tokens issued under the old password stop
+// working.
+func (c Client) SetUserPassword(id uuid.UUID, passwordHash string) error {
+	query := `
+		UPDATE users
+		SET password = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	return requireRowsAffected(c.db.Exec(query, passwordHash, id.String()))
+}
+
+// MarkEmailVerified records that the user has proven they own their email
+// address. Verifying an already verified address keeps the original time.
+func (c Client) MarkEmailVerified(id uuid.UUID) error {
+	query := `
+		UPDATE users
+		SET email_verified_at = COALESCE(email_verified_at, CURRENT_TIMESTAMP), updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	return requireRowsAffected(c.db.Exec(query, id.String()))
+}
+
+func (c Client) UpdateUserProfile(id uuid.UUID, profile UserProfile) error {
+	query := `
+		UPDATE users
+		SET display_name = ?, bio = ?, avatar_url = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	return requireRowsAffected(c.db.Exec(query, profile.DisplayName, profile.Bio, profile.AvatarURL, id.String()))
+}
+
+// SetUserEmail changes the user's email address. The new address starts out
+// unverified. It returns ErrConflict if another account uses the address.
+func (c Client) SetUserEmail(id uuid.UUID, email string) error {
 	query := `
-		DELETE FROM users
+		UPDATE users
+		SET email = ?, email_verified_at = NULL, updated_at = CURRENT_TIMESTAMP
 		WHERE id = ?
 	`
-	_, err := c.db.Exec(query, id.String())
+	err := requireRowsAffected(c.db.Exec(query, email, id.String()))
+	if isUniqueViolation(err) {
+		return fmt.Errorf("%w: email already in use", ErrConflict)
+	}
 	return err
 }
+
+// DeleteUser deletes the user along with their own videos and the videos'
+// tags, share links and collaborators, playlists, roles on other users'
+// videos, organization memberships, refresh tokens, API keys, emailed
+// tokens, recovery codes, linked identities and upload history. Files the
+// videos point at are left for the caller to clean up. Videos and uploads
+// they made for organizations stay there, credited to another owner, and it
+// returns ErrConflict if the user is the last owner of an organization.
+func (c Client) DeleteUser(id uuid.UUID) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var lastOwner bool
+	err = tx.QueryRow(`
+	SELECT EXISTS (
+		SELECT 1 FROM organization_members m
+		WHERE m.user_id = ? AND m.role = ? AND NOT EXISTS (
+			SELECT 1 FROM organization_members o
+			WHERE o.organization_id = m.organization_id AND o.user_id != m.user_id AND o.role = ?
+		)
+	)
+	`, id.String(), OrganizationRoleOwner, OrganizationRoleOwner).Scan(&lastOwner)
+	if err != nil {
+		return err
+	}
+	if lastOwner {
+		return fmt.Errorf("%w: user is the last owner of an organization", ErrConflict)
+	}
+
+	// every organization has an owner other than the user by now
+	for _, table := range []string{"videos", "uploads"} {
+		_, err = tx.Exec(`
+		UPDATE `+table+`
+		SET user_id = (
+			SELECT m.user_id FROM organization_members m
+			WHERE m.organization_id = `+table+`.organization_id AND m.role = ? AND m.user_id != ?
+			ORDER BY m.created_at
+			LIMIT 1
+		)
+		WHERE user_id = ? AND organization_id IS NOT NULL
+		`, OrganizationRoleOwner, id.String(), id.String())
+		if err != nil {
+			return fmt.Errorf("failed to hand over user's organization %s: %w", table, err)
+		}
+	}
+
+	_, err = tx.Exec(`DELETE FROM video_tags WHERE video_id IN (SELECT id FROM videos WHERE user_id = ?)`, id.String())
+	if err != nil {
+		return fmt.Errorf("failed to delete user's video tags: %w", err)
+	}
+	err = deleteUnusedTags(tx)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"videos", "playlists", "video_permissions", "organization_members", "refresh_tokens", "api_keys", "user_tokens", "recovery_codes", "user_identities", "uploads"} {
+		_, err = tx.Exec(`DELETE FROM `+table+` WHERE user_id = ?`, id.String())
+		if err != nil {
+			return fmt.Errorf("failed to delete user's %s: %w", table, err)
+		}
+	}
+
+	err = requireRowsAffected(tx.Exec(`DELETE FROM users WHERE id = ?`, id.String()))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
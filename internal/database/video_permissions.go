@@ -0,0 +1,143 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Roles collaborators can be given on a video. Each role can do everything
+// the ones before it can: viewers can see the video even when it's private,
+// editors can also change its thumbnail and metadata, and managers can also
+// replace its file, delete it, share it and manage its collaborators.
+const (
+	VideoRoleViewer  = "viewer"
+	VideoRoleEditor  = "editor"
+	VideoRoleManager = "manager"
+)
+
+// VideoPermission gives a user other than the owner a role on a video.
+type VideoPermission struct {
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	VideoID   uuid.UUID `json:"video_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	// Email is the collaborator's, so they can be recognised in listings.
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+const videoPermissionColumns = `vp.created_at, vp.updated_at, vp.video_id, vp.user_id, u.email, vp.role`
+
+func scanVideoPermission(row rowScanner) (VideoPermission, error) {
+	var permission VideoPermission
+	err := row.Scan(
+		&permission.CreatedAt,
+		&permission.UpdatedAt,
+		&permission.VideoID,
+		&permission.UserID,
+		&permission.Email,
+		&permission.Role,
+	)
+	return permission, err
+}
+
+// SetVideoPermission gives the user role on the video, replacing any role
+// they already had.
+func (c Client) SetVideoPermission(videoID, userID uuid.UUID, role string) (VideoPermission, error) {
+	query := `
+	INSERT INTO video_permissions (video_id, user_id, role, created_at, updated_at)
+	VALUES (?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+	ON CONFLICT(video_id, user_id) DO UPDATE SET
+		role = excluded.role,
+		updated_at = CURRENT_TIMESTAMP
+	`
+	_, err := c.db.Exec(query, videoID, userID, role)
+	if err != nil {
+		return VideoPermission{}, err
+	}
+
+	return c.GetVideoPermission(videoID, userID)
+}
+
+// GetVideoPermission returns the user's role on the video. It returns
+// ErrNotFound if they haven't been given one, which is always the case for
+// the video's owner.
+func (c Client) GetVideoPermission(videoID, userID uuid.UUID) (VideoPermission, error) {
+	query := `
+	SELECT ` + videoPermissionColumns + `
+	FROM video_permissions vp
+	JOIN users u ON u.id = vp.user_id
+	WHERE vp.video_id = ? AND vp.user_id = ?
+	`
+	permission, err := scanVideoPermission(c.db.QueryRow(query, videoID, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return VideoPermission{}, ErrNotFound
+	}
+	return permission, err
+}
+
+// GetVideoPermissions returns the video's collaborators in the order they
+// were added.
+func (c Client) GetVideoPermissions(videoID uuid.UUID) ([]VideoPermission, error) {
+	query := `
+	SELECT ` + videoPermissionColumns + `
+	FROM video_permissions vp
+	JOIN users u ON u.id = vp.user_id
+	WHERE vp.video_id = ?
+	ORDER BY vp.created_at, u.email
+	`
+	rows, err := c.db.Query(query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []VideoPermission{}
+	for rows.Next() {
+		permission, err := scanVideoPermission(rows)
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+	return permissions, rows.Err()
+}
+
+func (c Client) DeleteVideoPermission(videoID, userID uuid.UUID) error {
+	query := `DELETE FROM video_permissions WHERE video_id = ? AND user_id = ?`
+	return requireRowsAffected(c.db.Exec(query, videoID, userID))
+}
+
+// GetSharedVideos returns the videos the user has been given a role on,
+// newest first.
+func (c Client) GetSharedVideos(userID uuid.UUID) ([]Video, error) {
+	query := `
+	SELECT ` + prefixColumns("v", videoColumns) + `
+	FROM video_permissions vp
+	JOIN videos v ON v.id = vp.video_id
+	WHERE vp.user_id = ?
+	ORDER BY v.created_at DESC
+	`
+	rows, err := c.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	videos := []Video{}
+	for rows.Next() {
+		video, err := scanVideo(rows)
+		if err != nil {
+			return nil, err
+		}
+		videos = append(videos, video)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return c.withTags(videos)
+}
@@ -3,39 +3,146 @@ package database
 import (
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// Video statuses. A video is a draft until a file is uploaded for it.
+const (
+	VideoStatusDraft      = "draft"
+	VideoStatusProcessing = "processing"
+	VideoStatusReady      = "ready"
+	VideoStatusFailed     = "failed"
+)
+
+// Visibilities of videos and playlists. Public and unlisted ones can be
+// viewed by anyone with the link, and private ones only by the owner and,
+// for videos, its collaborators. Nothing lists public ones yet, so for now
+// the two differ only in intent.
+const (
+	VisibilityPublic   = "public"
+	VisibilityUnlisted = "unlisted"
+	VisibilityPrivate  = "private"
+)
+
 type Video struct {
 	ID           uuid.UUID `json:"id"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 	ThumbnailURL *string   `json:"thumbnail_url"`
 	VideoURL     *string   `json:"video_url"`
+	// VideoSize and ThumbnailSize are the sizes in bytes of the stored
+	// files, counted against the owner's storage quota.
+	VideoSize     int64  `json:"video_size"`
+	ThumbnailSize int64  `json:"thumbnail_size"`
+	Status        string `json:"status"`
+	// Orientation is "landscape", "portrait" or "other" once a file has
+	// been uploaded.
+	Orientation *string  `json:"orientation"`
+	DurationMs  int64    `json:"duration_ms"`
+	Tags        []string `json:"tags"`
 	CreateVideoParams
 }
 
+// UpdateVideoMetaParams are the changes to a video's metadata. Nil fields
+// are left as they are.
+type UpdateVideoMetaParams struct {
+	Title       *string
+	Description *string
+	Visibility  *string
+	// UnmodifiedSince, when set, makes the update fail with ErrModified if
+	// the video's updated_at is no longer this.
+	UnmodifiedSince *time.Time
+}
+
 type CreateVideoParams struct {
 	Title       string    `json:"title"`
 	Description string    `json:"description"`
+	Visibility  string    `json:"visibility"`
 	UserID      uuid.UUID `json:"user_id"`
+	// OrganizationID is set when an organization owns the video, in which
+	// case UserID is only the member who created it.
+	OrganizationID *uuid.UUID `json:"organization_id"`
+}
+
+// VideoSort is a field videos can be listed in order of.
+type VideoSort string
+
+const (
+	VideoSortCreated  VideoSort = "created"
+	VideoSortTitle    VideoSort = "title"
+	VideoSortDuration VideoSort = "duration"
+)
+
+// VideoCursor is the position of the last video on a page. Only the ID and
+// the field being sorted on are used.
+type VideoCursor struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	Title      string
+	DurationMs int64
+}
+
+type ListVideosParams struct {
+	UserID     uuid.UUID
+	Sort       VideoSort
+	Descending bool
+	// OrganizationID lists the organization's videos rather than the
+	// user's own.
+	OrganizationID *uuid.UUID
+	// After continues the listing from the end of a previous page.
+	After *VideoCursor
+	Limit int
+
+	HasVideo     *bool
+	HasThumbnail *bool
+	Orientation  string
+	Status       string
+	// Tags lists tags the videos must all have.
+	Tags []string
+	// CreatedAfter is inclusive and CreatedBefore exclusive.
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+}
+
+// sqliteTimestampLayout is how SQLite's CURRENT_TIMESTAMP writes times, so
+// timestamps compared against created_at have to be written the same way.
+const sqliteTimestampLayout = "2006-01-02 15:04:05"
+
+const videoColumns = `id, created_at, updated_at, title, description, thumbnail_url, video_url, video_size, thumbnail_size, status, orientation, duration_ms, visibility, user_id, organization_id`
+
+func scanVideo(row rowScanner) (Video, error) {
+	var video Video
+	err := row.Scan(
+		&video.ID,
+		&video.CreatedAt,
+		&video.UpdatedAt,
+		&video.Title,
+		&video.Description,
+		&video.ThumbnailURL,
+		&video.VideoURL,
+		&video.VideoSize,
+		&video.ThumbnailSize,
+		&video.Status,
+		&video.Orientation,
+		&video.DurationMs,
+		&video.Visibility,
+		&video.UserID,
+		&video.OrganizationID,
+	)
+	return video, err
 }
 
+// GetVideos returns the user's own videos, newest first. Videos they
+// created for an organization belong to it, so aren't included.
 func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
 	query := `
-	SELECT
-		id,
-		created_at,
-		updated_at,
-		title,
-		description,
-		thumbnail_url,
-		video_url,
-		user_id
+	SELECT ` + videoColumns + `
 	FROM videos
-	WHERE user_id = ?
+	WHERE user_id = ? AND organization_id IS NULL
 	ORDER BY created_at DESC
 	`
 
@@ -47,23 +154,129 @@ func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
 
 	videos := []Video{}
 	for rows.Next() {
-		var video Video
-		if err := rows.Scan(
-			&video.ID,
-			&video.CreatedAt,
-			&video.UpdatedAt,
-			&video.Title,
-			&video.Description,
-			&video.ThumbnailURL,
-			&video.VideoURL,
-			&video.UserID,
-		); err != nil {
+		video, err := scanVideo(rows)
+		if err != nil {
 			return nil, err
 		}
 		videos = append(videos, video)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return c.withTags(videos)
+}
 
-	return videos, nil
+// ListVideos returns a page of the user's or organization's videos, in
+// order of params.Sort with ties broken by ID.
+func (c Client) ListVideos(params ListVideosParams) ([]Video, error) {
+	scope, owner := videoScope("", params.UserID, params.OrganizationID)
+	where := []string{scope}
+	args := []interface{}{owner}
+
+	if params.HasVideo != nil {
+		if *params.HasVideo {
+			where = append(where, "video_url IS NOT NULL")
+		} else {
+			where = append(where, "video_url IS NULL")
+		}
+	}
+	if params.HasThumbnail != nil {
+		if *params.HasThumbnail {
+			where = append(where, "thumbnail_url IS NOT NULL")
+		} else {
+			where = append(where, "thumbnail_url IS NULL")
+		}
+	}
+	if params.Orientation != "" {
+		where = append(where, "orientation = ?")
+		args = append(args, params.Orientation)
+	}
+	if params.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, params.Status)
+	}
+	for _, tag := range params.Tags {
+		where = append(where, "id IN (SELECT vt.video_id FROM video_tags vt JOIN tags t ON t.id = vt.tag_id WHERE t.name = ?)")
+		args = append(args, tag)
+	}
+	if params.CreatedAfter != nil {
+		where = append(where, "created_at >= ?")
+		args = append(args, params.CreatedAfter.UTC().Format(sqliteTimestampLayout))
+	}
+	if params.CreatedBefore != nil {
+		where = append(where, "created_at < ?")
+		args = append(args, params.CreatedBefore.UTC().Format(sqliteTimestampLayout))
+	}
+
+	var column string
+	var after interface{}
+	switch params.Sort {
+	case VideoSortTitle:
+		column = "title"
+		if params.After != nil {
+			after = params.After.Title
+		}
+	case VideoSortDuration:
+		column = "duration_ms"
+		if params.After != nil {
+			after = params.After.DurationMs
+		}
+	default:
+		column = "created_at"
+		if params.After != nil {
+			after = params.After.CreatedAt.UTC().Format(sqliteTimestampLayout)
+		}
+	}
+	direction, op := "ASC", ">"
+	if params.Descending {
+		direction, op = "DESC", "<"
+	}
+	if params.After != nil {
+		where = append(where, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", column, op))
+		args = append(args, after, after, params.After.ID)
+	}
+
+	query := `
+	SELECT ` + videoColumns + `
+	FROM videos
+	WHERE ` + strings.Join(where, " AND ") + `
+	ORDER BY ` + column + ` ` + direction + `, id ` + direction + `
+	LIMIT ?
+	`
+	args = append(args, params.Limit)
+
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	videos := []Video{}
+	for rows.Next() {
+		video, err := scanVideo(rows)
+		if err != nil {
+			return nil, err
+		}
+		videos = append(videos, video)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return c.withTags(videos)
+}
+
+// videoScope is the condition, and its argument, that picks out an
+// organization's videos, or a user's own when organizationID is nil. The
+// columns are qualified with alias when it's given.
+func videoScope(alias string, userID uuid.UUID, organizationID *uuid.UUID) (string, interface{}) {
+	if alias != "" {
+		alias += "."
+	}
+	if organizationID != nil {
+		return alias + "organization_id = ?", *organizationID
+	}
+	return alias + "user_id = ? AND " + alias + "organization_id IS NULL", userID
 }
 
 func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
@@ -75,10 +288,12 @@ func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
 		updated_at,
 		title,
 		description,
-		user_id
-	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?)
+		visibility,
+		user_id,
+		organization_id
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?)
 	`
-	_, err := c.db.Exec(query, id, params.Title, params.Description, params.UserID)
+	_, err := c.db.Exec(query, id, params.Title, params.Description, params.Visibility, params.UserID, params.OrganizationID)
 	if err != nil {
 		return Video{}, err
 	}
@@ -88,68 +303,174 @@ func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
 
 func (c Client) GetVideo(id uuid.UUID) (Video, error) {
 	query := `
-	SELECT
-		id,
-		created_at,
-		updated_at,
-		title,
-		description,
-		thumbnail_url,
-		video_url,
-		user_id
+	SELECT ` + videoColumns + `
 	FROM videos
 	WHERE id = ?
 	`
 
-	var video Video
-	err := c.db.QueryRow(query, id).Scan(
-		&video.ID,
-		&video.CreatedAt,
-		&video.UpdatedAt,
-		&video.Title,
-		&video.Description,
-		&video.ThumbnailURL,
-		&video.VideoURL,
-		&video.UserID)
+	video, err := scanVideo(c.db.QueryRow(query, id))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return Video{}, nil
+			return Video{}, ErrNotFound
 		}
 		return Video{}, err
 	}
 
-	return video, nil
+	videos, err := c.withTags([]Video{video})
+	if err != nil {
+		return Video{}, err
+	}
+	return videos[0], nil
 }
 
+// UpdateVideo saves the video's fields and bumps its updated_at.
 func (c Client) UpdateVideo(video Video) error {
+	return updateVideo(c.db, video)
+}
+
+// UpdateVideoMeta changes the video's title, description and visibility,
+// leaving the fields params doesn't set and the rest of the row alone.
+func (c Client) UpdateVideoMeta(id uuid.UUID, params UpdateVideoMetaParams) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var updatedAt time.Time
+	err = tx.QueryRow(`SELECT updated_at FROM videos WHERE id = ?`, id).Scan(&updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if params.UnmodifiedSince != nil && !updatedAt.Equal(*params.UnmodifiedSince) {
+		return ErrModified
+	}
+
+	query := `
+	UPDATE videos
+	SET
+		title = COALESCE(?, title),
+		description = COALESCE(?, description),
+		visibility = COALESCE(?, visibility),
+		updated_at = ?
+	WHERE id = ?
+	`
+	err = requireRowsAffected(tx.Exec(
+		query,
+		params.Title,
+		params.Description,
+		params.Visibility,
+		time.Now().UTC(),
+		id,
+	))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func updateVideo(db execer, video Video) error {
+	// stored to the nanosecond rather than with CURRENT_TIMESTAMP, so that
+	// every update gives the video a new version
 	query := `
 	UPDATE videos
 	SET
+		updated_at = ?,
 		title = ?,
 		description = ?,
 		thumbnail_url = ?,
 		video_url = ?,
-		user_id = ?
+		video_size = ?,
+		thumbnail_size = ?,
+		status = ?,
+		orientation = ?,
+		duration_ms = ?,
+		visibility = ?,
+		user_id = ?,
+		organization_id = ?
 	WHERE id = ?
 	`
 
-	_, err := c.db.Exec(
+	return requireRowsAffected(db.Exec(
 		query,
+		time.Now().UTC(),
 		video.Title,
 		video.Description,
 		&video.ThumbnailURL,
 		&video.VideoURL,
+		video.VideoSize,
+		video.ThumbnailSize,
+		video.Status,
+		video.Orientation,
+		video.DurationMs,
+		video.Visibility,
 		video.UserID,
+		video.OrganizationID,
 		video.ID,
-	)
-	return err
+	))
+}
+
+// SetVideoStatus changes only the video's status, so it can't undo changes
+// made while a long upload was running.
+func (c Client) SetVideoStatus(id uuid.UUID, status string) error {
+	query := `
+	UPDATE videos
+	SET status = ?, updated_at = ?
+	WHERE id = ?
+	`
+	return requireRowsAffected(c.db.Exec(query, status, time.Now().UTC(), id))
 }
 
+// SetVideoOwner hands the video to a user and the organization it's to
+// belong to, or makes it their own when organizationID is nil, leaving the
+// rest of the row alone.
+func (c Client) SetVideoOwner(id, userID uuid.UUID, organizationID *uuid.UUID) error {
+	query := `
+	UPDATE videos
+	SET user_id = ?, organization_id = ?, updated_at = ?
+	WHERE id = ?
+	`
+	return requireRowsAffected(c.db.Exec(query, userID, organizationID, time.Now().UTC(), id))
+}
+
+// SetVideoThumbnail points the video at a newly saved thumbnail, leaving
+// the rest of the row alone so it can't undo a concurrent upload.
+func (c Client) SetVideoThumbnail(id uuid.UUID, url string, size int64) error {
+	query := `
+	UPDATE videos
+	SET thumbnail_url = ?, thumbnail_size = ?, updated_at = ?
+	WHERE id = ?
+	`
+	return requireRowsAffected(c.db.Exec(query, url, size, time.Now().UTC(), id))
+}
+
+// DeleteVideo deletes the video and its tags.
 func (c Client) DeleteVideo(id uuid.UUID) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM video_tags WHERE video_id = ?`, id)
+	if err != nil {
+		return err
+	}
+	err = deleteUnusedTags(tx)
+	if err != nil {
+		return err
+	}
+
 	query := `
 	DELETE FROM videos
 	WHERE id = ?
 	`
-	_, err := c.db.Exec(query, id)
-	return err
+	err = requireRowsAffected(tx.Exec(query, id))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
@@ -0,0 +1,240 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestSetVideoOwner(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			video := createTestVideo(t, store)
+			newOwner, err := store.CreateUser(CreateUserParams{Email: "new@example.com", Password: "hash"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			org, err := store.CreateOrganization("Acme", newOwner.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = store.SetVideoOwner(video.ID, newOwner.ID, &org.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := store.GetVideo(video.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.UserID != newOwner.ID || got.OrganizationID == nil || *got.OrganizationID != org.ID || got.Title != video.Title {
+				t.Errorf("video = %+v, want owner %s in organization %s", got, newOwner.ID, org.ID)
+			}
+			if !got.UpdatedAt.After(video.UpdatedAt) {
+				t.Error("UpdatedAt not advanced")
+			}
+
+			err = store.SetVideoOwner(video.ID, video.UserID, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err = store.GetVideo(video.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.UserID != video.UserID || got.OrganizationID != nil {
+				t.Errorf("video = %+v, want the original owner's own video", got)
+			}
+
+			err = store.SetVideoOwner(uuid.New(), newOwner.ID, nil)
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("unknown video: err = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestSetVideoThumbnail(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			video := createTestVideo(t, store)
+			err := store.RecordUpload(RecordUploadParams{
+				UserID:          video.UserID,
+				VideoID:         video.ID,
+				URL:             "https://cdn.example.com/video.mp4",
+				Size:            100,
+				StorageLimit:    -1,
+				UploadTimeLimit: -1,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = store.SetVideoThumbnail(video.ID, "/assets/thumb.png", 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := store.GetVideo(video.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.ThumbnailURL == nil || *got.ThumbnailURL != "/assets/thumb.png" || got.ThumbnailSize != 10 {
+				t.Errorf("thumbnail = %v, %d bytes", got.ThumbnailURL, got.ThumbnailSize)
+			}
+			if got.VideoURL == nil || got.VideoSize != 100 || got.Status != VideoStatusReady {
+				t.Errorf("video file lost: %v, %d bytes, status %q", got.VideoURL, got.VideoSize, got.Status)
+			}
+			if !got.UpdatedAt.After(video.UpdatedAt) {
+				t.Error("UpdatedAt not advanced")
+			}
+
+			err = store.SetVideoThumbnail(uuid.New(), "/assets/thumb.png", 10)
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("unknown video: err = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestUpdateVideoMeta(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			video := createTestVideo(t, store)
+			err := store.RecordUpload(RecordUploadParams{
+				UserID:          video.UserID,
+				VideoID:         video.ID,
+				URL:             "https://cdn.example.com/video.mp4",
+				Size:            100,
+				StorageLimit:    -1,
+				UploadTimeLimit: -1,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			stale := video.UpdatedAt
+
+			description := "New description"
+			visibility := VisibilityUnlisted
+			err = store.UpdateVideoMeta(video.ID, UpdateVideoMetaParams{Description: &description, Visibility: &visibility})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := store.GetVideo(video.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Title != "Boots" || got.Description != description || got.Visibility != visibility {
+				t.Errorf("metadata = %q, %q, %q", got.Title, got.Description, got.Visibility)
+			}
+			if got.VideoURL == nil || got.VideoSize != 100 {
+				t.Errorf("video file lost: %v, %d bytes", got.VideoURL, got.VideoSize)
+			}
+
+			title := "Renamed"
+			err = store.UpdateVideoMeta(video.ID, UpdateVideoMetaParams{Title: &title, UnmodifiedSince: &stale})
+			if !errors.Is(err, ErrModified) {
+				t.Errorf("stale update: err = %v, want ErrModified", err)
+			}
+			err = store.UpdateVideoMeta(video.ID, UpdateVideoMetaParams{Title: &title, UnmodifiedSince: &got.UpdatedAt})
+			if err != nil {
+				t.Errorf("current update: %v", err)
+			}
+
+			err = store.UpdateVideoMeta(uuid.New(), UpdateVideoMetaParams{Title: &title})
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("unknown video: err = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestListVideosPages(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			user, err := store.CreateUser(CreateUserParams{Email: "user@example.com", Password: "hash"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// two share a duration, so the ID has to break the tie
+			durations := map[string]time.Duration{"c": 3, "a": 1, "e": 2, "b": 2, "d": 5}
+			for _, title := range []string{"c", "a", "e", "b", "d"} {
+				video, err := store.CreateVideo(CreateVideoParams{UserID: user.ID, Title: title})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if title == "d" {
+					// left without a file, so it has no duration either
+					continue
+				}
+				err = store.RecordUpload(RecordUploadParams{
+					UserID:          user.ID,
+					VideoID:         video.ID,
+					URL:             "https://cdn.example.com/" + title + ".mp4",
+					Duration:        durations[title] * time.Second,
+					StorageLimit:    -1,
+					UploadTimeLimit: -1,
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// pages lists every video two at a time, following cursors
+			pages := func(params ListVideosParams) []Video {
+				t.Helper()
+				params.UserID = user.ID
+				params.Limit = 2
+				var all []Video
+				for i := 0; i < 5; i++ {
+					page, err := store.ListVideos(params)
+					if err != nil {
+						t.Fatal(err)
+					}
+					all = append(all, page...)
+					if len(page) < params.Limit {
+						return all
+					}
+					last := page[len(page)-1]
+					params.After = &VideoCursor{ID: last.ID, CreatedAt: last.CreatedAt, Title: last.Title, DurationMs: last.DurationMs}
+				}
+				t.Fatal("listing didn't end")
+				return nil
+			}
+			titles := func(videos []Video) string {
+				var s string
+				for _, video := range videos {
+					s += video.Title
+				}
+				return s
+			}
+
+			if got := titles(pages(ListVideosParams{Sort: VideoSortTitle})); got != "abcde" {
+				t.Errorf("by title = %q, want abcde", got)
+			}
+			if got := titles(pages(ListVideosParams{Sort: VideoSortTitle, Descending: true})); got != "edcba" {
+				t.Errorf("by title descending = %q, want edcba", got)
+			}
+
+			byDuration := pages(ListVideosParams{Sort: VideoSortDuration})
+			if len(byDuration) != 5 {
+				t.Fatalf("by duration listed %d videos, want 5", len(byDuration))
+			}
+			if got := titles(byDuration); got[:1] != "d" || got[1:2] != "a" || got[4:] != "c" {
+				t.Errorf("by duration = %q, want d, a, then b and e, then c", got)
+			}
+
+			hasVideo := false
+			if got := titles(pages(ListVideosParams{Sort: VideoSortTitle, HasVideo: &hasVideo})); got != "d" {
+				t.Errorf("without a file = %q, want d", got)
+			}
+			if got := titles(pages(ListVideosParams{Sort: VideoSortTitle, Status: VideoStatusReady})); got != "abce" {
+				t.Errorf("ready = %q, want abce", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+// Package progress tracks how far along long-running jobs, such as video
+// uploads, are and lets any number of watchers follow along.
+package progress
+
+import (
+	"sync"
+	"time"
+)
+
+// Stage is the step a job is on.
+type Stage string
+
+const (
+	StageReceiving  Stage = "receiving"
+	StageProcessing Stage = "processing"
+	StageUploading  Stage = "uploading"
+	StageComplete   Stage = "complete"
+	StageFailed     Stage = "failed"
+)
+
+// Finished reports whether no further events follow the stage.
+func (s Stage) Finished() bool {
+	return s == StageComplete || s == StageFailed
+}
+
+// Event is a snapshot of a job's progress. Each one supersedes the last, so
+// watchers that fall behind only miss intermediate snapshots.
+type Event struct {
+	Stage Stage `json:"stage"`
+	// Done and Total measure progress through the stage: bytes while
+	// receiving and uploading, milliseconds of video while processing.
+	// Total is zero when unknown.
+	Done  int64 `json:"done"`
+	Total int64 `json:"total,omitempty"`
+	// Percent is Done as a share of Total, when Total is known.
+	Percent float64 `json:"percent,omitempty"`
+	// Part and Parts count the pieces an upload is stored in.
+	Part  int    `json:"part,omitempty"`
+	Parts int    `json:"parts,omitempty"`
+	Error string `json:"error,omitempty"`
+	// Seq increases with every event published for a job.
+	Seq  uint64    `json:"seq"`
+	Time time.Time `json:"time"`
+}
+
+type job struct {
+	last     *Event
+	watchers map[*Watcher]struct{}
+}
+
+// Tracker holds the latest event of every job in progress.
+type Tracker struct {
+	mu   sync.Mutex
+	jobs map[string]*job
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{jobs: map[string]*job{}}
+}
+
+// Publish records ev as the latest progress of the job and wakes its
+// watchers.
+func (t *Tracker) Publish(key string, ev Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.sweep()
+	j := t.job(key)
+	if j.last != nil {
+		ev.Seq = j.last.Seq + 1
+	} else {
+		ev.Seq = 1
+	}
+	if ev.Total > 0 {
+		ev.Percent = float64(ev.Done) / float64(ev.Total) * 100
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now().UTC()
+	}
+	j.last = &ev
+	for w := range j.watchers {
+		w.wake()
+	}
+}
+
+// Watch follows the job's progress. A job that hasn't started yet can be
+// watched too, and a finished job is treated as not started, so a watcher
+// set up just before a job is restarted doesn't see the previous run end.
+// The watcher must be closed when no longer needed.
+func (t *Tracker) Watch(key string) *Watcher {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	w := &Watcher{tracker: t, key: key, updated: make(chan struct{}, 1)}
+	j := t.job(key)
+	j.watchers[w] = struct{}{}
+	if j.last != nil {
+		if j.last.Stage.Finished() {
+			w.seen = j.last.Seq
+		} else {
+			w.wake()
+		}
+	}
+	return w
+}
+
+func (t *Tracker) job(key string) *job {
+	j, ok := t.jobs[key]
+	if !ok {
+		j = &job{watchers: map[*Watcher]struct{}{}}
+		t.jobs[key] = j
+	}
+	return j
+}
+
+// sweep forgets jobs that have finished, or never started, and have nobody
+// watching.
+func (t *Tracker) sweep() {
+	for key, j := range t.jobs {
+		if len(j.watchers) == 0 && (j.last == nil || j.last.Stage.Finished()) {
+			delete(t.jobs, key)
+		}
+	}
+}
+
+// Watcher follows one job's progress.
+type Watcher struct {
+	tracker *Tracker
+	key     string
+	updated chan struct{}
+	seen    uint64
+}
+
+func (w *Watcher) wake() {
+	select {
+	case w.updated <- struct{}{}:
+	default:
+	}
+}
+
+// Updated receives when there may be a newer event for Latest to return.
+func (w *Watcher) Updated() <-chan struct{} {
+	return w.updated
+}
+
+// Latest returns the job's newest event if it hasn't been returned before.
+func (w *Watcher) Latest() (Event, bool) {
+	w.tracker.mu.Lock()
+	defer w.tracker.mu.Unlock()
+
+	j, ok := w.tracker.jobs[w.key]
+	if !ok || j.last == nil || j.last.Seq == w.seen {
+		return Event{}, false
+	}
+	w.seen = j.last.Seq
+	return *j.last, true
+}
+
+func (w *Watcher) Close() {
+	w.tracker.mu.Lock()
+	defer w.tracker.mu.Unlock()
+
+	if j, ok := w.tracker.jobs[w.key]; ok {
+		delete(j.watchers, w)
+	}
+	w.tracker.sweep()
+}
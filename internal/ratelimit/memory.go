@@ -0,0 +1,51 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often MemoryStore drops expired keys.
+const sweepInterval = time.Minute
+
+// MemoryStore keeps limiter state in process memory. State is lost on
+// restart and isn't shared between instances.
+type MemoryStore struct {
+	mu        sync.Mutex
+	states    map[string]State
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		states: map[string]State{},
+	}
+}
+
+func (m *MemoryStore) Update(key string, fn func(State) State) (State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(m.lastSweep) >= sweepInterval {
+		m.sweep(now)
+	}
+
+	state := fn(m.states[key])
+	if state.Expires.After(now) {
+		m.states[key] = state
+	} else {
+		delete(m.states, key)
+	}
+	return state, nil
+}
+
+// sweep must be called with the lock held.
+func (m *MemoryStore) sweep(now time.Time) {
+	for key, state := range m.states {
+		if !state.Expires.After(now) {
+			delete(m.states, key)
+		}
+	}
+	m.lastSweep = now
+}
@@ -0,0 +1,208 @@
+// Package ratelimit throttles repeated attempts at expensive or sensitive
+// operations, such as password checks, by key.
+package ratelimit
+
+import (
+	"time"
+)
+
+// Policy says how hard a Limiter throttles a key. Zero values turn the
+// corresponding mechanism off.
+type Policy struct {
+	// Limit attempts are allowed per Window, successful or not.
+	Limit  int
+	Window time.Duration
+
+	// After FreeFailures consecutive failures, each further failure blocks
+	// the key for BaseDelay, doubling every time up to MaxDelay.
+	FreeFailures int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+
+	// LockoutThreshold consecutive failures lock the key for
+	// LockoutDuration.
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+
+	// Failures older than ResetAfter are forgotten. It defaults to a day.
+	ResetAfter time.Duration
+}
+
+// State is what a Store keeps per key.
+type State struct {
+	WindowStart  time.Time
+	Attempts     int
+	Failures     int
+	LastFailure  time.Time
+	BlockedUntil time.Time
+	// Expires is when the state stops mattering and the store may drop it.
+	// It is always set by the Limiter.
+	Expires time.Time
+}
+
+// Store persists limiter state. Implementations must apply Update
+// atomically with respect to other calls for the same key.
+type Store interface {
+	Update(key string, fn func(State) State) (State, error)
+}
+
+// Decision is the outcome of an attempt or failure.
+type Decision struct {
+	Allowed bool
+	// RetryAfter is how long until the key may try again, when not allowed.
+	RetryAfter time.Duration
+	// Locked is set when the key has failed so often it was locked out.
+	Locked bool
+}
+
+type Limiter struct {
+	store  Store
+	policy Policy
+	now    func() time.Time
+}
+
+const defaultResetAfter = 24 * time.Hour
+
+func New(store Store, policy Policy) *Limiter {
+	if policy.ResetAfter <= 0 {
+		policy.ResetAfter = defaultResetAfter
+	}
+	return &Limiter{
+		store:  store,
+		policy: policy,
+		now:    time.Now,
+	}
+}
+
+// Allow records an attempt for key and reports whether it may go ahead. A
+// nil Limiter allows everything.
+func (l *Limiter) Allow(key string) (Decision, error) {
+	if l == nil {
+		return Decision{Allowed: true}, nil
+	}
+
+	var decision Decision
+	_, err := l.store.Update(key, func(s State) State {
+		now := l.now()
+		s = l.forgetFailures(s, now)
+
+		if now.Before(s.BlockedUntil) {
+			decision = Decision{
+				RetryAfter: s.BlockedUntil.Sub(now),
+				Locked:     l.locked(s),
+			}
+			return s
+		}
+
+		if l.policy.Limit > 0 {
+			if now.Sub(s.WindowStart) >= l.policy.Window {
+				s.WindowStart = now
+				s.Attempts = 0
+			}
+			if s.Attempts >= l.policy.Limit {
+				decision = Decision{RetryAfter: s.WindowStart.Add(l.policy.Window).Sub(now)}
+				return l.withExpiry(s)
+			}
+			s.Attempts++
+		}
+
+		decision = Decision{Allowed: true}
+		return l.withExpiry(s)
+	})
+	if err != nil {
+		return Decision{}, err
+	}
+	return decision, nil
+}
+
+// Fail records a failed attempt for key, such as a wrong password, and
+// returns whether the key may try again immediately.
+func (l *Limiter) Fail(key string) (Decision, error) {
+	if l == nil {
+		return Decision{Allowed: true}, nil
+	}
+
+	var decision Decision
+	_, err := l.store.Update(key, func(s State) State {
+		now := l.now()
+		s = l.forgetFailures(s, now)
+		s.Failures++
+		s.LastFailure = now
+
+		if l.locked(s) {
+			s.BlockedUntil = now.Add(l.policy.LockoutDuration)
+		} else if l.policy.BaseDelay > 0 && s.Failures > l.policy.FreeFailures {
+			s.BlockedUntil = now.Add(l.backoff(s.Failures - l.policy.FreeFailures))
+		}
+
+		decision = Decision{Allowed: true}
+		if now.Before(s.BlockedUntil) {
+			decision = Decision{
+				RetryAfter: s.BlockedUntil.Sub(now),
+				Locked:     l.locked(s),
+			}
+		}
+		return l.withExpiry(s)
+	})
+	if err != nil {
+		return Decision{}, err
+	}
+	return decision, nil
+}
+
+// Succeed clears key's failures after a successful attempt.
+func (l *Limiter) Succeed(key string) error {
+	if l == nil {
+		return nil
+	}
+
+	_, err := l.store.Update(key, func(s State) State {
+		s.Failures = 0
+		s.LastFailure = time.Time{}
+		s.BlockedUntil = time.Time{}
+		return l.withExpiry(s)
+	})
+	return err
+}
+
+func (l *Limiter) locked(s State) bool {
+	return l.policy.LockoutThreshold > 0 && s.Failures >= l.policy.LockoutThreshold
+}
+
+// backoff returns the delay after the nth failure past the free ones.
+func (l *Limiter) backoff(n int) time.Duration {
+	delay := l.policy.BaseDelay
+	for i := 1; i < n && i < 32; i++ {
+		delay *= 2
+		if l.policy.MaxDelay > 0 && delay >= l.policy.MaxDelay {
+			break
+		}
+	}
+	if l.policy.MaxDelay > 0 && delay > l.policy.MaxDelay {
+		delay = l.policy.MaxDelay
+	}
+	return delay
+}
+
+func (l *Limiter) forgetFailures(s State, now time.Time) State {
+	if s.Failures > 0 && now.Sub(s.LastFailure) >= l.policy.ResetAfter && !now.Before(s.BlockedUntil) {
+		s.Failures = 0
+		s.LastFailure = time.Time{}
+	}
+	return s
+}
+
+func (l *Limiter) withExpiry(s State) State {
+	s.Expires = latest(s.WindowStart.Add(l.policy.Window), s.BlockedUntil)
+	if s.Failures > 0 {
+		s.Expires = latest(s.Expires, s.LastFailure.Add(l.policy.ResetAfter))
+	}
+	return s
+}
+
+func latest(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
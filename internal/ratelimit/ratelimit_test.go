@@ -0,0 +1,200 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// clock is a fake time source the tests advance by hand. It starts at the
+// real time, since MemoryStore drops state by the wall clock.
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestLimiter(policy Policy) (*Limiter, *clock) {
+	c := &clock{now: time.Now()}
+	l := New(NewMemoryStore(), policy)
+	l.now = c.Now
+	return l, c
+}
+
+// step is one call a test makes against a Limiter, and the decision it
+// expects back.
+type step struct {
+	advance time.Duration
+	key     string
+	fail    bool
+	succeed bool
+	want    Decision
+}
+
+func runSteps(t *testing.T, policy Policy, steps []step) {
+	t.Helper()
+
+	l, c := newTestLimiter(policy)
+	for i, s := range steps {
+		c.Advance(s.advance)
+		key := s.key
+		if key == "" {
+			key = "a"
+		}
+
+		var got Decision
+		var err error
+		switch {
+		case s.succeed:
+			err = l.Succeed(key)
+			got = Decision{Allowed: true}
+		case s.fail:
+			got, err = l.Fail(key)
+		default:
+			got, err = l.Allow(key)
+		}
+		if err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if got != s.want {
+			t.Errorf("step %d (%s, fail %v): decision = %+v, want %+v", i, key, s.fail, got, s.want)
+		}
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	allowed := Decision{Allowed: true}
+	retry := func(d time.Duration) Decision { return Decision{RetryAfter: d} }
+	locked := func(d time.Duration) Decision { return Decision{RetryAfter: d, Locked: true} }
+
+	tests := []struct {
+		name   string
+		policy Policy
+		steps  []step
+	}{
+		{
+			name:   "window expiry",
+			policy: Policy{Limit: 2, Window: time.Minute},
+			steps: []step{
+				{want: allowed},
+				{advance: 10 * time.Second, want: allowed},
+				{advance: 20 * time.Second, want: retry(30 * time.Second)},
+				{advance: 29 * time.Second, want: retry(time.Second)},
+				// a new window starts once the old one is over
+				{advance: time.Second, want: allowed},
+				{want: allowed},
+				{want: retry(time.Minute)},
+			},
+		},
+		{
+			name:   "backoff growth",
+			policy: Policy{FreeFailures: 2, BaseDelay: time.Second, MaxDelay: 4 * time.Second},
+			steps: []step{
+				{fail: true, want: allowed},
+				{fail: true, want: allowed},
+				{fail: true, want: retry(time.Second)},
+				{want: retry(time.Second)},
+				{advance: time.Second, fail: true, want: retry(2 * time.Second)},
+				{advance: 2 * time.Second, fail: true, want: retry(4 * time.Second)},
+				// capped at MaxDelay
+				{advance: 4 * time.Second, fail: true, want: retry(4 * time.Second)},
+				{advance: 4 * time.Second, want: allowed},
+				// a success starts the count over
+				{succeed: true, want: allowed},
+				{fail: true, want: allowed},
+			},
+		},
+		{
+			name:   "lockout and unlock",
+			policy: Policy{LockoutThreshold: 3, LockoutDuration: 15 * time.Minute},
+			steps: []step{
+				{fail: true, want: allowed},
+				{fail: true, want: allowed},
+				{fail: true, want: locked(15 * time.Minute)},
+				{advance: 5 * time.Minute, want: locked(10 * time.Minute)},
+				{advance: 10 * time.Minute, want: allowed},
+				// still past the threshold, so the next failure locks again
+				{fail: true, want: locked(15 * time.Minute)},
+				{advance: 15 * time.Minute, succeed: true, want: allowed},
+				{fail: true, want: allowed},
+			},
+		},
+		{
+			name:   "failures are forgotten after ResetAfter",
+			policy: Policy{LockoutThreshold: 2, LockoutDuration: time.Minute, ResetAfter: time.Hour},
+			steps: []step{
+				{fail: true, want: allowed},
+				{advance: time.Hour, fail: true, want: allowed},
+				{fail: true, want: locked(time.Minute)},
+			},
+		},
+		{
+			name: "key isolation",
+			policy: Policy{
+				Limit:            2,
+				Window:           time.Minute,
+				LockoutThreshold: 2,
+				LockoutDuration:  time.Minute,
+			},
+			steps: []step{
+				{key: "a", want: allowed},
+				{key: "a", want: allowed},
+				{key: "a", want: retry(time.Minute)},
+				{key: "b", want: allowed},
+				{key: "b", fail: true, want: allowed},
+				{key: "b", fail: true, want: locked(time.Minute)},
+				{key: "c", fail: true, want: allowed},
+				{key: "c", want: allowed},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runSteps(t, tt.policy, tt.steps)
+		})
+	}
+}
+
+func TestNilLimiterAllows(t *testing.T) {
+	var l *Limiter
+	for i := 0; i < 3; i++ {
+		if d, err := l.Fail("a"); err != nil || !d.Allowed {
+			t.Fatalf("Fail = %+v, %v", d, err)
+		}
+		if d, err := l.Allow("a"); err != nil || !d.Allowed {
+			t.Fatalf("Allow = %+v, %v", d, err)
+		}
+	}
+}
+
+func TestMemoryStoreDropsExpiredState(t *testing.T) {
+	store := NewMemoryStore()
+	keep := func(expires time.Time) func(State) State {
+		return func(s State) State {
+			s.Attempts++
+			s.Expires = expires
+			return s
+		}
+	}
+
+	state, err := store.Update("a", keep(time.Now().Add(time.Minute)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Attempts != 1 || len(store.states) != 1 {
+		t.Fatalf("state = %+v, store holds %d keys; want 1 attempt stored", state, len(store.states))
+	}
+
+	_, err = store.Update("a", keep(time.Now().Add(-time.Second)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.states["a"]; ok {
+		t.Error("expired state kept")
+	}
+}
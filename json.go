@@ -2,14 +2,22 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 )
 
 func respondWithError(w http.ResponseWriter, code int, msg string, err error) {
 	if err != nil {
 		log.Println(err)
 	}
+	if limit, ok := bodyTooLarge(err); ok {
+		code = http.StatusRequestEntityTooLarge
+		msg = fmt.Sprintf("Request body is larger than the %s limit", formatBytes(limit))
+	}
 	if code > 499 {
 		log.Printf("Responding with 5XX error: %s", msg)
 	}
@@ -21,6 +29,21 @@ func respondWithError(w http.ResponseWriter, code int, msg string, err error) {
 	})
 }
 
+// respondWithStoreError maps the database package's sentinel errors onto
+// HTTP status codes, falling back to a 500 for anything unexpected.
+func respondWithStoreError(w http.ResponseWriter, msg string, err error) {
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		respondWithError(w, http.StatusNotFound, msg, err)
+	case errors.Is(err, database.ErrConflict):
+		respondWithError(w, http.StatusConflict, msg, err)
+	case errors.Is(err, database.ErrModified):
+		respondWithError(w, http.StatusPreconditionFailed, msg, err)
+	default:
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+	}
+}
+
 func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	dat, err := json.Marshal(payload)
@@ -6,20 +6,42 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/mailer"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/progress"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/ratelimit"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/sso"
 
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
 
 type apiConfig struct {
-	db               database.Client
+	db               database.Store
 	s3Client         *s3.Client
-	jwtSecret        string
+	jwtKeys          *auth.KeySet
+	accessTokenTTL   time.Duration
+	refreshTokenTTL  time.Duration
 	platform         string
+	adminEmails      map[string]bool
+	mailer           mailer.Mailer
+	appURL           string
+	requireVerified  bool
+	loginIPLimiter   *ratelimit.Limiter
+	loginUserLimiter *ratelimit.Limiter
+	signupLimiter    *ratelimit.Limiter
+	shareLimiter     *ratelimit.Limiter
+	oidcProviders    map[string]*sso.Provider
+	maxUploadSize    int64
+	uploadProgress   *progress.Tracker
+	defaultQuota     quotaLimits
 	filepathRoot     string
 	assetsRoot       string
 	s3Bucket         string
@@ -40,10 +62,37 @@ func main() {
 	if err != nil {
 		log.Fatalf("Couldn't connect to database: %v", err)
 	}
+	substringSearch := false
+	if value := os.Getenv("SUBSTRING_SEARCH"); value != "" {
+		substringSearch, err = strconv.ParseBool(value)
+		if err != nil {
+			log.Fatalf("SUBSTRING_SEARCH must be true or false: %v", err)
+		}
+	}
+	if !db.FullTextSearch() {
+		if !substringSearch {
+			log.Fatal("SQLite was built without FTS5, which video search needs. Build with -tags sqlite_fts5, or set SUBSTRING_SEARCH=true to search by substring instead")
+		}
+		log.Println("SQLite was built without FTS5, so video search matches substrings")
+	}
+
+	jwtKeys, err := loadJWTKeys(
+		os.Getenv("JWT_SECRET"),
+		os.Getenv("JWT_SIGNING_KEYS"),
+		os.Getenv("JWT_ACTIVE_KEY"),
+	)
+	if err != nil {
+		log.Fatalf("Couldn't load JWT keys: %v", err)
+	}
 
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		log.Fatal("JWT_SECRET environment variable is not set")
+	accessTokenTTL, err := durationFromEnv("ACCESS_TOKEN_TTL", 15*time.Minute)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	refreshTokenTTL, err := durationFromEnv("REFRESH_TOKEN_TTL", 60*24*time.Hour)
+	if err != nil {
+		log.Fatal(err)
 	}
 
 	platform := os.Getenv("PLATFORM")
@@ -51,6 +100,14 @@ func main() {
 		log.Fatal("PLATFORM environment variable is not set")
 	}
 
+	adminEmails := map[string]bool{}
+	for _, email := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		email = strings.TrimSpace(email)
+		if email != "" {
+			adminEmails[email] = true
+		}
+	}
+
 	filepathRoot := os.Getenv("FILEPATH_ROOT")
 	if filepathRoot == "" {
 		log.Fatal("FILEPATH_ROOT environment variable is not set")
@@ -81,6 +138,53 @@ func main() {
 		log.Fatal("PORT environment variable is not set")
 	}
 
+	appURL := strings.TrimSuffix(os.Getenv("APP_URL"), "/")
+	if appURL == "" {
+		appURL = "http://localhost:" + port
+	}
+
+	requireVerified := false
+	if value := os.Getenv("REQUIRE_EMAIL_VERIFICATION"); value != "" {
+		requireVerified, err = strconv.ParseBool(value)
+		if err != nil {
+			log.Fatalf("REQUIRE_EMAIL_VERIFICATION must be true or false: %v", err)
+		}
+	}
+
+	maxUploadSize := defaultMaxUploadSize
+	if value := os.Getenv("MAX_UPLOAD_SIZE"); value != "" {
+		maxUploadSize, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || maxUploadSize <= 0 {
+			log.Fatalf("MAX_UPLOAD_SIZE must be a positive number of bytes: %q", value)
+		}
+	}
+
+	var defaultQuota quotaLimits
+	defaultQuota.StorageBytes, err = quotaFromEnv("QUOTA_STORAGE_BYTES")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defaultQuota.Videos, err = quotaFromEnv("QUOTA_VIDEOS")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defaultQuota.UploadMinutes, err = quotaFromEnv("QUOTA_UPLOAD_MINUTES")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	appMailer, err := loadMailer()
+	if err != nil {
+		log.Fatalf("Couldn't set up mailer: %v", err)
+	}
+
+	oidcProviders, err := loadOIDCProviders(appURL)
+	if err != nil {
+		log.Fatalf("Couldn't configure OIDC providers: %v", err)
+	}
+
+	limiterStore := ratelimit.NewMemoryStore()
+
 	awsConfig, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(s3Region))
 	if err != nil {
 		log.Fatal(fmt.Errorf("Error loading AWS config: %w", err))
@@ -90,8 +194,22 @@ func main() {
 	cfg := apiConfig{
 		db:               db,
 		s3Client:         awsS3Client,
-		jwtSecret:        jwtSecret,
+		jwtKeys:          jwtKeys,
+		accessTokenTTL:   accessTokenTTL,
+		refreshTokenTTL:  refreshTokenTTL,
 		platform:         platform,
+		adminEmails:      adminEmails,
+		mailer:           appMailer,
+		appURL:           appURL,
+		requireVerified:  requireVerified,
+		loginIPLimiter:   ratelimit.New(limiterStore, loginIPPolicy),
+		loginUserLimiter: ratelimit.New(limiterStore, loginAccountPolicy),
+		signupLimiter:    ratelimit.New(limiterStore, signupIPPolicy),
+		shareLimiter:     ratelimit.New(limiterStore, sharePasswordPolicy),
+		oidcProviders:    oidcProviders,
+		maxUploadSize:    maxUploadSize,
+		uploadProgress:   progress.NewTracker(),
+		defaultQuota:     defaultQuota,
 		filepathRoot:     filepathRoot,
 		assetsRoot:       assetsRoot,
 		s3Bucket:         s3Bucket,
@@ -105,33 +223,252 @@ func main() {
 		log.Fatalf("Couldn't create assets directory: %v", err)
 	}
 
+	err = cfg.promoteAdmins()
+	if err != nil {
+		log.Fatalf("Couldn't promote admin users: %v", err)
+	}
+
+	srv := &http.Server{
+		Addr:    ":" + port,
+		Handler: cfg.routes(),
+	}
+
+	log.Printf("Serving on: http://localhost:%s/app/\n", port)
+	log.Fatal(srv.ListenAndServe())
+}
+
+// routes registers every endpoint, so tests can drive the same handlers the
+// server uses, with request bodies capped by limitBodyMiddleware.
+func (cfg *apiConfig) routes() http.Handler {
 	mux := http.NewServeMux()
-	appHandler := http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot)))
+	appHandler := http.StripPrefix("/app", http.FileServer(http.Dir(cfg.filepathRoot)))
 	mux.Handle("/app/", appHandler)
 
-	assetsHandler := http.StripPrefix("/assets", http.FileServer(http.Dir(assetsRoot)))
+	assetsHandler := http.StripPrefix("/assets", http.FileServer(http.Dir(cfg.assetsRoot)))
 	mux.Handle("/assets/", noCacheMiddleware(assetsHandler))
 
+	mux.HandleFunc("GET /.well-known/jwks.json", cfg.handlerJWKS)
+
 	mux.HandleFunc("POST /api/login", cfg.handlerLogin)
+	mux.HandleFunc("POST /api/login/2fa", cfg.handlerLoginMFA)
+	mux.HandleFunc("GET /api/oidc/providers", cfg.handlerOIDCProviders)
+	mux.HandleFunc("GET /api/oidc/{provider}/login", cfg.handlerOIDCLogin)
+	mux.HandleFunc("GET /api/oidc/{provider}/callback", cfg.handlerOIDCCallback)
+	mux.HandleFunc("POST /api/oidc/exchange", cfg.handlerOIDCExchange)
 	mux.HandleFunc("POST /api/refresh", cfg.handlerRefresh)
 	mux.HandleFunc("POST /api/revoke", cfg.handlerRevoke)
 
+	mux.Handle("GET /api/sessions", cfg.requireLogin(cfg.handlerSessionsList))
+	mux.Handle("DELETE /api/sessions", cfg.requireLogin(cfg.handlerSessionsRevokeOthers))
+	mux.Handle("DELETE /api/sessions/{sessionID}", cfg.requireLogin(cfg.handlerSessionRevoke))
+
 	mux.HandleFunc("POST /api/users", cfg.handlerUsersCreate)
+	mux.Handle("GET /api/users/me", cfg.requireLogin(cfg.handlerUserMe))
+	mux.Handle("PATCH /api/users/me", cfg.requireLogin(cfg.handlerUserMeUpdate))
+	mux.Handle("DELETE /api/users/me", cfg.requireLogin(cfg.handlerUserDelete))
+	mux.Handle("POST /api/users/me/avatar", withBodyLimit(maxImageUploadSize, cfg.requireLogin(cfg.handlerUserAvatarUpload)))
+	mux.Handle("DELETE /api/users/me/avatar", cfg.requireLogin(cfg.handlerUserAvatarDelete))
+	mux.Handle("PUT /api/users/me/password", cfg.requireLogin(cfg.handlerUserPasswordChange))
+	mux.Handle("PUT /api/users/me/email", cfg.requireLogin(cfg.handlerUserEmailChange))
+	mux.Handle("GET /api/users/me/2fa", cfg.requireLogin(cfg.handlerMFAStatus))
+	mux.Handle("POST /api/users/me/2fa", cfg.requireLogin(cfg.handlerMFAEnroll))
+	mux.Handle("POST /api/users/me/2fa/confirm", cfg.requireLogin(cfg.handlerMFAConfirm))
+	mux.Handle("DELETE /api/users/me/2fa", cfg.requireLogin(cfg.handlerMFADisable))
+	mux.Handle("POST /api/users/me/2fa/recovery_codes", cfg.requireLogin(cfg.handlerMFARecoveryCodesRegenerate))
+	mux.Handle("GET /api/users/me/usage", cfg.requireLogin(cfg.handlerUserUsage))
+	mux.Handle("PUT /api/users/me/active_organization", cfg.requireLogin(cfg.handlerActiveOrganizationSet))
+	mux.Handle("GET /api/users/me/identities", cfg.requireLogin(cfg.handlerIdentitiesList))
+	mux.Handle("DELETE /api/users/me/identities/{provider}", cfg.requireLogin(cfg.handlerIdentityDelete))
+	mux.HandleFunc("POST /api/verify_email", cfg.handlerVerifyEmail)
+	mux.HandleFunc("POST /api/verify_email/resend", cfg.handlerVerifyEmailResend)
+	mux.HandleFunc("POST /api/password_reset", cfg.handlerPasswordResetRequest)
+	mux.HandleFunc("POST /api/password_reset/confirm", cfg.handlerPasswordResetConfirm)
 
-	mux.HandleFunc("POST /api/videos", cfg.handlerVideoMetaCreate)
-	mux.HandleFunc("POST /api/thumbnail_upload/{videoID}", cfg.handlerUploadThumbnail)
-	mux.HandleFunc("POST /api/video_upload/{videoID}", cfg.handlerUploadVideo)
-	mux.HandleFunc("GET /api/videos", cfg.handlerVideosRetrieve)
-	mux.HandleFunc("GET /api/videos/{videoID}", cfg.handlerVideoGet)
-	mux.HandleFunc("DELETE /api/videos/{videoID}", cfg.handlerVideoMetaDelete)
+	mux.Handle("POST /api/api_keys", cfg.requireLogin(cfg.handlerAPIKeysCreate))
+	mux.Handle("GET /api/api_keys", cfg.requireLogin(cfg.handlerAPIKeysList))
+	mux.Handle("DELETE /api/api_keys/{keyID}", cfg.requireLogin(cfg.handlerAPIKeyRevoke))
+
+	mux.Handle("POST /api/videos", cfg.requireAuth(auth.ScopeVideosWrite, cfg.handlerVideoMetaCreate))
+	mux.Handle("POST /api/thumbnail_upload/{videoID}", withBodyLimit(maxImageUploadSize, cfg.requireAuth(auth.ScopeUpload, cfg.handlerUploadThumbnail)))
+	mux.Handle("POST /api/video_upload/{videoID}", cfg.requireAuth(auth.ScopeUpload, cfg.handlerUploadVideo))
+	mux.Handle("GET /api/videos", cfg.requireAuth(auth.ScopeVideosRead, cfg.handlerVideosRetrieve))
+	mux.Handle("GET /api/videos/search", cfg.requireAuth(auth.ScopeVideosRead, cfg.handlerVideosSearch))
+	mux.Handle("GET /api/videos/shared", cfg.requireAuth(auth.ScopeVideosRead, cfg.handlerSharedVideosList))
+	mux.Handle("GET /api/videos/{videoID}", cfg.optionalAuth(cfg.handlerVideoGet))
+	mux.Handle("GET /api/videos/{videoID}/progress", cfg.requireAuth(auth.ScopeVideosRead, cfg.handlerVideoProgress))
+	mux.Handle("PATCH /api/videos/{videoID}", cfg.requireAuth(auth.ScopeVideosWrite, cfg.handlerVideoMetaUpdate))
+	mux.Handle("DELETE /api/videos/{videoID}", cfg.requireAuth(auth.ScopeVideosWrite, cfg.handlerVideoMetaDelete))
+	mux.Handle("POST /api/videos/{videoID}/tags", cfg.requireAuth(auth.ScopeVideosWrite, cfg.handlerVideoTagsAdd))
+	mux.Handle("DELETE /api/videos/{videoID}/tags/{tag}", cfg.requireAuth(auth.ScopeVideosWrite, cfg.handlerVideoTagDelete))
+	mux.Handle("GET /api/tags", cfg.requireAuth(auth.ScopeVideosRead, cfg.handlerTagsList))
+	mux.Handle("POST /api/videos/{videoID}/shares", cfg.requireAuth(auth.ScopeVideosWrite, cfg.handlerShareLinkCreate))
+	mux.Handle("GET /api/videos/{videoID}/shares", cfg.requireAuth(auth.ScopeVideosRead, cfg.handlerShareLinksList))
+	mux.Handle("DELETE /api/videos/{videoID}/shares/{shareID}", cfg.requireAuth(auth.ScopeVideosWrite, cfg.handlerShareLinkRevoke))
+	mux.Handle("GET /s/{token}", noCacheMiddleware(http.HandlerFunc(cfg.handlerShareLinkView)))
+	mux.Handle("GET /api/videos/{videoID}/collaborators", cfg.requireAuth(auth.ScopeVideosRead, cfg.handlerVideoCollaboratorsList))
+	mux.Handle("POST /api/videos/{videoID}/collaborators", cfg.requireAuth(auth.ScopeVideosWrite, cfg.handlerVideoCollaboratorAdd))
+	mux.Handle("PATCH /api/videos/{videoID}/collaborators/{userID}", cfg.requireAuth(auth.ScopeVideosWrite, cfg.handlerVideoCollaboratorUpdate))
+	mux.Handle("DELETE /api/videos/{videoID}/collaborators/{userID}", cfg.requireAuth(auth.ScopeVideosWrite, cfg.handlerVideoCollaboratorRemove))
+
+	mux.Handle("POST /api/organizations", cfg.requireLogin(cfg.handlerOrganizationsCreate))
+	mux.Handle("GET /api/organizations", cfg.requireLogin(cfg.handlerOrganizationsList))
+	mux.Handle("GET /api/organizations/{orgID}", cfg.requireLogin(cfg.handlerOrganizationGet))
+	mux.Handle("PATCH /api/organizations/{orgID}", cfg.requireLogin(cfg.handlerOrganizationUpdate))
+	mux.Handle("DELETE /api/organizations/{orgID}", cfg.requireLogin(cfg.handlerOrganizationDelete))
+	mux.Handle("GET /api/organizations/{orgID}/usage", cfg.requireLogin(cfg.handlerOrganizationUsage))
+	mux.Handle("GET /api/organizations/{orgID}/members", cfg.requireLogin(cfg.handlerOrganizationMembersList))
+	mux.Handle("POST /api/organizations/{orgID}/members", cfg.requireLogin(cfg.handlerOrganizationMemberAdd))
+	mux.Handle("PATCH /api/organizations/{orgID}/members/{userID}", cfg.requireLogin(cfg.handlerOrganizationMemberUpdate))
+	mux.Handle("DELETE /api/organizations/{orgID}/members/{userID}", cfg.requireLogin(cfg.handlerOrganizationMemberRemove))
+	mux.Handle("PUT /api/videos/{videoID}/organization", cfg.requireAuth(auth.ScopeVideosWrite, cfg.handlerVideoOrganizationSet))
+
+	mux.Handle("POST /api/playlists", cfg.requireAuth(auth.ScopeVideosWrite, cfg.handlerPlaylistsCreate))
+	mux.Handle("GET /api/playlists", cfg.requireAuth(auth.ScopeVideosRead, cfg.handlerPlaylistsList))
+	mux.Handle("GET /api/playlists/{playlistID}", cfg.optionalAuth(cfg.handlerPlaylistGet))
+	mux.Handle("GET /api/playlists/{playlistID}/playlist.m3u8", cfg.optionalAuth(cfg.handlerPlaylistM3U8))
+	mux.Handle("PATCH /api/playlists/{playlistID}", cfg.requireAuth(auth.ScopeVideosWrite, cfg.handlerPlaylistUpdate))
+	mux.Handle("DELETE /api/playlists/{playlistID}", cfg.requireAuth(auth.ScopeVideosWrite, cfg.handlerPlaylistDelete))
+	mux.Handle("POST /api/playlists/{playlistID}/videos", cfg.requireAuth(auth.ScopeVideosWrite, cfg.handlerPlaylistVideoAdd))
+	mux.Handle("PUT /api/playlists/{playlistID}/videos", cfg.requireAuth(auth.ScopeVideosWrite, cfg.handlerPlaylistVideosReorder))
+	mux.Handle("DELETE /api/playlists/{playlistID}/videos/{videoID}", cfg.requireAuth(auth.ScopeVideosWrite, cfg.handlerPlaylistVideoRemove))
 
 	mux.HandleFunc("POST /admin/reset", cfg.handlerReset)
+	mux.Handle("GET /admin/users", cfg.requireAdmin(cfg.handlerAdminUsersList))
+	mux.Handle("PUT /admin/users/{userID}/role", cfg.requireAdmin(cfg.handlerAdminUserSetRole))
+	mux.Handle("POST /admin/users/{userID}/disable", cfg.requireAdmin(cfg.handlerAdminUserDisable))
+	mux.Handle("POST /admin/users/{userID}/enable", cfg.requireAdmin(cfg.handlerAdminUserEnable))
+	mux.Handle("PUT /admin/users/{userID}/upload_limit", cfg.requireAdmin(cfg.handlerAdminUserSetUploadLimit))
+	mux.Handle("PUT /admin/users/{userID}/quota", cfg.requireAdmin(cfg.handlerAdminUserSetQuota))
+	mux.Handle("PUT /admin/organizations/{orgID}/quota", cfg.requireAdmin(cfg.handlerAdminOrganizationSetQuota))
+	mux.Handle("PUT /admin/organizations/{orgID}/key_prefix", cfg.requireAdmin(cfg.handlerAdminOrganizationSetKeyPrefix))
+	mux.Handle("POST /admin/videos/{videoID}/transfer", cfg.requireAdmin(cfg.handlerAdminVideoTransfer))
+	mux.Handle("DELETE /admin/videos/{videoID}", cfg.requireAdmin(cfg.handlerAdminVideoDelete))
 
-	srv := &http.Server{
-		Addr:    ":" + port,
-		Handler: mux,
+	return limitBodyMiddleware(mux)
+}
+
+// durationFromEnv reads a time.ParseDuration string such as "15m" from the
+// environment, using fallback when the variable is unset.
+func durationFromEnv(key string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a duration like \"15m\": %w", key, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("%s must be positive", key)
 	}
+	return d, nil
+}
 
-	log.Printf("Serving on: http://localhost:%s/app/\n", port)
-	log.Fatal(srv.ListenAndServe())
+// quotaFromEnv reads a default quota limit from the environment. Unset or
+// negative means unlimited.
+func quotaFromEnv(key string) (int64, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return -1, nil
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a whole number: %w", key, err)
+	}
+	return n, nil
+}
+
+// loadJWTKeys builds the access token key set. signingKeys is a comma
+// separated list of kid:path pairs naming PEM encoded RSA or Ed25519 private
+// keys, and activeKey picks the one new tokens are signed with. The HS256
+// secret, if set, keeps tokens issued before the switch to asymmetric keys
+// valid, and signs new tokens when no other keys are configured.
+func loadJWTKeys(secret, signingKeys, activeKey string) (*auth.KeySet, error) {
+	if secret == "" && signingKeys == "" {
+		return nil, fmt.Errorf("JWT_SECRET or JWT_SIGNING_KEYS must be set")
+	}
+
+	keys := auth.NewKeySet()
+	if secret != "" {
+		keys.AddHMAC("", secret)
+	}
+	for _, entry := range strings.Split(signingKeys, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kid, path, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("JWT_SIGNING_KEYS entry %q must be kid:path", entry)
+		}
+		if err := keys.AddPrivateKeyFile(kid, path); err != nil {
+			return nil, err
+		}
+	}
+	if activeKey != "" {
+		if err := keys.SetSigningKey(activeKey); err != nil {
+			return nil, fmt.Errorf("JWT_ACTIVE_KEY: %w", err)
+		}
+	}
+	return keys, nil
+}
+
+// loadMailer picks how emails are delivered. Messages go through SMTP when
+// SMTP_HOST is set, and are otherwise written to MAIL_LOG_FILE, or to stdout
+// if that isn't set either, so the links can be followed in development.
+func loadMailer() (mailer.Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "Tubely <no-reply@localhost>"
+	}
+
+	host := os.Getenv("SMTP_HOST")
+	if host != "" {
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		return mailer.NewSMTPMailer(
+			host,
+			port,
+			os.Getenv("SMTP_USERNAME"),
+			os.Getenv("SMTP_PASSWORD"),
+			from,
+		)
+	}
+
+	if path := os.Getenv("MAIL_LOG_FILE"); path != "" {
+		return mailer.NewFileMailer(from, path)
+	}
+	return mailer.NewLogMailer(from, os.Stdout), nil
+}
+
+// loadOIDCProviders configures the identity providers named in the
+// comma-separated OIDC_PROVIDERS. Each one is read from OIDC_<NAME>_ISSUER,
+// OIDC_<NAME>_CLIENT_ID, OIDC_<NAME>_CLIENT_SECRET and optionally
+// OIDC_<NAME>_DISPLAY_NAME and OIDC_<NAME>_SCOPES.
+func loadOIDCProviders(appURL string) (map[string]*sso.Provider, error) {
+	providers := map[string]*sso.Provider{}
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+
+		cfg := sso.Config{
+			Name:         name,
+			DisplayName:  os.Getenv(prefix + "DISPLAY_NAME"),
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  appURL + "/api/oidc/" + name + "/callback",
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+		}
+		if cfg.Issuer == "" || cfg.ClientID == "" {
+			return nil, fmt.Errorf("%sISSUER and %sCLIENT_ID must be set", prefix, prefix)
+		}
+		providers[name] = sso.NewProvider(cfg)
+	}
+	return providers, nil
 }
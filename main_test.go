@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/mailer"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/progress"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/ratelimit"
+	"github.com/google/uuid"
+)
+
+const testPassword = "correct horse battery staple"
+
+// testAPI is the full set of routes backed by a MemoryStore, for handler
+// tests.
+type testAPI struct {
+	t       *testing.T
+	cfg     *apiConfig
+	db      *database.MemoryStore
+	handler http.Handler
+}
+
+func newTestAPI(t *testing.T) *testAPI {
+	t.Helper()
+
+	db := database.NewMemoryStore()
+	limiterStore := ratelimit.NewMemoryStore()
+	cfg := &apiConfig{
+		db:               db,
+		jwtKeys:          auth.NewHMACKeySet("test-secret"),
+		accessTokenTTL:   time.Hour,
+		refreshTokenTTL:  24 * time.Hour,
+		platform:         "dev",
+		adminEmails:      map[string]bool{},
+		mailer:           mailer.NewLogMailer("Tubely <no-reply@localhost>", io.Discard),
+		appURL:           "http://localhost:8091",
+		loginIPLimiter:   ratelimit.New(limiterStore, loginIPPolicy),
+		loginUserLimiter: ratelimit.New(limiterStore, loginAccountPolicy),
+		signupLimiter:    ratelimit.New(limiterStore, signupIPPolicy),
+		maxUploadSize:    defaultMaxUploadSize,
+		defaultQuota:     quotaLimits{StorageBytes: -1, Videos: -1, UploadMinutes: -1},
+		uploadProgress:   progress.NewTracker(),
+		filepathRoot:     t.TempDir(),
+		assetsRoot:       t.TempDir(),
+		s3CfDistribution: "https://cdn.example.com",
+		port:             "8091",
+	}
+	return &testAPI{t: t, cfg: cfg, db: db, handler: cfg.routes()}
+}
+
+// createUser adds a user with the given role whose password is testPassword,
+// returning them along with an access token.
+func (a *testAPI) createUser(email string, role auth.Role) (database.User, string) {
+	a.t.Helper()
+
+	hash, err := auth.HashPassword(testPassword)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	user, err := a.db.CreateUser(database.CreateUserParams{
+		Email:    email,
+		Password: hash,
+		Role:     string(role),
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return *user, a.accessToken(user.ID)
+}
+
+func (a *testAPI) accessToken(userID uuid.UUID) string {
+	a.t.Helper()
+
+	token, err := auth.MakeJWT(userID, a.cfg.jwtKeys, time.Hour)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return token
+}
+
+// login logs the user in with testPassword, returning their access and
+// refresh tokens.
+func (a *testAPI) login(email string) (string, string) {
+	a.t.Helper()
+
+	rec := a.do("POST", "/api/login", "", map[string]any{"email": email, "password": testPassword})
+	requireStatus(a.t, rec, http.StatusOK)
+	tokens := decodeJSON[struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}](a.t, rec)
+	return tokens.Token, tokens.RefreshToken
+}
+
+// do sends a request through the routes. A string body is sent as is and
+// anything else as JSON. The token, when set, is sent as a bearer token.
+func (a *testAPI) do(method, path, token string, body any, headers ...string) *httptest.ResponseRecorder {
+	a.t.Helper()
+
+	var reader io.Reader
+	switch body := body.(type) {
+	case nil:
+	case string:
+		reader = bytes.NewBufferString(body)
+	default:
+		data, err := json.Marshal(body)
+		if err != nil {
+			a.t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	rec := httptest.NewRecorder()
+	a.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// createVideo creates a video through the API, failing the test if it
+// can't.
+func (a *testAPI) createVideo(token string, params map[string]any) database.Video {
+	a.t.Helper()
+
+	rec := a.do("POST", "/api/videos", token, params)
+	requireStatus(a.t, rec, http.StatusCreated)
+	return decodeJSON[database.Video](a.t, rec)
+}
+
+// multipartFile encodes data as the file in field of a multipart form,
+// returning the body and its Content-Type.
+func multipartFile(t *testing.T, field, contentType string, data []byte) (string, string) {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="`+field+`"; filename="upload"`)
+	header.Set("Content-Type", contentType)
+	part, err := form.CreatePart(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = part.Write(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = form.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body.String(), form.FormDataContentType()
+}
+
+// mailbox is a mailer.Mailer that keeps the messages it's sent.
+type mailbox struct {
+	mu       sync.Mutex
+	messages []mailer.Message
+}
+
+func (m *mailbox) Send(ctx context.Context, msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// useMailbox makes the API deliver email to a mailbox the test can read.
+func (a *testAPI) useMailbox() *mailbox {
+	box := &mailbox{}
+	a.cfg.mailer = box
+	return box
+}
+
+// linkToken returns the token carried in param by the app link in the last
+// message sent to the address.
+func (m *mailbox) linkToken(t *testing.T, to, param string) string {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].To != to {
+			continue
+		}
+		for _, field := range strings.Fields(m.messages[i].Body) {
+			link, err := url.Parse(field)
+			if err == nil && link.Query().Has(param) {
+				return link.Query().Get(param)
+			}
+		}
+	}
+	t.Fatalf("no link with %s was sent to %s", param, to)
+	return ""
+}
+
+func requireStatus(t *testing.T, rec *httptest.ResponseRecorder, want int) {
+	t.Helper()
+	if rec.Code != want {
+		t.Fatalf("status = %d, want %d; body: %s", rec.Code, want, rec.Body.String())
+	}
+}
+
+func decodeJSON[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	err := json.Unmarshal(rec.Body.Bytes(), &v)
+	if err != nil {
+		t.Fatalf("couldn't decode %q: %v", rec.Body.String(), err)
+	}
+	return v
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+type authMethod string
+
+const (
+	authMethodJWT    authMethod = "jwt"
+	authMethodAPIKey authMethod = "api_key"
+)
+
+// principal is the authenticated caller of a request.
+type principal struct {
+	UserID uuid.UUID
+	Role   auth.Role
+	Method authMethod
+	// Scopes limits what an API key may do. Access tokens from a login are
+	// unscoped.
+	Scopes []string
+	// SessionID is the login session an access token belongs to.
+	SessionID string
+}
+
+func (p principal) authenticated() bool {
+	return p.UserID != uuid.Nil
+}
+
+// hasScope reports whether the credential was granted scope. It doesn't
+// consider the user's role; see allowed.
+func (p principal) hasScope(scope string) bool {
+	if p.Method == authMethodJWT {
+		return true
+	}
+	return auth.HasScope(p.Scopes, scope)
+}
+
+// allowed reports whether both the credential and the user's role permit
+// acting with scope.
+func (p principal) allowed(scope string) bool {
+	return p.hasScope(scope) && p.Role.Allows(scope)
+}
+
+type principalContextKey struct{}
+
+// requestPrincipal returns who made the request, or the zero principal for
+// anonymous requests to optionalAuth routes.
+func requestPrincipal(r *http.Request) principal {
+	p, _ := r.Context().Value(principalContextKey{}).(principal)
+	return p
+}
+
+// requireAuth admits requests carrying a valid access token, or an API key
+// that was granted scope.
+func (cfg *apiConfig) requireAuth(scope string, next http.HandlerFunc) http.Handler {
+	return cfg.authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		p := requestPrincipal(r)
+		if !p.authenticated() {
+			respondWithError(w, http.StatusUnauthorized, "Authentication required", nil)
+			return
+		}
+		if !p.hasScope(scope) {
+			respondWithError(w, http.StatusForbidden, "API key lacks the required scope", nil)
+			return
+		}
+		if !p.allowed(scope) {
+			respondWithError(w, http.StatusForbidden, "Your role doesn't allow this", nil)
+			return
+		}
+		next(w, r)
+	})
+}
+
+// requireLogin admits only access tokens from an interactive login. It
+// guards account management routes that API keys must never reach.
+func (cfg *apiConfig) requireLogin(next http.HandlerFunc) http.Handler {
+	return cfg.authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		p := requestPrincipal(r)
+		if !p.authenticated() {
+			respondWithError(w, http.StatusUnauthorized, "Authentication required", nil)
+			return
+		}
+		if p.Method != authMethodJWT {
+			respondWithError(w, http.StatusForbidden, "This endpoint requires a login session", nil)
+			return
+		}
+		next(w, r)
+	})
+}
+
+// requireAdmin admits only administrators signed in with a login session.
+func (cfg *apiConfig) requireAdmin(next http.HandlerFunc) http.Handler {
+	return cfg.requireLogin(func(w http.ResponseWriter, r *http.Request) {
+		if requestPrincipal(r).Role != auth.RoleAdmin {
+			respondWithError(w, http.StatusForbidden, "Admin role required", nil)
+			return
+		}
+		next(w, r)
+	})
+}
+
+// optionalAuth identifies the caller if credentials were sent but lets
+// anonymous requests through.
+func (cfg *apiConfig) optionalAuth(next http.HandlerFunc) http.Handler {
+	return cfg.authMiddleware(next)
+}
+
+// authMiddleware authenticates the request once and stores the principal in
+// its context. Requests without an Authorization header continue
+// anonymously; requests with invalid credentials are rejected.
+func (cfg *apiConfig) authMiddleware(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := cfg.authenticate(r)
+		if errors.Is(err, auth.ErrNoAuthHeaderIncluded) {
+			next(w, r)
+			return
+		}
+		if errors.Is(err, errAccountDisabled) {
+			respondWithError(w, http.StatusForbidden, "Account has been disabled", err)
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Couldn't authenticate request", err)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), principalContextKey{}, p)
+		next(w, r.WithContext(ctx))
+	})
+}
+
+// authenticate identifies the caller from either an access JWT ("Bearer")
+// or an API key ("ApiKey").
+func (cfg *apiConfig) authenticate(r *http.Request) (principal, error) {
+	if apiKey, err := auth.GetAPIKey(r.Header); err == nil {
+		return cfg.authenticateAPIKey(apiKey)
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return principal{}, err
+	}
+	var user *database.User
+	_, claims, err := auth.ParseJWT(token, cfg.jwtKeys, func(userID uuid.UUID, claims auth.AccessClaims) error {
+		var err error
+		user, err = cfg.userForAccessToken(userID, claims)
+		return err
+	})
+	if err != nil {
+		return principal{}, err
+	}
+	return principal{
+		UserID:    user.ID,
+		Role:      auth.Role(user.Role),
+		Method:    authMethodJWT,
+		SessionID: claims.SessionID,
+	}, nil
+}
+
+func (cfg *apiConfig) authenticateAPIKey(apiKey string) (principal, error) {
+	key, err := cfg.db.GetAPIKeyByHash(auth.HashToken(apiKey))
+	if errors.Is(err, database.ErrNotFound) {
+		return principal{}, errors.New("unknown API key")
+	}
+	if err != nil {
+		return principal{}, err
+	}
+	if key.RevokedAt != nil {
+		return principal{}, errors.New("API key has been revoked")
+	}
+
+	user, err := cfg.db.GetUser(key.UserID)
+	if err != nil {
+		return principal{}, err
+	}
+	if user.DisabledAt != nil {
+		return principal{}, errAccountDisabled
+	}
+
+	err = cfg.db.TouchAPIKey(key.ID)
+	if err != nil {
+		log.Printf("Couldn't record use of API key %s: %v", key.ID, err)
+	}
+	return principal{
+		UserID: user.ID,
+		Role:   auth.Role(user.Role),
+		Method: authMethodAPIKey,
+		Scopes: key.Scopes,
+	}, nil
+}
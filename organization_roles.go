@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const organizationRoleProblem = "Role must be member, admin or owner"
+
+// organizationRoleRank orders the roles, each able to do what all those
+// before it can.
+var organizationRoleRank = map[string]int{
+	database.OrganizationRoleMember: 1,
+	database.OrganizationRoleAdmin:  2,
+	database.OrganizationRoleOwner:  3,
+}
+
+func validOrganizationRole(role string) bool {
+	_, ok := organizationRoleRank[role]
+	return ok
+}
+
+// hasOrganizationRole reports whether role can do everything want can.
+func hasOrganizationRole(role, want string) bool {
+	return validOrganizationRole(role) && organizationRoleRank[role] >= organizationRoleRank[want]
+}
+
+// organizationVideoRole is the role a member with role has on each of the
+// organization's videos.
+func organizationVideoRole(role string) string {
+	if hasOrganizationRole(role, database.OrganizationRoleAdmin) {
+		return videoRoleOwner
+	}
+	return database.VideoRoleEditor
+}
+
+// activeOrganization returns the organization the user is working in, or
+// nil when they're working on their own videos. Users who have left the
+// organization they had switched to are back on their own videos.
+func (cfg *apiConfig) activeOrganization(userID uuid.UUID) (*uuid.UUID, error) {
+	user, err := cfg.db.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.ActiveOrganizationID == nil {
+		return nil, nil
+	}
+	_, err = cfg.db.GetOrganizationMember(*user.ActiveOrganizationID, userID)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user.ActiveOrganizationID, nil
+}
+
+// organizationWithRole gets the organization in the request path and checks
+// the caller has at least role in it, responding with an error if they
+// don't. Organizations look missing to anyone who isn't a member. action
+// says what they were trying to do, as in "You can't <action> this
+// organization".
+func (cfg *apiConfig) organizationWithRole(w http.ResponseWriter, r *http.Request, role, action string) (database.Membership, bool) {
+	orgID, err := uuid.Parse(r.PathValue("orgID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid organization ID", err)
+		return database.Membership{}, false
+	}
+
+	member, err := cfg.db.GetOrganizationMember(orgID, requestPrincipal(r).UserID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Organization not found", err)
+		return database.Membership{}, false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check membership", err)
+		return database.Membership{}, false
+	}
+	if !hasOrganizationRole(member.Role, role) {
+		respondWithError(w, http.StatusForbidden, "You can't "+action+" this organization", nil)
+		return database.Membership{}, false
+	}
+
+	org, err := cfg.db.GetOrganization(orgID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get organization", err)
+		return database.Membership{}, false
+	}
+	return database.Membership{Organization: org, Role: member.Role}, true
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// quotaLimits are the limits a user or organization is held to. A negative
+// limit means unlimited.
+type quotaLimits struct {
+	StorageBytes  int64
+	Videos        int64
+	UploadMinutes int64
+}
+
+// quotaFor applies a user's or organization's overrides to the server
+// defaults.
+func (cfg *apiConfig) quotaFor(overrides database.Quota) quotaLimits {
+	limits := cfg.defaultQuota
+	if overrides.StorageBytes != nil {
+		limits.StorageBytes = *overrides.StorageBytes
+	}
+	if overrides.Videos != nil {
+		limits.Videos = *overrides.Videos
+	}
+	if overrides.UploadMinutes != nil {
+		limits.UploadMinutes = *overrides.UploadMinutes
+	}
+	return limits
+}
+
+const quotaProblem = "Quota limits must be -1 or more"
+
+// validQuota reports whether every limit the overrides set is -1, for
+// unlimited, or more.
+func validQuota(overrides database.Quota) bool {
+	for _, limit := range []*int64{overrides.StorageBytes, overrides.Videos, overrides.UploadMinutes} {
+		if limit != nil && *limit < -1 {
+			return false
+		}
+	}
+	return true
+}
+
+// videoAccount is whoever videos count against: the organization they
+// belong to, or their owner when they belong to none.
+type videoAccount struct {
+	quota quotaLimits
+	usage database.Usage
+	// uploadLimit is the largest video file, in bytes, that may be uploaded.
+	uploadLimit int64
+	// keyPrefix goes before the S3 keys of the videos' files when set.
+	keyPrefix string
+}
+
+// accountFor returns the account of the organization, or of the user when
+// orgID is nil.
+func (cfg *apiConfig) accountFor(userID uuid.UUID, orgID *uuid.UUID) (videoAccount, error) {
+	since := usagePeriodStart(time.Now())
+	if orgID != nil {
+		org, err := cfg.db.GetOrganization(*orgID)
+		if err != nil {
+			return videoAccount{}, err
+		}
+		usage, err := cfg.db.GetOrganizationUsage(org.ID, since)
+		if err != nil {
+			return videoAccount{}, err
+		}
+		return videoAccount{
+			quota:       cfg.quotaFor(org.Quota),
+			usage:       usage,
+			uploadLimit: cfg.maxUploadSize,
+			keyPrefix:   organizationKeyPrefix(org),
+		}, nil
+	}
+
+	user, err := cfg.db.GetUser(userID)
+	if err != nil {
+		return videoAccount{}, err
+	}
+	usage, err := cfg.db.GetUsage(userID, since)
+	if err != nil {
+		return videoAccount{}, err
+	}
+	return videoAccount{
+		quota:       cfg.quotaFor(user.Quota),
+		usage:       usage,
+		uploadLimit: cfg.uploadLimit(*user),
+	}, nil
+}
+
+// videoAccountFor returns the account the video's files count against,
+// whoever uploads them.
+func (cfg *apiConfig) videoAccountFor(video database.Video) (videoAccount, error) {
+	return cfg.accountFor(video.UserID, video.OrganizationID)
+}
+
+// storageLeft is how many more bytes the user may store once freed bytes,
+// such as a file about to be replaced, are released.
+func (q quotaLimits) storageLeft(usage database.Usage, freed int64) int64 {
+	if q.StorageBytes < 0 {
+		return math.MaxInt64
+	}
+	return q.StorageBytes - usage.StorageBytes + freed
+}
+
+// uploadTimeLeft is how much more video the user may upload this month.
+func (q quotaLimits) uploadTimeLeft(usage database.Usage) time.Duration {
+	if q.UploadMinutes < 0 {
+		return math.MaxInt64
+	}
+	return time.Duration(q.UploadMinutes)*time.Minute - usage.UploadDuration
+}
+
+// uploadTimeLimit is the month's upload minutes as a duration, negative
+// when unlimited.
+func (q quotaLimits) uploadTimeLimit() time.Duration {
+	if q.UploadMinutes < 0 {
+		return -1
+	}
+	return time.Duration(q.UploadMinutes) * time.Minute
+}
+
+func (q quotaLimits) videosLeft(usage database.Usage) int64 {
+	if q.Videos < 0 {
+		return math.MaxInt64
+	}
+	return q.Videos - usage.Videos
+}
+
+// usagePeriodStart is the start of the calendar month, in UTC, that upload
+// minutes are counted over.
+func usagePeriodStart(now time.Time) time.Time {
+	now = now.UTC()
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// handlerUserUsage reports what the user has used of their quota. Limits
+// are null when unlimited.
+func (cfg *apiConfig) handlerUserUsage(w http.ResponseWriter, r *http.Request) {
+	account, err := cfg.accountFor(requestPrincipal(r).UserID, nil)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get usage", err)
+		return
+	}
+
+	respondWithUsage(w, account)
+}
+
+func respondWithUsage(w http.ResponseWriter, account videoAccount) {
+	type response struct {
+		PeriodStart        time.Time `json:"period_start"`
+		StorageBytes       int64     `json:"storage_bytes"`
+		StorageBytesLimit  *int64    `json:"storage_bytes_limit"`
+		Videos             int64     `json:"videos"`
+		VideosLimit        *int64    `json:"videos_limit"`
+		UploadMinutes      float64   `json:"upload_minutes"`
+		UploadMinutesLimit *int64    `json:"upload_minutes_limit"`
+	}
+
+	limit := func(n int64) *int64 {
+		if n < 0 {
+			return nil
+		}
+		return &n
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		PeriodStart:        usagePeriodStart(time.Now()),
+		StorageBytes:       account.usage.StorageBytes,
+		StorageBytesLimit:  limit(account.quota.StorageBytes),
+		Videos:             account.usage.Videos,
+		VideosLimit:        limit(account.quota.Videos),
+		UploadMinutes:      account.usage.UploadDuration.Minutes(),
+		UploadMinutesLimit: limit(account.quota.UploadMinutes),
+	})
+}
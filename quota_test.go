@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+)
+
+// setQuota gives the user their own quota through the admin API.
+func (a *testAPI) setQuota(userID string, quota map[string]any) {
+	a.t.Helper()
+
+	_, admin := a.createUser("quota-admin@example.com", auth.RoleAdmin)
+	rec := a.do("PUT", "/admin/users/"+userID+"/quota", admin, quota)
+	requireStatus(a.t, rec, http.StatusOK)
+}
+
+func TestQuotaVideoLimit(t *testing.T) {
+	api := newTestAPI(t)
+	user, token := api.createUser("uploader@example.com", auth.RoleUploader)
+	api.setQuota(user.ID.String(), map[string]any{"videos": 1})
+
+	api.createVideo(token, map[string]any{"title": "First"})
+	requireStatus(t, api.do("POST", "/api/videos", token, map[string]any{"title": "Second"}), http.StatusForbidden)
+}
+
+func TestQuotaStorage(t *testing.T) {
+	api := newTestAPI(t)
+	user, token := api.createUser("uploader@example.com", auth.RoleUploader)
+	video := api.createVideo(token, map[string]any{"title": "Boots"})
+	api.setQuota(user.ID.String(), map[string]any{"storage_bytes": 1 << 10})
+	path := "/api/thumbnail_upload/" + video.ID.String()
+
+	body, contentType := multipartFile(t, "thumbnail", "image/png", make([]byte, 2<<10))
+	requireStatus(t, api.do("POST", path, token, body, "Content-Type", contentType), http.StatusForbidden)
+
+	body, contentType = multipartFile(t, "thumbnail", "image/png", make([]byte, 512))
+	requireStatus(t, api.do("POST", path, token, body, "Content-Type", contentType), http.StatusOK)
+
+	// the thumbnail being replaced doesn't count against its replacement
+	body, contentType = multipartFile(t, "thumbnail", "image/png", make([]byte, 768))
+	requireStatus(t, api.do("POST", path, token, body, "Content-Type", contentType), http.StatusOK)
+}
+
+func TestHandlerUserUsage(t *testing.T) {
+	api := newTestAPI(t)
+	user, token := api.createUser("uploader@example.com", auth.RoleUploader)
+	api.setQuota(user.ID.String(), map[string]any{"videos": 5})
+	api.createVideo(token, map[string]any{"title": "Boots"})
+
+	rec := api.do("GET", "/api/users/me/usage", token, nil)
+	requireStatus(t, rec, http.StatusOK)
+	usage := decodeJSON[struct {
+		Videos            int64  `json:"videos"`
+		VideosLimit       *int64 `json:"videos_limit"`
+		StorageBytesLimit *int64 `json:"storage_bytes_limit"`
+	}](t, rec)
+	if usage.Videos != 1 {
+		t.Errorf("Videos = %d, want 1", usage.Videos)
+	}
+	if usage.VideosLimit == nil || *usage.VideosLimit != 5 {
+		t.Errorf("VideosLimit = %v, want 5", usage.VideosLimit)
+	}
+	if usage.StorageBytesLimit != nil {
+		t.Errorf("StorageBytesLimit = %d, want unlimited", *usage.StorageBytesLimit)
+	}
+
+	requireStatus(t, api.do("GET", "/api/users/me/usage", "", nil), http.StatusUnauthorized)
+}
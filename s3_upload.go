@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// s3PartSize is the size of each part of a multipart upload. Files no
+// bigger than one part are stored with a single PutObject.
+const s3PartSize int64 = 16 << 20
+
+// putLargeObject stores file in the bucket under key, in parts if it is
+// large, calling onPart after each part is stored.
+func (cfg *apiConfig) putLargeObject(ctx context.Context, key, contentType string, file *os.File, onPart func(part, parts int, stored, size int64)) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+
+	if size <= s3PartSize {
+		_, err = cfg.s3Client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:      &cfg.s3Bucket,
+			Key:         &key,
+			Body:        file,
+			ContentType: &contentType,
+		})
+		if err != nil {
+			return err
+		}
+		onPart(1, 1, size, size)
+		return nil
+	}
+
+	upload, err := cfg.s3Client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      &cfg.s3Bucket,
+		Key:         &key,
+		ContentType: &contentType,
+	})
+	if err != nil {
+		return err
+	}
+
+	parts := int((size + s3PartSize - 1) / s3PartSize)
+	completed := make([]types.CompletedPart, 0, parts)
+	for i := range parts {
+		offset := int64(i) * s3PartSize
+		length := min(s3PartSize, size-offset)
+		out, err := cfg.s3Client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:        &cfg.s3Bucket,
+			Key:           &key,
+			UploadId:      upload.UploadId,
+			PartNumber:    aws.Int32(int32(i + 1)),
+			Body:          io.NewSectionReader(file, offset, length),
+			ContentLength: aws.Int64(length),
+		})
+		if err != nil {
+			cfg.abortMultipartUpload(key, upload.UploadId)
+			return fmt.Errorf("couldn't upload part %d of %d: %w", i+1, parts, err)
+		}
+		completed = append(completed, types.CompletedPart{
+			ETag:       out.ETag,
+			PartNumber: aws.Int32(int32(i + 1)),
+		})
+		onPart(i+1, parts, offset+length, size)
+	}
+
+	_, err = cfg.s3Client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          &cfg.s3Bucket,
+		Key:             &key,
+		UploadId:        upload.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		cfg.abortMultipartUpload(key, upload.UploadId)
+		return err
+	}
+	return nil
+}
+
+// abortMultipartUpload discards the parts of a failed upload so they don't
+// linger in the bucket. It runs even if the request was cancelled.
+func (cfg *apiConfig) abortMultipartUpload(key string, uploadID *string) {
+	_, err := cfg.s3Client.AbortMultipartUpload(context.Background(), &s3.AbortMultipartUploadInput{
+		Bucket:   &cfg.s3Bucket,
+		Key:      &key,
+		UploadId: uploadID,
+	})
+	if err != nil {
+		log.Printf("Couldn't abort multipart upload of %s: %v", key, err)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/ratelimit"
+	"github.com/google/uuid"
+)
+
+var (
+	// loginIPPolicy throttles password guessing from one address across
+	// many accounts. It doesn't lock out, since many users can share an
+	// address.
+	loginIPPolicy = ratelimit.Policy{
+		Limit:        30,
+		Window:       time.Minute,
+		FreeFailures: 10,
+		BaseDelay:    time.Second,
+		MaxDelay:     5 * time.Minute,
+		ResetAfter:   time.Hour,
+	}
+	// loginAccountPolicy throttles guessing one account's password or
+	// second factor from any number of addresses.
+	loginAccountPolicy = ratelimit.Policy{
+		Limit:            10,
+		Window:           time.Minute,
+		FreeFailures:     3,
+		BaseDelay:        time.Second,
+		MaxDelay:         time.Minute,
+		LockoutThreshold: 10,
+		LockoutDuration:  15 * time.Minute,
+		ResetAfter:       time.Hour,
+	}
+	signupIPPolicy = ratelimit.Policy{
+		Limit:  10,
+		Window: time.Hour,
+	}
+	// sharePasswordPolicy throttles guessing a share link's password. It
+	// doesn't lock out, so guessing can't stop others from viewing the link.
+	sharePasswordPolicy = ratelimit.Policy{
+		FreeFailures: 5,
+		BaseDelay:    time.Second,
+		MaxDelay:     time.Minute,
+		ResetAfter:   time.Hour,
+	}
+)
+
+func loginIPKey(r *http.Request) string {
+	return "login:ip:" + clientIP(r)
+}
+
+func loginAccountKey(email string) string {
+	return "login:account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func signupIPKey(r *http.Request) string {
+	return "signup:ip:" + clientIP(r)
+}
+
+func sharePasswordKey(linkID uuid.UUID) string {
+	return "share:password:" + linkID.String()
+}
+
+// allowAttempt records an attempt against key. If the key is over its limit
+// it responds with 429 Too Many Requests and returns false.
+func allowAttempt(w http.ResponseWriter, r *http.Request, limiter *ratelimit.Limiter, key string) bool {
+	decision, err := limiter.Allow(key)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check rate limit", err)
+		return false
+	}
+	if decision.Allowed {
+		return true
+	}
+
+	auditEvent(r, "rate_limited", map[string]any{
+		"key":         key,
+		"locked":      decision.Locked,
+		"retry_after": decision.RetryAfter.String(),
+	})
+	respondTooManyRequests(w, decision)
+	return false
+}
+
+func respondTooManyRequests(w http.ResponseWriter, decision ratelimit.Decision) {
+	seconds := int(math.Ceil(decision.RetryAfter.Seconds()))
+	w.Header().Set("Retry-After", fmt.Sprint(seconds))
+	msg := "Too many attempts, try again later"
+	if decision.Locked {
+		msg = "Too many failed attempts, this account is temporarily locked"
+	}
+	respondWithError(w, http.StatusTooManyRequests, msg, nil)
+}
+
+// recordLoginFailure counts a failed password or second factor against the
+// client's address and the account, and audits it.
+func (cfg *apiConfig) recordLoginFailure(r *http.Request, email, reason string) {
+	auditEvent(r, "login_failed", map[string]any{
+		"email":  email,
+		"reason": reason,
+	})
+
+	_, err := cfg.loginIPLimiter.Fail(loginIPKey(r))
+	if err != nil {
+		log.Printf("Couldn't record login failure: %v", err)
+	}
+	decision, err := cfg.loginUserLimiter.Fail(loginAccountKey(email))
+	if err != nil {
+		log.Printf("Couldn't record login failure: %v", err)
+		return
+	}
+	if decision.Locked {
+		auditEvent(r, "account_locked", map[string]any{
+			"email":       email,
+			"retry_after": decision.RetryAfter.String(),
+		})
+	}
+}
+
+// recordLoginSuccess clears the failures counted against the client's
+// address and the account.
+func (cfg *apiConfig) recordLoginSuccess(r *http.Request, email string) {
+	err := cfg.loginIPLimiter.Succeed(loginIPKey(r))
+	if err != nil {
+		log.Printf("Couldn't record login success: %v", err)
+	}
+	err = cfg.loginUserLimiter.Succeed(loginAccountKey(email))
+	if err != nil {
+		log.Printf("Couldn't record login success: %v", err)
+	}
+}
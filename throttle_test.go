@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+)
+
+func TestLoginThrottle(t *testing.T) {
+	api := newTestAPI(t)
+	user, _ := api.createUser("user@example.com", auth.RoleUploader)
+	other, _ := api.createUser("other@example.com", auth.RoleUploader)
+
+	login := func(email, password string) *http.Response {
+		t.Helper()
+		return api.do("POST", "/api/login", "", map[string]any{"email": email, "password": password}).Result()
+	}
+
+	// the first failures past the free ones are answered, then the account
+	// has to wait
+	for i := 0; i <= loginAccountPolicy.FreeFailures; i++ {
+		if resp := login(user.Email, "wrong"); resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("failure %d: status = %d, want %d", i+1, resp.StatusCode, http.StatusUnauthorized)
+		}
+	}
+	for _, password := range []string{"wrong", testPassword} {
+		resp := login(user.Email, password)
+		if resp.StatusCode != http.StatusTooManyRequests {
+			t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusTooManyRequests)
+		}
+		if got := resp.Header.Get("Retry-After"); got != "1" {
+			t.Errorf("Retry-After = %q, want %q", got, "1")
+		}
+	}
+
+	// other accounts aren't held up
+	if resp := login(other.Email, testPassword); resp.StatusCode != http.StatusOK {
+		t.Errorf("other account: status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
+
+func TestSignupThrottle(t *testing.T) {
+	api := newTestAPI(t)
+
+	for i := 0; i < signupIPPolicy.Limit; i++ {
+		email := fmt.Sprintf("user%d@example.com", i)
+		requireStatus(t, api.do("POST", "/api/users", "", map[string]any{"email": email, "password": testPassword}), http.StatusCreated)
+	}
+	rec := api.do("POST", "/api/users", "", map[string]any{"email": "late@example.com", "password": testPassword})
+	requireStatus(t, rec, http.StatusTooManyRequests)
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("missing Retry-After")
+	}
+}
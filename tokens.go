@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+var errAccountDisabled = errors.New("account has been disabled")
+
+// userForAccessToken loads the user an access token was issued to, rejecting
+// tokens revoked after they were issued, either by logging out of their
+// session or by a bump of the user's token version.
+func (cfg *apiConfig) userForAccessToken(userID uuid.UUID, claims auth.AccessClaims) (*database.User, error) {
+	user, err := cfg.db.GetUser(userID)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, auth.ErrTokenRevoked
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.DisabledAt != nil {
+		return nil, errAccountDisabled
+	}
+	if claims.Version != user.TokenVersion {
+		return nil, auth.ErrTokenRevoked
+	}
+
+	if claims.SessionID != "" {
+		active, err := cfg.db.IsSessionActive(claims.SessionID)
+		if err != nil {
+			return nil, err
+		}
+		if !active {
+			return nil, auth.ErrTokenRevoked
+		}
+	}
+	return user, nil
+}
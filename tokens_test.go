@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestTokenLifetimes(t *testing.T) {
+	api := newTestAPI(t)
+	api.cfg.accessTokenTTL = 5 * time.Minute
+	api.cfg.refreshTokenTTL = 48 * time.Hour
+	user, _ := api.createUser("user@example.com", auth.RoleUploader)
+
+	start := time.Now().UTC()
+	accessToken, refreshToken := api.login(user.Email)
+
+	_, claims, err := auth.ParseJWT(accessToken, api.cfg.jwtKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lifetime := claims.ExpiresAt.Sub(claims.IssuedAt.Time); lifetime != 5*time.Minute {
+		t.Errorf("access token lifetime = %v, want %v", lifetime, 5*time.Minute)
+	}
+
+	stored, err := api.db.GetRefreshToken(refreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lifetime := stored.ExpiresAt.Sub(start); lifetime < 48*time.Hour || lifetime > 48*time.Hour+time.Minute {
+		t.Errorf("refresh token lifetime = %v, want %v", lifetime, 48*time.Hour)
+	}
+}
+
+func TestAccessTokenExpires(t *testing.T) {
+	api := newTestAPI(t)
+	user, _ := api.createUser("user@example.com", auth.RoleUploader)
+
+	expired, err := auth.MakeJWT(user.ID, api.cfg.jwtKeys, -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requireStatus(t, api.do("GET", "/api/videos", expired, nil), http.StatusUnauthorized)
+}
+
+func TestAccessTokenRevocation(t *testing.T) {
+	tests := []struct {
+		name   string
+		revoke func(api *testAPI, user database.User, refreshToken string)
+	}{
+		{"token version bumped", func(api *testAPI, user database.User, refreshToken string) {
+			err := api.db.IncrementTokenVersion(user.ID)
+			if err != nil {
+				api.t.Fatal(err)
+			}
+		}},
+		{"logged out", func(api *testAPI, user database.User, refreshToken string) {
+			requireStatus(api.t, api.do("POST", "/api/revoke", refreshToken, nil), http.StatusNoContent)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestAPI(t)
+			user, _ := api.createUser("user@example.com", auth.RoleUploader)
+			accessToken, refreshToken := api.login(user.Email)
+			requireStatus(t, api.do("GET", "/api/videos", accessToken, nil), http.StatusOK)
+
+			tt.revoke(api, user, refreshToken)
+			requireStatus(t, api.do("GET", "/api/videos", accessToken, nil), http.StatusUnauthorized)
+
+			// logging in again issues a token that works
+			accessToken, _ = api.login(user.Email)
+			requireStatus(t, api.do("GET", "/api/videos", accessToken, nil), http.StatusOK)
+		})
+	}
+}
+
+func TestDurationFromEnv(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", time.Hour, false},
+		{"15m", 15 * time.Minute, false},
+		{"1440h", 1440 * time.Hour, false},
+		{"15", 0, true},
+		{"0s", 0, true},
+		{"-5m", 0, true},
+	}
+	for _, tt := range tests {
+		t.Setenv("TEST_TOKEN_TTL", tt.value)
+		got, err := durationFromEnv("TEST_TOKEN_TTL", time.Hour)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("durationFromEnv(%q) = %v, %v; want %v, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
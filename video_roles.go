@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// videoRoleOwner is the role the owner of a video has on it. It's never
+// stored; owners are who videos.user_id says they are.
+const videoRoleOwner = "owner"
+
+const videoRoleProblem = "Role must be viewer, editor or manager"
+
+// videoRoleRank orders the roles, each able to do what all those before it
+// can.
+var videoRoleRank = map[string]int{
+	database.VideoRoleViewer:  1,
+	database.VideoRoleEditor:  2,
+	database.VideoRoleManager: 3,
+	videoRoleOwner:            4,
+}
+
+// validVideoRole reports whether role can be given to a collaborator.
+func validVideoRole(role string) bool {
+	switch role {
+	case database.VideoRoleViewer, database.VideoRoleEditor, database.VideoRoleManager:
+		return true
+	}
+	return false
+}
+
+// hasVideoRole reports whether role can do everything want can. The empty
+// role, for users with no access, can do nothing.
+func hasVideoRole(role, want string) bool {
+	return role != "" && videoRoleRank[role] >= videoRoleRank[want]
+}
+
+// videoRole returns the caller's role on the video, or "" if they have none.
+// An organization's videos belong to its members rather than whoever created
+// them, so creators who leave it lose access along with everyone else.
+func (cfg *apiConfig) videoRole(p principal, video database.Video) (string, error) {
+	if !p.authenticated() {
+		return "", nil
+	}
+	role := ""
+	if video.OrganizationID == nil {
+		if video.UserID == p.UserID {
+			return videoRoleOwner, nil
+		}
+	} else {
+		member, err := cfg.db.GetOrganizationMember(*video.OrganizationID, p.UserID)
+		if err != nil && !errors.Is(err, database.ErrNotFound) {
+			return "", err
+		}
+		if err == nil {
+			role = organizationVideoRole(member.Role)
+			if video.UserID == p.UserID {
+				role = videoRoleOwner
+			}
+		}
+	}
+	if role == videoRoleOwner {
+		return role, nil
+	}
+
+	permission, err := cfg.db.GetVideoPermission(video.ID, p.UserID)
+	if errors.Is(err, database.ErrNotFound) {
+		return role, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if !hasVideoRole(role, permission.Role) {
+		role = permission.Role
+	}
+	return role, nil
+}
+
+// canViewVideo is canView for videos, whose collaborators and organization
+// members may also see them when they're private.
+func (cfg *apiConfig) canViewVideo(p principal, video database.Video) (bool, error) {
+	if video.Visibility != database.VisibilityPrivate {
+		return true, nil
+	}
+	if !p.allowed(auth.ScopeVideosRead) {
+		return false, nil
+	}
+	role, err := cfg.videoRole(p, video)
+	return hasVideoRole(role, database.VideoRoleViewer), err
+}
+
+// videoWithRole gets the video and checks the caller has at least role on
+// it, responding with an error if they don't. action says what they were
+// trying to do, as in "You can't <action> this video".
+func (cfg *apiConfig) videoWithRole(w http.ResponseWriter, r *http.Request, videoID uuid.UUID, role, action string) (database.Video, bool) {
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithStoreError(w, "Couldn't get video", err)
+		return database.Video{}, false
+	}
+	callerRole, err := cfg.videoRole(requestPrincipal(r), video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check permissions", err)
+		return database.Video{}, false
+	}
+	if !hasVideoRole(callerRole, role) {
+		respondWithError(w, http.StatusForbidden, "You can't "+action+" this video", nil)
+		return database.Video{}, false
+	}
+	return video, true
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const visibilityProblem = "Visibility must be public, unlisted or private"
+
+func validVisibility(visibility string) bool {
+	switch visibility {
+	case database.VisibilityPublic, database.VisibilityUnlisted, database.VisibilityPrivate:
+		return true
+	}
+	return false
+}
+
+// canView reports whether the caller may see something the owner gave
+// visibility. Anyone with the link may see public and unlisted things, but
+// only the owner private ones.
+func canView(p principal, ownerID uuid.UUID, visibility string) bool {
+	if visibility != database.VisibilityPrivate {
+		return true
+	}
+	return p.UserID == ownerID && p.allowed(auth.ScopeVideosRead)
+}